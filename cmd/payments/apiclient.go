@@ -0,0 +1,189 @@
+package payments
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/src/services"
+	"github.com/SirWaithaka/payments-api/src/storage"
+)
+
+// EnvAPIKey is the environment variable with the api key commands sign requests with
+const EnvAPIKey = "PAYMENTS_API_KEY"
+
+func NewAPIClientCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apiclient",
+		Short: "Manage the api clients allowed to call the api",
+		Long: `Manage the api clients allowed to call the api.
+
+The commands connect to the database directly, the first api client can be
+created before the api is running.`,
+	}
+
+	cmd.AddCommand(NewAPIClientCreateCmd())
+	cmd.AddCommand(NewAPIClientListCmd())
+	cmd.AddCommand(NewAPIClientDisableCmd())
+
+	return cmd
+}
+
+func NewAPIClientCreateCmd() *cobra.Command {
+	var (
+		name     string
+		merchant string
+		scopes   []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an api client and print its api key",
+		Example: `  # Create a client that can initiate payouts and check their status
+  payments apiclient create --name disbursements --scopes payout,read
+
+  # Create a client of a merchant, it can only act on the merchant's shortcodes and payments
+  payments apiclient create --name shop --merchant 0199f1a2-... --scopes charge,read`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := auth.ToScopes(scopes)
+			if err != nil {
+				return err
+			}
+
+			service, closeDB, err := newAuthService()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+
+			client, credentials, err := service.Create(cmd.Context(), name, merchant, values)
+			if err != nil {
+				return errors.Wrap(err, "could not create api client")
+			}
+
+			printAPIClients(client)
+			fmt.Printf("\nAPI key (shown only once, set it in %s):\n%s\n", EnvAPIKey, credentials.APIKey())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Name of the api client (required)")
+	cmd.Flags().StringVar(&merchant, "merchant", "", "Merchant the client acts for, platform clients are not bound to a merchant")
+	cmd.Flags().StringSliceVar(&scopes, "scopes", nil, "Scopes: charge, payout, transfer, read or admin (required)")
+
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("scopes")
+
+	return cmd
+}
+
+func NewAPIClientListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List api clients",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, closeDB, err := newAuthService()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+
+			clients, err := service.List(cmd.Context())
+			if err != nil {
+				return errors.Wrap(err, "could not list api clients")
+			}
+
+			printAPIClients(clients...)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewAPIClientDisableCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "disable <id>",
+		Short:        "Disable an api client, its api key is no longer accepted",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, closeDB, err := newAuthService()
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+
+			if err = service.Disable(cmd.Context(), args[0]); err != nil {
+				return errors.Wrap(err, "could not disable api client")
+			}
+
+			fmt.Printf("✓ Disabled api client %s\n", args[0])
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// newAuthService connects to the database of the configs
+func newAuthService() (auth.Service, func(), error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the signing keys of new clients are encrypted with the credentials master key
+	cipher, err := services.NewCredentialsCipher(cfg.Credentials)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not load credentials master keys")
+	}
+	if !cipher.Enabled() && !cfg.Credentials.AllowPlaintext {
+		return nil, nil, errors.New("no credentials master key configured, set CREDENTIALS_ALLOW_PLAINTEXT to save signing keys in plaintext")
+	}
+
+	db, err := storage.NewDatabase(cfg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not connect to db")
+	}
+
+	service := auth.NewService(postgres.NewClientRepository(db.PG), cipher, cfg.Auth.MaxSignatureAge)
+	return service, db.Close, nil
+}
+
+func printAPIClients(clients ...auth.Client) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tMERCHANT\tKEY ID\tSCOPES\tDISABLED\tCREATED AT")
+
+	for _, client := range clients {
+		scopes := make([]string, 0, len(client.Scopes))
+		for _, scope := range client.Scopes {
+			scopes = append(scopes, string(scope))
+		}
+
+		merchant := client.MerchantID
+		if client.Platform() {
+			merchant = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			client.ClientID,
+			client.Name,
+			merchant,
+			client.KeyID,
+			strings.Join(scopes, ","),
+			client.Disabled,
+			client.CreatedAt.Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+)
+
+// configFile is the path of the yaml config file, set by the --config flag of the root command
+var configFile string
+
+// loadConfig loads the config from the config file and the env variables
+func loadConfig() (config.Config, error) {
+	var cfg config.Config
+	if err := config.Load(configFile, &cfg); err != nil {
+		return cfg, errors.Wrap(err, "configs could not be loaded")
+	}
+
+	return cfg, nil
+}
+
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	cmd.AddCommand(NewConfigPrintCmd())
+
+	return cmd
+}
+
+func NewConfigPrintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration",
+		Long: `Print the effective configuration as yaml, with secrets redacted.
+
+The configuration is loaded the same way as by serve: defaults, overridden by the
+config file, overridden by the env variables. The configuration is validated, the
+command fails with every invalid setting.`,
+		Example: `  # Print the configuration loaded from a file and the env
+  payments config print --config config.yaml
+
+  # Check the effect of an env variable
+  KAFKA_CONSUMER_CONCURRENCY=8 payments config print --config config.yaml`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			encoder := yaml.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent(2)
+			if err = encoder.Encode(cfg.Redacted()); err != nil {
+				return errors.Wrap(err, "config could not be printed")
+			}
+
+			return encoder.Close()
+		},
+	}
+
+	return cmd
+}
@@ -3,6 +3,7 @@ package payments
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -25,6 +26,7 @@ func NewCreateCmd() *cobra.Command {
 func NewCreateShortCodeCmd() *cobra.Command {
 	var (
 		endpoint          string
+		merchant          string
 		environment       string
 		service           string
 		typeField         string
@@ -34,6 +36,8 @@ func NewCreateShortCodeCmd() *cobra.Command {
 		key               string
 		secret            string
 		passphrase        string
+		priority          uint
+		callbackURL       string
 	)
 
 	cmd := &cobra.Command{
@@ -83,11 +87,13 @@ the specified service (daraja or quikk) in the given environment.`,
 			// Initialize SDK client
 			client := sdk.New(sdk.Config{
 				Endpoint: endpoint,
+				APIKey:   os.Getenv(EnvAPIKey),
 				LogLevel: gorequest.LogDebug,
 			})
 
 			// Build request
 			request := sdk.RequestAddShortCode{
+				MerchantID:        merchant,
 				Environment:       environment,
 				Service:           service,
 				Type:              typeField,
@@ -97,6 +103,8 @@ the specified service (daraja or quikk) in the given environment.`,
 				Key:               key,
 				Secret:            secret,
 				Passphrase:        passphrase,
+				Priority:          priority,
+				CallbackURL:       callbackURL,
 			}
 
 			// Create context with timeout
@@ -126,7 +134,10 @@ the specified service (daraja or quikk) in the given environment.`,
 	cmd.Flags().StringVar(&secret, "secret", "", "Consumer secret/API secret (required)")
 
 	// Optional flags
+	cmd.Flags().StringVar(&merchant, "merchant", "", "Merchant that owns the shortcode, not required for api keys bound to a merchant")
 	cmd.Flags().StringVar(&passphrase, "passphrase", "", "Passphrase (optional)")
+	cmd.Flags().UintVar(&priority, "priority", 0, "Priority, low value means higher priority (optional)")
+	cmd.Flags().StringVar(&callbackURL, "callback-url", "", "Base url partners send webhooks to (optional)")
 
 	// Mark required flags
 	cmd.MarkFlagRequired("endpoint")
@@ -0,0 +1,63 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SirWaithaka/payments-api/pkg/health"
+	kafkaclient "github.com/SirWaithaka/payments-api/src/clients/kafka"
+	natsclient "github.com/SirWaithaka/payments-api/src/clients/nats"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/events"
+	"github.com/SirWaithaka/payments-api/src/events/publisher"
+	"github.com/SirWaithaka/payments-api/src/events/subscriber"
+)
+
+// eventBus is the publisher and subscriber of the configured event broker
+type eventBus struct {
+	publisher  events.Publisher
+	subscriber events.Subscriber
+	// checks the connection to the broker
+	check health.Check
+	// closes the broker clients, called after all subscriptions have stopped
+	close func() error
+}
+
+func newEventBus(ctx context.Context, cfg config.Config) (eventBus, error) {
+	switch cfg.EventBroker {
+	case config.BrokerNats:
+		client, err := natsclient.Connect(ctx, natsclient.Config{
+			URL:             cfg.Nats.URL,
+			Stream:          cfg.Nats.Stream,
+			Subjects:        cfg.Nats.Subjects,
+			DuplicateWindow: time.Hour * 2,
+		})
+		if err != nil {
+			return eventBus{}, err
+		}
+
+		return eventBus{
+			publisher:  publisher.NewJetStream(client, cfg.Nats),
+			subscriber: subscriber.NewJetStream(client, cfg.Nats),
+			check:      client.Ping,
+			close:      client.Close,
+		}, nil
+
+	default:
+		pub := publisher.New(cfg.Kafka)
+		sub := subscriber.NewKafka(cfg.Kafka)
+
+		return eventBus{
+			publisher:  pub,
+			subscriber: sub,
+			check: func(ctx context.Context) error {
+				return kafkaclient.Ping(ctx, strings.Split(cfg.Kafka.Host, ","))
+			},
+			close: func() error {
+				return errors.Join(pub.Close(), sub.Close())
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,173 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/payments-api/pkg/sdk"
+)
+
+func NewMerchantCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merchant",
+		Short: "Manage merchants and report their payments",
+	}
+
+	cmd.AddCommand(NewMerchantCreateCmd())
+	cmd.AddCommand(NewMerchantListCmd())
+	cmd.AddCommand(NewMerchantReportCmd())
+
+	return cmd
+}
+
+func NewMerchantCreateCmd() *cobra.Command {
+	var (
+		endpoint string
+		name     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a merchant",
+		Example: `  # Create a merchant, then add its shortcodes and api clients
+  payments merchant create \
+    --endpoint https://api.payments.example.com \
+    --name "Brand A"`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			merchant, err := client.CreateMerchant(ctx, sdk.RequestCreateMerchant{Name: name})
+			if err != nil {
+				return fmt.Errorf("failed to create merchant: %w", err)
+			}
+
+			printMerchants(merchant)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.Flags().StringVar(&name, "name", "", "Name of the merchant (required)")
+
+	cmd.MarkFlagRequired("endpoint")
+	cmd.MarkFlagRequired("name")
+
+	return cmd
+}
+
+func NewMerchantListCmd() *cobra.Command {
+	var endpoint string
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List merchants",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			merchants, err := client.ListMerchants(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list merchants: %w", err)
+			}
+
+			printMerchants(merchants...)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func NewMerchantReportCmd() *cobra.Command {
+	var (
+		endpoint string
+		from     string
+		to       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "report <id>",
+		Short: "Report the number and amount of payments of a merchant by type and status",
+		Example: `  # Report the payments of a merchant in October
+  payments merchant report 0199f1a2-6b1d-7c3e-8f4a-2d9e5b7c1a30 \
+    --endpoint https://api.payments.example.com \
+    --from 2026-10-01T00:00:00Z \
+    --to 2026-11-01T00:00:00Z`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := sdk.RequestMerchantReport{MerchantID: args[0]}
+			if from != "" {
+				t, err := time.Parse(time.RFC3339, from)
+				if err != nil {
+					return fmt.Errorf("from must be an RFC3339 time: %w", err)
+				}
+				request.From = &t
+			}
+			if to != "" {
+				t, err := time.Parse(time.RFC3339, to)
+				if err != nil {
+					return fmt.Errorf("to must be an RFC3339 time: %w", err)
+				}
+				request.To = &t
+			}
+
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			report, err := client.MerchantReport(ctx, request)
+			if err != nil {
+				return fmt.Errorf("failed to report merchant payments: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TYPE\tSTATUS\tCOUNT\tAMOUNT")
+			for _, total := range report.Totals {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", total.Type, total.Status, total.Count, total.Amount)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.Flags().StringVar(&from, "from", "", "Report payments created at or after this RFC3339 time")
+	cmd.Flags().StringVar(&to, "to", "", "Report payments created before this RFC3339 time")
+
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func printMerchants(merchants ...sdk.Merchant) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCREATED AT")
+
+	for _, merchant := range merchants {
+		fmt.Fprintf(w, "%s\t%s\t%s\n",
+			merchant.MerchantID,
+			merchant.Name,
+			merchant.CreatedAt.Format("2006-01-02 15:04:05"),
+		)
+	}
+
+	w.Flush()
+}
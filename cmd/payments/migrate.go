@@ -0,0 +1,240 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/migrate"
+	"github.com/SirWaithaka/payments-api/src/storage"
+)
+
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database schema",
+		Long: `Migrate the database schema with the migrations embedded in the binary.
+
+The version of the schema is kept in the schema_migrations table, the same table
+used by golang-migrate. Migrators hold a postgres advisory lock, so that
+concurrent migrations of the same database run one at a time. Each migration
+runs in a transaction, a failed migration leaves the schema unchanged.`,
+	}
+
+	cmd.AddCommand(NewMigrateUpCmd())
+	cmd.AddCommand(NewMigrateDownCmd())
+	cmd.AddCommand(NewMigrateStatusCmd())
+	cmd.AddCommand(NewMigrateToCmd())
+
+	return cmd
+}
+
+func NewMigrateUpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "up",
+		Short:        "Apply all pending migrations",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd.Context(), func(ctx context.Context, migrator *migrate.Migrator) error {
+				if err := migrator.Up(ctx); err != nil {
+					return errors.Wrap(err, "could not apply migrations")
+				}
+				return printVersion(ctx, migrator)
+			})
+		},
+	}
+
+	return cmd
+}
+
+func NewMigrateDownCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "down [steps]",
+		Short: "Revert the latest migrations",
+		Long:  "Revert the given number of applied migrations, latest first. One migration is reverted by default.",
+		Example: `  # Revert the latest migration
+  payments migrate down
+
+  # Revert the 3 latest migrations
+  payments migrate down 3`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid steps %q, expected a positive number", args[0])
+				}
+				steps = n
+			}
+
+			return withMigrator(cmd.Context(), func(ctx context.Context, migrator *migrate.Migrator) error {
+				if err := migrator.Down(ctx, steps); err != nil {
+					return errors.Wrap(err, "could not revert migrations")
+				}
+				return printVersion(ctx, migrator)
+			})
+		},
+	}
+
+	return cmd
+}
+
+func NewMigrateToCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "to <version>",
+		Short: "Apply or revert migrations until the version is reached",
+		Example: `  # Migrate to a version
+  payments migrate to 20261019130000
+
+  # Revert all the migrations
+  payments migrate to 0`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+
+			return withMigrator(cmd.Context(), func(ctx context.Context, migrator *migrate.Migrator) error {
+				if err := migrator.To(ctx, version); err != nil {
+					return errors.Wrapf(err, "could not migrate to version %d", version)
+				}
+				return printVersion(ctx, migrator)
+			})
+		},
+	}
+
+	return cmd
+}
+
+func NewMigrateStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "status",
+		Short:        "List the migrations and whether they have been applied",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd.Context(), func(ctx context.Context, migrator *migrate.Migrator) error {
+				statuses, current, err := migrator.Status(ctx)
+				if err != nil {
+					return errors.Wrap(err, "could not read migration status")
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+				var pending int
+				for _, status := range statuses {
+					fmt.Fprintf(w, "%d\t%s\t%t\n", status.Version, status.Name, status.Applied)
+					if !status.Applied {
+						pending++
+					}
+				}
+				if err = w.Flush(); err != nil {
+					return err
+				}
+
+				fmt.Printf("\nDatabase is at version %d, %d migrations pending\n", current, pending)
+				return nil
+			})
+		},
+	}
+
+	return cmd
+}
+
+func NewSeedCmd() *cobra.Command {
+	var down, nonProduction bool
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Seed the database with test data",
+		Long: `Seed the database with the test data embedded in the binary, e.g. sandbox
+shortcodes. Seeds replace the data they insert, and can be run more than once.
+Seeds are refused without --non-production, run this only against databases
+used for testing.`,
+		Example: `  # Insert the test data
+  payments seed --non-production
+
+  # Remove the test data
+  payments seed --non-production --down`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// seeds insert sandbox shortcodes and credentials, a production database
+			// must not be seeded by mistake
+			if !nonProduction {
+				return errors.New("refusing to seed, pass --non-production to confirm the database is not used in production")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			l := logger.New(&logger.Config{LogMode: cfg.LogLevel, Service: cfg.ServiceName})
+
+			db, err := storage.NewDatabase(cfg)
+			if err != nil {
+				return errors.Wrap(err, "could not connect to db")
+			}
+			defer db.Close()
+
+			if err = db.Seed(l.WithContext(cmd.Context()), down); err != nil {
+				return errors.Wrap(err, "could not seed the database")
+			}
+
+			if down {
+				fmt.Println("✓ Removed the seeded data")
+				return nil
+			}
+			fmt.Println("✓ Seeded the database")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&down, "down", false, "Remove the seeded data")
+	cmd.Flags().BoolVar(&nonProduction, "non-production", false, "Confirm the database is not used in production, required")
+
+	return cmd
+}
+
+// withMigrator connects to the database of the configs and runs fn with its migrator
+func withMigrator(ctx context.Context, fn func(ctx context.Context, migrator *migrate.Migrator) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	l := logger.New(&logger.Config{LogMode: cfg.LogLevel, Service: cfg.ServiceName})
+
+	db, err := storage.NewDatabase(cfg)
+	if err != nil {
+		return errors.Wrap(err, "could not connect to db")
+	}
+	defer db.Close()
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		return errors.Wrap(err, "could not load migrations")
+	}
+
+	return fn(l.WithContext(ctx), migrator)
+}
+
+func printVersion(ctx context.Context, migrator *migrate.Migrator) error {
+	version, _, err := migrator.Version(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not read the database version")
+	}
+
+	fmt.Printf("✓ Database is at version %d\n", version)
+	return nil
+}
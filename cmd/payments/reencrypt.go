@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/src/services"
+	"github.com/SirWaithaka/payments-api/src/storage"
+)
+
+func NewShortCodeReencryptCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Encrypt shortcode credentials with the primary master key",
+		Long: `Encrypt shortcode credentials with the primary master key.
+
+Credentials saved in plaintext are encrypted, and the data keys of credentials
+encrypted with another master key are encrypted with the primary master key.
+Run this after adding a new primary master key, the old master key can be
+removed once all shortcodes are re-encrypted.
+
+The command connects to the database directly and reads the master keys from the
+credentials settings of the config file, or CREDENTIALS_MASTER_KEYS,
+CREDENTIALS_KEY_FILE and CREDENTIALS_PRIMARY_KEY_ID.`,
+		Example: `  # Rotate to master key k2, k1 is still needed to decrypt the data keys
+  CREDENTIALS_MASTER_KEYS=k1:<base64 key>,k2:<base64 key> \
+  CREDENTIALS_PRIMARY_KEY_ID=k2 \
+  payments shortcode reencrypt`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			cipher, err := services.NewCredentialsCipher(cfg.Credentials)
+			if err != nil {
+				return errors.Wrap(err, "could not load credentials master keys")
+			}
+			if !cipher.Enabled() {
+				return services.ErrNoMasterKey
+			}
+
+			db, err := storage.NewDatabase(cfg)
+			if err != nil {
+				return errors.Wrap(err, "could not connect to db")
+			}
+			defer db.Close()
+
+			repository := postgres.NewShortCodeRepository(db.PG)
+
+			// deleted shortcodes are re-encrypted too, their credentials are still in the database
+			shortcodes, err := repository.FindMany(cmd.Context(), mpesa.OptionsFindShortCodes{WithDeleted: true})
+			if err != nil {
+				return errors.Wrap(err, "could not list shortcodes")
+			}
+
+			var count int
+			for _, shortcode := range shortcodes {
+				keyID := shortcode.KeyID
+
+				shortcode, changed, err := cipher.Reencrypt(shortcode)
+				if err != nil {
+					return errors.Wrapf(err, "could not re-encrypt shortcode %s", shortcode.ShortCodeID)
+				}
+				if !changed {
+					continue
+				}
+
+				if !dryRun {
+					if err = repository.UpdateCredentials(cmd.Context(), shortcode); err != nil {
+						return errors.Wrapf(err, "could not save shortcode %s", shortcode.ShortCodeID)
+					}
+				}
+
+				if keyID == "" {
+					keyID = "plaintext"
+				}
+				fmt.Printf("%s %s: %s -> %s\n", shortcode.ShortCodeID, shortcode.ShortCode, keyID, shortcode.KeyID)
+				count++
+			}
+
+			if dryRun {
+				fmt.Printf("%d of %d shortcodes would be re-encrypted\n", count, len(shortcodes))
+				return nil
+			}
+			fmt.Printf("✓ Re-encrypted %d of %d shortcodes\n", count, len(shortcodes))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the shortcodes that would be re-encrypted")
+
+	return cmd
+}
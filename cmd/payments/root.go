@@ -1,6 +1,8 @@
 package payments
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
@@ -9,8 +11,17 @@ func NewRootCmd() *cobra.Command {
 		Use: "payments",
 	}
 
+	cmd.PersistentFlags().StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "path of the yaml config file, settings in the env override it (default from CONFIG_FILE)")
+
 	cmd.AddCommand(NewServeCmd())
 	cmd.AddCommand(NewCreateCmd())
+	cmd.AddCommand(NewShortCodeCmd())
+	cmd.AddCommand(NewWebhooksCmd())
+	cmd.AddCommand(NewAPIClientCmd())
+	cmd.AddCommand(NewMerchantCmd())
+	cmd.AddCommand(NewConfigCmd())
+	cmd.AddCommand(NewMigrateCmd())
+	cmd.AddCommand(NewSeedCmd())
 
 	return cmd
 }
@@ -1,30 +1,68 @@
 package payments
 
 import (
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/SirWaithaka/payments-api/pkg/graceful"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
 	"github.com/SirWaithaka/payments-api/src/api/rest"
 	"github.com/SirWaithaka/payments-api/src/config"
 	dipkg "github.com/SirWaithaka/payments-api/src/di"
 	"github.com/SirWaithaka/payments-api/src/events/listener"
-	"github.com/SirWaithaka/payments-api/src/events/publisher"
+	"github.com/SirWaithaka/payments-api/src/jobs"
+	"github.com/SirWaithaka/payments-api/src/services"
 	"github.com/SirWaithaka/payments-api/src/storage"
 )
 
 func NewServeCmd() *cobra.Command {
+	var roles string
+
 	// cmd represents the serve command
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Run the payments server",
+		Long: `Run the payments server with one or more roles.
+
+Roles are set with --roles, the ROLES variable or the roles setting of the config
+file, all roles are served by default:
+  api       client facing api endpoints
+  webhooks  partner webhook endpoints
+  worker    event consumers and background jobs
+
+Every role serves liveness on the http port, and readiness, breaker states and
+metrics on the internal port (HTTP_INTERNAL_PORT), which must not be exposed publicly.`,
+		Example: `  # Run all roles in one process
+  payments serve
+
+  # Run the webhook endpoints only, e.g. on a public facing instance
+  payments serve --roles webhooks
+
+  # Run the api and the event consumers
+  payments serve --roles api,worker`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// load application configs
-			var cfg config.Config
-			if err := config.FromEnv(&cfg); err != nil {
-				return errors.Wrap(err, "env configs could not be loaded")
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			// the flag overrides the roles set in the config
+			if cmd.Flags().Changed("roles") {
+				r, err := config.ParseRoles(roles)
+				if err != nil {
+					return errors.Wrap(err, "invalid --roles")
+				}
+				cfg.Roles = r
+			}
+			// all roles publish events
+			if err = cfg.ValidateEventBroker(); err != nil {
+				return errors.Wrap(err, "configs could not be loaded")
 			}
 
 			// set default logger
@@ -33,6 +71,18 @@ func NewServeCmd() *cobra.Command {
 			zerolog.DefaultContextLogger = &l
 			// add logger to context
 			mCtx := l.WithContext(cmd.Context())
+			l.Info().Strs("roles", cfg.Roles).Msg("serving roles")
+
+			// export traces to the collector
+			shutdownTracing, err := tracing.Setup(mCtx, tracing.Config{
+				ServiceName: cfg.ServiceName,
+				Endpoint:    cfg.Tracing.Endpoint,
+				SampleRatio: cfg.Tracing.SampleRatio,
+			})
+			if err != nil {
+				l.WithLevel(zerolog.FatalLevel).Err(err).Msg("could not set up tracing")
+				return err
+			}
 
 			// create db connection
 			db, err := storage.NewDatabase(cfg)
@@ -42,44 +92,121 @@ func NewServeCmd() *cobra.Command {
 			}
 			l.Info().Msg("db connection succeeded")
 
-			// create an instance of publisher
-			pub := publisher.New(cfg.Kafka)
+			// the api may fail on a schema without the columns and tables of pending migrations
+			if cfg.Postgres.CheckSchema {
+				if err = db.CheckSchema(mCtx); err != nil {
+					l.WithLevel(zerolog.FatalLevel).Err(err).Msg("run `payments migrate up` before serving")
+					db.Close()
+					return err
+				}
+			}
+
+			// create the publisher and subscriber of the configured event broker
+			bus, err := newEventBus(mCtx, cfg)
+			if err != nil {
+				l.WithLevel(zerolog.FatalLevel).Err(err).Msgf("could not connect to %s", cfg.EventBroker)
+				db.Close()
+				return err
+			}
+			l.Info().Msgf("%s connection succeeded", cfg.EventBroker)
+
+			// closeClients closes the broker clients and the db when serve fails to start
+			closeClients := func() {
+				if cErr := bus.close(); cErr != nil {
+					l.Error().Err(cErr).Msg("event broker close error")
+				}
+				db.Close()
+			}
+
+			// create the cipher of shortcode credentials
+			cipher, err := services.NewCredentialsCipher(cfg.Credentials)
+			if err != nil {
+				l.WithLevel(zerolog.FatalLevel).Err(err).Msg("could not load credentials master keys")
+				closeClients()
+				return err
+			}
+			if !cipher.Enabled() {
+				// plaintext credentials are only allowed when explicitly enabled for development
+				if !cfg.Credentials.AllowPlaintext {
+					err = errors.New("no credentials master key configured, set CREDENTIALS_ALLOW_PLAINTEXT to save credentials in plaintext")
+					l.WithLevel(zerolog.FatalLevel).Err(err).Msg("refusing to start")
+					closeClients()
+					return err
+				}
+				l.Warn().Msg("no credentials master key configured, shortcode credentials are saved in plaintext")
+			}
+
+			if cfg.Auth.Disabled {
+				l.Warn().Msg("api authentication is disabled, api requests are not authenticated")
+			}
 
 			// initialize DI container
-			di := dipkg.New(cfg, db, pub)
+			di := dipkg.New(cfg, db, bus.publisher, cipher)
+
+			// the api is not ready without the event broker, all roles publish events
+			di.Health.Register(cfg.EventBroker, bus.check)
+
+			// components are stopped in order: new requests are refused and in-flight
+			// requests complete before the consumers stop, events published by both
+			// are flushed before the broker clients close, the db is closed last. The
+			// http server runs with every role, to serve health checks and metrics on
+			// the internal port
+			coordinator := graceful.NewCoordinator(cfg.ShutdownTimeout)
+			app := rest.New(di)
+			coordinator.Add("http server", app.Shutdown)
+
+			if cfg.Roles.Has(config.RoleWorker) {
+				// create an instance of listener and start
+				ln := listener.New(mCtx, bus.subscriber, di)
+				if err = ln.Listen(); err != nil {
+					l.WithLevel(zerolog.FatalLevel).Err(err).Msg("could not start the listener")
+					closeClients()
+					return err
+				}
+				di.Health.Register("listener", ln.Check)
+				coordinator.Add("listener", ln.Shutdown)
+
+				// start the background jobs, a running job completes before the db is closed
+				scheduler := jobs.NewScheduler(mCtx)
+				scheduler.Add(jobs.NewInboxCleanup(di.Inbox, cfg.Jobs.InboxCleanup))
+				scheduler.Add(jobs.NewWebhookRepublish(di.Webhook, cfg.Jobs.WebhookRepublish))
+				scheduler.Add(jobs.NewRateLimitCleanup(di.Buckets, cfg.Jobs.RateLimitCleanup, cfg.RateLimit))
+				scheduler.Start()
+				coordinator.Add("jobs", scheduler.Shutdown)
+			}
 
-			// create an error group
-			g, gCtx := errgroup.WithContext(mCtx)
+			coordinator.Add("event broker", func(context.Context) error { return bus.close() })
+			coordinator.Add("database", func(context.Context) error {
+				db.Close()
+				return nil
+			})
 
-			// create an instance of http rest server
-			app := rest.New(gCtx, di)
+			// create an error group, the components are shut down if the server fails to start
+			g, gCtx := errgroup.WithContext(mCtx)
 			g.Go(app.Start)
-			g.Go(app.Stop)
-
-			// create an instance of listener and start
-			ln := listener.New(gCtx, cfg.Kafka, di)
-			g.Go(ln.Listen)
-			g.Go(ln.Close)
+			g.Go(func() error { return coordinator.Wait(gCtx) })
 
 			// wait for all goroutines in a g group
-			if err = g.Wait(); err != nil {
-				return err
-			}
-			l.Info().Msg("main shutting down")
+			err = g.Wait()
 
-			// close publisher
-			if err = pub.Close(); err != nil {
-				l.WithLevel(zerolog.FatalLevel).Err(err).Msg("publisher close error")
+			// flush pending spans, the collector may be unreachable
+			tCtx, cancel := context.WithTimeout(context.WithoutCancel(mCtx), 5*time.Second)
+			defer cancel()
+			if tErr := shutdownTracing(tCtx); tErr != nil {
+				l.Error().Err(tErr).Msg("tracing shutdown error")
 			}
 
-			// shutdown db
-			db.Close()
-
+			if err != nil {
+				l.Error().Err(err).Msg("main shut down with errors")
+				return err
+			}
 			l.Info().Msg("main shut down")
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&roles, "roles", "", "comma separated roles to serve: api, webhooks, worker (default from ROLES)")
+
 	return cmd
 }
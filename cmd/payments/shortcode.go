@@ -0,0 +1,247 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/gorequest"
+	"github.com/SirWaithaka/payments-api/pkg/sdk"
+)
+
+func NewShortCodeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shortcode",
+		Short: "Manage shortcode configurations",
+	}
+
+	cmd.AddCommand(NewShortCodeListCmd())
+	cmd.AddCommand(NewShortCodeUpdateCmd())
+	cmd.AddCommand(NewShortCodeDisableCmd())
+	cmd.AddCommand(NewShortCodeEnableCmd())
+	cmd.AddCommand(NewShortCodeReencryptCmd())
+
+	return cmd
+}
+
+func NewShortCodeListCmd() *cobra.Command {
+	var (
+		endpoint  string
+		merchant  string
+		service   string
+		typeField string
+		shortcode string
+		disabled  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List shortcode configurations",
+		Example: `  # List enabled payout shortcodes
+  payments shortcode list \
+    --endpoint https://api.payments.example.com \
+    --type payout \
+    --disabled=false`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := sdk.RequestListShortCodes{
+				MerchantID: merchant,
+				Service:    service,
+				Type:       typeField,
+				ShortCode:  shortcode,
+			}
+			if disabled != "" {
+				v, err := strconv.ParseBool(disabled)
+				if err != nil {
+					return fmt.Errorf("disabled must be either 'true' or 'false'")
+				}
+				request.Disabled = &v
+			}
+
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			shortcodes, err := client.ListShortCodes(ctx, request)
+			if err != nil {
+				return fmt.Errorf("failed to list shortcodes: %w", err)
+			}
+
+			printShortCodes(shortcodes...)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.Flags().StringVar(&merchant, "merchant", "", "List only shortcodes of the merchant")
+	cmd.Flags().StringVar(&service, "service", "", "Service: daraja or quikk")
+	cmd.Flags().StringVar(&typeField, "type", "", "Type: charge, payout, or transfer")
+	cmd.Flags().StringVar(&shortcode, "shortcode", "", "Shortcode number")
+	cmd.Flags().StringVar(&disabled, "disabled", "", "List only disabled (true) or enabled (false) shortcodes")
+
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func NewShortCodeUpdateCmd() *cobra.Command {
+	var (
+		endpoint    string
+		environment string
+		priority    uint
+		callbackURL string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "update <id>",
+		Short: "Update the priority, callback url or environment of a shortcode",
+		Example: `  # Make a shortcode the preferred shortcode for its type
+  payments shortcode update 0199f2a4-4c1e-7d5c-9a43-3c0f3b1e2a10 \
+    --endpoint https://api.payments.example.com \
+    --priority 1`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := sdk.RequestUpdateShortCode{}
+			if cmd.Flags().Changed("environment") {
+				if environment != "sandbox" && environment != "production" {
+					return fmt.Errorf("environment must be either 'sandbox' or 'production'")
+				}
+				request.Environment = &environment
+			}
+			if cmd.Flags().Changed("priority") {
+				if priority == 0 {
+					return fmt.Errorf("priority must be greater than 0")
+				}
+				request.Priority = &priority
+			}
+			if cmd.Flags().Changed("callback-url") {
+				request.CallbackURL = &callbackURL
+			}
+
+			if request == (sdk.RequestUpdateShortCode{}) {
+				return fmt.Errorf("at least one of --environment, --priority or --callback-url is required")
+			}
+
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			shortcode, err := client.UpdateShortCode(ctx, args[0], request)
+			if err != nil {
+				return fmt.Errorf("failed to update shortcode: %w", err)
+			}
+
+			printShortCodes(shortcode)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.Flags().StringVar(&environment, "environment", "", "Environment: sandbox or production")
+	cmd.Flags().UintVar(&priority, "priority", 0, "Priority, low value means higher priority")
+	cmd.Flags().StringVar(&callbackURL, "callback-url", "", "Base url partners send webhooks to")
+
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func NewShortCodeDisableCmd() *cobra.Command {
+	var endpoint string
+
+	cmd := &cobra.Command{
+		Use:   "disable <id>",
+		Short: "Stop a shortcode from being used for new payments",
+		Long: `Stop a shortcode from being used for new payments.
+
+Webhooks for payments already made with the shortcode are still accepted.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			shortcode, err := client.DisableShortCode(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to disable shortcode: %w", err)
+			}
+
+			printShortCodes(shortcode)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func NewShortCodeEnableCmd() *cobra.Command {
+	var endpoint string
+
+	cmd := &cobra.Command{
+		Use:          "enable <id>",
+		Short:        "Use a disabled shortcode for new payments again",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := newShortCodeClient(endpoint)
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+			defer cancel()
+
+			shortcode, err := client.EnableShortCode(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to enable shortcode: %w", err)
+			}
+
+			printShortCodes(shortcode)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func newShortCodeClient(endpoint string) sdk.Client {
+	return sdk.New(sdk.Config{
+		Endpoint: endpoint,
+		APIKey:   os.Getenv(EnvAPIKey),
+		LogLevel: gorequest.LogError,
+	})
+}
+
+func printShortCodes(shortcodes ...sdk.ShortCode) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMERCHANT\tSHORTCODE\tSERVICE\tTYPE\tENVIRONMENT\tPRIORITY\tKEY\tCALLBACK URL\tDISABLED")
+
+	for _, shortcode := range shortcodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%t\n",
+			shortcode.ShortCodeID,
+			shortcode.MerchantID,
+			shortcode.ShortCode,
+			shortcode.Service,
+			shortcode.Type,
+			shortcode.Environment,
+			shortcode.Priority,
+			shortcode.Key,
+			shortcode.CallbackURL,
+			shortcode.Disabled,
+		)
+	}
+	w.Flush()
+}
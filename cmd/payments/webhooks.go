@@ -0,0 +1,149 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SirWaithaka/gorequest"
+	"github.com/SirWaithaka/payments-api/pkg/sdk"
+)
+
+func NewWebhooksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhooks",
+		Short: "Manage webhooks received from partners",
+	}
+
+	cmd.AddCommand(NewWebhooksReplayCmd())
+
+	return cmd
+}
+
+func NewWebhooksReplayCmd() *cobra.Command {
+	var (
+		endpoint string
+		ids      []string
+		partner  string
+		action   string
+		from     string
+		to       string
+		limit    int
+		dryRun   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay stored webhooks",
+		Long: `Replay stored webhooks through webhook processing.
+
+Webhooks are selected by id, partner, action and the time they were received,
+and are replayed oldest first. Use --dry-run to show the payment updates the
+webhooks would apply without applying them. Rejected webhooks are never replayed.`,
+		Example: `  # Show payment updates of daraja b2c webhooks received in a time window
+  payments webhooks replay \
+    --endpoint https://api.payments.example.com \
+    --partner daraja \
+    --action b2c \
+    --from 2026-10-18T08:00:00Z \
+    --to 2026-10-18T10:00:00Z \
+    --dry-run
+
+  # Replay webhooks by id
+  payments webhooks replay \
+    --endpoint https://api.payments.example.com \
+    --ids 0199f2a4-4c1e-7d5c-9a43-3c0f3b1e2a10,0199f2a4-5d2f-7e6d-8b54-4d1f4c2f3b21`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := sdk.RequestReplayWebhooks{
+				IDs:     ids,
+				Partner: partner,
+				Action:  action,
+				Limit:   limit,
+				DryRun:  dryRun,
+			}
+
+			if from != "" {
+				t, err := time.Parse(time.RFC3339, from)
+				if err != nil {
+					return fmt.Errorf("from must be an RFC3339 time: %w", err)
+				}
+				request.From = &t
+			}
+			if to != "" {
+				t, err := time.Parse(time.RFC3339, to)
+				if err != nil {
+					return fmt.Errorf("to must be an RFC3339 time: %w", err)
+				}
+				request.To = &t
+			}
+
+			if len(ids) == 0 && partner == "" && action == "" && from == "" && to == "" {
+				return fmt.Errorf("at least one of --ids, --partner, --action, --from or --to is required")
+			}
+
+			// Initialize SDK client
+			client := sdk.New(sdk.Config{
+				Endpoint: endpoint,
+				APIKey:   os.Getenv(EnvAPIKey),
+				LogLevel: gorequest.LogError,
+			})
+
+			// Replaying webhooks can take a while
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
+			defer cancel()
+
+			response, err := client.ReplayWebhooks(ctx, request)
+			if err != nil {
+				return fmt.Errorf("failed to replay webhooks: %w", err)
+			}
+
+			printReplayedWebhooks(response)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "API endpoint URL (required)")
+	cmd.Flags().StringSliceVar(&ids, "ids", nil, "Comma separated ids of webhooks to replay")
+	cmd.Flags().StringVar(&partner, "partner", "", "Partner that sent the webhooks: daraja or quikk")
+	cmd.Flags().StringVar(&action, "action", "", "Webhook action, e.g. b2c")
+	cmd.Flags().StringVar(&from, "from", "", "Replay webhooks received at or after this RFC3339 time")
+	cmd.Flags().StringVar(&to, "to", "", "Replay webhooks received before this RFC3339 time")
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum number of webhooks to replay (default 100)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show payment updates without applying them")
+
+	cmd.MarkFlagRequired("endpoint")
+
+	return cmd
+}
+
+func printReplayedWebhooks(response sdk.ResponseReplayWebhooks) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEBHOOK\tPARTNER\tACTION\tPAYMENT\tSTATUS\tREFERENCE\tRESULT")
+
+	for _, webhook := range response.Webhooks {
+		var payment, status, reference string
+		if update := webhook.PaymentUpdate; update != nil {
+			payment, status, reference = update.PaymentID, update.Status, update.PaymentReference
+		}
+
+		result := "replayed"
+		switch {
+		case webhook.Error != "":
+			result = "error: " + webhook.Error
+		case webhook.Skipped != "":
+			result = "skipped: " + webhook.Skipped
+		case response.DryRun:
+			result = "dry run"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", webhook.WebhookID, webhook.Partner, webhook.Action, payment, status, reference, result)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d webhooks\n", len(response.Webhooks))
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public."event_inbox";
\ No newline at end of file
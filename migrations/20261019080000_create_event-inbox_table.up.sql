@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS public."event_inbox"
+(
+    "id"             uuid,
+    "consumer_group" text NOT NULL,
+    "event_id"       text NOT NULL,
+    "claimed_at"     timestamptz,
+    "processed_at"   timestamptz,
+    "created_at"     timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "chk_event_inbox_consumer_group" CHECK (consumer_group <> ''),
+    CONSTRAINT "chk_event_inbox_event_id" CHECK (event_id <> ''),
+    CONSTRAINT "unique_consumer_group_event_id" UNIQUE ("consumer_group", "event_id")
+);
+
+-- processed events older than the retention are removed by the inbox cleanup job
+CREATE INDEX IF NOT EXISTS "idx_event_inbox_created_at" ON public."event_inbox" ("created_at");
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS public."idx_mpesa_shortcodes_callback_token";
+
+ALTER TABLE public."mpesa_shortcodes"
+    DROP COLUMN IF EXISTS "callback_token";
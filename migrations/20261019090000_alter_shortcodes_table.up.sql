@@ -0,0 +1,9 @@
+ALTER TABLE public."mpesa_shortcodes"
+    ADD COLUMN IF NOT EXISTS "callback_token" text;
+
+-- generate callback tokens for existing shortcodes
+UPDATE public."mpesa_shortcodes"
+SET "callback_token" = replace(gen_random_uuid()::text, '-', '') || replace(gen_random_uuid()::text, '-', '')
+WHERE "callback_token" IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_mpesa_shortcodes_callback_token" ON public."mpesa_shortcodes" ("callback_token");
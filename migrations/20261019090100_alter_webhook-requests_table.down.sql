@@ -0,0 +1,2 @@
+ALTER TABLE public."webhook_requests"
+    DROP COLUMN IF EXISTS "rejection_reason";
@@ -0,0 +1,3 @@
+-- webhooks that fail authentication are stored with the reason they were rejected
+ALTER TABLE public."webhook_requests"
+    ADD COLUMN IF NOT EXISTS "rejection_reason" text;
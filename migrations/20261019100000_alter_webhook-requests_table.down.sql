@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS public."webhook_requests_unpublished";
+DROP INDEX IF EXISTS public."unique_webhook_partner_natural_key";
+
+ALTER TABLE public."webhook_requests"
+    DROP COLUMN IF EXISTS "content_hash",
+    DROP COLUMN IF EXISTS "natural_key",
+    DROP COLUMN IF EXISTS "duplicate_count",
+    DROP COLUMN IF EXISTS "last_duplicate_at",
+    DROP COLUMN IF EXISTS "published_at";
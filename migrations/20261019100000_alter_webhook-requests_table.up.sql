@@ -0,0 +1,21 @@
+ALTER TABLE public."webhook_requests"
+    ADD COLUMN IF NOT EXISTS "content_hash"      text,
+    ADD COLUMN IF NOT EXISTS "natural_key"       text,
+    ADD COLUMN IF NOT EXISTS "duplicate_count"   integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "last_duplicate_at" timestamptz,
+    -- webhooks are saved before their event is published, webhooks whose event was not
+    -- published are published again
+    ADD COLUMN IF NOT EXISTS "published_at"      timestamptz;
+
+-- webhooks saved before this migration were published when they were received
+UPDATE public."webhook_requests"
+SET "published_at" = "created_at"
+WHERE "rejection_reason" IS NULL
+  AND "published_at" IS NULL;
+
+CREATE INDEX IF NOT EXISTS "webhook_requests_unpublished"
+    ON public."webhook_requests" ("created_at") WHERE published_at IS NULL AND rejection_reason IS NULL;
+
+-- a partner webhook is saved once, rejected webhooks are not considered
+CREATE UNIQUE INDEX IF NOT EXISTS "unique_webhook_partner_natural_key"
+    ON public."webhook_requests" ("partner", "natural_key") WHERE rejection_reason IS NULL;
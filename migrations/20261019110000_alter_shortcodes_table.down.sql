@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS public."unique_service_shortcode_type";
+DROP INDEX IF EXISTS public."unique_priority_type";
+DROP INDEX IF EXISTS public."idx_mpesa_shortcodes_deleted_at";
+
+-- deleted shortcodes can break the unique constraints
+DELETE FROM public."mpesa_shortcodes" WHERE "deleted_at" IS NOT NULL;
+
+ALTER TABLE public."mpesa_shortcodes"
+    DROP COLUMN IF EXISTS "disabled",
+    DROP COLUMN IF EXISTS "deleted_at",
+    ADD CONSTRAINT "unique_service_shortcode_type" UNIQUE ("service", "shortcode", "type"),
+    ADD CONSTRAINT "unique_priority_type" UNIQUE ("priority", "type");
@@ -0,0 +1,15 @@
+ALTER TABLE public."mpesa_shortcodes"
+    ADD COLUMN IF NOT EXISTS "disabled"   boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamp;
+
+CREATE INDEX IF NOT EXISTS "idx_mpesa_shortcodes_deleted_at" ON public."mpesa_shortcodes" ("deleted_at");
+
+-- deleted shortcodes should not stop the shortcode from being added again
+ALTER TABLE public."mpesa_shortcodes"
+    DROP CONSTRAINT IF EXISTS "unique_service_shortcode_type",
+    DROP CONSTRAINT IF EXISTS "unique_priority_type";
+
+CREATE UNIQUE INDEX IF NOT EXISTS "unique_service_shortcode_type"
+    ON public."mpesa_shortcodes" ("service", "shortcode", "type") WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "unique_priority_type"
+    ON public."mpesa_shortcodes" ("priority", "type") WHERE deleted_at IS NULL;
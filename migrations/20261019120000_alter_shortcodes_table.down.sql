@@ -0,0 +1,16 @@
+-- the data keys are lost if the columns are dropped, encrypted credentials could not be decrypted
+DO
+$$
+    BEGIN
+        IF EXISTS (SELECT 1 FROM public."mpesa_shortcodes" WHERE "key_id" IS NOT NULL) THEN
+            RAISE EXCEPTION 'mpesa_shortcodes has encrypted credentials';
+        END IF;
+    END
+$$;
+
+DROP INDEX IF EXISTS public."idx_mpesa_shortcodes_key_hash";
+
+ALTER TABLE public."mpesa_shortcodes"
+    DROP COLUMN IF EXISTS "key_id",
+    DROP COLUMN IF EXISTS "data_key",
+    DROP COLUMN IF EXISTS "key_hash";
@@ -0,0 +1,12 @@
+ALTER TABLE public."mpesa_shortcodes"
+    ADD COLUMN IF NOT EXISTS "key_id"   text,
+    ADD COLUMN IF NOT EXISTS "data_key" text,
+    ADD COLUMN IF NOT EXISTS "key_hash" text;
+
+-- keys are encrypted, shortcodes are found by the hash of the key
+UPDATE public."mpesa_shortcodes"
+SET "key_hash" = encode(sha256(convert_to("key", 'UTF8')), 'hex')
+WHERE "key_hash" IS NULL
+  AND "key_id" IS NULL;
+
+CREATE INDEX IF NOT EXISTS "idx_mpesa_shortcodes_key_hash" ON public."mpesa_shortcodes" ("key_hash");
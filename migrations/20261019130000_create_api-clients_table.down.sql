@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public."api_nonces";
+DROP TABLE IF EXISTS public."api_clients";
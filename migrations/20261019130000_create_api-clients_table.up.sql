@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS public."api_clients"
+(
+    "id"            uuid,
+    "name"          text NOT NULL,
+    "key_id"        text NOT NULL,
+    "secret_hash"   text NOT NULL,
+    -- the signing key is encrypted with the data key, which is wrapped with the master key.
+    -- The key ids are null if the signing key is saved in plaintext.
+    "signing_key"   text NOT NULL,
+    "master_key_id" text,
+    "data_key"      text,
+    "scopes"        text NOT NULL,
+    "disabled"      boolean NOT NULL DEFAULT false,
+    "created_at"    timestamptz,
+    "updated_at"    timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "chk_api_clients_name" CHECK (name <> ''),
+    CONSTRAINT "chk_api_clients_key_id" CHECK (key_id <> ''),
+    CONSTRAINT "chk_api_clients_secret_hash" CHECK (secret_hash <> ''),
+    CONSTRAINT "chk_api_clients_signing_key" CHECK (signing_key <> ''),
+    CONSTRAINT "chk_api_clients_scopes" CHECK (scopes <> ''),
+    CONSTRAINT "idx_api_clients_key_id" UNIQUE ("key_id")
+);
+
+CREATE TABLE IF NOT EXISTS public."api_nonces"
+(
+    "key_id"     text,
+    "nonce"      text,
+    "expires_at" timestamptz NOT NULL,
+    PRIMARY KEY ("key_id", "nonce")
+);
+
+CREATE INDEX IF NOT EXISTS "idx_api_nonces_expires_at" ON public."api_nonces" ("expires_at");
@@ -0,0 +1,22 @@
+-- priorities of merchants can collide once they are no longer scoped
+DO
+$$
+    BEGIN
+        IF (SELECT count(DISTINCT "merchant_id") FROM public."mpesa_shortcodes" WHERE "merchant_id" IS NOT NULL) > 1 THEN
+            RAISE EXCEPTION 'mpesa_shortcodes belong to more than one merchant';
+        END IF;
+    END
+$$;
+
+DROP INDEX IF EXISTS public."unique_merchant_priority_type";
+CREATE UNIQUE INDEX IF NOT EXISTS "unique_priority_type"
+    ON public."mpesa_shortcodes" ("priority", "type") WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS public."unique_mpesa_payments_merchant_idempotency_id";
+
+ALTER TABLE public."webhook_requests" DROP COLUMN IF EXISTS "merchant_id";
+ALTER TABLE public."api_clients" DROP COLUMN IF EXISTS "merchant_id";
+ALTER TABLE public."mpesa_payments" DROP COLUMN IF EXISTS "merchant_id";
+ALTER TABLE public."mpesa_shortcodes" DROP COLUMN IF EXISTS "merchant_id";
+
+DROP TABLE IF EXISTS public."merchants";
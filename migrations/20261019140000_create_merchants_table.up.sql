@@ -0,0 +1,66 @@
+CREATE TABLE IF NOT EXISTS public."merchants"
+(
+    "id"         uuid,
+    "name"       text NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "chk_merchants_name" CHECK (name <> '')
+);
+
+ALTER TABLE public."mpesa_shortcodes"
+    ADD COLUMN IF NOT EXISTS "merchant_id" uuid REFERENCES public."merchants" ("id");
+ALTER TABLE public."mpesa_payments"
+    ADD COLUMN IF NOT EXISTS "merchant_id" uuid REFERENCES public."merchants" ("id");
+ALTER TABLE public."api_clients"
+    ADD COLUMN IF NOT EXISTS "merchant_id" uuid REFERENCES public."merchants" ("id");
+ALTER TABLE public."webhook_requests"
+    ADD COLUMN IF NOT EXISTS "merchant_id" uuid REFERENCES public."merchants" ("id");
+
+CREATE INDEX IF NOT EXISTS "idx_mpesa_shortcodes_merchant_id" ON public."mpesa_shortcodes" ("merchant_id");
+CREATE INDEX IF NOT EXISTS "idx_mpesa_payments_merchant_id" ON public."mpesa_payments" ("merchant_id");
+CREATE INDEX IF NOT EXISTS "idx_api_clients_merchant_id" ON public."api_clients" ("merchant_id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_requests_merchant_id" ON public."webhook_requests" ("merchant_id");
+
+-- existing shortcodes and payments belong to a default merchant, existing api clients
+-- are left as platform clients
+DO
+$$
+    DECLARE
+        default_merchant uuid;
+    BEGIN
+        IF EXISTS (SELECT 1 FROM public."mpesa_shortcodes") OR EXISTS (SELECT 1 FROM public."mpesa_payments") THEN
+            default_merchant := gen_random_uuid();
+            INSERT INTO public."merchants" ("id", "name", "created_at", "updated_at")
+            VALUES (default_merchant, 'default', now(), now());
+
+            UPDATE public."mpesa_shortcodes" SET "merchant_id" = default_merchant WHERE "merchant_id" IS NULL;
+            UPDATE public."mpesa_payments" SET "merchant_id" = default_merchant WHERE "merchant_id" IS NULL;
+        END IF;
+    END
+$$;
+
+-- a payment is saved once for each idempotency id of a merchant, a retried payment request is
+-- rejected as a duplicate instead of making the payment again. Payments saved before merchants
+-- may repeat an idempotency id, if they do the index only covers the payments made after them.
+DO
+$$
+    BEGIN
+        IF EXISTS (SELECT 1
+                   FROM public."mpesa_payments"
+                   GROUP BY "merchant_id", "idempotency_id"
+                   HAVING count(*) > 1) THEN
+            EXECUTE format('CREATE UNIQUE INDEX IF NOT EXISTS "unique_mpesa_payments_merchant_idempotency_id" '
+                               'ON public."mpesa_payments" ("merchant_id", "idempotency_id") WHERE "created_at" > %L',
+                           now()::timestamp);
+        ELSE
+            CREATE UNIQUE INDEX IF NOT EXISTS "unique_mpesa_payments_merchant_idempotency_id"
+                ON public."mpesa_payments" ("merchant_id", "idempotency_id");
+        END IF;
+    END
+$$;
+
+-- shortcode priorities are unique per merchant
+DROP INDEX IF EXISTS public."unique_priority_type";
+CREATE UNIQUE INDEX IF NOT EXISTS "unique_merchant_priority_type"
+    ON public."mpesa_shortcodes" ("merchant_id", "priority", "type") WHERE deleted_at IS NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS public."rate_limit_buckets"
+(
+    "key"        text,
+    "tokens"     double precision NOT NULL,
+    "updated_at" timestamptz NOT NULL,
+    PRIMARY KEY ("key")
+);
+
+-- idle buckets are removed by the rate limit cleanup job
+CREATE INDEX IF NOT EXISTS "idx_rate_limit_buckets_updated_at" ON public."rate_limit_buckets" ("updated_at");
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS public."idx_api_requests_merchant_id";
+DROP INDEX IF EXISTS public."idx_api_requests_payment_id";
+
+ALTER TABLE public."api_requests"
+    DROP CONSTRAINT IF EXISTS "chk_api_requests_operation",
+    DROP COLUMN IF EXISTS "operation",
+    DROP COLUMN IF EXISTS "attempt",
+    DROP COLUMN IF EXISTS "request_body",
+    DROP COLUMN IF EXISTS "http_status",
+    DROP COLUMN IF EXISTS "response_headers",
+    DROP COLUMN IF EXISTS "response_body",
+    DROP COLUMN IF EXISTS "merchant_id";
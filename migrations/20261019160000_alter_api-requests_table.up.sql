@@ -0,0 +1,21 @@
+-- partner exchanges are kept to prove what was sent and received
+ALTER TABLE public."api_requests"
+    ADD COLUMN IF NOT EXISTS "operation"        text,
+    ADD COLUMN IF NOT EXISTS "attempt"          integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "request_body"     JSONB,
+    ADD COLUMN IF NOT EXISTS "http_status"      integer,
+    ADD COLUMN IF NOT EXISTS "response_headers" JSONB,
+    ADD COLUMN IF NOT EXISTS "response_body"    text,
+    -- partner requests belong to the merchant of the shortcode they were made with
+    ADD COLUMN IF NOT EXISTS "merchant_id"      uuid REFERENCES public."merchants" ("id"),
+    ADD CONSTRAINT "chk_api_requests_operation" CHECK (operation <> '');
+
+CREATE INDEX IF NOT EXISTS "idx_api_requests_payment_id" ON public."api_requests" ("payment_id");
+CREATE INDEX IF NOT EXISTS "idx_api_requests_merchant_id" ON public."api_requests" ("merchant_id");
+
+-- requests made before this migration belong to the merchant of their payment
+UPDATE public."api_requests" AS r
+SET "merchant_id" = p."merchant_id"
+FROM public."mpesa_payments" AS p
+WHERE r."payment_id" = p."payment_id"
+  AND r."merchant_id" IS NULL;
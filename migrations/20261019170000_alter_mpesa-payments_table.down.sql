@@ -0,0 +1,2 @@
+ALTER TABLE public."mpesa_payments"
+    DROP COLUMN IF EXISTS "trace_parent";
@@ -0,0 +1,3 @@
+-- webhooks link their traces to the trace of the request that created the payment
+ALTER TABLE public."mpesa_payments"
+    ADD COLUMN IF NOT EXISTS "trace_parent" text;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS public."idx_mpesa_payments_request_id";
+
+ALTER TABLE public."mpesa_payments"
+    DROP COLUMN IF EXISTS "request_id";
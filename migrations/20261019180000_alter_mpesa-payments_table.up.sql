@@ -0,0 +1,5 @@
+-- the X-Request-ID of the api request that created the payment
+ALTER TABLE public."mpesa_payments"
+    ADD COLUMN IF NOT EXISTS "request_id" text;
+
+CREATE INDEX IF NOT EXISTS "idx_mpesa_payments_request_id" ON public."mpesa_payments" ("request_id");
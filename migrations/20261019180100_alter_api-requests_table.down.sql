@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS public."idx_api_requests_origin_request_id";
+
+ALTER TABLE public."api_requests"
+    DROP COLUMN IF EXISTS "origin_request_id";
@@ -0,0 +1,5 @@
+-- the X-Request-ID of the api request or event a partner request was made for
+ALTER TABLE public."api_requests"
+    ADD COLUMN IF NOT EXISTS "origin_request_id" text;
+
+CREATE INDEX IF NOT EXISTS "idx_api_requests_origin_request_id" ON public."api_requests" ("origin_request_id");
@@ -0,0 +1,2 @@
+ALTER TABLE public."mpesa_shortcodes"
+    DROP COLUMN IF EXISTS "callback_token_issued_at";
@@ -0,0 +1,9 @@
+ALTER TABLE public."mpesa_shortcodes"
+    ADD COLUMN IF NOT EXISTS "callback_token_issued_at" timestamp;
+
+-- the time the callback tokens were backfilled is not known, webhooks of payments made
+-- before this migration are accepted without a token
+UPDATE public."mpesa_shortcodes"
+SET "callback_token_issued_at" = current_timestamp
+WHERE "callback_token" IS NOT NULL
+  AND "callback_token_issued_at" IS NULL;
@@ -0,0 +1,10 @@
+// Package migrations embeds the sql migrations of the database schema, so that the
+// payments binary can migrate its own database
+package migrations
+
+import "embed"
+
+// FS holds the migrations, named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,21 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/migrations"
+	"github.com/SirWaithaka/payments-api/pkg/migrate"
+)
+
+func TestFS(t *testing.T) {
+	ms, err := migrate.Load(migrations.FS)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, ms)
+
+	// every migration can be reverted
+	for _, migration := range ms {
+		assert.NotEmptyf(t, migration.Down, "migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+}
@@ -0,0 +1,217 @@
+// Package envelope implements envelope encryption. Values are encrypted with a data key,
+// and the data key is encrypted (wrapped) with a master key that is identified by a key id.
+// Master keys are rotated by wrapping data keys with the new master key, values encrypted
+// with the data key do not change.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the size in bytes of master and data keys, keys are aes-256 keys
+const KeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrNoKeys     = errors.New("no master keys")
+)
+
+// NewKeyring creates a keyring with the master keys by their key id. New data keys are
+// wrapped with the primary key, which can be empty if there is only one master key.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if primary == "" {
+		if len(keys) > 1 {
+			return nil, errors.New("primary key id is required with more than one master key")
+		}
+		for id := range keys {
+			primary = id
+		}
+	}
+
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q: %w", primary, ErrUnknownKey)
+	}
+
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q should be %d bytes, got %d", id, KeySize, len(key))
+		}
+	}
+
+	return &Keyring{primary: primary, keys: keys}, nil
+}
+
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// PrimaryKeyID returns the id of the master key new data keys are wrapped with
+func (keyring *Keyring) PrimaryKeyID() string {
+	return keyring.primary
+}
+
+// NewDataKey generates a data key wrapped with the primary master key
+func (keyring *Keyring) NewDataKey() (DataKey, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return DataKey{}, err
+	}
+
+	return keyring.wrap(key)
+}
+
+// Unwrap decrypts a data key wrapped with the master key of the key id
+func (keyring *Keyring) Unwrap(keyID, wrapped string) (DataKey, error) {
+	master, ok := keyring.keys[keyID]
+	if !ok {
+		return DataKey{}, fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+
+	// the key id is authenticated, a wrapped key cannot be moved to another key id
+	key, err := open(master, wrapped, []byte(keyID))
+	if err != nil {
+		return DataKey{}, fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	return DataKey{KeyID: keyID, Wrapped: wrapped, key: key}, nil
+}
+
+// Rewrap wraps the data key with the primary master key
+func (keyring *Keyring) Rewrap(dataKey DataKey) (DataKey, error) {
+	if dataKey.key == nil {
+		return DataKey{}, errors.New("data key is not unwrapped")
+	}
+
+	return keyring.wrap(dataKey.key)
+}
+
+func (keyring *Keyring) wrap(key []byte) (DataKey, error) {
+	wrapped, err := seal(keyring.keys[keyring.primary], key, []byte(keyring.primary))
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return DataKey{KeyID: keyring.primary, Wrapped: wrapped, key: key}, nil
+}
+
+// DataKey encrypts and decrypts values. Only the wrapped key should be stored.
+type DataKey struct {
+	// id of the master key that wrapped the key
+	KeyID string
+	// base64 encoded data key, encrypted with the master key
+	Wrapped string
+
+	key []byte
+}
+
+// Encrypt encrypts the value and returns it base64 encoded. The associated data is
+// authenticated but not encrypted, the value can only be decrypted with the same data.
+func (dataKey DataKey) Encrypt(value string, data []byte) (string, error) {
+	return seal(dataKey.key, []byte(value), data)
+}
+
+// Decrypt decrypts a value returned by Encrypt with the same associated data
+func (dataKey DataKey) Decrypt(value string, data []byte) (string, error) {
+	b, err := open(dataKey.key, value, data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// seal encrypts with aes-gcm and returns the base64 encoded nonce and ciphertext
+func seal(key, plaintext, data []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, data)), nil
+}
+
+func open(key []byte, ciphertext string, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], data)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseKeys parses master keys in the form <key id>:<base64 key>
+func ParseKeys(entries []string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" || encoded == "" {
+			return nil, errors.New("master keys should be in the form <key id>:<base64 key>")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, err)
+		}
+		if _, ok = keys[id]; ok {
+			return nil, fmt.Errorf("master key %q is repeated", id)
+		}
+		keys[id] = key
+	}
+
+	return keys, nil
+}
+
+// ReadKeyFile reads master keys from a file with one <key id>:<base64 key> per line.
+// Empty lines and lines starting with # are ignored.
+func ReadKeyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+
+	return entries, scanner.Err()
+}
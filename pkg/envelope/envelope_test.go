@@ -0,0 +1,144 @@
+package envelope_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/envelope"
+)
+
+func newKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, envelope.KeySize)
+}
+
+func TestKeyring(t *testing.T) {
+	t.Run("test that values are decrypted with the unwrapped data key", func(t *testing.T) {
+		keyring, err := envelope.NewKeyring("", map[string][]byte{"k1": newKey(1)})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.Equal(t, "k1", keyring.PrimaryKeyID())
+
+		dataKey, err := keyring.NewDataKey()
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		ciphertext, err := dataKey.Encrypt("secret", []byte("shortcode/secret"))
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.NotContains(t, ciphertext, "secret")
+
+		unwrapped, err := keyring.Unwrap(dataKey.KeyID, dataKey.Wrapped)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		value, err := unwrapped.Decrypt(ciphertext, []byte("shortcode/secret"))
+		assert.Nil(t, err)
+		assert.Equal(t, "secret", value)
+	})
+
+	t.Run("test that rewrapped data keys decrypt old values", func(t *testing.T) {
+		old, _ := envelope.NewKeyring("k1", map[string][]byte{"k1": newKey(1)})
+		dataKey, _ := old.NewDataKey()
+		ciphertext, _ := dataKey.Encrypt("secret", []byte("shortcode/secret"))
+
+		// rotate the master key
+		keyring, err := envelope.NewKeyring("k2", map[string][]byte{"k1": newKey(1), "k2": newKey(2)})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		unwrapped, err := keyring.Unwrap(dataKey.KeyID, dataKey.Wrapped)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		rewrapped, err := keyring.Rewrap(unwrapped)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.Equal(t, "k2", rewrapped.KeyID)
+
+		// the old master key is no longer needed
+		keyring, _ = envelope.NewKeyring("k2", map[string][]byte{"k2": newKey(2)})
+		unwrapped, err = keyring.Unwrap(rewrapped.KeyID, rewrapped.Wrapped)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		value, err := unwrapped.Decrypt(ciphertext, []byte("shortcode/secret"))
+		assert.Nil(t, err)
+		assert.Equal(t, "secret", value)
+	})
+
+	t.Run("test that unknown and wrong keys are rejected", func(t *testing.T) {
+		keyring, _ := envelope.NewKeyring("k1", map[string][]byte{"k1": newKey(1), "k2": newKey(2)})
+		dataKey, _ := keyring.NewDataKey()
+
+		_, err := keyring.Unwrap("k3", dataKey.Wrapped)
+		assert.True(t, errors.Is(err, envelope.ErrUnknownKey))
+
+		// the wrapped key is bound to its key id
+		_, err = keyring.Unwrap("k2", dataKey.Wrapped)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("test that values are bound to their associated data", func(t *testing.T) {
+		keyring, _ := envelope.NewKeyring("k1", map[string][]byte{"k1": newKey(1)})
+		dataKey, _ := keyring.NewDataKey()
+
+		ciphertext, err := dataKey.Encrypt("secret", []byte("shortcode-1/secret"))
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		for _, data := range [][]byte{[]byte("shortcode-2/secret"), []byte("shortcode-1/key"), nil} {
+			_, err = dataKey.Decrypt(ciphertext, data)
+			assert.NotNil(t, err, string(data))
+		}
+	})
+
+	t.Run("test that invalid keyrings are rejected", func(t *testing.T) {
+		_, err := envelope.NewKeyring("", nil)
+		assert.True(t, errors.Is(err, envelope.ErrNoKeys))
+
+		_, err = envelope.NewKeyring("", map[string][]byte{"k1": newKey(1), "k2": newKey(2)})
+		assert.NotNil(t, err)
+
+		_, err = envelope.NewKeyring("k1", map[string][]byte{"k1": []byte("short")})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(newKey(1))
+
+	keys, err := envelope.ParseKeys([]string{"k1:" + encoded})
+	assert.Nil(t, err)
+	assert.Equal(t, newKey(1), keys["k1"])
+
+	for _, entries := range [][]string{{"k1"}, {":" + encoded}, {"k1:not base64"}, {"k1:" + encoded, "k1:" + encoded}} {
+		_, err = envelope.ParseKeys(entries)
+		assert.NotNil(t, err, entries)
+	}
+}
+
+func TestReadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# master keys\nk1:abc\n\nk2:def\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	entries, err := envelope.ReadKeyFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k1:abc", "k2:def"}, entries)
+}
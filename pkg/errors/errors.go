@@ -22,6 +22,27 @@ type Timeout interface {
 	Timeout() bool
 }
 
+// Invalid describes an error caused by an invalid request
+type Invalid interface {
+	Invalid() bool
+}
+
+// Forbidden describes an error where the caller is not allowed to act on a value
+type Forbidden interface {
+	Forbidden() bool
+}
+
+// RateLimited describes an error where an operation is rejected because a rate limit is exceeded
+type RateLimited interface {
+	RateLimited() bool
+}
+
+// RetryAfter describes an error of an operation that can be retried after a delay,
+// in whole seconds
+type RetryAfter interface {
+	RetryAfterSeconds() int
+}
+
 // Temporary describes an error that during an operation, but
 // can be classified as temporary and perhaps the operation
 // can be retried
@@ -2,6 +2,8 @@ package events
 
 import (
 	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
 type EventMessage interface {
@@ -11,28 +13,48 @@ type EventMessage interface {
 type EventType interface {
 	ID() string
 	Name() string
+	Key() string
 	EventMessage
 }
 
+// PublishableEvent is an event that can be stamped with
+// an id and a publish time when it is published
+type PublishableEvent interface {
+	EventType
+	SetID(id string)
+	SetPublishTime(t time.Time)
+}
+
 type eventType struct {
-	id   string
-	name string
+	// unique event id, set when the event is first published
+	EventID   string `json:"id,omitempty"`
+	EventName string `json:"name,omitempty"`
+	// key used to partition and order events, e.g. a payment id
+	key string
 }
 
 func (e eventType) ID() string {
-	return e.id
+	return e.EventID
 }
 
 func (e eventType) Name() string {
-	return e.name
+	return e.EventName
 }
 
 func (e *eventType) SetID(id string) {
-	e.id = id
+	e.EventID = id
 }
 
 func (e *eventType) SetName(name string) {
-	e.name = name
+	e.EventName = name
+}
+
+func (e eventType) Key() string {
+	return e.key
+}
+
+func (e *eventType) SetKey(key string) {
+	e.key = key
 }
 
 type Event[T any] struct {
@@ -65,3 +87,38 @@ func NewEvent[T any](name string, payload T) *Event[T] {
 
 	return &evt
 }
+
+// NewEventID generates a unique, time sortable event id
+func NewEventID() string {
+	return ulid.Make().String()
+}
+
+// RequestEvent is an event that carries the id of the api request it was published for
+type RequestEvent interface {
+	SetRequestID(id string)
+}
+
+// SetRequestID sets the request id on the event if the event carries one, an empty id
+// is not set
+func SetRequestID(event EventType, id string) {
+	evt, ok := event.(RequestEvent)
+	if !ok || id == "" {
+		return
+	}
+
+	evt.SetRequestID(id)
+}
+
+// Stamp sets a new id on the event if it does not have one, and sets its publish time.
+// An event that is re-published, e.g. from a dead letter topic, keeps its original id.
+func Stamp(event EventType) {
+	evt, ok := event.(PublishableEvent)
+	if !ok {
+		return
+	}
+
+	if evt.ID() == "" {
+		evt.SetID(NewEventID())
+	}
+	evt.SetPublishTime(time.Now().UTC())
+}
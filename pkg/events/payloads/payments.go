@@ -1,5 +1,7 @@
 package payloads
 
+import "time"
+
 type PaymentCompleted struct {
 	Reference  string `json:"reference"`  // original payment reference
 	ReceiptRef string `json:"receiptRef"` // payment receipt ref from provider
@@ -37,3 +39,13 @@ type WebhookReceived[T any] struct {
 	Service string `json:"service"`
 	Content T      `json:"content"`
 }
+
+// CircuitBreakerStateChanged payload for changes of the state of a partner circuit breaker
+type CircuitBreakerStateChanged struct {
+	Key          string    `json:"key"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	ErrorRate    float64   `json:"error_rate"`
+	SlowCallRate float64   `json:"slow_call_rate"`
+	ChangedAt    time.Time `json:"changed_at"`
+}
@@ -4,4 +4,6 @@ const (
 	PaymentCompleted            = "payment.completed"
 	PaymentStatusUpdated        = "payment.status.updated"
 	WebhookReceived      string = "webhook.received"
+	// CircuitBreakerStateChanged is published when the breaker of a partner shortcode opens or closes
+	CircuitBreakerStateChanged = "partner.breaker.changed"
 )
@@ -0,0 +1,80 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Coordinator shuts down the components of a process in the order they were added,
+// once the process receives SIGINT or SIGTERM. Components share a drain timeout, a
+// component that does not stop before it expires is cut off and the next is stopped.
+//
+//	coordinator := graceful.NewCoordinator(30 * time.Second)
+//	coordinator.Add("http server", server.Shutdown)
+//	coordinator.Add("consumers", listener.Shutdown)
+//
+//	if err := coordinator.Wait(ctx); err != nil {
+//		log.Fatal("Failed to gracefully shut down")
+//	}
+type Coordinator struct {
+	timeout time.Duration
+	steps   []step
+}
+
+type step struct {
+	name     string
+	shutdown ShutdownFunc
+}
+
+// NewCoordinator creates a Coordinator, all the components are given the timeout
+// to stop
+func NewCoordinator(timeout time.Duration) *Coordinator {
+	return &Coordinator{timeout: timeout}
+}
+
+// Add adds a component that is stopped after the components added before it
+func (coordinator *Coordinator) Add(name string, shutdown ShutdownFunc) {
+	coordinator.steps = append(coordinator.steps, step{name: name, shutdown: shutdown})
+}
+
+// Wait blocks until the process receives SIGINT or SIGTERM, or ctx is done, then shuts
+// down the components. A second signal received while shutting down stops the process.
+func (coordinator *Coordinator) Wait(ctx context.Context) error {
+	sCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	<-sCtx.Done()
+	// restore the default behaviour of the signals
+	stop()
+
+	return coordinator.Shutdown(ctx)
+}
+
+// Shutdown stops the components in order. Every component is stopped even if an earlier
+// one fails or the timeout expires, the errors of all the components are returned.
+func (coordinator *Coordinator) Shutdown(ctx context.Context) error {
+	l := zerolog.Ctx(ctx)
+	l.Info().Msgf("shutting down, draining for up to %s", coordinator.timeout)
+
+	// ctx is usually done by the time the process shuts down
+	dCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coordinator.timeout)
+	defer cancel()
+
+	var errs []error
+	for _, step := range coordinator.steps {
+		start := time.Now()
+		if err := step.shutdown(dCtx); err != nil {
+			l.Error().Err(err).Msgf("%s shutdown error", step.name)
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+			continue
+		}
+		l.Info().Msgf("%s stopped in %s", step.name, time.Since(start))
+	}
+
+	return errors.Join(errs...)
+}
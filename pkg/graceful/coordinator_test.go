@@ -0,0 +1,89 @@
+package graceful_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/graceful"
+)
+
+func TestCoordinator_Shutdown(t *testing.T) {
+	t.Run("test that components are stopped in order", func(t *testing.T) {
+		var stopped []string
+		stop := func(name string) graceful.ShutdownFunc {
+			return func(context.Context) error {
+				stopped = append(stopped, name)
+				return nil
+			}
+		}
+
+		coordinator := graceful.NewCoordinator(time.Second)
+		coordinator.Add("http server", stop("http server"))
+		coordinator.Add("listener", stop("listener"))
+		coordinator.Add("database", stop("database"))
+
+		assert.Nil(t, coordinator.Shutdown(t.Context()))
+		assert.Equal(t, []string{"http server", "listener", "database"}, stopped)
+	})
+
+	t.Run("test that later components are stopped after an error", func(t *testing.T) {
+		var closed bool
+
+		coordinator := graceful.NewCoordinator(time.Second)
+		coordinator.Add("listener", func(context.Context) error { return errors.New("consumer error") })
+		coordinator.Add("database", func(context.Context) error {
+			closed = true
+			return nil
+		})
+
+		assert.EqualError(t, coordinator.Shutdown(t.Context()), "listener: consumer error")
+		assert.True(t, closed)
+	})
+
+	t.Run("test that components share the timeout", func(t *testing.T) {
+		var deadlines []time.Time
+		drain := func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, deadline)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		coordinator := graceful.NewCoordinator(20 * time.Millisecond)
+		coordinator.Add("http server", drain)
+		coordinator.Add("listener", drain)
+
+		// the components are drained even if the parent context is cancelled
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		start := time.Now()
+		err := coordinator.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		if assert.Len(t, deadlines, 2) {
+			assert.Equal(t, deadlines[0], deadlines[1])
+		}
+	})
+}
+
+func TestCoordinator_Wait(t *testing.T) {
+	var stopped bool
+
+	coordinator := graceful.NewCoordinator(time.Second)
+	coordinator.Add("http server", func(context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	// components are shut down once the context is done
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	assert.Nil(t, coordinator.Wait(ctx))
+	assert.True(t, stopped)
+}
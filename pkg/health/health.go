@@ -0,0 +1,139 @@
+// Package health checks the dependencies of the api for readiness probes. Each
+// dependency is checked by a named check, the api is ready when all the checks pass.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the status of a component or of the api
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Check checks a component, the component is down if it returns an error. Checks
+// should return once ctx is done.
+type Check func(ctx context.Context) error
+
+// Component is the result of the check of a component
+type Component struct {
+	Name    string
+	Status  Status
+	Latency time.Duration
+	// error of the check, empty if the component is up
+	Error string
+}
+
+// Report is the result of the checks of all the components
+type Report struct {
+	// down if any component is down
+	Status     Status
+	Components []Component
+}
+
+// Up reports whether all the components are up
+func (report Report) Up() bool {
+	return report.Status == StatusUp
+}
+
+// NewChecker creates a Checker, each check is cancelled after the timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Checker runs the checks of the registered components
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// Register adds the check of a component, the check of a component with the same
+// name is replaced
+func (checker *Checker) Register(name string, check Check) {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+
+	checker.checks[name] = check
+}
+
+// Check runs the checks of all the components concurrently. Components are sorted
+// by name in the report.
+func (checker *Checker) Check(ctx context.Context) Report {
+	checker.mu.RLock()
+	checks := make(map[string]Check, len(checker.checks))
+	for name, check := range checker.checks {
+		checks[name] = check
+	}
+	checker.mu.RUnlock()
+
+	components := make([]Component, 0, len(checks))
+	results := make(chan Component, len(checks))
+
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- checker.run(ctx, name, check)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	report := Report{Status: StatusUp}
+	for component := range results {
+		if component.Status == StatusDown {
+			report.Status = StatusDown
+		}
+		components = append(components, component)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+	report.Components = components
+
+	return report
+}
+
+// run runs a check with the timeout of the checker, a check that does not return
+// before the timeout is down
+func (checker *Checker) run(ctx context.Context, name string, check Check) Component {
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("check timed out after %s", checker.timeout)
+		}
+	}
+
+	component := Component{Name: name, Status: StatusUp, Latency: time.Since(start)}
+	if err != nil {
+		component.Status = StatusDown
+		component.Error = err.Error()
+	}
+	return component
+}
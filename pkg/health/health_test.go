@@ -0,0 +1,77 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/health"
+)
+
+func TestChecker_Check(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+
+	t.Run("test all components up", func(t *testing.T) {
+		checker := health.NewChecker(time.Second)
+		checker.Register("listener", up)
+		checker.Register("database", up)
+
+		report := checker.Check(context.Background())
+		assert.True(t, report.Up())
+		assert.Equal(t, health.StatusUp, report.Status)
+		if assert.Len(t, report.Components, 2) {
+			// components are sorted by name
+			assert.Equal(t, "database", report.Components[0].Name)
+			assert.Equal(t, "listener", report.Components[1].Name)
+			for _, component := range report.Components {
+				assert.Equal(t, health.StatusUp, component.Status)
+				assert.Empty(t, component.Error)
+			}
+		}
+	})
+
+	t.Run("test a component down", func(t *testing.T) {
+		checker := health.NewChecker(time.Second)
+		checker.Register("database", up)
+		checker.Register("events", down)
+
+		report := checker.Check(context.Background())
+		assert.False(t, report.Up())
+		assert.Equal(t, health.StatusUp, report.Components[0].Status)
+		assert.Equal(t, health.StatusDown, report.Components[1].Status)
+		assert.Equal(t, "connection refused", report.Components[1].Error)
+	})
+
+	t.Run("test check timed out", func(t *testing.T) {
+		checker := health.NewChecker(10 * time.Millisecond)
+		checker.Register("database", slow)
+
+		report := checker.Check(context.Background())
+		assert.False(t, report.Up())
+		assert.Equal(t, "check timed out after 10ms", report.Components[0].Error)
+		assert.GreaterOrEqual(t, report.Components[0].Latency, 10*time.Millisecond)
+	})
+
+	t.Run("test check panicked", func(t *testing.T) {
+		checker := health.NewChecker(time.Second)
+		checker.Register("listener", func(context.Context) error { panic("nil listener") })
+
+		report := checker.Check(context.Background())
+		assert.False(t, report.Up())
+		assert.Equal(t, "check panicked: nil listener", report.Components[0].Error)
+	})
+
+	t.Run("test no components", func(t *testing.T) {
+		report := health.NewChecker(time.Second).Check(context.Background())
+		assert.True(t, report.Up())
+		assert.Empty(t, report.Components)
+	})
+}
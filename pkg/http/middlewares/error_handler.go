@@ -1,12 +1,15 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
 
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 )
 
@@ -37,10 +40,39 @@ func ErrorHandler() gin.HandlerFunc {
 			return
 		}
 
+		// requests the caller can correct, e.g. acting on merchants they are not bound to
+		var invalid pkgerrors.Invalid
+		if errors.As(err.Err, &invalid) && invalid.Invalid() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var forbidden pkgerrors.Forbidden
+		if errors.As(err.Err, &forbidden) && forbidden.Forbidden() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		// rate limited requests and partner calls rejected while the breaker of the
+		// shortcode is open can be retried after a delay
+		var retry pkgerrors.RetryAfter
+		if errors.As(err.Err, &retry) {
+			status := http.StatusServiceUnavailable
+			var limited pkgerrors.RateLimited
+			if errors.As(err.Err, &limited) && limited.RateLimited() {
+				status = http.StatusTooManyRequests
+			}
+
+			c.Header("Retry-After", strconv.Itoa(retry.RetryAfterSeconds()))
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
 		switch e := err.Err.(type) {
 		case postgres.Error:
 			if e.NotFound() {
 				c.AbortWithStatus(http.StatusNotFound)
+			} else if e.Duplicate() {
+				c.AbortWithStatus(http.StatusConflict)
 			} else {
 				c.AbortWithStatus(http.StatusInternalServerError)
 			}
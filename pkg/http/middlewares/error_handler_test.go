@@ -3,9 +3,11 @@ package middlewares_test
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,6 +16,27 @@ import (
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 )
 
+// statusError implements the error interfaces the handler maps to status codes
+type statusError struct {
+	invalid, forbidden, limited bool
+	retryAfter                  time.Duration
+}
+
+func (e statusError) Error() string          { return "status error" }
+func (e statusError) Invalid() bool          { return e.invalid }
+func (e statusError) Forbidden() bool        { return e.forbidden }
+func (e statusError) RateLimited() bool      { return e.limited }
+func (e statusError) RetryAfterSeconds() int { return int(e.retryAfter.Seconds()) }
+
+// invalidError is an error that is only invalid
+type invalidError struct{ statusError }
+
+// retryError is an error that can only be retried after a delay
+type retryError struct{ seconds int }
+
+func (e retryError) Error() string          { return "retry error" }
+func (e retryError) RetryAfterSeconds() int { return e.seconds }
+
 func assertEquals(t *testing.T, exp any, val any) {
 	if exp != val {
 		t.Errorf("expected %v but got %v", exp, val)
@@ -39,6 +62,20 @@ func TestErrorHandler(t *testing.T) {
 		assertEquals(t, http.StatusNotFound, w.Code)
 	})
 
+	t.Run("test it catches postgres duplicate errors", func(t *testing.T) {
+		err := postgres.Error{Err: gorm.ErrDuplicatedKey}
+
+		engine.GET("/duplicate", func(c *gin.Context) {
+			_ = c.Error(err)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/duplicate", nil)
+		engine.ServeHTTP(w, req)
+
+		assertEquals(t, http.StatusConflict, w.Code)
+	})
+
 	t.Run("test it catches validation errors", func(t *testing.T) {
 		type body struct {
 			Value string `json:"value" binding:"required"`
@@ -75,4 +112,51 @@ func TestErrorHandler(t *testing.T) {
 
 		assertEquals(t, http.StatusConflict, w.Code)
 	})
+
+	t.Run("test it catches rate limit errors", func(t *testing.T) {
+
+		engine.POST("/limited", func(c *gin.Context) {
+			_ = c.Error(statusError{limited: true, retryAfter: 2 * time.Second})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/limited", nil)
+		engine.ServeHTTP(w, req)
+
+		assertEquals(t, http.StatusTooManyRequests, w.Code)
+		assertEquals(t, "2", w.Header().Get("Retry-After"))
+	})
+	t.Run("test it catches errors retried after a delay", func(t *testing.T) {
+
+		engine.POST("/breaker", func(c *gin.Context) {
+			_ = c.Error(retryError{seconds: 10})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/breaker", nil)
+		engine.ServeHTTP(w, req)
+
+		assertEquals(t, http.StatusServiceUnavailable, w.Code)
+		assertEquals(t, "10", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("test it catches invalid and forbidden errors", func(t *testing.T) {
+
+		engine.POST("/invalid", func(c *gin.Context) {
+			_ = c.Error(fmt.Errorf("wrapped: %w", invalidError{statusError{invalid: true}}))
+		})
+		engine.POST("/forbidden", func(c *gin.Context) {
+			_ = c.Error(statusError{forbidden: true})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/invalid", nil)
+		engine.ServeHTTP(w, req)
+		assertEquals(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodPost, "/forbidden", nil)
+		engine.ServeHTTP(w, req)
+		assertEquals(t, http.StatusForbidden, w.Code)
+	})
 }
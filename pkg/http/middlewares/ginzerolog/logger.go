@@ -6,10 +6,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
 )
 
 type responseWriter struct {
@@ -32,24 +32,19 @@ func New(cfg Config) gin.HandlerFunc {
 			return
 		}
 
-		// get request id from user context
-		requestID := xid.New().String()
-		reqId := c.Request.Context().Value(logger.LRequestID)
-		if reqId != nil {
-			requestID = reqId.(string)
-		}
+		// get request id from the request context, requests without an id are logged without it
+		requestID := requestid.FromContext(c.Request.Context())
 
-		// update logging context with http method and request url
-		cfg.Logger.UpdateContext(func(ctx zerolog.Context) zerolog.Context {
-			return ctx.Fields(map[string]interface{}{
-				logger.LRequestID: requestID,
-				"method":          c.Request.Method,
-				"url":             c.Request.URL.String(),
-			})
-		})
+		// create a logger for the request with its id, http method and request url. The
+		// configured logger is shared by all requests and is not modified
+		lg := cfg.Logger.With().Fields(map[string]interface{}{
+			logger.LRequestID: requestID,
+			"method":          c.Request.Method,
+			"url":             c.Request.URL.String(),
+		}).Logger()
 
 		// pass logger to request context
-		c.Request = c.Request.WithContext(cfg.Logger.WithContext(c.Request.Context()))
+		c.Request = c.Request.WithContext(lg.WithContext(c.Request.Context()))
 
 		// capture time before calling next handler
 		start := time.Now()
@@ -81,7 +76,6 @@ func New(cfg Config) gin.HandlerFunc {
 				level = zerolog.ErrorLevel
 			}
 
-			lg := *cfg.Logger
 			lg.WithLevel(level).
 				Int("statusCode", statusCode).
 				Str("elapsed", elapsed(duration)).
@@ -0,0 +1,35 @@
+package middlewares_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/http/middlewares"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	engine := gin.New()
+	engine.Use(middlewares.Metrics())
+	engine.GET("/payments/:id", func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+	engine.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/payments/1", nil)
+	engine.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	engine.ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Body)
+
+	// requests are labelled by the route template, not the path
+	assert.Contains(t, string(body), `payments_http_request_duration_seconds_count{method="GET",route="/payments/:id",status="202"} 1`)
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+// RequestID sets the request id on the request context and the response headers. The id
+// of the caller in the X-Request-ID header is used if it is valid, otherwise an id is generated.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.WithContext(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/http/middlewares"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	var id string
+	engine := gin.New()
+	engine.Use(middlewares.RequestID())
+	engine.GET("/", func(c *gin.Context) {
+		id = requestid.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	t.Run("test that the id of the caller is used", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.Header, "fake_request_id")
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, "fake_request_id", id)
+		assert.Equal(t, "fake_request_id", w.Header().Get(requestid.Header))
+	})
+
+	t.Run("test that an id is generated if the caller has none", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		engine.ServeHTTP(w, req)
+
+		assert.NotEmpty(t, id)
+		assert.Equal(t, id, w.Header().Get(requestid.Header))
+	})
+
+	t.Run("test that an invalid id of the caller is replaced", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.Header, "invalid id")
+		engine.ServeHTTP(w, req)
+
+		assert.NotEqual(t, "invalid id", id)
+		assert.True(t, requestid.Valid(id))
+		assert.Equal(t, id, w.Header().Get(requestid.Header))
+	})
+}
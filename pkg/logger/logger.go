@@ -51,6 +51,8 @@ var (
 func New(cfg *Config) zerolog.Logger {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	zerolog.TimeFieldFormat = time.RFC3339Nano
+	// redact secrets and phone numbers in values logged with Any and Interface
+	zerolog.InterfaceMarshalFunc = MarshalRedacted
 
 	if cfg == nil {
 		return defaultLogger()
@@ -0,0 +1,427 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TagName is the struct tag that sets how a field is redacted in logs
+// e.g. Password string `log:"secret"`
+const TagName = "log"
+
+const (
+	// TagSecret masks the whole value
+	TagSecret = "secret"
+	// TagPhone masks the middle of the value, the first and last 3 characters are shown
+	TagPhone = "phone"
+	// TagPlain logs the value as it is, even if the field name matches a rule
+	TagPlain = "plain"
+)
+
+// Redacted replaces values of secret fields
+const Redacted = "[REDACTED]"
+
+// maximum depth of nested values that are redacted, deeper values are logged as they are
+const maxRedactDepth = 32
+
+// phoneNumber is the rule of fields matched by name that hold phone numbers. Some of them
+// hold shortcodes or account numbers too e.g. PartyA, so only values that look like phone
+// numbers are masked.
+const phoneNumber = "phone_number"
+
+// field names matched by the redaction rules. Names are matched exactly, compared in lower
+// case with underscores and dashes removed, so InitiatorPassword matches initiator_password.
+// Generic names such as key or token are not matched, fields with those names are tagged.
+var (
+	secretFields = fieldSet(
+		"password", "initiatorpassword", "passphrase", "secret", "consumersecret", "consumerkey",
+		"apikey", "securitycredential", "accesstoken", "callbacktoken", "authorization",
+		"datakey", "masterkeys", "cookie", "setcookie",
+	)
+	phoneFields = fieldSet(
+		"msisdn", "phonenumber", "partya", "partyb", "customerno", "recipientno",
+		"externalaccountnumber", "sourceaccountnumber", "destinationaccountnumber",
+	)
+)
+
+func fieldSet(names ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+func normalize(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// rule returns the redaction rule of a field by its name
+func rule(name string) string {
+	name = normalize(name)
+	if _, ok := secretFields[name]; ok {
+		return TagSecret
+	}
+	if _, ok := phoneFields[name]; ok {
+		return phoneNumber
+	}
+	return ""
+}
+
+// fieldRule returns the redaction rule of a struct field, the struct tag takes precedence
+// over the field name and its json name.
+func fieldRule(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup(TagName); ok {
+		if tag == TagPlain {
+			return ""
+		}
+		return tag
+	}
+
+	if r := rule(field.Name); r != "" {
+		return r
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return rule(name)
+}
+
+// MaskSecret returns Redacted for non-empty values
+func MaskSecret(value string) string {
+	if value == "" {
+		return value
+	}
+	return Redacted
+}
+
+// MaskPhone masks the middle of a phone number e.g. 254712345678 becomes 254******678
+func MaskPhone(value string) string {
+	if len(value) <= 6 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:3] + strings.Repeat("*", len(value)-6) + value[len(value)-3:]
+}
+
+// isPhoneNumber returns true for values of at least 9 digits with an optional + prefix,
+// shortcodes have at most 7 digits
+func isPhoneNumber(value string) bool {
+	value = strings.TrimPrefix(value, "+")
+	if len(value) < 9 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func mask(r, value string) string {
+	switch r {
+	case TagSecret:
+		return MaskSecret(value)
+	case TagPhone:
+		return MaskPhone(value)
+	case phoneNumber:
+		if isPhoneNumber(value) {
+			return MaskPhone(value)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// Redact returns a copy of v with secret fields masked and phone numbers partially masked.
+// v is not modified. Fields are matched by their `log` struct tag or by their name.
+func Redact(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	switch value := v.(type) {
+	case []byte:
+		return RedactJSON(value)
+	case json.RawMessage:
+		return json.RawMessage(RedactJSON(value))
+	}
+
+	return redact(reflect.ValueOf(v), 0).Interface()
+}
+
+func redact(v reflect.Value, depth int) reflect.Value {
+	if depth > maxRedactDepth {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(redact(v.Elem(), depth+1))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(redact(v.Elem(), depth+1))
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := out.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+
+			if r := fieldRule(v.Type().Field(i)); r != "" {
+				field.Set(redactField(r, v.Field(i)))
+				continue
+			}
+			field.Set(redact(v.Field(i), depth+1))
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		// name value pairs e.g. {"Name": "PhoneNumber", "Value": 254712345678} in daraja callbacks
+		valueRule := pairRule(v)
+
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if iter.Key().Kind() == reflect.String {
+				r := rule(iter.Key().String())
+				if valueRule != "" && strings.EqualFold(iter.Key().String(), "value") {
+					r = valueRule
+				}
+				if r != "" {
+					out.SetMapIndex(iter.Key(), redactField(r, value))
+					continue
+				}
+			}
+			out.SetMapIndex(iter.Key(), redact(value, depth+1))
+		}
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		// byte slices holding json e.g. datatypes.JSON are redacted as json
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := v.Bytes()
+			if !isJSON(b) {
+				return v
+			}
+			return reflect.ValueOf(RedactJSON(b)).Convert(v.Type())
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redact(v.Index(i), depth+1))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redact(v.Index(i), depth+1))
+		}
+		return out
+
+	case reflect.String:
+		// urls with a callback token e.g. the callback urls of daraja requests
+		if !strings.Contains(v.String(), "token=") {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(redactTokenParams(v.String()))
+		return out
+
+	default:
+		return v
+	}
+}
+
+// redactField masks a value matched by a rule. Strings are masked, numbers are masked as
+// strings where the type allows it, or replaced with their zero value. Values of other
+// types are replaced with their zero value if they are secrets.
+func redactField(r string, v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(mask(r, v.String()))
+		return out
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(redactField(r, v.Elem()))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		// phone numbers decoded from json are numbers, they are masked as strings
+		if number, ok := formatNumber(v.Elem()); ok && reflect.TypeOf("").AssignableTo(v.Type()) {
+			if masked := mask(r, number); masked != number {
+				out.Set(reflect.ValueOf(masked))
+				return out
+			}
+			return v
+		}
+		out.Set(redactField(r, v.Elem()))
+		return out
+	}
+
+	number, ok := formatNumber(v)
+	switch {
+	case r == TagSecret:
+		return reflect.Zero(v.Type())
+	case r == TagPhone && ok:
+		return reflect.Zero(v.Type())
+	case r == phoneNumber && ok && isPhoneNumber(number):
+		return reflect.Zero(v.Type())
+	default:
+		// e.g. a struct in a field named like a phone number field
+		return v
+	}
+}
+
+// formatNumber formats integer and float values in decimal
+func formatNumber(v reflect.Value) (string, bool) {
+	switch {
+	case v.CanInt():
+		return strconv.FormatInt(v.Int(), 10), true
+	case v.CanUint():
+		return strconv.FormatUint(v.Uint(), 10), true
+	case v.CanFloat():
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// pairRule returns the rule of the value in a map with name and value keys, by the name
+func pairRule(v reflect.Value) string {
+	if v.Type().Key().Kind() != reflect.String || v.Len() != 2 {
+		return ""
+	}
+
+	var name reflect.Value
+	iter := v.MapRange()
+	for iter.Next() {
+		if strings.EqualFold(iter.Key().String(), "name") {
+			name = iter.Value()
+		}
+	}
+	if name.Kind() == reflect.Interface {
+		name = name.Elem()
+	}
+	if name.Kind() != reflect.String {
+		return ""
+	}
+	return rule(name.String())
+}
+
+func isJSON(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || (b[0] != '{' && b[0] != '[') {
+		return false
+	}
+	return json.Valid(b)
+}
+
+// RedactJSON redacts a json document. Values that are not json are redacted with RedactString.
+func RedactJSON(b []byte) []byte {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return []byte(RedactString(string(b)))
+	}
+
+	out, err := marshal(Redact(v))
+	if err != nil {
+		return []byte(RedactString(string(b)))
+	}
+	return out
+}
+
+var (
+	// matches "name": "value" and "name": number pairs in json text
+	jsonFieldPattern = regexp.MustCompile(`"([A-Za-z0-9_\-]+)"\s*:\s*(?:"((?:[^"\\]|\\.)*)"|(-?[0-9]+(?:\.[0-9]+)?))`)
+	// matches authorization headers in http dumps
+	authorizationPattern = regexp.MustCompile(`(?i)(authorization:\s*)(?:(basic|bearer)\s+)?[^\s]+`)
+	// matches token query parameters in urls, the & may be escaped in json text
+	tokenParamPattern = regexp.MustCompile(`((?:[?&]|\\u0026)token=)[^&\s"\\#]+`)
+)
+
+// redactTokenParams masks the values of token query parameters in urls
+func redactTokenParams(s string) string {
+	return tokenParamPattern.ReplaceAllString(s, "${1}"+Redacted)
+}
+
+// RedactString redacts secrets and phone numbers in free text such as http request and
+// response dumps. Json string and number fields, authorization headers and token query
+// parameters are redacted, masked numbers are replaced with strings.
+func RedactString(s string) string {
+	s = redactTokenParams(s)
+	s = jsonFieldPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := jsonFieldPattern.FindStringSubmatch(match)
+		r := rule(parts[1])
+		if r == "" {
+			return match
+		}
+
+		value := parts[2]
+		if parts[3] != "" {
+			value = parts[3]
+		}
+		masked := mask(r, value)
+		if masked == value {
+			return match
+		}
+		return `"` + parts[1] + `":"` + masked + `"`
+	})
+
+	return authorizationPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := authorizationPattern.FindStringSubmatch(match)
+		if parts[2] != "" {
+			return parts[1] + parts[2] + " " + Redacted
+		}
+		return parts[1] + Redacted
+	})
+}
+
+// marshal encodes the same way as the default zerolog interface marshaler
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// MarshalRedacted is a zerolog.InterfaceMarshalFunc that redacts values before they are
+// encoded. It is set by New, values logged with Any and Interface are redacted.
+func MarshalRedacted(v any) ([]byte, error) {
+	return marshal(Redact(v))
+}
@@ -0,0 +1,193 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+)
+
+type credentials struct {
+	ShortCode         string
+	InitiatorPassword string
+	Key               *string `log:"secret"`
+	Account           string  `log:"phone"`
+	Pin               int     `log:"secret"`
+	Token             string  `log:"plain"`
+	Nested            []nested
+}
+
+type nested struct {
+	SecurityCredential string `json:"SecurityCredential"`
+	Msisdn             string `json:"customer"`
+	Params             map[string]any
+}
+
+func TestRedact(t *testing.T) {
+	key := "app-key"
+	value := credentials{
+		ShortCode:         "600000",
+		InitiatorPassword: "password",
+		Key:               &key,
+		Account:           "254712345678",
+		Pin:               1234,
+		Token:             "token",
+		Nested: []nested{{
+			SecurityCredential: "credential",
+			Msisdn:             "254712345678",
+			Params:             map[string]any{"PartyA": "254712345678", "Amount": 10},
+		}},
+	}
+
+	redacted, ok := logger.Redact(value).(credentials)
+	if !ok {
+		t.Fatalf("expected credentials type, got %T", redacted)
+	}
+
+	assert.Equal(t, "600000", redacted.ShortCode)
+	assert.Equal(t, logger.Redacted, redacted.InitiatorPassword)
+	assert.Equal(t, logger.Redacted, *redacted.Key)
+	assert.Equal(t, "254******678", redacted.Account)
+	assert.Equal(t, 0, redacted.Pin)
+	assert.Equal(t, "token", redacted.Token)
+	assert.Equal(t, logger.Redacted, redacted.Nested[0].SecurityCredential)
+	assert.Equal(t, "254******678", redacted.Nested[0].Msisdn)
+	assert.Equal(t, "254******678", redacted.Nested[0].Params["PartyA"])
+	assert.Equal(t, 10, redacted.Nested[0].Params["Amount"])
+
+	// the value is not modified
+	assert.Equal(t, "password", value.InitiatorPassword)
+	assert.Equal(t, "app-key", key)
+	assert.Equal(t, "254712345678", value.Nested[0].Params["PartyA"])
+
+	// http headers
+	headers := logger.Redact(map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer abcdef",
+		"Set-Cookie":    "session=abcdef",
+	})
+	assert.Equal(t, map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": logger.Redacted,
+		"Set-Cookie":    logger.Redacted,
+	}, headers)
+}
+
+// settings has fields named like the fields of the redaction rules
+type settings struct {
+	Key       string
+	Token     string
+	MSISDN    limit
+	PartyA    string
+	PartyB    int64
+	Msisdn    int64
+	Secret    int
+	Recipient string `log:"phone"`
+}
+
+type limit struct {
+	Rate  float64
+	Burst int
+}
+
+func TestRedact_Rules(t *testing.T) {
+	t.Run("test that generic names are not redacted", func(t *testing.T) {
+		value := settings{Key: "payment-1", Token: "abc", MSISDN: limit{Rate: 1, Burst: 10}}
+
+		redacted := logger.Redact(value).(settings)
+		assert.Equal(t, "payment-1", redacted.Key)
+		assert.Equal(t, "abc", redacted.Token)
+		assert.Equal(t, limit{Rate: 1, Burst: 10}, redacted.MSISDN)
+	})
+
+	t.Run("test that shortcodes in phone number fields are not masked", func(t *testing.T) {
+		value := settings{PartyA: "600000", PartyB: 600000}
+
+		redacted := logger.Redact(value).(settings)
+		assert.Equal(t, "600000", redacted.PartyA)
+		assert.Equal(t, int64(600000), redacted.PartyB)
+	})
+
+	t.Run("test that numbers are redacted", func(t *testing.T) {
+		value := settings{PartyA: "+254712345678", PartyB: 254712345678, Msisdn: 254712345678, Secret: 1234, Recipient: "600000"}
+
+		redacted := logger.Redact(value).(settings)
+		assert.Equal(t, "+25*******678", redacted.PartyA)
+		assert.Equal(t, int64(0), redacted.PartyB)
+		assert.Equal(t, int64(0), redacted.Msisdn)
+		assert.Equal(t, 0, redacted.Secret)
+		// tagged fields are always masked
+		assert.Equal(t, "******", redacted.Recipient)
+
+		// numbers decoded from json are masked as strings
+		params := logger.Redact(map[string]any{"PartyA": float64(254712345678), "PartyB": float64(600000), "Amount": float64(10)}).(map[string]any)
+		assert.Equal(t, "254******678", params["PartyA"])
+		assert.Equal(t, float64(600000), params["PartyB"])
+		assert.Equal(t, float64(10), params["Amount"])
+	})
+}
+
+func TestRedactJSON(t *testing.T) {
+	payload := `{"Body":{"stkCallback":{"CallbackMetadata":{"Item":[{"Name":"Amount","Value":1},{"Name":"PhoneNumber","Value":254712345678}]}}},"Password":"secret"}`
+
+	var v map[string]any
+	if err := json.Unmarshal(logger.RedactJSON([]byte(payload)), &v); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	items := v["Body"].(map[string]any)["stkCallback"].(map[string]any)["CallbackMetadata"].(map[string]any)["Item"].([]any)
+	assert.Equal(t, float64(1), items[0].(map[string]any)["Value"])
+	assert.Equal(t, "254******678", items[1].(map[string]any)["Value"])
+	assert.Equal(t, logger.Redacted, v["Password"])
+}
+
+func TestRedactString(t *testing.T) {
+	dump := `POST /mpesa/b2c/v1/paymentrequest HTTP/1.1 Authorization: Bearer abcdef {"InitiatorName": "api", "SecurityCredential": "abc\"def", "PartyB": "254712345678"}`
+
+	redacted := logger.RedactString(dump)
+	assert.Equal(t, `POST /mpesa/b2c/v1/paymentrequest HTTP/1.1 Authorization: Bearer [REDACTED] {"InitiatorName": "api", "SecurityCredential":"[REDACTED]", "PartyB":"254******678"}`, redacted)
+
+	t.Run("test that numeric phone numbers are masked", func(t *testing.T) {
+		dump := `{"PartyA": 254712345678, "PartyB": 174379, "PhoneNumber":254712345678, "Amount": 10}`
+
+		redacted := logger.RedactString(dump)
+		assert.Equal(t, `{"PartyA":"254******678", "PartyB": 174379, "PhoneNumber":"254******678", "Amount": 10}`, redacted)
+	})
+
+	t.Run("test that fields with generic names are not redacted", func(t *testing.T) {
+		dump := `{"key": "payment-1", "token": "abc", "msisdn": "10/m", "PartyA": "600000"}`
+
+		assert.Equal(t, dump, logger.RedactString(dump))
+	})
+
+	t.Run("test that token query parameters are redacted", func(t *testing.T) {
+		dump := `{"CallBackURL": "https://example.com/webhooks/daraja/stk?token=abc", "ResultURL": "https://example.com/result?a=1\u0026token=abc"}`
+
+		redacted := logger.RedactString(dump)
+		assert.Equal(t, `{"CallBackURL": "https://example.com/webhooks/daraja/stk?token=[REDACTED]", "ResultURL": "https://example.com/result?a=1\u0026token=[REDACTED]"}`, redacted)
+	})
+}
+
+func TestMarshalRedacted(t *testing.T) {
+	marshal := zerolog.InterfaceMarshalFunc
+	defer func() { zerolog.InterfaceMarshalFunc = marshal }()
+	zerolog.InterfaceMarshalFunc = logger.MarshalRedacted
+
+	var buf bytes.Buffer
+	l := zerolog.New(&buf)
+	l.Info().Any(logger.LData, map[string]string{"secret": "value", "url": "https://example.com?a=1&b=2"}).Msg("")
+
+	assert.JSONEq(t, `{"level":"info","data":{"secret":"[REDACTED]","url":"https://example.com?a=1&b=2"}}`, buf.String())
+
+	t.Run("test that callback tokens in urls are redacted", func(t *testing.T) {
+		request := struct{ CallBackURL string }{CallBackURL: "https://example.com/webhooks/daraja/stk?token=abc&b=2"}
+
+		b, err := logger.MarshalRedacted(request)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"CallBackURL":"https://example.com/webhooks/daraja/stk?token=[REDACTED]&b=2"}`, string(b))
+	})
+}
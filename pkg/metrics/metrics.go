@@ -0,0 +1,158 @@
+// Package metrics defines the prometheus metrics of the api. Metrics are registered on the
+// default prometheus registry and served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "payments"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of http requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	partnerRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "partner",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of partner api calls by shortcode, operation and outcome.",
+		// partner calls are slower than api requests, timeouts are in tens of seconds
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"partner", "shortcode", "operation", "outcome"})
+
+	paymentsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "created_total",
+		Help:      "Number of payments created by type.",
+	}, []string{"type"})
+
+	paymentsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "completed_total",
+		Help:      "Number of payments that reached a final status by type and status.",
+	}, []string{"type", "status"})
+
+	webhookDelay = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "delay_seconds",
+		Help:      "Delay between the creation of a payment and the arrival of its webhook.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600, 1800},
+	}, []string{"partner", "type"})
+
+	eventPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "publish_errors_total",
+		Help:      "Number of events that failed to publish by broker and event.",
+	}, []string{"broker", "event"})
+
+	eventConsumeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "consume_errors_total",
+		Help:      "Number of failed event handler calls by broker, topic and consumer group.",
+	}, []string{"broker", "topic", "group"})
+
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "consumer_lag",
+		Help:      "Number of messages behind the latest message by broker, topic, consumer group and partition.",
+	}, []string{"broker", "topic", "group", "partition"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database queries by statement.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"statement", "status"})
+)
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveHTTPRequest records the duration of an http request. The route is the route
+// template, e.g. /api/merchants/:id, to keep the number of series bounded.
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObservePartnerRequest records the duration and outcome of a partner api call
+func ObservePartnerRequest(partner, shortcodeID, operation, outcome string, duration time.Duration) {
+	partnerRequestDuration.WithLabelValues(partner, shortcodeID, operation, outcome).Observe(duration.Seconds())
+}
+
+// PaymentCreated counts a payment that is saved
+func PaymentCreated(paymentType string) {
+	paymentsCreated.WithLabelValues(paymentType).Inc()
+}
+
+// PaymentCompleted counts a payment that reached a final status
+func PaymentCompleted(paymentType, status string) {
+	paymentsCompleted.WithLabelValues(paymentType, status).Inc()
+}
+
+// ObserveWebhookDelay records the delay between the creation of a payment and its webhook
+func ObserveWebhookDelay(partner, paymentType string, delay time.Duration) {
+	webhookDelay.WithLabelValues(partner, paymentType).Observe(delay.Seconds())
+}
+
+// EventPublishError counts an event that failed to publish
+func EventPublishError(broker, event string) {
+	eventPublishErrors.WithLabelValues(broker, event).Inc()
+}
+
+// EventConsumeError counts a failed event handler call
+func EventConsumeError(broker, topic, group string) {
+	eventConsumeErrors.WithLabelValues(broker, topic, group).Inc()
+}
+
+// SetConsumerLag sets the number of messages a consumer is behind on a partition
+func SetConsumerLag(broker, topic, group, partition string, lag int64) {
+	consumerLag.WithLabelValues(broker, topic, group, partition).Set(float64(max(0, lag)))
+}
+
+// ObserveQuery records the duration of a database query, queries are labelled by the
+// statement type of the sql, e.g. select or insert
+func ObserveQuery(sql string, failed bool, duration time.Duration) {
+	status := "ok"
+	if failed {
+		status = "error"
+	}
+	queryDuration.WithLabelValues(statement(sql), status).Observe(duration.Seconds())
+}
+
+// statement returns the lower case statement type of the sql
+func statement(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	switch s := strings.ToLower(fields[0]); s {
+	case "select", "insert", "update", "delete", "with", "begin", "commit", "rollback", "savepoint":
+		return s
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+)
+
+// scrape returns the metrics served by the handler
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	metrics.Handler().ServeHTTP(w, req)
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics.ObserveHTTPRequest(http.MethodGet, "/api/merchants/:id", http.StatusOK, 10*time.Millisecond)
+	metrics.ObserveHTTPRequest(http.MethodGet, "", http.StatusNotFound, time.Millisecond)
+	metrics.ObservePartnerRequest("daraja", "shortcode-1", "c2b", "timeout", 30*time.Second)
+	metrics.PaymentCreated("charge")
+	metrics.PaymentCompleted("charge", "succeeded")
+	metrics.ObserveWebhookDelay("daraja", "charge", 5*time.Second)
+	metrics.EventPublishError("kafka", "payment.completed")
+	metrics.EventConsumeError("kafka", "payment.completed", "notifications")
+	metrics.SetConsumerLag("kafka", "payment.completed", "notifications", "0", 12)
+	metrics.ObserveQuery(`SELECT * FROM "mpesa_payments" WHERE payment_id = '1'`, false, time.Millisecond)
+	metrics.ObserveQuery(`  insert into "api_requests" ("id") values ('1')`, true, time.Millisecond)
+
+	body := scrape(t)
+
+	expected := []string{
+		`payments_http_request_duration_seconds_count{method="GET",route="/api/merchants/:id",status="200"} 1`,
+		`payments_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+		`payments_partner_request_duration_seconds_count{operation="c2b",outcome="timeout",partner="daraja",shortcode="shortcode-1"} 1`,
+		`payments_created_total{type="charge"} 1`,
+		`payments_completed_total{status="succeeded",type="charge"} 1`,
+		`payments_webhook_delay_seconds_count{partner="daraja",type="charge"} 1`,
+		`payments_events_publish_errors_total{broker="kafka",event="payment.completed"} 1`,
+		`payments_events_consume_errors_total{broker="kafka",group="notifications",topic="payment.completed"} 1`,
+		`payments_events_consumer_lag{broker="kafka",group="notifications",partition="0",topic="payment.completed"} 12`,
+		`payments_db_query_duration_seconds_count{statement="select",status="ok"} 1`,
+		`payments_db_query_duration_seconds_count{statement="insert",status="error"} 1`,
+	}
+	for _, line := range expected {
+		assert.Contains(t, body, line)
+	}
+}
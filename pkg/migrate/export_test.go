@@ -0,0 +1,17 @@
+package migrate
+
+import "fmt"
+
+// Plan exposes plan to tests, each step is described as "<applied|reverted> <version> -> <version after>"
+func Plan(migrations []Migration, current, target uint64) ([]string, error) {
+	steps, err := plan(migrations, current, target)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]string, 0, len(steps))
+	for _, s := range steps {
+		descriptions = append(descriptions, fmt.Sprintf("%s %d -> %d", s.direction(), s.migration.Version, s.version))
+	}
+	return descriptions, nil
+}
@@ -0,0 +1,443 @@
+// Package migrate applies versioned sql migrations to a postgres database. Migrations
+// are files named <version>_<name>.up.sql and <version>_<name>.down.sql, the applied
+// version is kept in the schema_migrations table used by golang-migrate, so that a
+// database migrated with either can be migrated with the other.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+// table keeps the version of the latest applied migration, and whether it failed
+// part way
+const table = "schema_migrations"
+
+// lockID is the key of the advisory lock held while migrating, so that migrators of
+// the same database run one at a time
+var lockID = int64(crc32.ChecksumIEEE([]byte(table)))
+
+var (
+	// ErrDirty is returned when a migration failed part way without a transaction and
+	// the schema has to be fixed by hand
+	ErrDirty = errors.New("database is dirty")
+	// ErrBehind is returned by Check when there are migrations to apply
+	ErrBehind = errors.New("database schema is behind")
+)
+
+// fileName matches the name of a migration file
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change of the schema, with the sql that applies it and the
+// sql that reverts it
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations in the root of fsys ordered by version, other files are
+// ignored. Every migration has an up file, the down file is optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%s: invalid version %q", entry.Name(), match[1])
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%s: version %d is used by %s", entry.Name(), version, migration.Name)
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return compare(a.Version, b.Version) })
+
+	return migrations, nil
+}
+
+func compare(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Version uint64
+	Name    string
+	Applied bool
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Migrator of the database with the migrations ordered by version
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Latest returns the version of the last migration, 0 if there are no migrations
+func (migrator *Migrator) Latest() uint64 {
+	if len(migrator.migrations) == 0 {
+		return 0
+	}
+	return migrator.migrations[len(migrator.migrations)-1].Version
+}
+
+// Version returns the version of the latest applied migration, 0 if none has been applied
+func (migrator *Migrator) Version(ctx context.Context) (version uint64, dirty bool, err error) {
+	return readVersion(ctx, migrator.db)
+}
+
+// Status returns every migration and whether it has been applied, with the current version
+func (migrator *Migrator) Status(ctx context.Context) ([]Status, uint64, error) {
+	current, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if dirty {
+		return nil, current, fmt.Errorf("%w at version %d", ErrDirty, current)
+	}
+
+	statuses := make([]Status, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		statuses = append(statuses, Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: migration.Version <= current,
+		})
+	}
+
+	return statuses, current, nil
+}
+
+// Check returns ErrBehind if there are migrations to apply. A database with a later
+// version than the latest migration is not behind, e.g. while a newer release rolls out.
+func (migrator *Migrator) Check(ctx context.Context) error {
+	current, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirty, current)
+	}
+
+	if latest := migrator.Latest(); current < latest {
+		var pending int
+		for _, migration := range migrator.migrations {
+			if migration.Version > current {
+				pending++
+			}
+		}
+		return fmt.Errorf("%w: version %d, latest %d, %d migrations pending", ErrBehind, current, latest, pending)
+	}
+
+	return nil
+}
+
+// Up applies all the migrations that have not been applied
+func (migrator *Migrator) Up(ctx context.Context) error {
+	return migrator.To(ctx, migrator.Latest())
+}
+
+// Down reverts the given number of applied migrations, latest first
+func (migrator *Migrator) Down(ctx context.Context, steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps %d is less than 1", steps)
+	}
+
+	return migrator.migrate(ctx, func(current uint64) (uint64, error) {
+		if current == 0 {
+			return 0, nil
+		}
+		i := slices.IndexFunc(migrator.migrations, func(m Migration) bool { return m.Version == current })
+		if i < 0 {
+			return 0, fmt.Errorf("version %d is not a known migration", current)
+		}
+
+		if i-steps < 0 {
+			return 0, nil
+		}
+		return migrator.migrations[i-steps].Version, nil
+	})
+}
+
+// To applies or reverts migrations until the version is reached, version 0 reverts
+// all the migrations
+func (migrator *Migrator) To(ctx context.Context, version uint64) error {
+	return migrator.migrate(ctx, func(uint64) (uint64, error) { return version, nil })
+}
+
+// migrate moves the database from its current version to the target version returned by
+// target. Migrators are serialized by an advisory lock held on one connection, which
+// runs the migrations.
+func (migrator *Migrator) migrate(ctx context.Context, target func(current uint64) (uint64, error)) error {
+	l := zerolog.Ctx(ctx)
+
+	return withLock(ctx, migrator.db, func(conn *sql.Conn) error {
+		create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s ("version" bigint NOT NULL PRIMARY KEY, "dirty" boolean NOT NULL)`, table)
+		if _, err := conn.ExecContext(ctx, create); err != nil {
+			return fmt.Errorf("create %s: %w", table, err)
+		}
+
+		// the version is read once the lock is held, another migrator may have changed it
+		current, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w at version %d", ErrDirty, current)
+		}
+
+		to, err := target(current)
+		if err != nil {
+			return err
+		}
+		steps, err := plan(migrator.migrations, current, to)
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			l.Info().Msgf("no change, database is at version %d", current)
+			return nil
+		}
+
+		for _, step := range steps {
+			start := time.Now()
+			if err = apply(ctx, conn, step); err != nil {
+				return err
+			}
+			l.Info().Msgf("%s %d_%s in %s", step.direction(), step.migration.Version, step.migration.Name, time.Since(start))
+		}
+
+		return nil
+	})
+}
+
+// step applies or reverts a migration, leaving the database at version
+type step struct {
+	migration Migration
+	up        bool
+	version   uint64
+}
+
+func (s step) direction() string {
+	if s.up {
+		return "applied"
+	}
+	return "reverted"
+}
+
+// plan returns the steps from the current version to the target version, in order
+func plan(migrations []Migration, current, target uint64) ([]step, error) {
+	known := func(version uint64) bool {
+		return version == 0 || slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version })
+	}
+	if !known(current) {
+		return nil, fmt.Errorf("database version %d is not a known migration", current)
+	}
+	if !known(target) {
+		return nil, fmt.Errorf("version %d is not a known migration", target)
+	}
+
+	var steps []step
+	if target >= current {
+		for _, migration := range migrations {
+			if migration.Version > current && migration.Version <= target {
+				steps = append(steps, step{migration: migration, up: true, version: migration.Version})
+			}
+		}
+		return steps, nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= target || migration.Version > current {
+			continue
+		}
+		if migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+
+		var previous uint64
+		if i > 0 {
+			previous = migrations[i-1].Version
+		}
+		steps = append(steps, step{migration: migration, version: previous})
+	}
+
+	return steps, nil
+}
+
+// apply runs the sql of the step and records the version in a transaction, a migration
+// that fails leaves the schema and the version unchanged
+func apply(ctx context.Context, conn *sql.Conn, s step) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := s.migration.Down
+	if s.up {
+		query = s.migration.Up
+	}
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", s.migration.Version, s.migration.Name, err)
+	}
+
+	// like golang-migrate, the table has a row only when a migration is applied
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+		return err
+	}
+	if s.version > 0 {
+		insert := fmt.Sprintf(`INSERT INTO %s ("version", "dirty") VALUES ($1, false)`, table)
+		if _, err = tx.ExecContext(ctx, insert, int64(s.version)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Seed runs the up files of the seeds in fsys ordered by version, or the down files in
+// reverse order. Seeds are not versioned, each is run every time in a transaction.
+func Seed(ctx context.Context, db *sql.DB, fsys fs.FS, down bool) error {
+	l := zerolog.Ctx(ctx)
+
+	seeds, err := Load(fsys)
+	if err != nil {
+		return err
+	}
+	if down {
+		slices.Reverse(seeds)
+	}
+
+	return withLock(ctx, db, func(conn *sql.Conn) error {
+		for _, seed := range seeds {
+			query := seed.Up
+			if down {
+				query = seed.Down
+			}
+			if query == "" {
+				continue
+			}
+
+			if err := execTx(ctx, conn, query); err != nil {
+				return fmt.Errorf("seed %d_%s: %w", seed.Version, seed.Name, err)
+			}
+			l.Info().Msgf("ran seed %d_%s", seed.Version, seed.Name)
+		}
+		return nil
+	})
+}
+
+func execTx(ctx context.Context, conn *sql.Conn, query string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withLock runs fn with a connection that holds the advisory lock, it blocks until the
+// lock is acquired or ctx is done
+func withLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	// advisory locks are held by a session, the lock is taken and released on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	zerolog.Ctx(ctx).Debug().Msg("waiting for migration lock")
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("migration lock: %w", err)
+	}
+	// the lock is released even if ctx is done, it is also released when the connection closes
+	defer func() { _, _ = conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockID) }()
+
+	return fn(conn)
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// readVersion reads the version from the table, a database without the table has no
+// applied migrations
+func readVersion(ctx context.Context, db queryer) (uint64, bool, error) {
+	var (
+		v     int64
+		dirty bool
+	)
+	err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT "version", "dirty" FROM %s LIMIT 1`, table)).Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if pgErr := (*pgconn.PgError)(nil); errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+		// undefined table
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read version: %w", err)
+	}
+
+	return uint64(v), dirty, nil
+}
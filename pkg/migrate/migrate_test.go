@@ -0,0 +1,101 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("test that migrations are ordered by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"20_create_b_table.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+			"20_create_b_table.down.sql": {Data: []byte("DROP TABLE b;")},
+			"3_create_a_table.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+			"Dockerfile":                 {Data: []byte("FROM scratch")},
+			"migrations.go":              {Data: []byte("package migrations")},
+		}
+
+		migrations, err := migrate.Load(fsys)
+		assert.Nil(t, err)
+		assert.Equal(t, []migrate.Migration{
+			{Version: 3, Name: "create_a_table", Up: "CREATE TABLE a ();"},
+			{Version: 20, Name: "create_b_table", Up: "CREATE TABLE b ();", Down: "DROP TABLE b;"},
+		}, migrations)
+	})
+
+	t.Run("test that a migration without an up file is an error", func(t *testing.T) {
+		fsys := fstest.MapFS{"1_create_a_table.down.sql": {Data: []byte("DROP TABLE a;")}}
+
+		_, err := migrate.Load(fsys)
+		assert.EqualError(t, err, "migration 1_create_a_table has no up file")
+	})
+
+	t.Run("test that migrations with the same version are an error", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"1_create_a_table.up.sql": {Data: []byte("CREATE TABLE a ();")},
+			"1_create_b_table.up.sql": {Data: []byte("CREATE TABLE b ();")},
+		}
+
+		_, err := migrate.Load(fsys)
+		assert.EqualError(t, err, "1_create_b_table.up.sql: version 1 is used by create_a_table")
+	})
+
+	t.Run("test that version 0 is an error", func(t *testing.T) {
+		fsys := fstest.MapFS{"0_create_a_table.up.sql": {Data: []byte("CREATE TABLE a ();")}}
+
+		_, err := migrate.Load(fsys)
+		assert.EqualError(t, err, `0_create_a_table.up.sql: invalid version "0"`)
+	})
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []migrate.Migration{
+		{Version: 10, Name: "a", Up: "up a", Down: "down a"},
+		{Version: 20, Name: "b", Up: "up b", Down: "down b"},
+		{Version: 30, Name: "c", Up: "up c", Down: "down c"},
+	}
+
+	testcases := []struct {
+		name            string
+		current, target uint64
+		expected        []string
+	}{
+		{name: "all migrations are applied to an empty database", current: 0, target: 30,
+			expected: []string{"applied 10 -> 10", "applied 20 -> 20", "applied 30 -> 30"}},
+		{name: "pending migrations are applied", current: 10, target: 30,
+			expected: []string{"applied 20 -> 20", "applied 30 -> 30"}},
+		{name: "migrations are reverted to the target", current: 30, target: 10,
+			expected: []string{"reverted 30 -> 20", "reverted 20 -> 10"}},
+		{name: "all migrations are reverted to version 0", current: 20, target: 0,
+			expected: []string{"reverted 20 -> 10", "reverted 10 -> 0"}},
+		{name: "nothing is applied at the target", current: 20, target: 20, expected: []string{}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := migrate.Plan(migrations, tc.current, tc.target)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, steps)
+		})
+	}
+
+	t.Run("test that an unknown version is an error", func(t *testing.T) {
+		_, err := migrate.Plan(migrations, 0, 25)
+		assert.EqualError(t, err, "version 25 is not a known migration")
+
+		// the database was migrated by a newer release
+		_, err = migrate.Plan(migrations, 40, 30)
+		assert.EqualError(t, err, "database version 40 is not a known migration")
+	})
+
+	t.Run("test that a migration without a down file cannot be reverted", func(t *testing.T) {
+		migrations := []migrate.Migration{{Version: 10, Name: "a", Up: "up a"}}
+
+		_, err := migrate.Plan(migrations, 10, 0)
+		assert.EqualError(t, err, "migration 10_a has no down file")
+	})
+}
@@ -0,0 +1,83 @@
+// Package rate defines the token bucket limits of requests. Limits are read from config
+// files and env variables in the form <requests>/<period>.
+package rate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket that holds up to Burst tokens and is refilled at Rate tokens
+// per second. Each request takes a token, requests are limited when the bucket is empty.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Disabled returns true if the limit does not limit requests
+func (limit Limit) Disabled() bool {
+	return limit.Rate <= 0 || limit.Burst <= 0
+}
+
+// Refill returns the duration an empty bucket takes to be refilled, 0 if the limit is disabled
+func (limit Limit) Refill() time.Duration {
+	if limit.Disabled() {
+		return 0
+	}
+	return time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+}
+
+func (limit Limit) String() string {
+	if limit.Disabled() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", limit.Burst, limit.Refill())
+}
+
+// MarshalText encodes the limit in the form parsed by ParseLimit
+func (limit Limit) MarshalText() ([]byte, error) {
+	return []byte(limit.String()), nil
+}
+
+// UnmarshalText decodes a limit with ParseLimit, limits are read from config files and
+// env variables as text
+func (limit *Limit) UnmarshalText(text []byte) error {
+	l, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*limit = l
+	return nil
+}
+
+// ParseLimit parses a limit in the form <requests>/<period>, e.g. 5/1m allows a burst of
+// 5 requests and refills the bucket in a minute. An empty value or 0 disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", s)
+	}
+
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, requests should be a positive number", s)
+	}
+
+	// a period without a number is one unit, e.g. 10/s
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, period should be a positive duration", s)
+	}
+
+	return Limit{Rate: float64(burst) / duration.Seconds(), Burst: burst}, nil
+}
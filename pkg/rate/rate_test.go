@@ -0,0 +1,54 @@
+package rate_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+func TestParseLimit(t *testing.T) {
+	tcs := map[string]struct {
+		value    string
+		expected rate.Limit
+		err      bool
+	}{
+		"test that requests per period are parsed":        {value: "5/1m", expected: rate.Limit{Rate: 5.0 / 60, Burst: 5}},
+		"test that a period without a number is one unit": {value: "10/s", expected: rate.Limit{Rate: 10, Burst: 10}},
+		"test that an empty value disables the limit":     {value: "", expected: rate.Limit{}},
+		"test that 0 disables the limit":                  {value: "0", expected: rate.Limit{}},
+		"test that a value without a period is invalid":   {value: "10", err: true},
+		"test that an invalid period is invalid":          {value: "10/x", err: true},
+		"test that negative requests are invalid":         {value: "-1/s", err: true},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			limit, err := rate.ParseLimit(tc.value)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected.Burst, limit.Burst)
+			assert.InDelta(t, tc.expected.Rate, limit.Rate, 1e-9)
+		})
+	}
+}
+
+func TestLimit_UnmarshalText(t *testing.T) {
+	var limit rate.Limit
+	assert.Nil(t, limit.UnmarshalText([]byte("5/1m")))
+	assert.Equal(t, 5, limit.Burst)
+
+	// the text of a limit is parsed back to the same limit
+	text, err := limit.MarshalText()
+	assert.Nil(t, err)
+	var parsed rate.Limit
+	assert.Nil(t, parsed.UnmarshalText(text))
+	assert.Equal(t, limit.Burst, parsed.Burst)
+	assert.InDelta(t, limit.Rate, parsed.Rate, 1e-9)
+
+	assert.Error(t, limit.UnmarshalText([]byte("10")))
+}
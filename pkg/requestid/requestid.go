@@ -0,0 +1,60 @@
+// Package requestid carries the id of an api request through the context, the logs, the
+// events it publishes and the partner requests it makes. The id is accepted from the
+// X-Request-ID header of the caller or generated, so that a request can be followed
+// across all the logs with a single id.
+package requestid
+
+import (
+	"context"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+)
+
+// Header is the http and message header that carries the request id
+const Header = "X-Request-ID"
+
+// maxLength is the max length of a request id accepted from a caller
+const maxLength = 128
+
+type contextKey struct{}
+
+// New generates a request id
+func New() string {
+	return xid.New().String()
+}
+
+// Valid reports whether an id from a caller can be used as a request id. Ids are limited
+// in length and to printable ascii characters, since they are logged and saved.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// FromContext returns the request id in ctx, empty if ctx has none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// WithContext returns a copy of ctx with the request id, the id is also added to the
+// logger of ctx
+func WithContext(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	l := zerolog.Ctx(ctx).With().Str(logger.LRequestID, id).Logger()
+	ctx = l.WithContext(ctx)
+
+	return context.WithValue(ctx, contextKey{}, id)
+}
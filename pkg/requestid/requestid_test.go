@@ -0,0 +1,53 @@
+package requestid_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+func TestValid(t *testing.T) {
+	testcases := []struct {
+		name  string
+		id    string
+		valid bool
+	}{
+		{name: "test that a generated id is valid", id: requestid.New(), valid: true},
+		{name: "test that a uuid is valid", id: "5f0c8a3e-7a1b-4c2d-9e8f-1a2b3c4d5e6f", valid: true},
+		{name: "test that an empty id is invalid", id: "", valid: false},
+		{name: "test that an id with spaces is invalid", id: "request id", valid: false},
+		{name: "test that an id with control characters is invalid", id: "id\nforged log line", valid: false},
+		{name: "test that a long id is invalid", id: strings.Repeat("a", 129), valid: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.valid, requestid.Valid(tc.id))
+		})
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	t.Run("test that the id is set on the context and its logger", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		l := zerolog.New(buf)
+		ctx := l.WithContext(context.Background())
+
+		ctx = requestid.WithContext(ctx, "fake_request_id")
+		zerolog.Ctx(ctx).Info().Msg("message")
+
+		assert.Equal(t, "fake_request_id", requestid.FromContext(ctx))
+		assert.Contains(t, buf.String(), `"requestID":"fake_request_id"`)
+	})
+
+	t.Run("test that an empty id is not set", func(t *testing.T) {
+		ctx := requestid.WithContext(context.Background(), "")
+		assert.Empty(t, requestid.FromContext(ctx))
+	})
+}
@@ -2,40 +2,117 @@ package sdk
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/SirWaithaka/gorequest"
 	"github.com/SirWaithaka/gorequest/corehooks"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/signature"
 )
 
 func defaultHooks() gorequest.Hooks {
 	hooks := corehooks.Default()
 
 	hooks.Build.PushBackHook(corehooks.EncodeRequestBody)
-	hooks.Send.PushBackHook(corehooks.ResponseStatusCode)
+	hooks.Send.PushBackHook(decodeErrorResponse)
+	hooks.Unmarshal.PushBackHook(decodeResponseBody)
 	return hooks
 }
 
+// decodeResponseBody decodes json response bodies into the request output
+var decodeResponseBody = gorequest.Hook{Name: "sdk.DecodeResponseBody", Fn: func(r *gorequest.Request) {
+	if r.Error != nil || r.Data == nil || r.Response == nil || r.Response.Body == nil {
+		return
+	}
+
+	err := json.NewDecoder(r.Response.Body).Decode(r.Data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.Error = err
+	}
+}}
+
+// forwardRequestID sends the request id in the context of the request, so that the api
+// request can be followed from the request of the caller
+var forwardRequestID = gorequest.Hook{Name: "sdk.ForwardRequestID", Fn: func(r *gorequest.Request) {
+	if r.Request == nil || r.Request.Header.Get(requestid.Header) != "" {
+		return
+	}
+	if id := requestid.FromContext(r.Context()); id != "" {
+		r.Request.Header.Set(requestid.Header, id)
+	}
+}}
+
+// signRequest signs requests with the api key secret before they are sent
+func signRequest(apiKey string) gorequest.Hook {
+	keyID, secret, err := signature.ParseAPIKey(apiKey)
+
+	return gorequest.Hook{Name: "sdk.SignRequest", Fn: func(r *gorequest.Request) {
+		if err != nil {
+			r.Error = err
+			return
+		}
+		if r.Request == nil {
+			return
+		}
+		if e := signature.SignRequest(r.Request, keyID, secret, time.Now()); e != nil {
+			r.Error = e
+		}
+	}}
+}
+
 type Config struct {
 	Endpoint string
+	// api key in the form <key id>.<secret>, requests are signed with the secret
+	APIKey   string
 	Hooks    gorequest.Hooks
 	LogLevel gorequest.LogLevel
+	// max number of retries of safe operations after temporary errors, and of payments
+	// after errors returned before they are saved. DefaultMaxRetries if 0. Operations
+	// are not retried if negative
+	MaxRetries int
+	// delay before the first retry, doubled for each retry. DefaultRetryDelay if 0
+	RetryDelay time.Duration
 }
 
 type Client struct {
-	endpoint string
-	Hooks    gorequest.Hooks
+	endpoint   string
+	maxRetries int
+	retryDelay time.Duration
+	Hooks      gorequest.Hooks
 }
 
 func New(cfg Config) Client {
 	if cfg.Hooks.IsEmpty() {
 		cfg.Hooks = defaultHooks()
 	}
+	// the signature covers the encoded body, sign requests when they are sent
+	if cfg.APIKey != "" {
+		cfg.Hooks.Send.PushFrontHook(signRequest(cfg.APIKey))
+	}
+	cfg.Hooks.Send.PushFrontHook(forwardRequestID)
 	// add log level to request config
 	cfg.Hooks.Build.PushFront(gorequest.WithLogLevel(cfg.LogLevel))
 	cfg.Hooks.Build.PushFront(gorequest.WithRequestHeader("content-type", "application/json"))
 
-	return Client{endpoint: cfg.Endpoint, Hooks: cfg.Hooks}
+	switch {
+	case cfg.MaxRetries == 0:
+		cfg.MaxRetries = DefaultMaxRetries
+	case cfg.MaxRetries < 0:
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+
+	return Client{endpoint: cfg.Endpoint, maxRetries: cfg.MaxRetries, retryDelay: cfg.RetryDelay, Hooks: cfg.Hooks}
 }
 
 func (client Client) AddShortCodeRequest(input RequestAddShortCode, opts ...gorequest.Option) *gorequest.Request {
@@ -53,8 +130,465 @@ func (client Client) AddShortCodeRequest(input RequestAddShortCode, opts ...gore
 }
 
 func (client Client) AddShortCode(ctx context.Context, input RequestAddShortCode) error {
-	req := client.AddShortCodeRequest(input)
-	req.WithContext(ctx)
+	return client.send(ctx, false, func() *gorequest.Request { return client.AddShortCodeRequest(input) })
+}
+
+func (client Client) ListShortCodesRequest(input RequestListShortCodes, output *[]ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	query := url.Values{}
+	if input.MerchantID != "" {
+		query.Set("merchant_id", input.MerchantID)
+	}
+	if input.Service != "" {
+		query.Set("service", input.Service)
+	}
+	if input.Type != "" {
+		query.Set("type", input.Type)
+	}
+	if input.ShortCode != "" {
+		query.Set("shortcode", input.ShortCode)
+	}
+	if input.Disabled != nil {
+		query.Set("disabled", strconv.FormatBool(*input.Disabled))
+	}
+
+	path := EndpointListShortCodes
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	op := gorequest.Operation{
+		Name:   OperationListShortCodes,
+		Method: http.MethodGet,
+		Path:   path,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+func (client Client) ListShortCodes(ctx context.Context, input RequestListShortCodes) ([]ShortCode, error) {
+	var output []ShortCode
+	err := client.send(ctx, true, func() *gorequest.Request { return client.ListShortCodesRequest(input, &output) })
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func (client Client) GetShortCodeRequest(id string, output *ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationGetShortCode,
+		Method: http.MethodGet,
+		Path:   fmt.Sprintf(EndpointGetShortCode, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+func (client Client) GetShortCode(ctx context.Context, id string) (ShortCode, error) {
+	var output ShortCode
+	err := client.send(ctx, true, func() *gorequest.Request { return client.GetShortCodeRequest(id, &output) })
+	if err != nil {
+		return ShortCode{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) UpdateShortCodeRequest(id string, input RequestUpdateShortCode, output *ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationUpdateShortCode,
+		Method: http.MethodPatch,
+		Path:   fmt.Sprintf(EndpointUpdateShortCode, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// UpdateShortCode changes the priority, callback url or environment of a shortcode
+func (client Client) UpdateShortCode(ctx context.Context, id string, input RequestUpdateShortCode) (ShortCode, error) {
+	var output ShortCode
+	err := client.send(ctx, false, func() *gorequest.Request { return client.UpdateShortCodeRequest(id, input, &output) })
+	if err != nil {
+		return ShortCode{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) EnableShortCodeRequest(id string, output *ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationEnableShortCode,
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf(EndpointEnableShortCode, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+func (client Client) EnableShortCode(ctx context.Context, id string) (ShortCode, error) {
+	var output ShortCode
+	err := client.send(ctx, false, func() *gorequest.Request { return client.EnableShortCodeRequest(id, &output) })
+	if err != nil {
+		return ShortCode{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) DisableShortCodeRequest(id string, output *ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationDisableShortCode,
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf(EndpointDisableShortCode, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// DisableShortCode stops a shortcode from being used for new payments
+func (client Client) DisableShortCode(ctx context.Context, id string) (ShortCode, error) {
+	var output ShortCode
+	err := client.send(ctx, false, func() *gorequest.Request { return client.DisableShortCodeRequest(id, &output) })
+	if err != nil {
+		return ShortCode{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) ReplayWebhooksRequest(input RequestReplayWebhooks, output *ResponseReplayWebhooks, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationReplayWebhooks,
+		Method: http.MethodPost,
+		Path:   EndpointReplayWebhooks,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// ReplayWebhooks processes stored webhooks again. With DryRun set, the payment
+// updates are returned without being applied.
+func (client Client) ReplayWebhooks(ctx context.Context, input RequestReplayWebhooks) (ResponseReplayWebhooks, error) {
+	var output ResponseReplayWebhooks
+	err := client.send(ctx, false, func() *gorequest.Request { return client.ReplayWebhooksRequest(input, &output) })
+	if err != nil {
+		return ResponseReplayWebhooks{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) CreateMerchantRequest(input RequestCreateMerchant, output *Merchant, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationCreateMerchant,
+		Method: http.MethodPost,
+		Path:   EndpointCreateMerchant,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+func (client Client) CreateMerchant(ctx context.Context, input RequestCreateMerchant) (Merchant, error) {
+	var output Merchant
+	err := client.send(ctx, false, func() *gorequest.Request { return client.CreateMerchantRequest(input, &output) })
+	if err != nil {
+		return Merchant{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) ListMerchantsRequest(output *[]Merchant, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationListMerchants,
+		Method: http.MethodGet,
+		Path:   EndpointListMerchants,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// ListMerchants lists all merchants, api keys bound to a merchant only get their merchant
+func (client Client) ListMerchants(ctx context.Context) ([]Merchant, error) {
+	var output []Merchant
+	err := client.send(ctx, true, func() *gorequest.Request { return client.ListMerchantsRequest(&output) })
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+func (client Client) MerchantReportRequest(input RequestMerchantReport, output *MerchantReport, opts ...gorequest.Option) *gorequest.Request {
+	query := url.Values{}
+	if input.From != nil {
+		query.Set("from", input.From.Format(time.RFC3339))
+	}
+	if input.To != nil {
+		query.Set("to", input.To.Format(time.RFC3339))
+	}
+
+	path := fmt.Sprintf(EndpointMerchantReport, url.PathEscape(input.MerchantID))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	op := gorequest.Operation{
+		Name:   OperationMerchantReport,
+		Method: http.MethodGet,
+		Path:   path,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// MerchantReport sums the payments of the merchant by type and status
+func (client Client) MerchantReport(ctx context.Context, input RequestMerchantReport) (MerchantReport, error) {
+	var output MerchantReport
+	err := client.send(ctx, true, func() *gorequest.Request { return client.MerchantReportRequest(input, &output) })
+	if err != nil {
+		return MerchantReport{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) GetMerchantRequest(id string, output *Merchant, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationGetMerchant,
+		Method: http.MethodGet,
+		Path:   fmt.Sprintf(EndpointGetMerchant, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+func (client Client) GetMerchant(ctx context.Context, id string) (Merchant, error) {
+	var output Merchant
+	err := client.send(ctx, true, func() *gorequest.Request { return client.GetMerchantRequest(id, &output) })
+	if err != nil {
+		return Merchant{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) DeleteShortCodeRequest(id string, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationDeleteShortCode,
+		Method: http.MethodDelete,
+		Path:   fmt.Sprintf(EndpointDeleteShortCode, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, nil)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// DeleteShortCode removes a shortcode, payments made with it are kept
+func (client Client) DeleteShortCode(ctx context.Context, id string) error {
+	return client.send(ctx, false, func() *gorequest.Request { return client.DeleteShortCodeRequest(id) })
+}
+
+func (client Client) RotateShortCodeCredentialsRequest(id string, input RequestRotateShortCodeCredentials, output *ShortCode, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationRotateShortCodeCredentials,
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf(EndpointRotateShortCodeCredentials, url.PathEscape(id)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// RotateShortCodeCredentials replaces the credentials that are set in the input, others
+// are kept
+func (client Client) RotateShortCodeCredentials(ctx context.Context, id string, input RequestRotateShortCodeCredentials) (ShortCode, error) {
+	var output ShortCode
+	err := client.send(ctx, false, func() *gorequest.Request {
+		return client.RotateShortCodeCredentialsRequest(id, input, &output)
+	})
+	if err != nil {
+		return ShortCode{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) paymentRequest(name, path string, input RequestPayment, output *PaymentResponse, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   name,
+		Method: http.MethodPost,
+		Path:   path,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// pay makes the payment built by build, every attempt is sent with the same idempotency id.
+// The payment is only sent again after errors returned before the api saved it. A payment
+// rejected as a duplicate, e.g. made again after it failed once saved, returns the payment
+// made with the idempotency id.
+func (client Client) pay(ctx context.Context, input RequestPayment, build func(RequestPayment, *PaymentResponse, ...gorequest.Option) *gorequest.Request) (PaymentResponse, error) {
+	if input.IdempotencyID == "" {
+		input.IdempotencyID = newIdempotencyID()
+	}
+
+	var output PaymentResponse
+	err := client.retry(ctx, unsaved, func() *gorequest.Request { return build(input, &output) })
+	if errors.Is(err, ErrDuplicate) {
+		return client.made(ctx, input, err)
+	}
+	if err != nil {
+		return PaymentResponse{}, err
+	}
+
+	return output, nil
+}
+
+// made finds the payment made with the idempotency id of the input, the duplicate error
+// is returned if it is not found. Idempotency ids are unique for each merchant, so the
+// payment is only looked up for inputs with a merchant id.
+func (client Client) made(ctx context.Context, input RequestPayment, duplicate error) (PaymentResponse, error) {
+	if input.MerchantID == "" {
+		return PaymentResponse{}, duplicate
+	}
+
+	payment, err := client.PaymentStatus(ctx, RequestPaymentStatus{IdempotencyID: input.IdempotencyID})
+	if err != nil {
+		return PaymentResponse{}, fmt.Errorf("%w, the payment could not be found: %w", duplicate, err)
+	}
+	// api keys not bound to a merchant find the payments of every merchant
+	if payment.MerchantID != input.MerchantID {
+		return PaymentResponse{}, duplicate
+	}
+
+	return PaymentResponse{PaymentID: payment.PaymentID, TransactionID: payment.ClientTransactionID, Status: payment.Status}, nil
+}
+
+func (client Client) ChargeRequest(input RequestPayment, output *PaymentResponse, opts ...gorequest.Option) *gorequest.Request {
+	return client.paymentRequest(OperationCharge, EndpointCharge, input, output, opts...)
+}
+
+// Charge sends an stk push to the phone number of the customer to pay the amount
+func (client Client) Charge(ctx context.Context, input RequestPayment) (PaymentResponse, error) {
+	return client.pay(ctx, input, client.ChargeRequest)
+}
+
+func (client Client) PayoutRequest(input RequestPayment, output *PaymentResponse, opts ...gorequest.Option) *gorequest.Request {
+	return client.paymentRequest(OperationPayout, EndpointPayout, input, output, opts...)
+}
+
+// Payout pays the amount to the phone number of the customer
+func (client Client) Payout(ctx context.Context, input RequestPayment) (PaymentResponse, error) {
+	return client.pay(ctx, input, client.PayoutRequest)
+}
+
+func (client Client) TransferRequest(input RequestPayment, output *PaymentResponse, opts ...gorequest.Option) *gorequest.Request {
+	return client.paymentRequest(OperationTransfer, EndpointTransfer, input, output, opts...)
+}
+
+// Transfer pays the amount to a till or paybill
+func (client Client) Transfer(ctx context.Context, input RequestPayment) (PaymentResponse, error) {
+	return client.pay(ctx, input, client.TransferRequest)
+}
+
+func (client Client) PaymentStatusRequest(input RequestPaymentStatus, output *Payment, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationPaymentStatus,
+		Method: http.MethodPost,
+		Path:   EndpointPaymentStatus,
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, input, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// PaymentStatus finds a payment by its payment id, transaction id or payment reference
+func (client Client) PaymentStatus(ctx context.Context, input RequestPaymentStatus) (Payment, error) {
+	var output Payment
+	err := client.send(ctx, true, func() *gorequest.Request { return client.PaymentStatusRequest(input, &output) })
+	if err != nil {
+		return Payment{}, err
+	}
+
+	return output, nil
+}
+
+func (client Client) PaymentRequestsRequest(paymentID string, output *[]PartnerRequest, opts ...gorequest.Option) *gorequest.Request {
+	op := gorequest.Operation{
+		Name:   OperationPaymentRequests,
+		Method: http.MethodGet,
+		Path:   fmt.Sprintf(EndpointPaymentRequests, url.PathEscape(paymentID)),
+	}
+
+	cfg := gorequest.Config{Endpoint: client.endpoint}
+	req := gorequest.New(cfg, op, client.Hooks, nil, nil, output)
+	req.ApplyOptions(opts...)
+
+	return req
+}
+
+// PaymentRequests lists the requests made to partners for a payment, oldest first
+func (client Client) PaymentRequests(ctx context.Context, paymentID string) ([]PartnerRequest, error) {
+	var output []PartnerRequest
+	err := client.send(ctx, true, func() *gorequest.Request { return client.PaymentRequestsRequest(paymentID, &output) })
+	if err != nil {
+		return nil, err
+	}
 
-	return req.Send()
+	return output, nil
 }
@@ -0,0 +1,406 @@
+package sdk_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/sdk"
+)
+
+func TestClient_Errors(t *testing.T) {
+	tcs := map[string]struct {
+		status     int
+		headers    map[string]string
+		body       string
+		target     error
+		message    string
+		details    string
+		retryAfter time.Duration
+	}{
+		"test validation error": {
+			status:  http.StatusBadRequest,
+			body:    `{"error":"validation failed","details":{"amount":"required"}}`,
+			target:  sdk.ErrValidation,
+			message: "validation failed",
+			details: `{"amount":"required"}`,
+		},
+		"test unauthorized": {
+			status:  http.StatusUnauthorized,
+			body:    `{"error":"invalid signature"}`,
+			target:  sdk.ErrUnauthorized,
+			message: "invalid signature",
+		},
+		"test forbidden": {
+			status:  http.StatusForbidden,
+			body:    `{"error":"api key does not have scope payments:write"}`,
+			target:  sdk.ErrForbidden,
+			message: "api key does not have scope payments:write",
+		},
+		"test not found without a body": {
+			status: http.StatusNotFound,
+			target: sdk.ErrNotFound,
+		},
+		"test duplicate": {
+			status: http.StatusConflict,
+			target: sdk.ErrDuplicate,
+		},
+		"test limit exceeded": {
+			status:     http.StatusTooManyRequests,
+			headers:    map[string]string{"Retry-After": "60"},
+			body:       `{"error":"rate limit exceeded"}`,
+			target:     sdk.ErrLimitExceeded,
+			message:    "rate limit exceeded",
+			retryAfter: time.Minute,
+		},
+		"test unavailable": {
+			status:     http.StatusServiceUnavailable,
+			headers:    map[string]string{"Retry-After": "45"},
+			body:       `{"error":"shortcode unavailable"}`,
+			target:     sdk.ErrUnavailable,
+			message:    "shortcode unavailable",
+			retryAfter: 45 * time.Second,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			requestID := requestid.New()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(requestid.Header, requestID)
+				for key, value := range tc.headers {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+
+			// retries would wait for the retry after durations
+			client := sdk.New(sdk.Config{Endpoint: server.URL, MaxRetries: -1})
+
+			_, err := client.GetMerchant(t.Context(), "01JB2M9G3D4E5F6G7H8J9K0M1N")
+			assert.ErrorIs(t, err, tc.target)
+
+			var e sdk.Error
+			if assert.ErrorAs(t, err, &e) {
+				assert.Equal(t, tc.status, e.StatusCode)
+				assert.Equal(t, tc.message, e.Message)
+				assert.Equal(t, requestID, e.RequestID)
+				assert.Equal(t, tc.retryAfter, e.RetryAfter)
+				if tc.details != "" {
+					assert.JSONEq(t, tc.details, string(e.Details))
+				}
+			}
+		})
+	}
+
+	t.Run("test that errors are not matched by other sentinels", func(t *testing.T) {
+		err := sdk.Error{StatusCode: http.StatusNotFound}
+		assert.ErrorIs(t, err, sdk.ErrNotFound)
+		assert.False(t, errors.Is(err, sdk.ErrDuplicate))
+		assert.True(t, err.NotFound())
+		assert.False(t, err.Temporary())
+		assert.EqualError(t, sdk.Error{StatusCode: http.StatusConflict, Message: "duplicate", RequestID: "abc"},
+			"payments api: 409 Conflict: duplicate (request id abc)")
+	})
+}
+
+func TestClient_Retries(t *testing.T) {
+	// responds with the status until it has been called n times, then with the body
+	failTimes := func(n int32, status int, body string, calls *atomic.Int32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= n {
+				w.WriteHeader(status)
+				_, _ = fmt.Fprint(w, `{"error":"unavailable"}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, body)
+		}
+	}
+
+	t.Run("test that safe operations are retried after temporary errors", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(failTimes(2, http.StatusServiceUnavailable, `{"id":"01JB2M9G3D4E5F6G7H8J9K0M1N"}`, &calls))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		merchant, err := client.GetMerchant(t.Context(), "01JB2M9G3D4E5F6G7H8J9K0M1N")
+		assert.Nil(t, err)
+		assert.Equal(t, "01JB2M9G3D4E5F6G7H8J9K0M1N", merchant.MerchantID)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("test that the retry after duration is waited", func(t *testing.T) {
+		var calls atomic.Int32
+		var first time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				first = time.Now()
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			assert.GreaterOrEqual(t, time.Since(first), time.Second)
+			_, _ = fmt.Fprint(w, `[]`)
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.ListMerchants(t.Context())
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("test that the last error is returned after the max retries", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(failTimes(10, http.StatusBadGateway, `[]`, &calls))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, MaxRetries: 2, RetryDelay: time.Millisecond})
+
+		_, err := client.ListShortCodes(t.Context(), sdk.RequestListShortCodes{})
+		assert.ErrorIs(t, err, sdk.ErrUnavailable)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("test that unsafe operations are not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(failTimes(1, http.StatusServiceUnavailable, `{}`, &calls))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.CreateMerchant(t.Context(), sdk.RequestCreateMerchant{Name: "Acme"})
+		assert.ErrorIs(t, err, sdk.ErrUnavailable)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("test that errors that are not temporary are not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(failTimes(1, http.StatusBadRequest, `{}`, &calls))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.PaymentStatus(t.Context(), sdk.RequestPaymentStatus{PaymentID: "01JB2M5A4K7V8Q3R6T9W0X1Y2Z"})
+		assert.ErrorIs(t, err, sdk.ErrValidation)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestClient_Payments(t *testing.T) {
+	t.Run("test that a generated idempotency id is sent with every attempt", func(t *testing.T) {
+		var ids []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, sdk.EndpointPayout, r.URL.Path)
+
+			var req sdk.RequestPayment
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+			ids = append(ids, req.IdempotencyID)
+
+			// rate limited before the payment is saved
+			if len(ids) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"payment_id":"01JB2M5A4K7V8Q3R6T9W0X1Y2Z","transaction_id":%q,"status":"received"}`, req.TransactionID)
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		payment, err := client.Payout(t.Context(), sdk.RequestPayment{TransactionID: "refund-7", Amount: "100", ExternalAccountID: "254712345678"})
+		assert.Nil(t, err)
+		assert.Equal(t, sdk.PaymentResponse{PaymentID: "01JB2M5A4K7V8Q3R6T9W0X1Y2Z", TransactionID: "refund-7", Status: sdk.StatusReceived}, payment)
+		if assert.Len(t, ids, 2) {
+			assert.Equal(t, ids[0], ids[1])
+			_, err = uuid.FromString(ids[0])
+			assert.Nil(t, err)
+		}
+	})
+
+	t.Run("test that payments are retried only after errors returned before they are saved", func(t *testing.T) {
+		tcs := map[string]struct {
+			status  int
+			headers map[string]string
+			calls   int32
+		}{
+			"test rate limited":                     {status: http.StatusTooManyRequests, calls: 2},
+			"test breaker open":                     {status: http.StatusServiceUnavailable, headers: map[string]string{"Retry-After": "1"}, calls: 2},
+			"test unavailable after the save":       {status: http.StatusServiceUnavailable, calls: 1},
+			"test bad gateway":                      {status: http.StatusBadGateway, calls: 1},
+			"test gateway timeout":                  {status: http.StatusGatewayTimeout, calls: 1},
+			"test internal error after the save":    {status: http.StatusInternalServerError, calls: 1},
+			"test validation error before the save": {status: http.StatusBadRequest, calls: 1},
+		}
+
+		for name, tc := range tcs {
+			t.Run(name, func(t *testing.T) {
+				var calls atomic.Int32
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if calls.Add(1) == 1 {
+						for key, value := range tc.headers {
+							w.Header().Set(key, value)
+						}
+						w.WriteHeader(tc.status)
+						return
+					}
+					_, _ = fmt.Fprint(w, `{"payment_id":"01JB2M5A4K7V8Q3R6T9W0X1Y2Z","status":"sent"}`)
+				}))
+				defer server.Close()
+
+				client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+				_, _ = client.Charge(t.Context(), sdk.RequestPayment{Amount: "100", ExternalAccountID: "254712345678"})
+				assert.Equal(t, tc.calls, calls.Load())
+			})
+		}
+	})
+
+	t.Run("test that a payment saved before an error is returned when it is made again", func(t *testing.T) {
+		// behaves like the api: the payment is saved before the partner is called, the
+		// partner call fails, and a payment with a saved idempotency id is a duplicate
+		var charges atomic.Int32
+		saved := make(map[string]sdk.Payment)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case sdk.EndpointCharge:
+				charges.Add(1)
+				var req sdk.RequestPayment
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+
+				if _, ok := saved[req.IdempotencyID]; ok {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				saved[req.IdempotencyID] = sdk.Payment{
+					PaymentID:           "01JB2M5A4K7V8Q3R6T9W0X1Y2Z",
+					MerchantID:          req.MerchantID,
+					ClientTransactionID: req.TransactionID,
+					IdempotencyID:       req.IdempotencyID,
+					Status:              sdk.StatusReceived,
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case sdk.EndpointPaymentStatus:
+				var req sdk.RequestPaymentStatus
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+
+				payment, ok := saved[req.IdempotencyID]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(payment)
+			}
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+		input := sdk.RequestPayment{MerchantID: "merchant-1", TransactionID: "order-1024", IdempotencyID: "charge-1", Amount: "250", ExternalAccountID: "254712345678"}
+
+		// the failed attempt is not retried, the payment may have been made
+		_, err := client.Charge(t.Context(), input)
+		assert.ErrorIs(t, err, sdk.ErrUnavailable)
+		assert.Equal(t, int32(1), charges.Load())
+
+		// the caller makes the payment again and gets the saved payment
+		payment, err := client.Charge(t.Context(), input)
+		assert.Nil(t, err)
+		assert.Equal(t, sdk.PaymentResponse{PaymentID: "01JB2M5A4K7V8Q3R6T9W0X1Y2Z", TransactionID: "order-1024", Status: sdk.StatusReceived}, payment)
+		assert.Equal(t, int32(2), charges.Load())
+		assert.Len(t, saved, 1)
+	})
+
+	t.Run("test that a duplicate is returned if the payment is not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == sdk.EndpointPaymentStatus {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.Payout(t.Context(), sdk.RequestPayment{MerchantID: "merchant-1", IdempotencyID: "payout-1", Amount: "100", ExternalAccountID: "254712345678"})
+		assert.ErrorIs(t, err, sdk.ErrDuplicate)
+		assert.ErrorIs(t, err, sdk.ErrNotFound)
+	})
+
+	t.Run("test that the payment is not looked up without a merchant id", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NotEqual(t, sdk.EndpointPaymentStatus, r.URL.Path)
+			w.WriteHeader(http.StatusConflict)
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.Payout(t.Context(), sdk.RequestPayment{IdempotencyID: "payout-1", Amount: "100", ExternalAccountID: "254712345678"})
+		assert.ErrorIs(t, err, sdk.ErrDuplicate)
+		assert.False(t, errors.Is(err, sdk.ErrNotFound))
+	})
+
+	t.Run("test that the idempotency id of the caller is kept", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == sdk.EndpointPaymentStatus {
+				var req sdk.RequestPaymentStatus
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "transfer-9", req.IdempotencyID)
+
+				// the payment of another merchant with the same idempotency id
+				_, _ = fmt.Fprint(w, `{"PaymentID":"01JB2M5A4K7V8Q3R6T9W0X1Y2Z","MerchantID":"merchant-2","IdempotencyID":"transfer-9"}`)
+				return
+			}
+			assert.Equal(t, sdk.EndpointTransfer, r.URL.Path)
+
+			var req sdk.RequestPayment
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "transfer-9", req.IdempotencyID)
+			assert.Equal(t, sdk.AccountTypePaybill, req.ExternalAccountType)
+
+			w.WriteHeader(http.StatusConflict)
+		}))
+		defer server.Close()
+
+		client := sdk.New(sdk.Config{Endpoint: server.URL, RetryDelay: time.Millisecond})
+
+		_, err := client.Transfer(t.Context(), sdk.RequestPayment{
+			MerchantID:          "merchant-1",
+			IdempotencyID:       "transfer-9",
+			Amount:              "1000",
+			ExternalAccountType: sdk.AccountTypePaybill,
+			ExternalAccountID:   "888880",
+			Beneficiary:         "1234",
+		})
+		assert.ErrorIs(t, err, sdk.ErrDuplicate)
+	})
+}
+
+func TestClient_RequestID(t *testing.T) {
+	id := requestid.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, id, r.Header.Get(requestid.Header))
+		_, _ = fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	client := sdk.New(sdk.Config{Endpoint: server.URL})
+
+	requests, err := client.PaymentRequests(requestid.WithContext(t.Context(), id), "01JB2M5A4K7V8Q3R6T9W0X1Y2Z")
+	assert.Nil(t, err)
+	assert.Empty(t, requests)
+}
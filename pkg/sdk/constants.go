@@ -1,9 +1,60 @@
 package sdk
 
 const (
-	OperationAddShortCode = "add_short_code"
+	OperationAddShortCode               = "add_short_code"
+	OperationListShortCodes             = "list_short_codes"
+	OperationGetShortCode               = "get_short_code"
+	OperationUpdateShortCode            = "update_short_code"
+	OperationEnableShortCode            = "enable_short_code"
+	OperationDisableShortCode           = "disable_short_code"
+	OperationReplayWebhooks             = "replay_webhooks"
+	OperationCreateMerchant             = "create_merchant"
+	OperationListMerchants              = "list_merchants"
+	OperationMerchantReport             = "merchant_report"
+	OperationGetMerchant                = "get_merchant"
+	OperationDeleteShortCode            = "delete_short_code"
+	OperationRotateShortCodeCredentials = "rotate_short_code_credentials"
+	OperationCharge                     = "charge"
+	OperationPayout                     = "payout"
+	OperationTransfer                   = "transfer"
+	OperationPaymentStatus              = "payment_status"
+	OperationPaymentRequests            = "payment_requests"
 )
 
 const (
-	EndpointAddShortCode = "/api/mpesa/shortcode"
+	EndpointAddShortCode               = "/api/mpesa/shortcode"
+	EndpointListShortCodes             = "/api/mpesa/shortcode"
+	EndpointGetShortCode               = "/api/mpesa/shortcode/%s"
+	EndpointUpdateShortCode            = "/api/mpesa/shortcode/%s"
+	EndpointEnableShortCode            = "/api/mpesa/shortcode/%s/enable"
+	EndpointDisableShortCode           = "/api/mpesa/shortcode/%s/disable"
+	EndpointReplayWebhooks             = "/api/admin/webhooks/replay"
+	EndpointCreateMerchant             = "/api/merchants"
+	EndpointListMerchants              = "/api/merchants"
+	EndpointMerchantReport             = "/api/merchants/%s/report"
+	EndpointGetMerchant                = "/api/merchants/%s"
+	EndpointDeleteShortCode            = "/api/mpesa/shortcode/%s"
+	EndpointRotateShortCodeCredentials = "/api/mpesa/shortcode/%s/credentials"
+	EndpointCharge                     = "/api/mpesa/charge"
+	EndpointPayout                     = "/api/mpesa/payout"
+	EndpointTransfer                   = "/api/mpesa/transfer"
+	EndpointPaymentStatus              = "/api/mpesa/status"
+	EndpointPaymentRequests            = "/api/mpesa/payments/%s/requests"
+)
+
+// statuses of a payment and of the requests made to partners
+const (
+	StatusReceived  = "received"
+	StatusSent      = "sent"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusError     = "error"
+	StatusTimeout   = "timeout"
+	StatusDeclined  = "declined"
+)
+
+// account types of the beneficiary of a transfer
+const (
+	AccountTypeTill    = "till"
+	AccountTypePaybill = "paybill"
 )
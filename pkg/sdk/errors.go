@@ -0,0 +1,120 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+// errors matched by an Error with errors.Is, by the status code of the response
+var (
+	// 400, the request is invalid, e.g. a required field is missing
+	ErrValidation = errors.New("validation failed")
+	// 401, the api key or the request signature is invalid
+	ErrUnauthorized = errors.New("unauthorized")
+	// 403, the api key does not have the scope of the operation or the merchant
+	ErrForbidden = errors.New("forbidden")
+	// 404, the payment, shortcode or merchant does not exist
+	ErrNotFound = errors.New("not found")
+	// 409, e.g. a payment with the idempotency id already exists
+	ErrDuplicate = errors.New("duplicate")
+	// 429, a rate limit of the api key, phone number or shortcode is exceeded
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// 502, 503 and 504, e.g. the circuit breaker of the shortcodes is open
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// Error is an error response of the api
+type Error struct {
+	StatusCode int
+	// message of the error, empty for responses without a body
+	Message string
+	// details of validation errors
+	Details json.RawMessage
+	// id of the api request, to find it in the logs of the api
+	RequestID string
+	// duration to wait before retrying, set for rate limited and unavailable responses
+	RetryAfter time.Duration
+}
+
+func (e Error) Error() string {
+	msg := fmt.Sprintf("payments api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id %s)", e.RequestID)
+	}
+	return msg
+}
+
+// Is reports whether the error is one of the errors of its status code
+func (e Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrValidation
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrDuplicate
+	case http.StatusTooManyRequests:
+		return target == ErrLimitExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return target == ErrUnavailable
+	}
+	return false
+}
+
+func (e Error) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+func (e Error) Duplicate() bool {
+	return e.StatusCode == http.StatusConflict
+}
+
+// Temporary reports whether the request may succeed if it is retried
+func (e Error) Temporary() bool {
+	return errors.Is(e, ErrLimitExceeded) || errors.Is(e, ErrUnavailable)
+}
+
+// errorBody is the body of error responses
+type errorBody struct {
+	Error   string          `json:"error"`
+	Details json.RawMessage `json:"details"`
+}
+
+// decodeErrorResponse sets an Error as the request error for responses with an error status
+var decodeErrorResponse = gorequest.Hook{Name: "sdk.DecodeErrorResponse", Fn: func(r *gorequest.Request) {
+	if r.Error != nil || r.Response == nil || r.Response.StatusCode < http.StatusBadRequest {
+		return
+	}
+
+	e := Error{StatusCode: r.Response.StatusCode, RequestID: r.Response.Header.Get(requestid.Header)}
+	if seconds, err := strconv.Atoi(r.Response.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	// the body is optional, e.g. not found responses have none
+	if r.Response.Body != nil {
+		var body errorBody
+		if err := json.NewDecoder(io.LimitReader(r.Response.Body, 1<<20)).Decode(&body); err == nil {
+			e.Message = body.Error
+			e.Details = body.Details
+		}
+	}
+
+	r.Error = e
+}}
@@ -0,0 +1,93 @@
+package sdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/SirWaithaka/payments-api/pkg/sdk"
+)
+
+func ExampleClient_Charge() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+sdk.EndpointCharge, func(w http.ResponseWriter, r *http.Request) {
+		var req sdk.RequestPayment
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sdk.PaymentResponse{
+			PaymentID:     "01JB2M5A4K7V8Q3R6T9W0X1Y2Z",
+			TransactionID: req.TransactionID,
+			Status:        sdk.StatusReceived,
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := sdk.New(sdk.Config{Endpoint: server.URL})
+
+	// the idempotency id is generated, and kept when the charge is retried
+	payment, err := client.Charge(context.Background(), sdk.RequestPayment{
+		TransactionID:     "order-1024",
+		Amount:            "250",
+		ExternalAccountID: "254712345678",
+		Description:       "order 1024",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(payment.PaymentID, payment.TransactionID, payment.Status)
+	// Output: 01JB2M5A4K7V8Q3R6T9W0X1Y2Z order-1024 received
+}
+
+func ExampleClient_PaymentStatus() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+sdk.EndpointPaymentStatus, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"PaymentID":"01JB2M5A4K7V8Q3R6T9W0X1Y2Z","Type":"charge","ClientTransactionID":"order-1024",`+
+			`"PaymentReference":"TJ4ABCD123","Amount":"250","Status":"succeeded"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := sdk.New(sdk.Config{Endpoint: server.URL})
+
+	payment, err := client.PaymentStatus(context.Background(), sdk.RequestPaymentStatus{TransactionID: "order-1024"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(payment.Type, payment.PaymentReference, payment.Status)
+	// Output: charge TJ4ABCD123 succeeded
+}
+
+func ExampleError() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/mpesa/shortcode/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "01JB2M8F2C3D4E5F6G7H8J9K0M")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := sdk.New(sdk.Config{Endpoint: server.URL})
+
+	_, err := client.GetShortCode(context.Background(), "01JB2M6B5L8W9R4S7U0X1Y2Z3A")
+	if errors.Is(err, sdk.ErrNotFound) {
+		fmt.Println("shortcode not found")
+	}
+
+	var e sdk.Error
+	if errors.As(err, &e) {
+		fmt.Println(e.StatusCode, e.RequestID)
+	}
+	// Output:
+	// shortcode not found
+	// 404 01JB2M8F2C3D4E5F6G7H8J9K0M
+}
@@ -1,6 +1,13 @@
 package sdk
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type RequestAddShortCode struct {
+	// merchant that owns the shortcode, not required for api keys bound to a merchant
+	MerchantID        string `json:"merchant_id,omitempty"`
 	Environment       string `json:"environment"`
 	Service           string `json:"service"`
 	Type              string `json:"type"`
@@ -10,4 +17,191 @@ type RequestAddShortCode struct {
 	Key               string `json:"key"`
 	Secret            string `json:"secret"`
 	Passphrase        string `json:"passphrase"`
+	Priority          uint   `json:"priority,omitempty"`
+	CallbackURL       string `json:"callback_url,omitempty"`
+}
+
+type RequestListShortCodes struct {
+	MerchantID string
+	Service    string
+	Type       string
+	ShortCode  string
+	// list only enabled or disabled shortcodes, all are listed if nil
+	Disabled *bool
+}
+
+type RequestUpdateShortCode struct {
+	Environment *string `json:"environment,omitempty"`
+	Priority    *uint   `json:"priority,omitempty"`
+	CallbackURL *string `json:"callback_url,omitempty"`
+}
+
+// ShortCode is a shortcode configuration, secrets are redacted by the api
+type ShortCode struct {
+	ShortCodeID       string `json:"id"`
+	MerchantID        string `json:"merchant_id"`
+	Environment       string `json:"environment"`
+	ShortCode         string `json:"shortcode"`
+	Priority          uint   `json:"priority"`
+	Service           string `json:"service"`
+	Type              string `json:"type"`
+	InitiatorName     string `json:"initiator_name"`
+	InitiatorPassword string `json:"initiator_password"`
+	Passphrase        string `json:"passphrase"`
+	Key               string `json:"key"`
+	Secret            string `json:"secret"`
+	CallbackURL       string `json:"callback_url"`
+	CallbackToken     string `json:"callback_token"`
+	Disabled          bool   `json:"disabled"`
+}
+
+type RequestReplayWebhooks struct {
+	IDs     []string   `json:"ids,omitempty"`
+	Partner string     `json:"partner,omitempty"`
+	Action  string     `json:"action,omitempty"`
+	From    *time.Time `json:"from,omitempty"`
+	To      *time.Time `json:"to,omitempty"`
+	Limit   int        `json:"limit,omitempty"`
+	DryRun  bool       `json:"dry_run"`
+}
+
+type PaymentUpdate struct {
+	PaymentID        string `json:"payment_id"`
+	Status           string `json:"status,omitempty"`
+	PaymentReference string `json:"payment_reference,omitempty"`
+}
+
+type ReplayedWebhook struct {
+	WebhookID     string         `json:"webhook_id"`
+	Partner       string         `json:"partner"`
+	Action        string         `json:"action"`
+	Replayed      bool           `json:"replayed"`
+	Skipped       string         `json:"skipped,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	PaymentUpdate *PaymentUpdate `json:"payment_update,omitempty"`
+}
+
+type ResponseReplayWebhooks struct {
+	DryRun   bool              `json:"dry_run"`
+	Webhooks []ReplayedWebhook `json:"webhooks"`
+}
+
+type RequestCreateMerchant struct {
+	Name string `json:"name"`
+}
+
+type Merchant struct {
+	MerchantID string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type RequestMerchantReport struct {
+	MerchantID string
+	// report payments created at or after From and before To
+	From *time.Time
+	To   *time.Time
+}
+
+type MerchantReportTotal struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+	Amount string `json:"amount"`
+}
+
+type MerchantReport struct {
+	MerchantID string                `json:"merchant_id"`
+	From       *time.Time            `json:"from,omitempty"`
+	To         *time.Time            `json:"to,omitempty"`
+	Totals     []MerchantReportTotal `json:"totals"`
+}
+
+type RequestRotateShortCodeCredentials struct {
+	InitiatorName     string `json:"initiator_name,omitempty"`
+	InitiatorPassword string `json:"initiator_password,omitempty"`
+	Passphrase        string `json:"passphrase,omitempty"`
+	Key               string `json:"key,omitempty"`
+	Secret            string `json:"secret,omitempty"`
+	// generate a new token partners send webhooks with
+	RotateCallbackToken bool `json:"rotate_callback_token"`
+}
+
+// RequestPayment is a charge, payout or transfer
+type RequestPayment struct {
+	// merchant the payment is made for, not required for api keys bound to a merchant
+	MerchantID string `json:"merchant_id,omitempty"`
+	// id of the payment in the system of the caller, for reconciliation. Need not be unique
+	TransactionID string `json:"transaction_id"`
+	// unique id of the payment for the merchant, a payment with an id that has been used
+	// returns the payment made with it if the merchant id is set. Generated if empty, set
+	// it to retry a payment after a restart
+	IdempotencyID string `json:"idempotency_id"`
+	Amount        string `json:"amount"`
+	// account type of the beneficiary of a transfer, till or paybill
+	ExternalAccountType string `json:"external_account_type,omitempty"`
+	// phone number charged or paid, or the till or paybill of a transfer
+	ExternalAccountID string `json:"external_account_id"`
+	// account number of the beneficiary of a transfer
+	Beneficiary string `json:"beneficiary,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PaymentResponse is a payment accepted by the api, its status changes once the partner
+// sends the result
+type PaymentResponse struct {
+	PaymentID     string `json:"payment_id"`
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+}
+
+// RequestPaymentStatus finds a payment by one of its ids
+type RequestPaymentStatus struct {
+	PaymentID        string `json:"payment_id,omitempty"`
+	TransactionID    string `json:"transaction_id,omitempty"`
+	PaymentReference string `json:"payment_reference,omitempty"`
+	IdempotencyID    string `json:"idempotency_id,omitempty"`
+}
+
+// Payment is a payment returned by the status endpoint, which keys its fields by their
+// names in the api
+type Payment struct {
+	PaymentID  string `json:"PaymentID"`
+	MerchantID string `json:"MerchantID"`
+	// charge, payout or transfer
+	Type                string `json:"Type"`
+	ClientTransactionID string `json:"ClientTransactionID"`
+	IdempotencyID       string `json:"IdempotencyID"`
+	// reference of the payment from the partner
+	PaymentReference         string    `json:"PaymentReference"`
+	Amount                   string    `json:"Amount"`
+	SourceAccountNumber      string    `json:"SourceAccountNumber"`
+	DestinationAccountNumber string    `json:"DestinationAccountNumber"`
+	Beneficiary              string    `json:"Beneficiary"`
+	Description              string    `json:"Description"`
+	ShortCodeID              string    `json:"ShortCodeID"`
+	Status                   string    `json:"Status"`
+	CreatedAt                time.Time `json:"CreatedAt"`
+	// id of the api request that created the payment
+	RequestID string `json:"RequestID"`
+}
+
+// PartnerRequest is a request made to a partner for a payment, the request body has
+// secrets and phone numbers redacted
+type PartnerRequest struct {
+	RequestID       string            `json:"request_id"`
+	PaymentID       string            `json:"payment_id"`
+	ExternalID      string            `json:"external_id,omitempty"`
+	OriginRequestID string            `json:"origin_request_id,omitempty"`
+	Partner         string            `json:"partner"`
+	Operation       string            `json:"operation"`
+	Status          string            `json:"status"`
+	Attempt         int               `json:"attempt"`
+	LatencyMs       int64             `json:"latency_ms"`
+	RequestBody     json.RawMessage   `json:"request_body,omitempty"`
+	HTTPStatus      int               `json:"http_status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Response        map[string]any    `json:"response,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
 }
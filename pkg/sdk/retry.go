@@ -0,0 +1,111 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/SirWaithaka/gorequest"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries of safe operations and payments if not
+	// configured
+	DefaultMaxRetries = 3
+	// DefaultRetryDelay is the delay before the first retry if not configured
+	DefaultRetryDelay = 200 * time.Millisecond
+	// maxRetryWait is the longest the client waits to retry, requests the api asks to
+	// retry later than this are not retried
+	maxRetryWait = 30 * time.Second
+)
+
+// send sends the request built by build. Safe operations are sent again after temporary
+// errors, with a new request built for each attempt.
+//
+// Operations are safe to retry when sending them twice has the effect of sending them
+// once, e.g. reads. Payments are sent with retry, see pay.
+func (client Client) send(ctx context.Context, safe bool, build func() *gorequest.Request) error {
+	if !safe {
+		return client.retry(ctx, nil, build)
+	}
+	return client.retry(ctx, temporary, build)
+}
+
+// retry sends the request built by build, and sends it again while retryable reports
+// that the error may not be returned by another attempt. The request is sent once if
+// retryable is nil.
+func (client Client) retry(ctx context.Context, retryable func(err error) bool, build func() *gorequest.Request) error {
+	var retries int
+	if retryable != nil {
+		retries = client.maxRetries
+	}
+
+	delay := client.retryDelay
+	for attempt := 0; ; attempt++ {
+		req := build()
+		req.WithContext(ctx)
+
+		err := req.Send()
+		if err == nil || attempt >= retries || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		// wait for as long as the api asks
+		wait := delay
+		var e Error
+		if errors.As(err, &e) && e.RetryAfter > wait {
+			wait = e.RetryAfter
+		}
+		if wait > maxRetryWait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// temporary reports whether the request may succeed if it is sent again, after a
+// temporary error of the api or an error sending the request
+func temporary(err error) bool {
+	var e Error
+	if errors.As(err, &e) {
+		return e.Temporary()
+	}
+
+	// the request was not sent or its response was not received
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// unsaved reports whether a payment was rejected before the api saved it, so that it
+// can be sent again. The api saves a payment before it calls the partner, a payment
+// that fails after, e.g. with a 503 or a timeout, may have been made.
+func unsaved(err error) bool {
+	var e Error
+	if errors.As(err, &e) {
+		// rate limits are checked before the payment is saved, and a payment rejected
+		// by an open breaker is unavailable with a Retry-After
+		return errors.Is(e, ErrLimitExceeded) ||
+			e.StatusCode == http.StatusServiceUnavailable && e.RetryAfter > 0
+	}
+
+	// the connection to the api was not made, e.g. it was refused
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// newIdempotencyID generates an idempotency id for a payment
+func newIdempotencyID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
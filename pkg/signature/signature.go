@@ -0,0 +1,111 @@
+// Package signature signs api requests with an api client secret. The signature is an
+// hmac-sha256 over the method, path, timestamp, nonce and body hash of the request, with
+// a signing key derived from the secret as the key. The server stores the sha256 hash of
+// the secret, which cannot sign requests, and the signing key encrypted.
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// request headers of signed requests
+const (
+	HeaderKeyID     = "X-Api-Key-Id"
+	HeaderTimestamp = "X-Api-Timestamp"
+	HeaderNonce     = "X-Api-Nonce"
+	HeaderSignature = "X-Api-Signature"
+)
+
+// ErrInvalidAPIKey is returned for api keys not in the form <key id>.<secret>
+var ErrInvalidAPIKey = errors.New("api key should be in the form <key id>.<secret>")
+
+// ParseAPIKey splits an api key into its key id and secret
+func ParseAPIKey(key string) (keyID, secret string, err error) {
+	keyID, secret, ok := strings.Cut(key, ".")
+	if !ok || keyID == "" || secret == "" {
+		return "", "", ErrInvalidAPIKey
+	}
+	return keyID, secret, nil
+}
+
+// HashSecret returns the hex encoded sha256 hash of the secret, which is stored to
+// authenticate api keys
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// signingKeyLabel separates the signing key from other values derived from the secret
+const signingKeyLabel = "payments-api request signing"
+
+// SigningKey returns the hex encoded key requests are signed with. The key is derived
+// from the secret, it cannot be derived from the hash returned by HashSecret.
+func SigningKey(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingKeyLabel))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StringToSign returns the value that is signed for a request
+func StringToSign(method, path, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), path, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// Sign returns the hex encoded signature of a request, signingKey is the value returned by SigningKey
+func Sign(signingKey, method, path, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(StringToSign(method, path, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify compares the signature of a request in constant time
+func Verify(signingKey, signature, method, path, timestamp, nonce string, body []byte) bool {
+	expected := Sign(signingKey, method, path, timestamp, nonce, body)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// NewNonce returns a random hex encoded nonce
+func NewNonce() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// SignRequest adds the signature headers to the request. The body is read and replaced.
+func SignRequest(r *http.Request, keyID, secret string, now time.Time) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		_ = r.Body.Close()
+
+		body = b
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := NewNonce()
+
+	r.Header.Set(HeaderKeyID, keyID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Sign(SigningKey(secret), r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+
+	return nil
+}
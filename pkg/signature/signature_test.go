@@ -0,0 +1,61 @@
+package signature_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/signature"
+)
+
+func TestSignRequest(t *testing.T) {
+	body := `{"amount":"10"}`
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/api/mpesa/payout?dry=true", strings.NewReader(body))
+
+	if err := signature.SignRequest(req, "pk_1", "secret", time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	// the body can still be sent
+	b, _ := io.ReadAll(req.Body)
+	assert.Equal(t, body, string(b))
+
+	assert.Equal(t, "pk_1", req.Header.Get(signature.HeaderKeyID))
+	assert.Equal(t, "1700000000", req.Header.Get(signature.HeaderTimestamp))
+	assert.NotEmpty(t, req.Header.Get(signature.HeaderNonce))
+
+	key := signature.SigningKey("secret")
+	valid := signature.Verify(key, req.Header.Get(signature.HeaderSignature), http.MethodPost, "/api/mpesa/payout?dry=true",
+		"1700000000", req.Header.Get(signature.HeaderNonce), []byte(body))
+	assert.True(t, valid)
+
+	// any change to the request invalidates the signature
+	valid = signature.Verify(key, req.Header.Get(signature.HeaderSignature), http.MethodPost, "/api/mpesa/payout?dry=true",
+		"1700000000", req.Header.Get(signature.HeaderNonce), []byte(`{"amount":"1000"}`))
+	assert.False(t, valid)
+
+	valid = signature.Verify(signature.SigningKey("other"), req.Header.Get(signature.HeaderSignature), http.MethodPost,
+		"/api/mpesa/payout?dry=true", "1700000000", req.Header.Get(signature.HeaderNonce), []byte(body))
+	assert.False(t, valid)
+
+	// the stored hash of the secret cannot verify the signature
+	valid = signature.Verify(signature.HashSecret("secret"), req.Header.Get(signature.HeaderSignature), http.MethodPost,
+		"/api/mpesa/payout?dry=true", "1700000000", req.Header.Get(signature.HeaderNonce), []byte(body))
+	assert.False(t, valid)
+}
+
+func TestParseAPIKey(t *testing.T) {
+	keyID, secret, err := signature.ParseAPIKey("pk_1.abc.def")
+	assert.Nil(t, err)
+	assert.Equal(t, "pk_1", keyID)
+	assert.Equal(t, "abc.def", secret)
+
+	for _, key := range []string{"", "pk_1", "pk_1.", ".secret"} {
+		_, _, err = signature.ParseAPIKey(key)
+		assert.ErrorIs(t, err, signature.ErrInvalidAPIKey, key)
+	}
+}
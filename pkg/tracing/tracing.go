@@ -0,0 +1,113 @@
+// Package tracing sets up the opentelemetry tracing of the api. Spans are exported by otlp
+// over http to a collector, trace context is propagated with w3c traceparent headers.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation is the name of the tracer spans of the api are created with
+const instrumentation = "github.com/SirWaithaka/payments-api"
+
+// headerTraceParent is the w3c header that carries the trace context
+const headerTraceParent = "traceparent"
+
+// Config configures how spans are exported
+type Config struct {
+	ServiceName string
+	// otlp http endpoint of the collector, e.g. http://localhost:4318. Spans are
+	// not exported if empty
+	Endpoint string
+	// ratio of new traces that are sampled, between 0 and 1
+	SampleRatio float64
+}
+
+// Setup sets the global tracer provider and propagator. The returned function flushes
+// pending spans and stops the exporter, it should be called before the process exits.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	// trace context is propagated even if spans are not exported, so that the
+	// traces of upstream callers continue through the api
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// follow the sampling decision of the caller
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the api
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Propagator returns the global propagator
+func Propagator() propagation.TextMapPropagator {
+	return otel.GetTextMapPropagator()
+}
+
+// RecordError records the error on the span and sets its status to error, a nil error
+// is not recorded
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End records the error on the span if it is not nil, then ends the span
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// TraceParent returns the w3c traceparent of the span in ctx, empty if ctx has no span
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(headerTraceParent)
+}
+
+// Link returns a link to the span of a w3c traceparent, ok is false if the traceparent
+// is empty or invalid
+func Link(traceParent string) (link trace.Link, ok bool) {
+	if traceParent == "" {
+		return trace.Link{}, false
+	}
+
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{headerTraceParent: traceParent})
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return trace.Link{}, false
+	}
+
+	return trace.Link{SpanContext: sc}, true
+}
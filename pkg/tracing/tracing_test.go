@@ -0,0 +1,42 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+func TestTraceParent(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	t.Run("test that the traceparent of the span in context is returned", func(t *testing.T) {
+		ctx := trace.ContextWithSpanContext(context.Background(), sc)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tracing.TraceParent(ctx))
+	})
+
+	t.Run("test that an empty traceparent is returned without a span", func(t *testing.T) {
+		assert.Empty(t, tracing.TraceParent(context.Background()))
+	})
+
+	t.Run("test that a link is created from a traceparent", func(t *testing.T) {
+		link, ok := tracing.Link("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		assert.True(t, ok)
+		assert.Equal(t, sc.TraceID(), link.SpanContext.TraceID())
+		assert.Equal(t, sc.SpanID(), link.SpanContext.SpanID())
+	})
+
+	t.Run("test that no link is created from an empty or invalid traceparent", func(t *testing.T) {
+		for _, traceParent := range []string{"", "invalid", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+			_, ok := tracing.Link(traceParent)
+			assert.False(t, ok, traceParent)
+		}
+	})
+}
@@ -3,31 +3,43 @@ FROM public."mpesa_shortcodes";
 
 INSERT INTO public."mpesa_shortcodes" (id, priority, environment, service, type, shortcode, initiator_name,
                                        initiator_password, passphrase,
-                                       key, secret, callback_url, created_at, updated_at)
+                                       key, secret, callback_url, callback_token, created_at, updated_at)
 VALUES ('018f7e2a-1b3c-7d4e-9f8a-2c5d6e7f8a9b', 1, 'sandbox', 'daraja', 'charge', '174379', 'testapi', 'Safaricom123!!',
         'bfb279f9aa9bdbcf158e97dd71a467cd2e0c893059b10f78e6b72ada1ed2c919',
         '7nRVPmgCrfIEseRTTmkLDDqAYAKhhS9KWx0AfYLGj9NVE2C2',
         'Cyq7VrtT1vzQAmPQV1zlrC9MZ2n6py6qqaLYzNgFAx6uDG8sTKYSVoCh8sdplZF7',
-        'https://webhook.sirwaithaka.space/webhooks/daraja', current_timestamp, null),
+        'https://webhook.sirwaithaka.space/webhooks/daraja',
+        replace(gen_random_uuid()::text, '-', '') || replace(gen_random_uuid()::text, '-', ''), current_timestamp, null),
        ('018f7e2a-2c4d-7e5f-a1b2-3d6e9f1a2b3c', 1, 'sandbox', 'daraja', 'payout', '600991', 'testapi', 'Safaricom123!!',
         'bfb279f9aa9bdbcf158e97dd71a467cd2e0c893059b10f78e6b72ada1ed2c919',
         '7nRVPmgCrfIEseRTTmkLDDqAYAKhhS9KWx0AfYLGj9NVE2C2',
         'Cyq7VrtT1vzQAmPQV1zlrC9MZ2n6py6qqaLYzNgFAx6uDG8sTKYSVoCh8sdplZF7',
-        'https://webhook.sirwaithaka.space/webhooks/daraja', current_timestamp, null),
+        'https://webhook.sirwaithaka.space/webhooks/daraja',
+        replace(gen_random_uuid()::text, '-', '') || replace(gen_random_uuid()::text, '-', ''), current_timestamp, null),
        ('018f7e2a-3d5e-7f6a-b2c3-4e7f1a2b3c4d', 1, 'sandbox', 'daraja', 'transfer', '600979', 'testapi',
         'Safaricom123!!',
         'bfb279f9aa9bdbcf158e97dd71a467cd2e0c893059b10f78e6b72ada1ed2c919',
         '7nRVPmgCrfIEseRTTmkLDDqAYAKhhS9KWx0AfYLGj9NVE2C2',
         'Cyq7VrtT1vzQAmPQV1zlrC9MZ2n6py6qqaLYzNgFAx6uDG8sTKYSVoCh8sdplZF7',
-        'https://webhook.sirwaithaka.space/webhooks/daraja', current_timestamp, null),
+        'https://webhook.sirwaithaka.space/webhooks/daraja',
+        replace(gen_random_uuid()::text, '-', '') || replace(gen_random_uuid()::text, '-', ''), current_timestamp, null),
 
        --- QUIKK shortcodes
        ('0187cecc-68a0-7900-8bca-12dfb3b978fc', 2, 'sandbox', 'quikk', 'charge', '174379', null, null, null,
         '459e9a652a6e6dfd918aeccdf488e9db',
-        'd54c2d5868650a926864510cf8f1f616', null, current_timestamp, null),
+        'd54c2d5868650a926864510cf8f1f616', null, null, current_timestamp, null),
        ('0187cecc-68a1-7900-916c-05ba965502b0', 2, 'sandbox', 'quikk', 'payout', '511382', null, null, null,
         '459e9a652a6e6dfd918aeccdf488e9db',
-        'd54c2d5868650a926864510cf8f1f616', null, current_timestamp, null),
+        'd54c2d5868650a926864510cf8f1f616', null, null, current_timestamp, null),
        ('0187cecc-68a2-7900-bd65-2a3f8183c0d2', 2, 'sandbox', 'quikk', 'transfer', '174379', null, null, null,
         '459e9a652a6e6dfd918aeccdf488e9db',
-        'd54c2d5868650a926864510cf8f1f616', null, current_timestamp, null);
+        'd54c2d5868650a926864510cf8f1f616', null, null, current_timestamp, null);
+
+-- seeded credentials are in plaintext, shortcodes are found by the hash of the key
+UPDATE public."mpesa_shortcodes"
+SET "key_hash" = encode(sha256(convert_to("key", 'UTF8')), 'hex')
+WHERE "key_id" IS NULL;
+
+UPDATE public."mpesa_shortcodes"
+SET "callback_token_issued_at" = current_timestamp
+WHERE "callback_token" IS NOT NULL;
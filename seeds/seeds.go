@@ -0,0 +1,9 @@
+// Package seeds embeds the sql seeds of test data, run with `payments seed`
+package seeds
+
+import "embed"
+
+// FS holds the seeds, named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
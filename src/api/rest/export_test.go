@@ -0,0 +1,20 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes exposes the routes of the port and the internal port of the server to tests
+func Routes(server *Server) (routes, internal []string) {
+	return paths(server.server), paths(server.internal)
+}
+
+func paths(s *http.Server) []string {
+	var out []string
+	for _, route := range s.Handler.(*gin.Engine).Routes() {
+		out = append(out, route.Method+" "+route.Path)
+	}
+	return out
+}
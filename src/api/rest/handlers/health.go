@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/SirWaithaka/payments-api/pkg/health"
+	"github.com/SirWaithaka/payments-api/src/api/rest/responses"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
+)
+
+func NewHealthHandlers(breakers circuit.Breakers, checker *health.Checker) HealthHandlers {
+	return HealthHandlers{breakers: breakers, checker: checker}
+}
+
+type HealthHandlers struct {
+	breakers circuit.Breakers
+	checker  *health.Checker
+}
+
+// Live reports that the process is serving requests, dependencies are not checked so
+// that an unavailable dependency does not restart the api
+func (handler HealthHandlers) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, responses.HealthResponse{Status: string(health.StatusUp)})
+}
+
+// Ready checks the dependencies of the api, the api is not ready and responds with
+// 503 if any of them is down
+func (handler HealthHandlers) Ready(c *gin.Context) {
+	report := handler.checker.Check(c.Request.Context())
+
+	response := responses.HealthResponse{
+		Status:     string(report.Status),
+		Components: make([]responses.ComponentResponse, 0, len(report.Components)),
+	}
+	for _, component := range report.Components {
+		response.Components = append(response.Components, responses.ComponentResponse{
+			Name:      component.Name,
+			Status:    string(component.Status),
+			LatencyMs: float64(component.Latency.Microseconds()) / 1000,
+			Error:     component.Error,
+		})
+	}
+
+	status := http.StatusOK
+	if !report.Up() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
+
+// Breakers returns the state of the circuit breakers of partner api calls. Open breakers
+// do not fail the check, the api still serves requests of other shortcodes.
+func (handler HealthHandlers) Breakers(c *gin.Context) {
+	response := make([]responses.BreakerResponse, 0)
+
+	for _, breaker := range handler.breakers.Status() {
+		response = append(response, responses.BreakerResponse{
+			Key:               breaker.Key,
+			State:             string(breaker.State),
+			Calls:             breaker.Calls,
+			ErrorRate:         breaker.ErrorRate,
+			SlowCallRate:      breaker.SlowCallRate,
+			OpenedAt:          breaker.OpenedAt,
+			RetryAfterSeconds: int(breaker.RetryAfter.Seconds()),
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/src/api/rest/requests"
+	"github.com/SirWaithaka/payments-api/src/api/rest/responses"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+)
+
+func NewMerchantHandlers(service merchants.Service) MerchantHandlers {
+	return MerchantHandlers{service: service}
+}
+
+type MerchantHandlers struct {
+	service merchants.Service
+}
+
+func (handler MerchantHandlers) Create(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("create merchant request")
+
+	var params requests.RequestCreateMerchant
+	if err := c.ShouldBindBodyWithJSON(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+
+	merchant, err := handler.service.Create(c.Request.Context(), params.Name)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, merchantResponse(merchant))
+}
+
+// List returns all merchants, clients bound to a merchant only get their merchant
+func (handler MerchantHandlers) List(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("list merchants request")
+
+	values, err := handler.service.List(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	response := make([]responses.MerchantResponse, 0, len(values))
+	for _, merchant := range values {
+		response = append(response, merchantResponse(merchant))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (handler MerchantHandlers) Get(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("get merchant request")
+
+	merchant, err := handler.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchantResponse(merchant))
+}
+
+// Report sums the payments of the merchant by type and status
+func (handler MerchantHandlers) Report(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("merchant report request")
+
+	var params requests.RequestMerchantReport
+	if err := c.ShouldBindQuery(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+
+	report, err := handler.service.Report(c.Request.Context(), merchants.OptionsReport{
+		MerchantID: c.Param("id"),
+		From:       params.From,
+		To:         params.To,
+	})
+	if errors.Is(err, merchants.ErrInvalidReportWindow) {
+		c.Status(http.StatusBadRequest)
+		_ = c.Error(err)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	response := responses.MerchantReportResponse{
+		MerchantID: report.MerchantID,
+		From:       report.From,
+		To:         report.To,
+		Totals:     make([]responses.MerchantReportTotal, 0, len(report.Totals)),
+	}
+	for _, total := range report.Totals {
+		response.Totals = append(response.Totals, responses.MerchantReportTotal(total))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func merchantResponse(merchant merchants.Merchant) responses.MerchantResponse {
+	return responses.MerchantResponse{
+		MerchantID: merchant.MerchantID,
+		Name:       merchant.Name,
+		CreatedAt:  merchant.CreatedAt,
+	}
+}
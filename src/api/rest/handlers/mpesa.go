@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -33,6 +35,7 @@ func (handler MpesaHandlers) Charge(c *gin.Context) {
 	}
 
 	payment, err := handler.service.Charge(c.Request.Context(), mpesa.PaymentRequest{
+		MerchantID:            params.MerchantID,
 		IdempotencyID:         params.IdempotencyID,
 		ClientTransactionID:   params.TransactionID,
 		Amount:                params.Amount,
@@ -63,6 +66,7 @@ func (handler MpesaHandlers) Payout(c *gin.Context) {
 	}
 
 	payment, err := handler.service.Payout(c.Request.Context(), mpesa.PaymentRequest{
+		MerchantID:            params.MerchantID,
 		IdempotencyID:         params.IdempotencyID,
 		ClientTransactionID:   params.TransactionID,
 		Amount:                params.Amount,
@@ -93,6 +97,7 @@ func (handler MpesaHandlers) Transfer(c *gin.Context) {
 	}
 
 	payment, err := handler.service.Transfer(c.Request.Context(), mpesa.PaymentRequest{
+		MerchantID:            params.MerchantID,
 		IdempotencyID:         params.IdempotencyID,
 		ClientTransactionID:   params.TransactionID,
 		Amount:                params.Amount,
@@ -135,6 +140,9 @@ func (handler MpesaHandlers) PaymentStatus(c *gin.Context) {
 	if params.PaymentReference != "" {
 		opts.PaymentReference = &params.PaymentReference
 	}
+	if params.IdempotencyID != "" {
+		opts.IdempotencyID = &params.IdempotencyID
+	}
 
 	payment, err := handler.service.Status(c.Request.Context(), opts)
 	if err != nil {
@@ -146,6 +154,49 @@ func (handler MpesaHandlers) PaymentStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, payment)
 }
 
+// PaymentRequests returns every request made to the partner for a payment, with the payload
+// sent and the response received
+func (handler MpesaHandlers) PaymentRequests(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa payment requests request")
+
+	values, err := handler.service.Requests(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	response := make([]responses.PartnerRequestResponse, 0, len(values))
+	for _, value := range values {
+		response = append(response, partnerRequestResponse(value))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func partnerRequestResponse(request requestsd.Request) responses.PartnerRequestResponse {
+	response := responses.PartnerRequestResponse{
+		RequestID:       request.RequestID,
+		PaymentID:       request.PaymentID,
+		ExternalID:      request.ExternalID,
+		OriginRequestID: request.OriginRequestID,
+		Partner:         request.Partner,
+		Operation:       request.Operation.String(),
+		Status:          request.Status.String(),
+		Attempt:         request.Attempt,
+		LatencyMs:       request.Latency.Milliseconds(),
+		HTTPStatus:      request.HTTPStatus,
+		ResponseHeaders: request.ResponseHeaders,
+		ResponseBody:    request.ResponseBody,
+		Response:        request.Response,
+		CreatedAt:       request.CreatedAt,
+	}
+	if len(request.RequestBody) > 0 {
+		response.RequestBody = json.RawMessage(request.RequestBody)
+	}
+	return response
+}
+
 func (handler MpesaHandlers) AddShortCode(c *gin.Context) {
 	l := zerolog.Ctx(c.Request.Context())
 	l.Debug().Msg("mpesa add shortcode request")
@@ -157,6 +208,7 @@ func (handler MpesaHandlers) AddShortCode(c *gin.Context) {
 	}
 
 	shortcode := mpesa.ShortCode{
+		MerchantID:        params.MerchantID,
 		Environment:       params.Environment,
 		Service:           requestsd.ToPartner(params.Service),
 		Type:              mpesa.ToPaymentType(params.Type),
@@ -166,6 +218,8 @@ func (handler MpesaHandlers) AddShortCode(c *gin.Context) {
 		Passphrase:        params.Passphrase,
 		InitiatorName:     params.InitiatorName,
 		InitiatorPassword: params.InitiatorPassword,
+		Priority:          params.Priority,
+		CallbackURL:       params.CallbackURL,
 	}
 
 	err := handler.shortcode.Add(c.Request.Context(), shortcode)
@@ -177,3 +231,194 @@ func (handler MpesaHandlers) AddShortCode(c *gin.Context) {
 	c.Status(http.StatusCreated)
 
 }
+
+func (handler MpesaHandlers) ListShortCodes(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa list shortcodes request")
+
+	var params requests.RequestListShortCodes
+	if err := c.ShouldBindQuery(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+
+	opts := mpesa.OptionsFindShortCodes{Disabled: params.Disabled}
+	if params.MerchantID != "" {
+		opts.MerchantID = &params.MerchantID
+	}
+	if params.Service != "" {
+		service := requestsd.ToPartner(params.Service)
+		opts.Service = &service
+	}
+	if params.Type != "" {
+		opts.Type = &params.Type
+	}
+	if params.ShortCode != "" {
+		opts.ShortCode = &params.ShortCode
+	}
+
+	shortcodes, err := handler.shortcode.List(c.Request.Context(), opts)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	response := make([]responses.ShortCodeResponse, 0, len(shortcodes))
+	for _, shortcode := range shortcodes {
+		response = append(response, shortCodeResponse(shortcode))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (handler MpesaHandlers) GetShortCode(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa get shortcode request")
+
+	handler.writeShortCode(c, c.Param("id"))
+}
+
+func (handler MpesaHandlers) UpdateShortCode(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa update shortcode request")
+
+	var params requests.RequestUpdateShortCode
+	if err := c.ShouldBindBodyWithJSON(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	err := handler.shortcode.Update(c.Request.Context(), id, mpesa.OptionsUpdateShortCode{
+		Environment: params.Environment,
+		Priority:    params.Priority,
+		CallbackURL: params.CallbackURL,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	handler.writeShortCode(c, id)
+}
+
+func (handler MpesaHandlers) EnableShortCode(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa enable shortcode request")
+
+	id := c.Param("id")
+	if err := handler.shortcode.Enable(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	handler.writeShortCode(c, id)
+}
+
+func (handler MpesaHandlers) DisableShortCode(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa disable shortcode request")
+
+	id := c.Param("id")
+	if err := handler.shortcode.Disable(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	handler.writeShortCode(c, id)
+}
+
+func (handler MpesaHandlers) DeleteShortCode(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa delete shortcode request")
+
+	if err := handler.shortcode.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (handler MpesaHandlers) RotateShortCodeCredentials(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("mpesa rotate shortcode credentials request")
+
+	var params requests.RequestRotateShortCodeCredentials
+	if err := c.ShouldBindBodyWithJSON(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	err := handler.shortcode.RotateCredentials(c.Request.Context(), id, mpesa.ShortCodeCredentials{
+		InitiatorName:       params.InitiatorName,
+		InitiatorPassword:   params.InitiatorPassword,
+		Passphrase:          params.Passphrase,
+		Key:                 params.Key,
+		Secret:              params.Secret,
+		RotateCallbackToken: params.RotateCallbackToken,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	handler.writeShortCode(c, id)
+}
+
+// writeShortCode fetches the shortcode and writes it with its secrets redacted
+func (handler MpesaHandlers) writeShortCode(c *gin.Context, id string) {
+	shortcode, err := handler.shortcode.Get(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shortCodeResponse(shortcode))
+}
+
+// redacted replaces the values of secrets in responses
+const redacted = "[REDACTED]"
+
+func shortCodeResponse(shortcode mpesa.ShortCode) responses.ShortCodeResponse {
+	// part of the key is shown if it is not encrypted
+	key := redact(shortcode.Key)
+	if shortcode.KeyID == "" {
+		key = mask(shortcode.Key)
+	}
+
+	return responses.ShortCodeResponse{
+		ShortCodeID:       shortcode.ShortCodeID,
+		MerchantID:        shortcode.MerchantID,
+		Environment:       shortcode.Environment,
+		ShortCode:         shortcode.ShortCode,
+		Priority:          shortcode.Priority,
+		Service:           shortcode.Service.String(),
+		Type:              shortcode.Type.String(),
+		InitiatorName:     shortcode.InitiatorName,
+		InitiatorPassword: redact(shortcode.InitiatorPassword),
+		Passphrase:        redact(shortcode.Passphrase),
+		Key:               key,
+		Secret:            redact(shortcode.Secret),
+		CallbackURL:       shortcode.CallbackURL,
+		CallbackToken:     redact(shortcode.CallbackToken),
+		Disabled:          shortcode.Disabled,
+	}
+}
+
+// redact hides a secret, empty values are left empty to show the secret is not set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// mask hides all but the last 4 characters of a key, so that keys can be told apart
+func mask(key string) string {
+	if len(key) <= 8 {
+		return redact(key)
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	restrequests "github.com/SirWaithaka/payments-api/src/api/rest/requests"
+	"github.com/SirWaithaka/payments-api/src/api/rest/responses"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
 )
@@ -28,7 +32,12 @@ func (handler WebhookHandlers) Daraja(c *gin.Context) {
 	action := c.Param("action")
 
 	// TODO: Make partner argument into type
-	err := handler.service.Confirm(c.Request.Context(), requests.NewWebhookResult("daraja", action, c.Request.Body))
+	result := requests.NewWebhookResult("daraja", action, c.Request.Body)
+	if !handler.authenticate(c, result) {
+		return
+	}
+
+	err := handler.service.Confirm(c.Request.Context(), result)
 	if err != nil {
 		l.Warn().Err(err).Msg("error processing webhook")
 		c.String(http.StatusAccepted, "accepted")
@@ -46,7 +55,12 @@ func (handler WebhookHandlers) QuikkMpesa(c *gin.Context) {
 	// get path param
 	action := c.Param("action")
 
-	err := handler.service.Confirm(c.Request.Context(), requests.NewWebhookResult("quikk", action, c.Request.Body))
+	result := requests.NewWebhookResult("quikk", action, c.Request.Body)
+	if !handler.authenticate(c, result) {
+		return
+	}
+
+	err := handler.service.Confirm(c.Request.Context(), result)
 	if err != nil {
 		l.Warn().Err(err).Msg("error processing webhook")
 		c.String(http.StatusAccepted, "accepted")
@@ -55,3 +69,91 @@ func (handler WebhookHandlers) QuikkMpesa(c *gin.Context) {
 
 	c.String(http.StatusOK, "OK")
 }
+
+// authenticate verifies the webhook was sent by the partner and writes an error
+// response if it was not. Returns true if the webhook can be processed.
+func (handler WebhookHandlers) authenticate(c *gin.Context, result *requests.WebhookResult) bool {
+	l := zerolog.Ctx(c.Request.Context())
+
+	result.Credentials = requests.WebhookCredentials{
+		SourceIP: c.ClientIP(),
+		// callback token added to the callback url when the request was sent
+		Token:         c.Query("token"),
+		Date:          c.GetHeader("Date"),
+		Authorization: c.GetHeader("Authorization"),
+	}
+
+	err := handler.service.Authenticate(c.Request.Context(), result)
+	if err == nil {
+		return true
+	}
+
+	var rejected requests.WebhookRejectedError
+	if errors.As(err, &rejected) {
+		c.String(http.StatusUnauthorized, "unauthorized")
+		return false
+	}
+
+	// the partner retries webhooks that are not accepted
+	l.Error().Err(err).Msg("error authenticating webhook")
+	c.String(http.StatusInternalServerError, "error")
+	return false
+}
+
+// Replay processes stored webhooks again, used to recover from webhook processing errors
+func (handler WebhookHandlers) Replay(c *gin.Context) {
+	l := zerolog.Ctx(c.Request.Context())
+	l.Debug().Msg("replay webhooks request")
+
+	var params restrequests.RequestReplayWebhooks
+	if err := c.ShouldBindBodyWithJSON(&params); err != nil {
+		handleRequestParsingError(c, err)
+		return
+	}
+	l.Debug().Any(logger.LData, params).Msg("params")
+
+	opts := webhooks.OptionsFindWebhooks{IDs: params.IDs, From: params.From, To: params.To, Limit: params.Limit}
+	if params.Partner != "" {
+		opts.Partner = &params.Partner
+	}
+	if params.Action != "" {
+		opts.Action = &params.Action
+	}
+
+	results, err := handler.service.Replay(c.Request.Context(), opts, params.DryRun)
+	if errors.Is(err, webhooks.ErrReplayFilterRequired) {
+		c.Status(http.StatusBadRequest)
+		_ = c.Error(err)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	response := responses.ReplayWebhooksResponse{DryRun: params.DryRun, Webhooks: make([]responses.ReplayWebhookResponse, 0, len(results))}
+	for _, result := range results {
+		webhook := responses.ReplayWebhookResponse{
+			WebhookID: result.WebhookID,
+			Partner:   result.Partner,
+			Action:    result.Action,
+			Replayed:  result.Replayed,
+			Skipped:   result.Skipped,
+		}
+		if result.Err != nil {
+			webhook.Error = result.Err.Error()
+		}
+		if update := result.Update; update != nil {
+			webhook.PaymentUpdate = &responses.PaymentUpdateResponse{PaymentID: update.PaymentID}
+			if update.Status != nil {
+				webhook.PaymentUpdate.Status = update.Status.String()
+			}
+			if update.PaymentReference != nil {
+				webhook.PaymentUpdate.PaymentReference = *update.PaymentReference
+			}
+		}
+		response.Webhooks = append(response.Webhooks, webhook)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/signature"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+)
+
+// ClientKey is the gin context key of the authenticated api client
+const ClientKey = "auth.client"
+
+// Authenticate authenticates api clients with either an api key as a bearer token, or
+// a request signed with the api key secret.
+func Authenticate(service auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		l := zerolog.Ctx(ctx)
+
+		var (
+			client auth.Client
+			err    error
+		)
+
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			client, err = service.AuthenticateKey(ctx, strings.TrimSpace(token))
+		} else if keyID := c.GetHeader(signature.HeaderKeyID); keyID != "" {
+			// the body is cached, handlers bind it from the context
+			body, e := c.GetRawData()
+			if e != nil {
+				_ = c.AbortWithError(http.StatusBadRequest, e)
+				return
+			}
+			c.Set(gin.BodyBytesKey, body)
+
+			client, err = service.AuthenticateSignature(ctx, auth.SignedRequest{
+				KeyID:     keyID,
+				Timestamp: c.GetHeader(signature.HeaderTimestamp),
+				Nonce:     c.GetHeader(signature.HeaderNonce),
+				Signature: c.GetHeader(signature.HeaderSignature),
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.RequestURI(),
+				Body:      body,
+			})
+		} else {
+			err = auth.ErrUnauthorized
+		}
+
+		if err != nil {
+			if errors.Is(err, auth.ErrUnauthorized) {
+				l.Warn().Err(err).Msg("api client not authenticated")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Set(ClientKey, client)
+
+		// add the client to the request logger
+		lctx := l.With().Str("clientId", client.ClientID)
+		if !client.Platform() {
+			// bind the request to the merchant of the client
+			ctx = merchants.WithMerchant(ctx, client.MerchantID)
+			lctx = lctx.Str("merchantId", client.MerchantID)
+		}
+		logger := lctx.Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(ctx))
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects api clients that are not granted the scope
+func RequireScope(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := c.MustGet(ClientKey).(auth.Client)
+		if !ok || !client.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": auth.ErrForbidden.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePlatform rejects api clients that are bound to a merchant
+func RequirePlatform() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, ok := c.MustGet(ClientKey).(auth.Client)
+		if !ok || !client.Platform() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": auth.ErrForbidden.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,210 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/signature"
+	"github.com/SirWaithaka/payments-api/src/api/rest/middlewares"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+)
+
+// MockRepository keeps api clients and nonces in memory
+type MockRepository struct {
+	auth.Repository
+	clients []auth.Client
+	nonces  map[string]bool
+}
+
+func (m *MockRepository) Add(ctx context.Context, client auth.Client) error {
+	client.ClientID = client.KeyID
+	m.clients = append(m.clients, client)
+	return nil
+}
+
+func (m *MockRepository) FindOne(ctx context.Context, opts auth.OptionsFindClients) (auth.Client, error) {
+	for _, client := range m.clients {
+		if opts.KeyID != nil && client.KeyID == *opts.KeyID {
+			return client, nil
+		}
+	}
+	return auth.Client{}, postgres.Error{Err: postgres.ErrNotFound}
+}
+
+func (m *MockRepository) AddNonce(ctx context.Context, keyID, nonce string, expiresAt time.Time) error {
+	if m.nonces[keyID+nonce] {
+		return postgres.Error{Err: postgres.ErrDuplicate}
+	}
+	m.nonces[keyID+nonce] = true
+	return nil
+}
+
+// MockCipher seals signing keys with a prefix, like a cipher with a master key the
+// database does not have
+type MockCipher struct{}
+
+func (MockCipher) EncryptSigningKey(client auth.Client) (auth.Client, error) {
+	client.SigningKey = "sealed:" + client.SigningKey
+	client.MasterKeyID = "k1"
+	return client, nil
+}
+
+func (MockCipher) DecryptSigningKey(client auth.Client) (string, error) {
+	return strings.TrimPrefix(client.SigningKey, "sealed:"), nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repository := &MockRepository{nonces: make(map[string]bool)}
+	service := auth.NewService(repository, MockCipher{}, time.Minute)
+	_, payout, _ := service.Create(t.Context(), "payouts", "", []auth.Scope{auth.ScopePayout})
+	_, reader, _ := service.Create(t.Context(), "reader", "", []auth.Scope{auth.ScopeRead})
+	_, shop, _ := service.Create(t.Context(), "shop", "merchant-a", []auth.Scope{auth.ScopeAdmin})
+
+	engine := gin.New()
+	group := engine.Group("/api", middlewares.Authenticate(service))
+	group.POST("/payout", middlewares.RequireScope(auth.ScopePayout), func(c *gin.Context) {
+		var body map[string]string
+		if err := c.ShouldBindBodyWithJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusOK, body)
+	})
+	group.GET("/merchant", middlewares.RequireScope(auth.ScopeRead), func(c *gin.Context) {
+		merchantID, _ := merchants.FromContext(c.Request.Context())
+		c.String(http.StatusOK, merchantID)
+	})
+	group.POST("/admin", middlewares.RequireScope(auth.ScopeAdmin), middlewares.RequirePlatform(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	signed := func(apiKey, body string, now time.Time) *http.Request {
+		keyID, secret, _ := signature.ParseAPIKey(apiKey)
+		req, _ := http.NewRequest(http.MethodPost, "/api/payout", strings.NewReader(body))
+		_ = signature.SignRequest(req, keyID, secret, now)
+		return req
+	}
+
+	t.Run("test that bearer keys are authenticated", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/payout", strings.NewReader(`{"amount":"10"}`))
+		req.Header.Set("Authorization", "Bearer "+payout.APIKey())
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, "/api/payout", nil)
+		req.Header.Set("Authorization", "Bearer "+payout.KeyID+".wrong")
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("test that signed requests are authenticated once", func(t *testing.T) {
+		req := signed(payout.APIKey(), `{"amount":"10"}`, time.Now())
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		// the handler reads the body that was signed
+		assert.JSONEq(t, `{"amount":"10"}`, w.Body.String())
+
+		// replay the same request
+		replay, _ := http.NewRequest(http.MethodPost, "/api/payout", strings.NewReader(`{"amount":"10"}`))
+		replay.Header = req.Header.Clone()
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, replay)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("test that tampered and expired signed requests are rejected", func(t *testing.T) {
+		req := signed(payout.APIKey(), `{"amount":"10"}`, time.Now())
+		tampered, _ := http.NewRequest(http.MethodPost, "/api/payout", strings.NewReader(`{"amount":"1000"}`))
+		tampered.Header = req.Header.Clone()
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, tampered)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, signed(payout.APIKey(), `{}`, time.Now().Add(-2*time.Minute)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("test that requests signed with the stored values are rejected", func(t *testing.T) {
+		keyID, _, _ := signature.ParseAPIKey(payout.APIKey())
+		stored, _ := repository.FindOne(t.Context(), auth.OptionsFindClients{KeyID: &keyID})
+
+		for _, key := range []string{stored.SecretHash, stored.SigningKey} {
+			body := `{"amount":"10"}`
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := signature.NewNonce()
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/payout", strings.NewReader(body))
+			req.Header.Set(signature.HeaderKeyID, keyID)
+			req.Header.Set(signature.HeaderTimestamp, timestamp)
+			req.Header.Set(signature.HeaderNonce, nonce)
+			req.Header.Set(signature.HeaderSignature, signature.Sign(key, http.MethodPost, "/api/payout", timestamp, nonce, []byte(body)))
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("test that clients without the scope are forbidden", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, signed(reader.APIKey(), `{}`, time.Now()))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("test that requests of merchant clients are bound to the merchant", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/merchant", nil)
+		req.Header.Set("Authorization", "Bearer "+shop.APIKey())
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "merchant-a", w.Body.String())
+
+		// platform clients are not bound to a merchant
+		req, _ = http.NewRequest(http.MethodGet, "/api/merchant", nil)
+		req.Header.Set("Authorization", "Bearer "+reader.APIKey())
+
+		w = httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("test that merchant clients are forbidden on platform routes", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+shop.APIKey())
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("test that unauthenticated requests are rejected", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/api/payout", nil)
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
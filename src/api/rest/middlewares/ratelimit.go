@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+)
+
+// RateLimit limits the requests of each api client. Requests are limited by the client ip
+// if they are not authenticated.
+func RateLimit(limiter ratelimit.Limiter, limit rate.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := ratelimit.IPKey(c.ClientIP())
+		if client, ok := c.Get(ClientKey); ok {
+			key = ratelimit.ClientKey(client.(auth.Client).ClientID)
+		}
+
+		err := limiter.Allow(c.Request.Context(), key, limit)
+		var limited ratelimit.LimitedError
+		if errors.As(err, &limited) {
+			c.Header("Retry-After", strconv.Itoa(limited.RetryAfterSeconds()))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": limited.Error()})
+			return
+		}
+		if err != nil {
+			_ = c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/api/rest/middlewares"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+)
+
+// MockLimiter allows a number of requests for each key
+type MockLimiter struct {
+	allowed map[string]int
+}
+
+func (m *MockLimiter) Allow(ctx context.Context, key string, limit rate.Limit) error {
+	if m.allowed[key] == 0 {
+		return ratelimit.LimitedError{Key: key, RetryAfter: 300 * time.Millisecond}
+	}
+	m.allowed[key]--
+	return nil
+}
+
+func (m *MockLimiter) AllowAll(ctx context.Context, buckets ...ratelimit.Bucket) error {
+	for _, bucket := range buckets {
+		if m.allowed[bucket.Key] == 0 {
+			return ratelimit.LimitedError{Key: bucket.Key, RetryAfter: 300 * time.Millisecond}
+		}
+	}
+	for _, bucket := range buckets {
+		m.allowed[bucket.Key]--
+	}
+	return nil
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := &MockLimiter{allowed: map[string]int{
+		ratelimit.ClientKey("client-1"): 1,
+		ratelimit.IPKey("192.0.2.1"):    1,
+	}}
+
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		// authenticate requests with a client id header
+		if id := c.GetHeader("X-Client"); id != "" {
+			c.Set(middlewares.ClientKey, auth.Client{ClientID: id})
+		}
+	})
+	engine.Use(middlewares.RateLimit(limiter, rate.Limit{Rate: 1, Burst: 1}))
+	engine.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	t.Run("test that requests of a client are limited", func(t *testing.T) {
+		for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Client", "client-1")
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, expected, w.Code)
+		}
+	})
+
+	t.Run("test that limited requests are told when to retry", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Client", "client-2")
+
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("test that unauthenticated requests are limited by ip", func(t *testing.T) {
+		for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:5000"
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, expected, w.Code)
+		}
+	})
+}
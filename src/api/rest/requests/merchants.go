@@ -0,0 +1,13 @@
+package requests
+
+import "time"
+
+type RequestCreateMerchant struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type RequestMerchantReport struct {
+	// report payments created at or after From and before To
+	From *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To   *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
@@ -1,6 +1,8 @@
 package requests
 
 type RequestMpesaPayment struct {
+	// (optional) merchant the payment is made for, required for clients not bound to a merchant
+	MerchantID string `json:"merchant_id"`
 	//External identifier for the transfer which can be used for reconciliation. Need not be unique
 	TransactionID string `json:"transaction_id" validate:"required"`
 	//Unique idempotency identifier. Duplicates are rejected
@@ -21,16 +23,47 @@ type RequestMpesaPaymentStatus struct {
 	PaymentID        string `json:"payment_id"`
 	TransactionID    string `json:"transaction_id"`
 	PaymentReference string `json:"payment_reference"`
+	IdempotencyID    string `json:"idempotency_id"`
 }
 
 type RequestAddShortCode struct {
+	// (optional) merchant that owns the shortcode, required for clients not bound to a merchant
+	MerchantID        string `json:"merchant_id"`
 	Environment       string `json:"environment" validate:"required,oneof=sandbox production"`
 	Service           string `json:"service" validate:"required,oneof=daraja quikk"`
 	Type              string `json:"type" validate:"required,oneof=charge payout transfer"`
 	ShortCode         string `json:"shortcode" validate:"required"`
 	InitiatorName     string `json:"initiator_name" validate:"required"`
 	InitiatorPassword string `json:"initiator_password" validate:"required"`
-	Key               string `json:"key" validate:"required"`
+	Key               string `json:"key" validate:"required" log:"secret"`
 	Secret            string `json:"secret" validate:"required"`
 	Passphrase        string `json:"passphrase"`
+	// (optional) low value means higher priority
+	Priority uint `json:"priority"`
+	// (optional) base url partners send webhooks to
+	CallbackURL string `json:"callback_url" validate:"omitempty,url"`
+}
+
+type RequestListShortCodes struct {
+	MerchantID string `form:"merchant_id"`
+	Service    string `form:"service"`
+	Type       string `form:"type"`
+	ShortCode  string `form:"shortcode"`
+	// list only enabled or disabled shortcodes
+	Disabled *bool `form:"disabled"`
+}
+
+type RequestUpdateShortCode struct {
+	Environment *string `json:"environment" validate:"omitempty,oneof=sandbox production"`
+	Priority    *uint   `json:"priority" validate:"omitempty,min=1"`
+	CallbackURL *string `json:"callback_url" validate:"omitempty,url"`
+}
+
+type RequestRotateShortCodeCredentials struct {
+	InitiatorName       string `json:"initiator_name"`
+	InitiatorPassword   string `json:"initiator_password"`
+	Passphrase          string `json:"passphrase"`
+	Key                 string `json:"key" log:"secret"`
+	Secret              string `json:"secret"`
+	RotateCallbackToken bool   `json:"rotate_callback_token"`
 }
@@ -0,0 +1,17 @@
+package requests
+
+import "time"
+
+type RequestReplayWebhooks struct {
+	// ids of stored webhooks to replay
+	IDs     []string `json:"ids"`
+	Partner string   `json:"partner"`
+	Action  string   `json:"action"`
+	// replay webhooks received at or after From and before To
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+	// maximum number of webhooks replayed
+	Limit int `json:"limit"`
+	// return the payment updates without applying them
+	DryRun bool `json:"dry_run"`
+}
@@ -0,0 +1,26 @@
+package responses
+
+import "time"
+
+type BreakerResponse struct {
+	Key               string     `json:"key"`
+	State             string     `json:"state"`
+	Calls             int        `json:"calls"`
+	ErrorRate         float64    `json:"error_rate"`
+	SlowCallRate      float64    `json:"slow_call_rate"`
+	OpenedAt          *time.Time `json:"opened_at,omitempty"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+}
+
+// HealthResponse is the status of the api and of each of its components
+type HealthResponse struct {
+	Status     string              `json:"status"`
+	Components []ComponentResponse `json:"components,omitempty"`
+}
+
+type ComponentResponse struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
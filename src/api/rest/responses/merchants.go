@@ -0,0 +1,23 @@
+package responses
+
+import "time"
+
+type MerchantResponse struct {
+	MerchantID string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type MerchantReportTotal struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+	Amount string `json:"amount"`
+}
+
+type MerchantReportResponse struct {
+	MerchantID string                `json:"merchant_id"`
+	From       *time.Time            `json:"from,omitempty"`
+	To         *time.Time            `json:"to,omitempty"`
+	Totals     []MerchantReportTotal `json:"totals"`
+}
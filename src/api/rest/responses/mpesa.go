@@ -1,7 +1,51 @@
 package responses
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type MpesaPaymentResponse struct {
 	PaymentID     string `json:"payment_id"`
 	TransactionID string `json:"transaction_id"`
 	Status        string `json:"status"`
 }
+
+// ShortCodeResponse is a shortcode with its secrets redacted
+type ShortCodeResponse struct {
+	ShortCodeID       string `json:"id"`
+	MerchantID        string `json:"merchant_id"`
+	Environment       string `json:"environment"`
+	ShortCode         string `json:"shortcode"`
+	Priority          uint   `json:"priority"`
+	Service           string `json:"service"`
+	Type              string `json:"type"`
+	InitiatorName     string `json:"initiator_name"`
+	InitiatorPassword string `json:"initiator_password"`
+	Passphrase        string `json:"passphrase"`
+	Key               string `json:"key" log:"secret"`
+	Secret            string `json:"secret"`
+	CallbackURL       string `json:"callback_url"`
+	CallbackToken     string `json:"callback_token"`
+	Disabled          bool   `json:"disabled"`
+}
+
+// PartnerRequestResponse is a request made to a partner for a payment, the request body has
+// secrets and phone numbers redacted
+type PartnerRequestResponse struct {
+	RequestID       string            `json:"request_id"`
+	PaymentID       string            `json:"payment_id"`
+	ExternalID      string            `json:"external_id,omitempty"`
+	OriginRequestID string            `json:"origin_request_id,omitempty"`
+	Partner         string            `json:"partner"`
+	Operation       string            `json:"operation"`
+	Status          string            `json:"status"`
+	Attempt         int               `json:"attempt"`
+	LatencyMs       int64             `json:"latency_ms"`
+	RequestBody     json.RawMessage   `json:"request_body,omitempty"`
+	HTTPStatus      int               `json:"http_status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Response        map[string]any    `json:"response,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package responses
+
+type PaymentUpdateResponse struct {
+	PaymentID        string `json:"payment_id"`
+	Status           string `json:"status,omitempty"`
+	PaymentReference string `json:"payment_reference,omitempty"`
+}
+
+type ReplayWebhookResponse struct {
+	WebhookID     string                 `json:"webhook_id"`
+	Partner       string                 `json:"partner"`
+	Action        string                 `json:"action"`
+	Replayed      bool                   `json:"replayed"`
+	Skipped       string                 `json:"skipped,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	PaymentUpdate *PaymentUpdateResponse `json:"payment_update,omitempty"`
+}
+
+type ReplayWebhooksResponse struct {
+	DryRun   bool                    `json:"dry_run"`
+	Webhooks []ReplayWebhookResponse `json:"webhooks"`
+}
@@ -3,25 +3,86 @@ package rest
 import (
 	"github.com/gin-gonic/gin"
 
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
 	"github.com/SirWaithaka/payments-api/src/api/rest/handlers"
+	"github.com/SirWaithaka/payments-api/src/api/rest/middlewares"
+	"github.com/SirWaithaka/payments-api/src/config"
 	dipkg "github.com/SirWaithaka/payments-api/src/di"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
 )
 
+// routes adds the routes of the roles served by the process
 func routes(router *gin.Engine, di *dipkg.DI) {
-	webhookRoutes(router, di)
+	if di.Cfg.Roles.Has(config.RoleWebhooks) {
+		webhookRoutes(router, di)
+	}
+	if di.Cfg.Roles.Has(config.RoleAPI) {
+		apiRoutes(router, di)
+	}
+}
 
+func apiRoutes(router *gin.Engine, di *dipkg.DI) {
 	mpesaHandlers := handlers.NewMpesaHandlers(di.Mpesa, di.ShortCode)
 
 	group := router.Group("/api")
 
+	// api clients are authenticated and need a scope for each route
+	scope := func(scope auth.Scope) gin.HandlerFunc {
+		if di.Cfg.Auth.Disabled {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middlewares.RequireScope(scope)
+	}
+	// platform routes are not allowed for clients bound to a merchant
+	platform := func() gin.HandlerFunc {
+		if di.Cfg.Auth.Disabled {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middlewares.RequirePlatform()
+	}
+	if !di.Cfg.Auth.Disabled {
+		group.Use(middlewares.Authenticate(di.Auth))
+	}
+	// limit the requests of each api client
+	group.Use(middlewares.RateLimit(di.Limiter, di.Cfg.RateLimit.Client))
+
+	// merchant routes, clients bound to a merchant only access their merchant
+	merchantHandlers := handlers.NewMerchantHandlers(di.Merchant)
+	group.POST("/merchants", scope(auth.ScopeAdmin), platform(), merchantHandlers.Create)
+	group.GET("/merchants", scope(auth.ScopeRead), merchantHandlers.List)
+	group.GET("/merchants/:id", scope(auth.ScopeRead), merchantHandlers.Get)
+	group.GET("/merchants/:id/report", scope(auth.ScopeRead), merchantHandlers.Report)
+
 	// mpesa routes
 	mpesaGroup := group.Group("/mpesa")
-	mpesaGroup.POST("/charge", mpesaHandlers.Charge)
-	mpesaGroup.POST("/payout", mpesaHandlers.Payout)
-	mpesaGroup.POST("/transfer", mpesaHandlers.Transfer)
-	mpesaGroup.POST("/status", mpesaHandlers.PaymentStatus)
+	mpesaGroup.POST("/charge", scope(auth.ScopeCharge), mpesaHandlers.Charge)
+	mpesaGroup.POST("/payout", scope(auth.ScopePayout), mpesaHandlers.Payout)
+	mpesaGroup.POST("/transfer", scope(auth.ScopeTransfer), mpesaHandlers.Transfer)
+	mpesaGroup.POST("/status", scope(auth.ScopeRead), mpesaHandlers.PaymentStatus)
+	mpesaGroup.GET("/payments/:id/requests", scope(auth.ScopeRead), mpesaHandlers.PaymentRequests)
+
+	mpesaGroup.POST("/shortcode", scope(auth.ScopeAdmin), mpesaHandlers.AddShortCode)
+	mpesaGroup.GET("/shortcode", scope(auth.ScopeRead), mpesaHandlers.ListShortCodes)
+	mpesaGroup.GET("/shortcode/:id", scope(auth.ScopeRead), mpesaHandlers.GetShortCode)
+	mpesaGroup.PATCH("/shortcode/:id", scope(auth.ScopeAdmin), mpesaHandlers.UpdateShortCode)
+	mpesaGroup.DELETE("/shortcode/:id", scope(auth.ScopeAdmin), mpesaHandlers.DeleteShortCode)
+	mpesaGroup.POST("/shortcode/:id/enable", scope(auth.ScopeAdmin), mpesaHandlers.EnableShortCode)
+	mpesaGroup.POST("/shortcode/:id/disable", scope(auth.ScopeAdmin), mpesaHandlers.DisableShortCode)
+	mpesaGroup.POST("/shortcode/:id/credentials", scope(auth.ScopeAdmin), mpesaHandlers.RotateShortCodeCredentials)
+
+	// admin routes
+	webhookHandlers := handlers.NewWebhookHandlers(di.Webhook)
+	adminGroup := group.Group("/admin", scope(auth.ScopeAdmin), platform())
+	adminGroup.POST("/webhooks/replay", webhookHandlers.Replay)
+}
 
-	mpesaGroup.POST("/shortcode", mpesaHandlers.AddShortCode)
+// internalRoutes adds the routes of the internal port, they are served with every role
+func internalRoutes(router *gin.Engine, healthHandlers handlers.HealthHandlers) {
+	router.GET("/health/live", healthHandlers.Live)
+	router.GET("/health/ready", healthHandlers.Ready)
+	router.GET("/health/breakers", healthHandlers.Breakers)
+	// prometheus metrics
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 }
 
 func webhookRoutes(router *gin.Engine, di *dipkg.DI) {
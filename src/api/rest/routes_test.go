@@ -0,0 +1,55 @@
+package rest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/api/rest"
+	"github.com/SirWaithaka/payments-api/src/config"
+	dipkg "github.com/SirWaithaka/payments-api/src/di"
+)
+
+func TestRoutes(t *testing.T) {
+	api := []string{"POST /api/mpesa/charge", "GET /api/merchants", "POST /api/admin/webhooks/replay"}
+	webhooks := []string{"POST /webhooks/daraja/:action", "POST /webhooks/quikk/mpesa/:action"}
+	internal := []string{"GET /health/live", "GET /health/ready", "GET /health/breakers", "GET /metrics"}
+
+	testcases := []struct {
+		name     string
+		roles    config.Roles
+		served   []string
+		unserved []string
+	}{
+		{name: "test the api role", roles: config.Roles{config.RoleAPI}, served: api, unserved: webhooks},
+		{name: "test the webhooks role", roles: config.Roles{config.RoleWebhooks}, served: webhooks, unserved: api},
+		{name: "test the worker role", roles: config.Roles{config.RoleWorker}, unserved: append(api, webhooks...)},
+		{name: "test all roles", roles: config.Roles{config.RoleAPI, config.RoleWebhooks, config.RoleWorker}, served: append(api, webhooks...)},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Roles = tc.roles
+
+			routes, internalRoutes := rest.Routes(rest.New(&dipkg.DI{Cfg: &cfg}))
+
+			for _, route := range tc.served {
+				assert.Contains(t, routes, route)
+			}
+			for _, route := range tc.unserved {
+				assert.NotContains(t, routes, route)
+			}
+
+			// liveness is served on both ports, the other internal endpoints only on the
+			// internal port
+			assert.Contains(t, routes, "GET /health/live")
+			for _, route := range internal {
+				assert.Contains(t, internalRoutes, route)
+				if route != "GET /health/live" {
+					assert.NotContains(t, routes, route)
+				}
+			}
+		})
+	}
+}
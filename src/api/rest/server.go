@@ -12,58 +12,113 @@ import (
 	"github.com/SirWaithaka/payments-api/pkg/http/middlewares"
 	"github.com/SirWaithaka/payments-api/pkg/http/middlewares/ginzerolog"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/src/api/rest/handlers"
 	dipkg "github.com/SirWaithaka/payments-api/src/di"
 )
 
-func New(c context.Context, di *dipkg.DI) *Server {
+func New(di *dipkg.DI) *Server {
 	l := logger.New(&logger.Config{})
 
 	engine := gin.New()
 	gin.SetMode(gin.ReleaseMode)
 
+	// the client ip is used to authenticate webhooks, only trust
+	// forwarded headers set by known proxies
+	if err := engine.SetTrustedProxies(di.Cfg.HTTP.TrustedProxies); err != nil {
+		l.Error().Err(err).Msg("invalid trusted proxies")
+	}
+
 	// add middlewares to server
 	engine.Use(gin.Recovery())
+	engine.Use(middlewares.RequestID())
+	engine.Use(middlewares.Tracing())
 	engine.Use(ginzerolog.New(ginzerolog.Config{Logger: &l}))
+	engine.Use(middlewares.Metrics())
 	engine.Use(middlewares.ErrorHandler())
-	// add health check route
+	// liveness is served with every role, it does not report on dependencies
+	healthHandlers := handlers.NewHealthHandlers(di.Breakers, di.Health)
 	engine.GET("/health", middlewares.Healthcheck)
+	engine.GET("/health/live", healthHandlers.Live)
 
 	routes(engine, di)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", di.Cfg.HTTPPort),
-		Handler: engine.Handler(),
+		Addr:              fmt.Sprintf(":%s", di.Cfg.HTTP.Port),
+		Handler:           engine.Handler(),
+		ReadHeaderTimeout: di.Cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       di.Cfg.HTTP.ReadTimeout,
+		WriteTimeout:      di.Cfg.HTTP.WriteTimeout,
+		IdleTimeout:       di.Cfg.HTTP.IdleTimeout,
+	}
+
+	// readiness, breakers and metrics expose the state of dependencies, they are served
+	// on an internal port that is not exposed with the webhook endpoints
+	internalEngine := gin.New()
+	internalEngine.Use(gin.Recovery())
+	internalRoutes(internalEngine, healthHandlers)
+
+	internal := &http.Server{
+		Addr:              fmt.Sprintf(":%s", di.Cfg.HTTP.InternalPort),
+		Handler:           internalEngine.Handler(),
+		ReadHeaderTimeout: di.Cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       di.Cfg.HTTP.ReadTimeout,
+		WriteTimeout:      di.Cfg.HTTP.WriteTimeout,
+		IdleTimeout:       di.Cfg.HTTP.IdleTimeout,
 	}
 
 	return &Server{
-		ctx:    c,
-		logger: l,
-		server: server,
+		logger:   l,
+		server:   server,
+		internal: internal,
 	}
 }
 
 type Server struct {
-	ctx    context.Context
 	server *http.Server
-	logger zerolog.Logger
+	// serves the internal endpoints
+	internal *http.Server
+	logger   zerolog.Logger
 }
 
+// Start serves requests on the port and the internal port. It returns the error of the
+// first server that fails to start, or nil once both are shut down.
 func (server *Server) Start() error {
 	server.logger.Info().Msg("starting http server ...")
 
-	if err := server.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		server.logger.WithLevel(zerolog.FatalLevel).Err(err).Msg("failed to start http server")
+	errs := make(chan error, 2)
+	go func() { errs <- server.listen(server.server) }()
+	go func() { errs <- server.listen(server.internal) }()
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) listen(s *http.Server) error {
+	if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		server.logger.WithLevel(zerolog.FatalLevel).Err(err).Str("addr", s.Addr).Msg("failed to start http server")
 		return err
 	}
 
 	return nil
 }
 
-// Stop listens for an os signal and shuts down the server
-func (server *Server) Stop() error {
+// Shutdown stops accepting requests and waits for in-flight requests to complete until
+// ctx is done, requests still in flight are then cut off
+func (server *Server) Shutdown(ctx context.Context) error {
 	defer server.logger.Info().Msg("server stopped")
 
-	<-server.ctx.Done()
 	server.logger.Info().Msg("stopping http server ...")
-	return server.server.Shutdown(server.ctx)
+	var errs []error
+	for _, s := range []*http.Server{server.server, server.internal} {
+		if err := s.Shutdown(ctx); err != nil {
+			errs = append(errs, err, s.Close())
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -4,6 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -11,9 +16,38 @@ import (
 	"github.com/segmentio/kafka-go"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+	"github.com/SirWaithaka/payments-api/src/clients/pool"
 	"github.com/SirWaithaka/payments-api/src/events"
 )
 
+// headers added to messages sent to the dead letter topic
+const (
+	HeaderDLQTopic     = "dlq-original-topic"
+	HeaderDLQPartition = "dlq-original-partition"
+	HeaderDLQOffset    = "dlq-original-offset"
+	HeaderDLQError     = "dlq-error"
+)
+
+// maxStallDelay is the longest delay between retries of a commit or of sending a message
+// to the dead letter topic
+const maxStallDelay = 30 * time.Second
+
+// reader fetches and commits messages, it is implemented by kafka.Reader
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Config() kafka.ReaderConfig
+	Close() error
+}
+
+// sender sends messages to the dead letter topic, it is implemented by Producer
+type sender interface {
+	SendMessage(ctx context.Context, topic string, key, value []byte, headers ...kafka.Header) error
+}
+
 // ConsumerConfig specific configuration for consumers.
 type ConsumerConfig struct {
 	Brokers        []string
@@ -24,17 +58,40 @@ type ConsumerConfig struct {
 	MaxBytes       int
 	CommitInterval int // In milliseconds
 	StartOffset    int64
+	// topic where messages are sent after all handler retries fail
+	DeadLetterTopic string
+	// max number of times a failed message is retried before it is dead-lettered
+	MaxRetries int
+	// duration to delay before retrying a failed message
+	RetryDelay time.Duration
+	// number of messages handled concurrently, defaults to 1
+	Concurrency int
 }
 
 // Consumer is a Kafka consumer structure.
 type Consumer struct {
-	reader  *kafka.Reader
+	reader  reader
 	handler events.Handler
+
+	dlq        sender
+	dlqTopic   string
+	maxRetries int
+	retryDelay time.Duration
+
+	workers *pool.Pool[kafka.Message]
+	offsets *offsetTracker
+	// number of workers retrying a message they could not commit or dead-letter
+	stalled atomic.Int32
 }
 
 // NewConsumer creates a new consumer instance.
 func NewConsumer(cCfg ConsumerConfig) *Consumer {
 	return &Consumer{
+		workers:    pool.New(cCfg.Concurrency, key),
+		offsets:    newOffsetTracker(),
+		dlqTopic:   cCfg.DeadLetterTopic,
+		maxRetries: cCfg.MaxRetries,
+		retryDelay: cCfg.RetryDelay,
 		reader: kafka.NewReader(kafka.ReaderConfig{
 			Brokers:        cCfg.Brokers,
 			Topic:          cCfg.Topic,
@@ -47,59 +104,221 @@ func NewConsumer(cCfg ConsumerConfig) *Consumer {
 	}
 }
 
-// ReadMessage reads a message from the Kafka topic.
+// ReadMessage reads messages from the Kafka topic until ctx is cancelled.
+//
+// Messages are handled by a pool of workers. Messages with the same key are always
+// handled by the same worker, so they are processed in the order they were published.
+//
+// Offsets are committed only after the handler succeeds or the message has been
+// sent to the dead letter topic, so a message is never lost if the process stops
+// mid-processing. Messages already being handled when ctx is cancelled are finished
+// and committed before ReadMessage returns.
 func (c *Consumer) ReadMessage(ctx context.Context) error {
 	l := zerolog.Ctx(ctx)
-	l.Debug().Msgf("starting consumer - %s on host %s", c.reader.Config().Topic, c.reader.Config().Brokers[0])
+	l.Debug().Msgf("starting consumer - %s on host %s with %d workers", c.reader.Config().Topic, c.reader.Config().Brokers[0], c.workers.Size())
 
-loop:
-	for {
-		// check if context is canceled
-		select {
-		case <-ctx.Done():
-			l.Debug().Msgf("stopping consumer - %s", c.reader.Config().Topic)
-			break loop
-		default:
+	err := c.workers.Run(ctx, c.fetch, c.handle)
+	l.Debug().Msgf("stopping consumer - %s", c.reader.Config().Topic)
+
+	return err
+}
+
+// fetch reads the next message and tracks its offset until it is committed
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, error) {
+	l := zerolog.Ctx(ctx)
+
+	// fetching does not commit the message offset
+	message, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return message, err
+	}
+	l.Info().Msgf("message at offset %d", message.Offset)
+	metrics.SetConsumerLag(broker, message.Topic, c.reader.Config().GroupID, strconv.Itoa(message.Partition), message.HighWaterMark-message.Offset-1)
+
+	c.offsets.track(message)
+
+	return message, nil
+}
+
+// key returns the key of the message, messages with the same key are handled in order
+func key(message kafka.Message) string {
+	return string(message.Key)
+}
+
+// handle parses and processes a single message, then commits it. A message that cannot
+// be parsed or keeps failing after all retries is moved to the dead letter topic.
+func (c *Consumer) handle(ctx, hCtx context.Context, message kafka.Message) (err error) {
+	// the handler continues with the request id and the trace of the producer
+	hCtx = requestid.WithContext(hCtx, header(message.Headers, requestid.Header))
+	hCtx, span := startProcessSpan(hCtx, message, c.reader.Config().GroupID)
+	defer func() { tracing.End(span, err) }()
+
+	l := zerolog.Ctx(hCtx)
+
+	// get the event handler
+	out, fn := c.handler()
+	if fn == nil {
+		l.Debug().Msg("return handler func is nil")
+		return c.deadLetter(ctx, hCtx, message, errors.New("handler func is nil"))
+	}
+
+	// parse event payload into the out var
+	if err := jsoniter.NewDecoder(bytes.NewReader(message.Value)).Decode(out); err != nil {
+		l.Error().Err(err).Msg("json error parsing message into variable")
+		// the message will never parse, retrying is pointless
+		return c.deadLetter(ctx, hCtx, message, err)
+	}
+	l.Debug().Any(logger.LData, out).Msg("message parsed")
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		// call the event handler function
+		if err = call(hCtx, fn); err == nil {
+			return c.commit(ctx, hCtx, message)
 		}
+		l.Warn().Err(err).Msgf("message handler error, attempt: %d", attempt)
+		span.RecordError(err)
+		metrics.EventConsumeError(broker, message.Topic, c.reader.Config().GroupID)
 
-		message, err := c.reader.ReadMessage(ctx)
-		if err != nil {
-			l.Error().Err(err).Msg("failed to read message")
-			continue
+		if attempt >= c.maxRetries {
+			break
 		}
-		l.Info().Msgf("message at offset %d", message.Offset)
 
-		// get the event handler
-		out, fn := c.handler()
-		if fn == nil {
-			l.Debug().Msg("return handler func is nil")
-			return errors.New("handler func is nil")
+		// wait before retrying, with exponential backoff
+		select {
+		case <-ctx.Done():
+			// the consumer is stopping, leave the message uncommitted so it is redelivered
+			l.Info().Msg("consumer stopping, message will be redelivered")
+			return nil
+		case <-time.After(delay):
+			delay = time.Duration(float64(delay) * 1.5)
 		}
+	}
 
-		// parse event payload into the out var
-		if e := jsoniter.NewDecoder(bytes.NewReader(message.Value)).Decode(out); e != nil {
-			l.Error().Err(e).Msg("json error parsing message into variable")
-			continue
+	return c.deadLetter(ctx, hCtx, message, err)
+}
+
+// deadLetter sends the message to the dead letter topic and commits it.
+func (c *Consumer) deadLetter(ctx, hCtx context.Context, message kafka.Message, cause error) error {
+	l := zerolog.Ctx(hCtx)
+
+	if c.dlq == nil || c.dlqTopic == "" {
+		return fmt.Errorf("no dead letter topic configured: %w", cause)
+	}
+
+	// the headers of the message are copied, appending could write to its backing array
+	headers := slices.Concat(message.Headers, []kafka.Header{
+		{Key: HeaderDLQTopic, Value: []byte(message.Topic)},
+		{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		{Key: HeaderDLQError, Value: []byte(cause.Error())},
+	})
+
+	err := c.retry(ctx, hCtx, "send message to dead letter topic", func() error {
+		return c.dlq.SendMessage(hCtx, c.dlqTopic, message.Key, message.Value, headers...)
+	})
+	if err != nil {
+		// the consumer is stopping, the message is redelivered
+		return nil
+	}
+	l.Warn().Err(cause).Msgf("message at offset %d sent to %s", message.Offset, c.dlqTopic)
+
+	return c.commit(ctx, hCtx, message)
+}
+
+// commit marks the message as complete, its offset is committed once all
+// earlier messages on the same partition have completed
+func (c *Consumer) commit(ctx, hCtx context.Context, message kafka.Message) error {
+	l := zerolog.Ctx(hCtx)
+
+	m, ok := c.offsets.complete(message)
+	if !ok {
+		return nil
+	}
+
+	// a failed commit is retried, the tracker has already released the message. Messages
+	// of the partition completed meanwhile wait for the commit.
+	err := c.offsets.commit(m, func(m kafka.Message) error {
+		return c.retry(ctx, hCtx, "commit message", func() error {
+			if err := c.reader.CommitMessages(hCtx, m); err != nil {
+				return err
+			}
+			l.Debug().Msgf("committed offset %d on partition %d", m.Offset, m.Partition)
+			return nil
+		})
+	})
+	if err != nil {
+		// the consumer stopped before the commit, the message is redelivered
+		return fmt.Errorf("commit offset %d on partition %d: %w", m.Offset, m.Partition, err)
+	}
+
+	return nil
+}
+
+// retry calls fn until it succeeds, with exponential backoff. The consumer is reported as
+// stalled while fn keeps failing. retry returns the error of fn if ctx is done first, the
+// message is then left uncommitted and redelivered.
+func (c *Consumer) retry(ctx, hCtx context.Context, op string, fn func() error) error {
+	l := zerolog.Ctx(hCtx)
+
+	delay := max(c.retryDelay, time.Millisecond)
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 0 {
+				c.stalled.Add(-1)
+			}
+			return nil
+		}
+		l.Error().Err(err).Msgf("failed to %s, attempt: %d", op, attempt)
+		if attempt == 0 {
+			c.stalled.Add(1)
 		}
-		l.Debug().Any(logger.LData, out).Msg("message parsed")
 
-		// call the event handler function
-		e := fn(ctx)
-		if e != nil {
-			// any error that occurs in the event handler is just logged
-			l.Debug().Err(e).Msg("message handler error")
-			continue
+		select {
+		case <-ctx.Done():
+			c.stalled.Add(-1)
+			return err
+		case <-time.After(delay):
+			delay = min(delay*2, maxStallDelay)
 		}
 	}
+}
 
+// Check reports whether the consumer is stalled on a message it cannot commit or
+// dead-letter, later messages of the partition are not committed meanwhile
+func (c *Consumer) Check(_ context.Context) error {
+	if stalled := c.stalled.Load(); stalled > 0 {
+		return fmt.Errorf("%s: %d workers stalled on a message", c.reader.Config().Topic, stalled)
+	}
 	return nil
 }
 
+// call runs the handler function, a panic in the handler is returned as an error
+func call(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(ctx).WithLevel(zerolog.FatalLevel).Str(logger.LData, string(debug.Stack())).Msg("recovered from panic")
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
+
 func (c *Consumer) SetHandler(handler events.Handler) {
 	c.handler = handler
 }
 
-// Close closes the consumer reader.
+// SetDeadLetterProducer sets the producer used to send failed messages to the dead letter topic
+func (c *Consumer) SetDeadLetterProducer(producer *Producer) {
+	if producer != nil {
+		c.dlq = producer
+	}
+}
+
+// Close closes the consumer reader. Any pending offset commits are flushed
+// before the reader is closed.
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
@@ -0,0 +1,277 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/src/clients/pool"
+)
+
+// fakeReader delivers the messages sent on its channel and records the commits
+type fakeReader struct {
+	messages chan kafka.Message
+
+	mu        sync.Mutex
+	committed []int64
+	// number of commits that fail before commits succeed
+	failCommits int
+}
+
+func newFakeReader() *fakeReader {
+	return &fakeReader{messages: make(chan kafka.Message, 10)}
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.messages:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failCommits > 0 {
+		r.failCommits--
+		return errors.New("coordinator not available")
+	}
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Config() kafka.ReaderConfig {
+	return kafka.ReaderConfig{Topic: "payment.completed", GroupID: "payment.completed-group", Brokers: []string{"localhost:9092"}}
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) commits() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// fakeSender records the messages sent to the dead letter topic
+type fakeSender struct {
+	mu      sync.Mutex
+	headers [][]kafka.Header
+	fails   int
+}
+
+func (s *fakeSender) SendMessage(_ context.Context, _ string, _, _ []byte, headers ...kafka.Header) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("leader not available")
+	}
+	s.headers = append(s.headers, headers)
+	return nil
+}
+
+type testEvent struct {
+	ID string `json:"id"`
+}
+
+func (event testEvent) Message() any { return event }
+
+func newTestConsumer(reader *fakeReader, concurrency int, fn func(ctx context.Context, event *testEvent) error) *Consumer {
+	c := &Consumer{
+		reader:     reader,
+		workers:    pool.New(concurrency, key),
+		offsets:    newOffsetTracker(),
+		dlqTopic:   "payment.completed.dlq",
+		retryDelay: time.Millisecond,
+	}
+	c.SetHandler(func() (pkgevents.EventMessage, func(context.Context) error) {
+		event := &testEvent{}
+		return event, func(ctx context.Context) error { return fn(ctx, event) }
+	})
+	return c
+}
+
+func TestConsumer_ReadMessage(t *testing.T) {
+	t.Run("test that messages with the same key are handled in order", func(t *testing.T) {
+		reader := newFakeReader()
+
+		var mu sync.Mutex
+		handled := make(map[string][]string)
+		done := make(chan struct{}, 6)
+		consumer := newTestConsumer(reader, 3, func(ctx context.Context, event *testEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			key := event.ID[:1]
+			handled[key] = append(handled[key], event.ID)
+			done <- struct{}{}
+			return nil
+		})
+
+		for i, id := range []string{"a1", "b1", "a2", "b2", "a3", "b3"} {
+			reader.messages <- kafka.Message{Key: []byte(id[:1]), Offset: int64(i), Value: []byte(`{"id":"` + id + `"}`)}
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- consumer.ReadMessage(ctx) }()
+
+		for range 6 {
+			<-done
+		}
+		cancel()
+		assert.Nil(t, <-errs)
+
+		assert.Equal(t, []string{"a1", "a2", "a3"}, handled["a"])
+		assert.Equal(t, []string{"b1", "b2", "b3"}, handled["b"])
+		assert.Eventually(t, func() bool {
+			commits := reader.commits()
+			return len(commits) > 0 && commits[len(commits)-1] == 5
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("test that a failed commit is retried and reported as stalled", func(t *testing.T) {
+		reader := newFakeReader()
+		reader.failCommits = 3
+
+		stalled := make(chan error, 10)
+		consumer := newTestConsumer(reader, 1, func(context.Context, *testEvent) error { return nil })
+		consumer.retryDelay = 20 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		errs := make(chan error, 1)
+		go func() { errs <- consumer.ReadMessage(ctx) }()
+
+		reader.messages <- kafka.Message{Offset: 7, Value: []byte(`{"id":"1"}`)}
+		assert.Eventually(t, func() bool {
+			err := consumer.Check(ctx)
+			if err != nil {
+				stalled <- err
+			}
+			return err != nil
+		}, time.Second, time.Millisecond)
+		assert.EqualError(t, <-stalled, "payment.completed: 1 workers stalled on a message")
+
+		// the consumer keeps running and commits once the broker recovers
+		assert.Eventually(t, func() bool { return len(reader.commits()) == 1 }, 2*time.Second, time.Millisecond)
+		assert.Nil(t, consumer.Check(ctx))
+
+		reader.messages <- kafka.Message{Offset: 8, Value: []byte(`{"id":"2"}`)}
+		assert.Eventually(t, func() bool { return len(reader.commits()) == 2 }, time.Second, time.Millisecond)
+
+		cancel()
+		assert.Nil(t, <-errs)
+	})
+}
+
+func TestConsumer_work(t *testing.T) {
+	t.Run("test that an in-flight message is finished and committed when the consumer stops", func(t *testing.T) {
+		reader := newFakeReader()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		consumer := newTestConsumer(reader, 1, func(ctx context.Context, event *testEvent) error {
+			close(started)
+			<-release
+			return nil
+		})
+		reader.messages <- kafka.Message{Offset: 4, Value: []byte(`{"id":"1"}`)}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- consumer.ReadMessage(ctx) }()
+
+		<-started
+		cancel()
+		close(release)
+
+		assert.Nil(t, <-errs)
+		assert.Equal(t, []int64{4}, reader.commits())
+	})
+
+	t.Run("test that a failing message is retried then dead-lettered", func(t *testing.T) {
+		reader := newFakeReader()
+
+		var mu sync.Mutex
+		attempts := 0
+		consumer := newTestConsumer(reader, 1, func(ctx context.Context, event *testEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return errors.New("handler error")
+		})
+		consumer.maxRetries = 2
+		dlq := &fakeSender{}
+		consumer.dlq = dlq
+		reader.messages <- kafka.Message{Offset: 5, Value: []byte(`{"id":"1"}`)}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- consumer.ReadMessage(ctx) }()
+
+		assert.Eventually(t, func() bool { return len(reader.commits()) == 1 }, time.Second, time.Millisecond)
+		cancel()
+		assert.Nil(t, <-errs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 3, attempts)
+		dlq.mu.Lock()
+		defer dlq.mu.Unlock()
+		assert.Len(t, dlq.headers, 1)
+	})
+}
+
+func TestConsumer_DeadLetter(t *testing.T) {
+	t.Run("test that the headers of the message are not modified", func(t *testing.T) {
+		reader := newFakeReader()
+		dlq := &fakeSender{fails: 1}
+		consumer := newTestConsumer(reader, 1, nil)
+		consumer.dlq = dlq
+
+		// spare capacity that an append would write into
+		headers := make([]kafka.Header, 1, 10)
+		headers[0] = kafka.Header{Key: "X-Request-ID", Value: []byte("req-1")}
+		message := kafka.Message{Topic: "payment.completed", Offset: 3, Headers: headers}
+		consumer.offsets.track(message)
+
+		err := consumer.deadLetter(t.Context(), t.Context(), message, errors.New("handler error"))
+		assert.Nil(t, err)
+
+		assert.Equal(t, kafka.Header{}, headers[:2][1])
+		if assert.Len(t, dlq.headers, 1) {
+			assert.Len(t, dlq.headers[0], 5)
+			assert.Equal(t, "handler error", header(dlq.headers[0], HeaderDLQError))
+			assert.Equal(t, "req-1", header(dlq.headers[0], "X-Request-ID"))
+		}
+		assert.Equal(t, []int64{3}, reader.commits())
+	})
+
+	t.Run("test that the message is left uncommitted if the consumer stops", func(t *testing.T) {
+		reader := newFakeReader()
+		consumer := newTestConsumer(reader, 1, nil)
+		consumer.dlq = &fakeSender{fails: 100}
+
+		message := kafka.Message{Topic: "payment.completed", Offset: 3}
+		consumer.offsets.track(message)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		defer cancel()
+
+		assert.Nil(t, consumer.deadLetter(ctx, t.Context(), message, errors.New("handler error")))
+		assert.Empty(t, reader.commits())
+		assert.Nil(t, consumer.Check(ctx))
+	})
+}
@@ -2,8 +2,15 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
 )
 
+// broker is the name of the broker in metrics
+const broker = "kafka"
+
 // Config common configuration used by both producers and consumers.
 type Config struct {
 	Brokers []string
@@ -13,3 +20,23 @@ type Config struct {
 func New(ctx context.Context, host string) {
 
 }
+
+// Ping checks that at least one of the brokers accepts connections, the cluster
+// remains available while any of its brokers is reachable
+func Ping(ctx context.Context, brokers []string) error {
+	var errs []error
+	for _, address := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("broker %s: %w", address, err))
+			continue
+		}
+		_ = conn.Close()
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return errors.New("no brokers configured")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker keeps track of fetched messages per partition. When messages are
+// handled concurrently they can complete out of order, but committing an offset
+// commits every offset below it. The tracker only releases a message for commit
+// once every message fetched before it on the same partition has completed.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+	// highest committed offset per partition
+	committed map[int]int64
+
+	// commitMu serializes commits, it is not held by track and complete so that a
+	// commit retried while the broker is down does not block fetching
+	commitMu sync.Mutex
+}
+
+type partitionOffsets struct {
+	// offsets fetched and not yet committed, in the order they were fetched
+	pending []int64
+	// completed messages that are waiting on an earlier offset
+	done map[int64]kafka.Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets), committed: make(map[int]int64)}
+}
+
+// track records a fetched message as in-flight
+func (t *offsetTracker) track(message kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[message.Partition]
+	// an offset lower than one already tracked means the partition was re-assigned
+	// and is being consumed again from the last commit, so the old state is dropped
+	if !ok || (len(p.pending) > 0 && message.Offset <= p.pending[len(p.pending)-1]) {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[message.Partition] = p
+		delete(t.committed, message.Partition)
+	}
+
+	p.pending = append(p.pending, message.Offset)
+}
+
+// complete marks a message as done and returns the highest message on the partition
+// whose offset, and every offset before it, has completed. false is returned if an
+// earlier message is still in-flight.
+func (t *offsetTracker) complete(message kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[message.Partition]
+	if !ok || len(p.pending) == 0 || message.Offset < p.pending[0] {
+		// message belongs to a partition state that has since been dropped
+		return kafka.Message{}, false
+	}
+	p.done[message.Offset] = message
+
+	var (
+		last  kafka.Message
+		found bool
+	)
+	for len(p.pending) > 0 {
+		m, ok := p.done[p.pending[0]]
+		if !ok {
+			break
+		}
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+		last, found = m, true
+	}
+
+	return last, found
+}
+
+// commit calls commit with a message released by complete. Commits are made one at a
+// time, a message whose partition has since committed a higher offset is not committed
+// so that the committed offset never moves back.
+func (t *offsetTracker) commit(message kafka.Message, commit func(kafka.Message) error) error {
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+
+	t.mu.Lock()
+	last, ok := t.committed[message.Partition]
+	t.mu.Unlock()
+	if ok && message.Offset <= last {
+		return nil
+	}
+
+	if err := commit(message); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.committed[message.Partition] = message.Offset
+	t.mu.Unlock()
+	return nil
+}
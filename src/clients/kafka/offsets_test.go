@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetTracker_Complete(t *testing.T) {
+	message := func(partition int, offset int64) kafka.Message {
+		return kafka.Message{Partition: partition, Offset: offset}
+	}
+	// complete commits the message released by completing m
+	complete := func(tracker *offsetTracker, m kafka.Message, commit func(kafka.Message) error) error {
+		if released, ok := tracker.complete(m); ok {
+			return tracker.commit(released, commit)
+		}
+		return nil
+	}
+
+	t.Run("test that offset is committed only after earlier offsets complete", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		for i := range 3 {
+			tracker.track(message(0, int64(i)))
+		}
+
+		var committed []int64
+		commit := func(m kafka.Message) error {
+			committed = append(committed, m.Offset)
+			return nil
+		}
+
+		// offsets 1 and 2 complete before 0
+		assert.Nil(t, complete(tracker, message(0, 2), commit))
+		assert.Nil(t, complete(tracker, message(0, 1), commit))
+		assert.Empty(t, committed)
+
+		// completing 0 releases the highest contiguous offset
+		assert.Nil(t, complete(tracker, message(0, 0), commit))
+		assert.Equal(t, []int64{2}, committed)
+	})
+
+	t.Run("test that partitions are tracked separately", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		tracker.track(message(0, 10))
+		tracker.track(message(1, 5))
+
+		var committed []kafka.Message
+		commit := func(m kafka.Message) error {
+			committed = append(committed, m)
+			return nil
+		}
+
+		assert.Nil(t, complete(tracker, message(1, 5), commit))
+		assert.Equal(t, []kafka.Message{message(1, 5)}, committed)
+	})
+
+	t.Run("test that a re-assigned partition drops old offsets", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		tracker.track(message(0, 3))
+		tracker.track(message(0, 4))
+		// partition consumed again from the last commit
+		tracker.track(message(0, 3))
+
+		var committed []int64
+		commit := func(m kafka.Message) error {
+			committed = append(committed, m.Offset)
+			return nil
+		}
+
+		assert.Nil(t, complete(tracker, message(0, 3), commit))
+		assert.Equal(t, []int64{3}, committed)
+	})
+
+	t.Run("test that a lower offset is not committed after a higher one", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		tracker.track(message(0, 1))
+		tracker.track(message(0, 2))
+
+		var committed []int64
+		commit := func(m kafka.Message) error {
+			committed = append(committed, m.Offset)
+			return nil
+		}
+
+		// both messages are released before either is committed
+		first, ok := tracker.complete(message(0, 1))
+		assert.True(t, ok)
+		second, ok := tracker.complete(message(0, 2))
+		assert.True(t, ok)
+
+		assert.Nil(t, tracker.commit(second, commit))
+		assert.Nil(t, tracker.commit(first, commit))
+		assert.Equal(t, []int64{2}, committed)
+	})
+
+	t.Run("test that messages are tracked while a commit is in progress", func(t *testing.T) {
+		tracker := newOffsetTracker()
+		tracker.track(message(0, 1))
+
+		committing := make(chan struct{})
+		release := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			errs <- complete(tracker, message(0, 1), func(kafka.Message) error {
+				close(committing)
+				<-release
+				return errors.New("broker not available")
+			})
+		}()
+		<-committing
+
+		// the commit does not hold the lock of track and complete
+		tracker.track(message(0, 2))
+		_, ok := tracker.complete(message(0, 2))
+		assert.True(t, ok)
+
+		close(release)
+		assert.EqualError(t, <-errs, "broker not available")
+	})
+}
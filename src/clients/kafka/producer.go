@@ -3,12 +3,15 @@ package kafka
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/segmentio/kafka-go"
 
 	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
 )
 
 // ProducerConfig specific configuration for producers.
@@ -37,7 +40,7 @@ func NewProducer(cfg Config, pCfg ProducerConfig) *Producer {
 		retryDelay:  pCfg.RetryDelay,
 		writer: &kafka.Writer{
 			Addr:                   kafka.TCP(cfg.Brokers...),
-			Balancer:               &kafka.LeastBytes{},
+			Balancer:               &kafka.Hash{}, // messages with the same key go to the same partition
 			BatchSize:              pCfg.BatchSize,
 			BatchTimeout:           time.Duration(pCfg.BatchTimeout) * time.Millisecond,
 			RequiredAcks:           pCfg.RequiredAcks,
@@ -47,12 +50,20 @@ func NewProducer(cfg Config, pCfg ProducerConfig) *Producer {
 	}
 }
 
-// SendMessage sends a message to the Kafka topic.
-func (p *Producer) SendMessage(ctx context.Context, topic string, key, value []byte) error {
+// SendMessage sends a message to the Kafka topic. The request id and the trace context
+// of ctx are added to the message headers.
+func (p *Producer) SendMessage(ctx context.Context, topic string, key, value []byte, headers ...kafka.Header) (err error) {
 	l := zerolog.Ctx(ctx)
 
+	// the headers of the caller are not modified
+	headers = slices.Clone(headers)
+	if id := requestid.FromContext(ctx); id != "" {
+		headerCarrier{headers: &headers}.Set(requestid.Header, id)
+	}
+	ctx, span := startPublishSpan(ctx, topic, &headers)
+	defer func() { tracing.End(span, err) }()
+
 	var (
-		err          error
 		retryCount   int
 		currentDelay = p.retryDelay
 	)
@@ -61,9 +72,10 @@ func (p *Producer) SendMessage(ctx context.Context, topic string, key, value []b
 		l.Debug().Msgf("sending message, retry: %d", retryCount)
 		// post message
 		err = p.writer.WriteMessages(ctx, kafka.Message{
-			Topic: topic,
-			Key:   key,
-			Value: value,
+			Topic:   topic,
+			Key:     key,
+			Value:   value,
+			Headers: headers,
 		})
 
 		// return immediately if err is nil
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+// headerCarrier adapts kafka message headers to a propagation.TextMapCarrier, the trace
+// context of a producer is carried to the consumers in the message headers
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (carrier headerCarrier) Get(key string) string {
+	return header(*carrier.headers, key)
+}
+
+// Set replaces the value of the header if the message already has it
+func (carrier headerCarrier) Set(key, value string) {
+	for i, h := range *carrier.headers {
+		if h.Key == key {
+			(*carrier.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*carrier.headers = append(*carrier.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (carrier headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*carrier.headers))
+	for _, h := range *carrier.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// header returns the value of the first header with the key, empty if there is none
+func header(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// startPublishSpan starts a producer span for a message sent to the topic, and adds its
+// trace context to the headers
+func startPublishSpan(ctx context.Context, topic string, headers *[]kafka.Header) (context.Context, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(topic),
+		),
+	)
+	tracing.Propagator().Inject(ctx, headerCarrier{headers: headers})
+
+	return ctx, span
+}
+
+// startProcessSpan starts a consumer span for a message, continuing the trace of the
+// producer from the message headers
+func startProcessSpan(ctx context.Context, message kafka.Message, group string) (context.Context, trace.Span) {
+	headers := message.Headers
+	ctx = tracing.Propagator().Extract(ctx, headerCarrier{headers: &headers})
+
+	return tracing.Tracer().Start(ctx, "process "+message.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(message.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(message.Partition)),
+			semconv.MessagingKafkaConsumerGroup(group),
+			semconv.MessagingKafkaMessageOffset(int(message.Offset)),
+		),
+	)
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+func TestHeaderCarrier(t *testing.T) {
+	t.Run("test that set replaces an existing header", func(t *testing.T) {
+		headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}, {Key: "other", Value: []byte("value")}}
+		carrier := headerCarrier{headers: &headers}
+
+		carrier.Set("traceparent", "new")
+		carrier.Set("tracestate", "state")
+
+		assert.Len(t, headers, 3)
+		assert.Equal(t, "new", carrier.Get("traceparent"))
+		assert.Equal(t, "state", carrier.Get("tracestate"))
+		assert.Equal(t, "", carrier.Get("missing"))
+		assert.Equal(t, []string{"traceparent", "other", "tracestate"}, carrier.Keys())
+	})
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	_, err := tracing.Setup(context.Background(), tracing.Config{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	t.Run("test that the consumer continues the trace of the producer", func(t *testing.T) {
+		var headers []kafka.Header
+		pCtx, publish := startPublishSpan(context.Background(), "payment.completed", &headers)
+		publish.End()
+
+		message := kafka.Message{Topic: "payment.completed", Headers: headers}
+		_, process := startProcessSpan(context.Background(), message, "payment.completed-group")
+		process.End()
+
+		spans := recorder.Ended()
+		if assert.Len(t, spans, 2) {
+			assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind())
+			assert.Equal(t, trace.SpanKindConsumer, spans[1].SpanKind())
+			// the process span is a child of the publish span
+			assert.Equal(t, trace.SpanContextFromContext(pCtx).TraceID(), spans[1].SpanContext().TraceID())
+			assert.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+	"github.com/SirWaithaka/payments-api/src/clients/pool"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+// ConsumerConfig specific configuration for consumers.
+type ConsumerConfig struct {
+	Subject string
+	// name of the durable consumer, consumers with the same name share messages
+	Durable string
+	// max number of times a message is delivered before it is terminated
+	MaxDeliver int
+	// duration the server waits for an ack before redelivering a message
+	AckWait time.Duration
+	// duration to delay before a failed message is redelivered
+	RetryDelay time.Duration
+	// number of messages handled concurrently, defaults to 1
+	Concurrency int
+}
+
+// Consumer is a durable JetStream pull consumer.
+type Consumer struct {
+	client  *Client
+	cfg     ConsumerConfig
+	handler events.Handler
+
+	workers *pool.Pool[jetstream.Msg]
+}
+
+// NewConsumer creates a new consumer instance.
+func NewConsumer(client *Client, cCfg ConsumerConfig) *Consumer {
+	workers := pool.New(cCfg.Concurrency, key)
+	cCfg.Concurrency = workers.Size()
+
+	return &Consumer{client: client, cfg: cCfg, workers: workers}
+}
+
+// ReadMessage reads messages from the subject until ctx is cancelled.
+//
+// Messages are handled by a pool of workers. Messages with the same key are handled
+// by the same worker. A message is acked after the handler succeeds, and nak-ed with
+// a delay when it fails so that the server redelivers it. Once a message has been
+// delivered MaxDeliver times it is terminated and not delivered again.
+func (c *Consumer) ReadMessage(ctx context.Context) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("starting consumer - %s on stream %s with %d workers", c.cfg.Subject, c.client.stream, c.cfg.Concurrency)
+
+	consumer, err := c.client.js.CreateOrUpdateConsumer(ctx, c.client.stream, jetstream.ConsumerConfig{
+		Durable:       c.cfg.Durable,
+		FilterSubject: c.cfg.Subject,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.cfg.AckWait,
+		MaxDeliver:    c.cfg.MaxDeliver,
+	})
+	if err != nil {
+		l.Error().Err(err).Msg("failed to create consumer")
+		return err
+	}
+
+	iter, err := consumer.Messages(jetstream.PullMaxMessages(c.cfg.Concurrency))
+	if err != nil {
+		l.Error().Err(err).Msg("failed to start consuming messages")
+		return err
+	}
+	defer iter.Stop()
+
+	fetch := func(ctx context.Context) (jetstream.Msg, error) {
+		msg, err := iter.Next(jetstream.NextContext(ctx))
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return nil, pool.ErrClosed
+		}
+		return msg, err
+	}
+	err = c.workers.Run(ctx, fetch, c.handle)
+	l.Debug().Msgf("stopping consumer - %s", c.cfg.Subject)
+
+	return err
+}
+
+// key returns the key of the message, messages with the same key are handled in order
+func key(msg jetstream.Msg) string {
+	return msg.Headers().Get(HeaderKey)
+}
+
+// handle parses and processes a single message, then acks or naks it.
+func (c *Consumer) handle(_, ctx context.Context, msg jetstream.Msg) error {
+	// the handler continues with the request id of the producer
+	ctx = requestid.WithContext(ctx, msg.Headers().Get(requestid.Header))
+	l := zerolog.Ctx(ctx)
+
+	md, err := msg.Metadata()
+	if err != nil {
+		l.Error().Err(err).Msg("failed to read message metadata")
+		return nil
+	}
+	l.Info().Msgf("message at sequence %d, delivery: %d", md.Sequence.Stream, md.NumDelivered)
+	metrics.SetConsumerLag(broker, c.cfg.Subject, c.cfg.Durable, "", int64(md.NumPending))
+
+	// get the event handler
+	out, fn := c.handler()
+	if fn == nil {
+		l.Debug().Msg("return handler func is nil")
+		return errors.New("handler func is nil")
+	}
+
+	// parse event payload into the out var
+	if err = jsoniter.NewDecoder(bytes.NewReader(msg.Data())).Decode(out); err != nil {
+		l.Error().Err(err).Msg("json error parsing message into variable")
+		// the message will never parse, redelivering it is pointless
+		c.term(ctx, msg, err)
+		return nil
+	}
+	l.Debug().Any(logger.LData, out).Msg("message parsed")
+
+	// the handler continues the trace of the producer
+	ctx, span := startProcessSpan(ctx, msg, c.cfg.Durable)
+	defer span.End()
+
+	// call the event handler function
+	if err = call(ctx, fn); err == nil {
+		// a failed ack only means the message is redelivered
+		if err = msg.Ack(); err != nil {
+			l.Error().Err(err).Msg("failed to ack message")
+		}
+		return nil
+	}
+	l.Warn().Err(err).Msgf("message handler error, delivery: %d", md.NumDelivered)
+	tracing.RecordError(span, err)
+	metrics.EventConsumeError(broker, c.cfg.Subject, c.cfg.Durable)
+
+	if c.cfg.MaxDeliver > 0 && md.NumDelivered >= uint64(c.cfg.MaxDeliver) {
+		c.term(ctx, msg, err)
+		return nil
+	}
+
+	// redeliver with exponential backoff
+	delay := time.Duration(float64(c.cfg.RetryDelay) * math.Pow(1.5, float64(md.NumDelivered-1)))
+	if err = msg.NakWithDelay(delay); err != nil {
+		l.Error().Err(err).Msg("failed to nak message")
+	}
+
+	return nil
+}
+
+// term tells the server to stop redelivering the message
+func (c *Consumer) term(ctx context.Context, msg jetstream.Msg, cause error) {
+	l := zerolog.Ctx(ctx)
+
+	if err := msg.TermWithReason(cause.Error()); err != nil {
+		l.Error().Err(err).Msg("failed to terminate message")
+		return
+	}
+	l.Warn().Err(cause).Msgf("message on %s terminated", msg.Subject())
+}
+
+// call runs the handler function, a panic in the handler is returned as an error
+func call(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(ctx).WithLevel(zerolog.FatalLevel).Str(logger.LData, string(debug.Stack())).Msg("recovered from panic")
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func (c *Consumer) SetHandler(handler events.Handler) {
+	c.handler = handler
+}
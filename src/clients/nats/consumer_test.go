@@ -0,0 +1,143 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+// fakeMsg is a delivered message that records how it was acknowledged
+type fakeMsg struct {
+	jetstream.Msg
+
+	data      []byte
+	headers   nats.Header
+	delivered uint64
+
+	acked      bool
+	nakDelay   time.Duration
+	termReason string
+}
+
+func (msg *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: msg.delivered}, nil
+}
+
+func (msg *fakeMsg) Data() []byte { return msg.data }
+
+func (msg *fakeMsg) Headers() nats.Header { return msg.headers }
+
+func (msg *fakeMsg) Subject() string { return "payment.completed" }
+
+func (msg *fakeMsg) Ack() error {
+	msg.acked = true
+	return nil
+}
+
+func (msg *fakeMsg) NakWithDelay(delay time.Duration) error {
+	msg.nakDelay = delay
+	return nil
+}
+
+func (msg *fakeMsg) TermWithReason(reason string) error {
+	msg.termReason = reason
+	return nil
+}
+
+type testEvent struct {
+	ID string `json:"id"`
+}
+
+func (event testEvent) Message() any { return event }
+
+func newTestConsumer(fn func(ctx context.Context, event *testEvent) error) *Consumer {
+	c := NewConsumer(nil, ConsumerConfig{
+		Subject:    "payment.completed",
+		Durable:    "payment-completed-group",
+		MaxDeliver: 3,
+		RetryDelay: 100 * time.Millisecond,
+	})
+	c.SetHandler(func() (pkgevents.EventMessage, func(context.Context) error) {
+		event := &testEvent{}
+		return event, func(ctx context.Context) error { return fn(ctx, event) }
+	})
+	return c
+}
+
+func TestConsumer_handle(t *testing.T) {
+	t.Run("test that a handled message is acked", func(t *testing.T) {
+		var handled testEvent
+		var id string
+		c := newTestConsumer(func(ctx context.Context, event *testEvent) error {
+			handled = *event
+			id = requestid.FromContext(ctx)
+			return nil
+		})
+
+		msg := &fakeMsg{data: []byte(`{"id":"1"}`), headers: nats.Header{requestid.Header: []string{"req-1"}}, delivered: 1}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+
+		assert.True(t, msg.acked)
+		assert.Equal(t, testEvent{ID: "1"}, handled)
+		assert.Equal(t, "req-1", id)
+	})
+
+	t.Run("test that a failed message is redelivered with backoff", func(t *testing.T) {
+		c := newTestConsumer(func(context.Context, *testEvent) error { return errors.New("handler error") })
+
+		msg := &fakeMsg{data: []byte(`{"id":"1"}`), headers: nats.Header{}, delivered: 1}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+		assert.False(t, msg.acked)
+		assert.Equal(t, 100*time.Millisecond, msg.nakDelay)
+
+		msg = &fakeMsg{data: []byte(`{"id":"1"}`), headers: nats.Header{}, delivered: 2}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+		assert.Equal(t, 150*time.Millisecond, msg.nakDelay)
+	})
+
+	t.Run("test that a message is terminated after the last delivery", func(t *testing.T) {
+		c := newTestConsumer(func(context.Context, *testEvent) error { return errors.New("handler error") })
+
+		msg := &fakeMsg{data: []byte(`{"id":"1"}`), headers: nats.Header{}, delivered: 3}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+		assert.Equal(t, "handler error", msg.termReason)
+		assert.Zero(t, msg.nakDelay)
+	})
+
+	t.Run("test that a message that cannot be parsed is terminated", func(t *testing.T) {
+		called := false
+		c := newTestConsumer(func(context.Context, *testEvent) error {
+			called = true
+			return nil
+		})
+
+		msg := &fakeMsg{data: []byte(`not json`), headers: nats.Header{}, delivered: 1}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+		assert.NotEmpty(t, msg.termReason)
+		assert.False(t, called)
+	})
+
+	t.Run("test that a panic in the handler is redelivered", func(t *testing.T) {
+		c := newTestConsumer(func(context.Context, *testEvent) error { panic("fake panic") })
+
+		msg := &fakeMsg{data: []byte(`{"id":"1"}`), headers: nats.Header{}, delivered: 1}
+		assert.Nil(t, c.handle(t.Context(), t.Context(), msg))
+		assert.Equal(t, 100*time.Millisecond, msg.nakDelay)
+	})
+}
+
+func TestKey(t *testing.T) {
+	msg := &fakeMsg{headers: nats.Header{}}
+	assert.Equal(t, "", key(msg))
+
+	msg.headers.Set(HeaderKey, "payment-1")
+	assert.Equal(t, "payment-1", key(msg))
+}
@@ -0,0 +1,79 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+)
+
+// broker is the name of the broker in metrics
+const broker = "nats"
+
+// Config common configuration used by both producers and consumers.
+type Config struct {
+	URL string
+	// name of the stream that stores published messages
+	Stream string
+	// subjects captured by the stream
+	Subjects []string
+	// window in which published messages with the same id are discarded as duplicates
+	DuplicateWindow time.Duration
+}
+
+// Client is a NATS connection with a JetStream context, shared by producers and consumers.
+type Client struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream string
+}
+
+// Connect connects to the NATS server and creates the stream, or updates
+// its configuration if it already exists.
+func Connect(ctx context.Context, cfg Config) (*Client, error) {
+	l := zerolog.Ctx(ctx)
+
+	conn, err := nats.Connect(cfg.URL, nats.Name("payments-api"), nats.MaxReconnects(-1))
+	if err != nil {
+		l.Error().Err(err).Msg("failed to connect to nats")
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       cfg.Stream,
+		Subjects:   cfg.Subjects,
+		Storage:    jetstream.FileStorage,
+		Retention:  jetstream.LimitsPolicy,
+		Duplicates: cfg.DuplicateWindow,
+	})
+	if err != nil {
+		conn.Close()
+		l.Error().Err(err).Msg("failed to create stream")
+		return nil, fmt.Errorf("stream %s: %w", cfg.Stream, err)
+	}
+	l.Debug().Msgf("connected to nats on %s, stream %s", conn.ConnectedUrl(), cfg.Stream)
+
+	return &Client{conn: conn, js: js, stream: cfg.Stream}, nil
+}
+
+// Close drains the connection, pending messages are flushed before it is closed.
+func (c *Client) Close() error {
+	return c.conn.Drain()
+}
+
+// Ping checks that the client is connected and makes a round trip to the server
+func (c *Client) Ping(ctx context.Context) error {
+	if status := c.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("connection %s", status)
+	}
+	return c.conn.FlushWithContext(ctx)
+}
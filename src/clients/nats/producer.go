@@ -0,0 +1,78 @@
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+// HeaderKey is the message header that carries the message key. Messages
+// with the same key are handled by the same consumer worker.
+const HeaderKey = "Payments-Key"
+
+// ProducerConfig specific configuration for producers.
+type ProducerConfig struct {
+	// max number of retries when the stream is unavailable
+	PostRetries int
+	// duration to delay before making a retry
+	RetryDelay time.Duration
+}
+
+// Producer publishes messages to a JetStream stream.
+type Producer struct {
+	js          jetstream.JetStream
+	postRetries int
+	retryDelay  time.Duration
+}
+
+// NewProducer creates a new producer instance.
+func NewProducer(client *Client, pCfg ProducerConfig) *Producer {
+	return &Producer{js: client.js, postRetries: pCfg.PostRetries, retryDelay: pCfg.RetryDelay}
+}
+
+// SendMessage publishes a message to the subject and waits for the stream to acknowledge it.
+// The id is used by the stream to discard duplicate publishes of the same message, and
+// the request id and the trace context of ctx are added to the message headers.
+func (p *Producer) SendMessage(ctx context.Context, subject, id, key string, value []byte) (err error) {
+	l := zerolog.Ctx(ctx)
+
+	msg := nats.NewMsg(subject)
+	msg.Data = value
+	if key != "" {
+		msg.Header.Set(HeaderKey, key)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		msg.Header.Set(requestid.Header, id)
+	}
+
+	ctx, span := startPublishSpan(ctx, msg)
+	defer func() { tracing.End(span, err) }()
+
+	opts := []jetstream.PublishOpt{
+		jetstream.WithRetryAttempts(p.postRetries),
+		jetstream.WithRetryWait(p.retryDelay),
+	}
+	if id != "" {
+		opts = append(opts, jetstream.WithMsgID(id))
+	}
+
+	ack, err := p.js.PublishMsg(ctx, msg, opts...)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to send message")
+		return err
+	}
+
+	if ack.Duplicate {
+		l.Debug().Msgf("duplicate message %s discarded by stream", id)
+		return nil
+	}
+	l.Debug().Msgf("message sent, stream sequence: %d", ack.Sequence)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+)
+
+// fakeJetStream records the published messages
+type fakeJetStream struct {
+	jetstream.JetStream
+
+	published []*nats.Msg
+	err       error
+}
+
+func (js *fakeJetStream) PublishMsg(_ context.Context, msg *nats.Msg, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	if js.err != nil {
+		return nil, js.err
+	}
+	js.published = append(js.published, msg)
+	return &jetstream.PubAck{Stream: "PAYMENTS", Sequence: uint64(len(js.published))}, nil
+}
+
+func TestProducer_SendMessage(t *testing.T) {
+	t.Run("test that the key and request id are sent in the headers", func(t *testing.T) {
+		js := &fakeJetStream{}
+		producer := &Producer{js: js}
+
+		ctx := requestid.WithContext(t.Context(), "req-1")
+		err := producer.SendMessage(ctx, "payment.completed", "event-1", "payment-1", []byte(`{"id":"1"}`))
+		assert.Nil(t, err)
+
+		if assert.Len(t, js.published, 1) {
+			msg := js.published[0]
+			assert.Equal(t, "payment.completed", msg.Subject)
+			assert.Equal(t, []byte(`{"id":"1"}`), msg.Data)
+			assert.Equal(t, "payment-1", msg.Header.Get(HeaderKey))
+			assert.Equal(t, "req-1", msg.Header.Get(requestid.Header))
+		}
+	})
+
+	t.Run("test that a message without a key has no key header", func(t *testing.T) {
+		js := &fakeJetStream{}
+		producer := &Producer{js: js}
+
+		assert.Nil(t, producer.SendMessage(t.Context(), "payment.completed", "event-1", "", nil))
+		if assert.Len(t, js.published, 1) {
+			assert.Empty(t, js.published[0].Header.Values(HeaderKey))
+		}
+	})
+
+	t.Run("test that publish errors are returned", func(t *testing.T) {
+		producer := &Producer{js: &fakeJetStream{err: errors.New("no responders")}}
+
+		err := producer.SendMessage(t.Context(), "payment.completed", "event-1", "", nil)
+		assert.EqualError(t, err, "no responders")
+	})
+}
@@ -0,0 +1,53 @@
+package nats
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+var (
+	// system is the name of the messaging system in spans
+	system = semconv.MessagingSystemKey.String("nats")
+	// consumerKey is the attribute of the durable consumer that handles a message
+	consumerKey = attribute.Key("messaging.consumer.group.name")
+)
+
+// startPublishSpan starts a producer span for the message, and adds its trace context
+// to the message headers
+func startPublishSpan(ctx context.Context, msg *nats.Msg) (context.Context, trace.Span) {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+msg.Subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			system,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(msg.Subject),
+		),
+	)
+	tracing.Propagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	return ctx, span
+}
+
+// startProcessSpan starts a consumer span for a message, continuing the trace of the
+// producer from the message headers
+func startProcessSpan(ctx context.Context, msg jetstream.Msg, durable string) (context.Context, trace.Span) {
+	ctx = tracing.Propagator().Extract(ctx, propagation.HeaderCarrier(msg.Headers()))
+
+	return tracing.Tracer().Start(ctx, "process "+msg.Subject(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			system,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(msg.Subject()),
+			consumerKey.String(durable),
+		),
+	)
+}
@@ -0,0 +1,141 @@
+// Package pool handles the messages of a broker consumer with a pool of workers.
+package pool
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrClosed is returned by Fetch once no more messages can be fetched, the pool then stops
+var ErrClosed = errors.New("pool: fetch closed")
+
+// Fetch returns the next message, it blocks until a message is fetched or ctx is done
+type Fetch[M any] func(ctx context.Context) (M, error)
+
+// Handle handles a single message. ctx is cancelled when the pool stops, hCtx is not,
+// so that a message being handled runs to completion. An error stops the pool.
+type Handle[M any] func(ctx, hCtx context.Context, message M) error
+
+// Key returns the key of a message, messages without a key return an empty string
+type Key[M any] func(message M) string
+
+// Pool dispatches fetched messages to a fixed number of workers. Messages with the same
+// key are always handled by the same worker, so they are handled in the order they were
+// fetched.
+type Pool[M any] struct {
+	size int
+	key  Key[M]
+
+	// round-robin counter for messages without a key
+	next uint32
+}
+
+// New creates a pool of size workers, a size less than 1 creates a single worker
+func New[M any](size int, key Key[M]) *Pool[M] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Pool[M]{size: size, key: key}
+}
+
+// Size returns the number of workers of the pool
+func (p *Pool[M]) Size() int {
+	return p.size
+}
+
+// Run fetches messages and handles them until ctx is cancelled or a message fails to be
+// handled. Messages already being handled when ctx is cancelled are finished before Run
+// returns, messages still queued are not handled.
+func (p *Pool[M]) Run(ctx context.Context, fetch Fetch[M], handle Handle[M]) error {
+	// in-flight messages are handled with a context that is not cancelled
+	// on shutdown, so that they run to completion
+	hCtx := context.WithoutCancel(ctx)
+
+	g, gCtx := errgroup.WithContext(ctx)
+
+	// start the workers, each with its own queue
+	queues := make([]chan M, p.size)
+	for i := range queues {
+		queue := make(chan M)
+		queues[i] = queue
+		g.Go(func() error {
+			return p.work(gCtx, hCtx, queue, handle)
+		})
+	}
+
+	g.Go(func() error {
+		// stop the workers once fetching stops
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
+		return p.fetch(gCtx, queues, fetch)
+	})
+
+	return g.Wait()
+}
+
+// fetch reads messages and dispatches each to a worker queue chosen by the message key
+func (p *Pool[M]) fetch(ctx context.Context, queues []chan M, fetch Fetch[M]) error {
+	l := zerolog.Ctx(ctx)
+
+	for {
+		message, err := fetch(ctx)
+		if err != nil {
+			// check if context is canceled or fetching has stopped
+			if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+				return nil
+			}
+			l.Error().Err(err).Msg("failed to fetch message")
+			continue
+		}
+
+		select {
+		case queues[p.worker(p.key(message))] <- message:
+		case <-ctx.Done():
+			// the message is not handled and will be redelivered
+			return nil
+		}
+	}
+}
+
+// worker returns the index of the worker that handles messages with the given key.
+// Messages without a key have no ordering and are spread across workers.
+func (p *Pool[M]) worker(key string) int {
+	if key == "" {
+		p.next++
+		return int(p.next % uint32(p.size))
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(p.size))
+}
+
+// work handles messages from the queue one at a time until the queue is closed
+func (p *Pool[M]) work(ctx, hCtx context.Context, queue <-chan M, handle Handle[M]) error {
+	l := zerolog.Ctx(ctx)
+
+	for message := range queue {
+		// messages still queued when the pool stops are not handled,
+		// they are not acknowledged and will be redelivered
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if err := handle(ctx, hCtx, message); err != nil {
+			// the message is not acknowledged, stop consuming so that it is
+			// redelivered instead of being skipped
+			l.Error().Err(err).Msg("stopping workers, message not acknowledged")
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	key string
+	id  int
+}
+
+func messageKey(m message) string { return m.key }
+
+// source returns a Fetch that returns the messages then blocks until ctx is done
+func source(messages ...message) Fetch[message] {
+	ch := make(chan message, len(messages))
+	for _, m := range messages {
+		ch <- m
+	}
+
+	return func(ctx context.Context) (message, error) {
+		select {
+		case m := <-ch:
+			return m, nil
+		case <-ctx.Done():
+			return message{}, ctx.Err()
+		}
+	}
+}
+
+func TestPool_worker(t *testing.T) {
+	t.Run("test that messages with the same key are routed to the same worker", func(t *testing.T) {
+		p := New(4, messageKey)
+
+		for _, key := range []string{"payment-1", "payment-2", "payment-3"} {
+			worker := p.worker(key)
+			assert.GreaterOrEqual(t, worker, 0)
+			assert.Less(t, worker, 4)
+			for range 5 {
+				assert.Equal(t, worker, p.worker(key))
+			}
+		}
+	})
+
+	t.Run("test that messages without a key are spread across workers", func(t *testing.T) {
+		p := New(4, messageKey)
+
+		workers := make(map[int]int)
+		for range 8 {
+			workers[p.worker("")]++
+		}
+		assert.Equal(t, map[int]int{0: 2, 1: 2, 2: 2, 3: 2}, workers)
+	})
+
+	t.Run("test that a pool has at least one worker", func(t *testing.T) {
+		p := New(0, messageKey)
+
+		assert.Equal(t, 1, p.Size())
+		assert.Equal(t, 0, p.worker("payment-1"))
+	})
+}
+
+func TestPool_Run(t *testing.T) {
+	t.Run("test that messages with the same key are handled in order", func(t *testing.T) {
+		p := New(3, messageKey)
+
+		var messages []message
+		for i := range 30 {
+			messages = append(messages, message{key: string(rune('a' + i%3)), id: i})
+		}
+
+		var mu sync.Mutex
+		handled := make(map[string][]int)
+		done := make(chan struct{}, len(messages))
+		handle := func(ctx, hCtx context.Context, m message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[m.key] = append(handled[m.key], m.id)
+			done <- struct{}{}
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- p.Run(ctx, source(messages...), handle) }()
+
+		for range messages {
+			<-done
+		}
+		cancel()
+		assert.Nil(t, <-errs)
+
+		for key, ids := range handled {
+			assert.IsIncreasing(t, ids, key)
+			assert.Len(t, ids, 10)
+		}
+	})
+
+	t.Run("test that messages with different keys are handled concurrently", func(t *testing.T) {
+		p := New(2, messageKey)
+
+		// find two keys that are routed to different workers
+		keys := []string{"a"}
+		for _, key := range []string{"b", "c", "d", "e", "f"} {
+			if p.worker(key) != p.worker(keys[0]) {
+				keys = append(keys, key)
+				break
+			}
+		}
+
+		// each handler waits for the other, they only finish if they run at the same time
+		var started sync.WaitGroup
+		started.Add(2)
+		both := make(chan struct{})
+		go func() { started.Wait(); close(both) }()
+
+		done := make(chan error, 2)
+		handle := func(ctx, hCtx context.Context, m message) error {
+			started.Done()
+			select {
+			case <-both:
+				done <- nil
+			case <-time.After(time.Second):
+				done <- errors.New("handlers did not run concurrently")
+			}
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- p.Run(ctx, source(message{key: keys[0]}, message{key: keys[1]}), handle) }()
+
+		assert.Nil(t, <-done)
+		assert.Nil(t, <-done)
+		cancel()
+		assert.Nil(t, <-errs)
+	})
+
+	t.Run("test that an in-flight message is finished when the pool stops", func(t *testing.T) {
+		p := New(1, messageKey)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var finished bool
+		handle := func(ctx, hCtx context.Context, m message) error {
+			close(started)
+			<-release
+			// the handler context is not cancelled
+			finished = hCtx.Err() == nil
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		errs := make(chan error, 1)
+		go func() { errs <- p.Run(ctx, source(message{id: 1}), handle) }()
+
+		<-started
+		cancel()
+		close(release)
+
+		assert.Nil(t, <-errs)
+		assert.True(t, finished)
+	})
+
+	t.Run("test that a handler error stops the pool", func(t *testing.T) {
+		p := New(2, messageKey)
+
+		handle := func(ctx, hCtx context.Context, m message) error {
+			return errors.New("handler error")
+		}
+
+		err := p.Run(t.Context(), source(message{id: 1}), handle)
+		assert.EqualError(t, err, "handler error")
+	})
+
+	t.Run("test that a closed fetch stops the pool", func(t *testing.T) {
+		p := New(2, messageKey)
+
+		calls := 0
+		fetch := func(ctx context.Context) (message, error) {
+			calls++
+			if calls == 1 {
+				return message{}, errors.New("fetch error")
+			}
+			return message{}, ErrClosed
+		}
+		handle := func(ctx, hCtx context.Context, m message) error { return nil }
+
+		assert.Nil(t, p.Run(t.Context(), fetch, handle))
+		assert.Equal(t, 2, calls)
+	})
+}
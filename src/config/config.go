@@ -1,32 +1,303 @@
 package config
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+// supported event brokers
+const (
+	BrokerKafka = "kafka"
+	BrokerNats  = "nats"
+)
+
+// roles of a process, a process serves one or more roles
+const (
+	// client facing api endpoints
+	RoleAPI = "api"
+	// partner webhook endpoints
+	RoleWebhooks = "webhooks"
+	// event consumers and background jobs
+	RoleWorker = "worker"
+)
+
+// partner environments, a shortcode is configured for one of them
+const (
+	EnvironmentSandbox    = "sandbox"
+	EnvironmentProduction = "production"
+)
+
+// Roles is the set of roles served by a process
+type Roles []string
+
+// Has reports whether the role is in the set
+func (roles Roles) Has(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+// ParseRoles parses a comma separated list of roles
+func ParseRoles(value string) (Roles, error) {
+	var roles Roles
+	for _, role := range strings.Split(value, ",") {
+		role = strings.TrimSpace(role)
+		switch role {
+		case RoleAPI, RoleWebhooks, RoleWorker:
+		default:
+			return nil, fmt.Errorf("unsupported role %q", role)
+		}
+
+		if !roles.Has(role) {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, nil
+}
+
+// HTTPConfig configures the http server
+type HTTPConfig struct {
+	Port string `yaml:"port"`
+	// port of the readiness, breaker and metrics endpoints, it should not be exposed
+	// outside the cluster
+	InternalPort string `yaml:"internal_port"`
+	// proxies trusted to set the client ip in the X-Forwarded-For header
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// max duration to read the headers of a request
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// max duration to read a request, including its body
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// max duration to write a response, it should allow for the partner api calls
+	// made by a request
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// max duration an idle keep-alive connection is kept open
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
 type PostgresConfigs struct {
-	User     string
-	Password string
-	Host     string
-	Port     string
-	DbName   string
-	Schema   string
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	DbName   string `yaml:"database"`
+	Schema   string `yaml:"schema"`
+	// max number of open connections of the pool, unlimited if 0
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// max number of idle connections kept in the pool
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// max duration a connection is reused, connections are reused forever if 0
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// max duration a connection is idle before it is closed, idle connections are kept if 0
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// refuse to serve while migrations of the schema have not been applied
+	CheckSchema bool `yaml:"check_schema"`
 }
 
 type KafkaConfig struct {
-	Host string
+	// comma separated addresses of the brokers
+	Host     string              `yaml:"brokers"`
+	Consumer KafkaConsumerConfig `yaml:"consumer"`
+	Producer KafkaProducerConfig `yaml:"producer"`
+}
+
+// KafkaConsumerConfig tunes the consumers of event subscriptions
+type KafkaConsumerConfig struct {
+	// number of messages each consumer handles concurrently
+	Concurrency int `yaml:"concurrency"`
+	// min and max number of bytes fetched from the broker at once
+	MinBytes int `yaml:"min_bytes"`
+	MaxBytes int `yaml:"max_bytes"`
+	// interval at which the offsets of handled messages are committed
+	CommitInterval time.Duration `yaml:"commit_interval"`
+	// max number of times a failed message is retried before it is dead-lettered
+	MaxRetries int `yaml:"max_retries"`
+	// duration to delay before the first retry of a failed message
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+// KafkaProducerConfig tunes the producers of events and of dead-lettered messages
+type KafkaProducerConfig struct {
+	// max number of messages sent to the broker in a batch
+	BatchSize int `yaml:"batch_size"`
+	// max duration to wait for a batch to fill before it is sent
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+	// max number of retries when sending a message
+	Retries int `yaml:"retries"`
+	// duration to delay before making a retry
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+// NatsConfig configures the jetstream event broker
+type NatsConfig struct {
+	URL string `yaml:"url"`
+	// name of the stream that stores events
+	Stream string `yaml:"stream"`
+	// subjects captured by the stream
+	Subjects []string `yaml:"subjects"`
+	// max number of times an event is delivered to a consumer
+	MaxDeliver int `yaml:"max_deliver"`
+	// duration to wait for a consumer to ack an event before it is redelivered
+	AckWait time.Duration `yaml:"ack_wait"`
+	// number of messages each consumer handles concurrently
+	ConsumerConcurrency int `yaml:"consumer_concurrency"`
+	// duration to delay before the first redelivery of a failed event
+	ConsumerRetryDelay time.Duration `yaml:"consumer_retry_delay"`
+	// max number of retries when publishing an event
+	ProducerRetries int `yaml:"producer_retries"`
+	// duration to delay before retrying to publish an event
+	ProducerRetryDelay time.Duration `yaml:"producer_retry_delay"`
+}
+
+// WebhooksConfig configures how partner webhooks are authenticated
+type WebhooksConfig struct {
+	// ip addresses or cidr ranges daraja webhooks are accepted from, none if empty
+	DarajaAllowedIPs []string `yaml:"daraja_allowed_ips"`
+	// max age of a quikk webhook signature
+	QuikkSignatureMaxAge time.Duration `yaml:"quikk_signature_max_age"`
+}
+
+// CredentialsConfig configures the master keys shortcode credentials are encrypted with
+type CredentialsConfig struct {
+	// master keys in the form <key id>:<base64 key>
+	MasterKeys []string `yaml:"master_keys"`
+	// file with a master key in the form <key id>:<base64 key> on each line
+	KeyFile string `yaml:"key_file"`
+	// id of the master key new credentials are encrypted with, not required with one master key
+	PrimaryKeyID string `yaml:"primary_key_id"`
+	// allow credentials to be saved in plaintext without a master key, for development only
+	AllowPlaintext bool `yaml:"allow_plaintext"`
+}
+
+// AuthConfig configures how api clients are authenticated
+type AuthConfig struct {
+	// disables authentication of api requests, only for local development
+	Disabled bool `yaml:"disabled"`
+	// max age of a request signature, signed requests are rejected if their timestamp
+	// differs from the server time by more than the max age
+	MaxSignatureAge time.Duration `yaml:"max_signature_age"`
+}
+
+// RateLimitConfig configures the token bucket limits of requests, a zero limit is disabled
+type RateLimitConfig struct {
+	// api requests of each api client
+	Client rate.Limit `yaml:"client"`
+	// payments charged from or paid to each customer phone number
+	MSISDN rate.Limit `yaml:"msisdn"`
+	// partner api calls made with each shortcode
+	ShortCode rate.Limit `yaml:"shortcode"`
+}
+
+// BreakerConfig configures the circuit breakers of partner api calls made with each shortcode
+type BreakerConfig struct {
+	// number of latest calls the error and slow call rates are computed from, breakers are
+	// disabled if 0
+	Window int `yaml:"window"`
+	// minimum number of calls in the window before the breaker can open
+	MinCalls int `yaml:"min_calls"`
+	// rate of failed calls in the window that opens the breaker, between 0 and 1
+	ErrorRate float64 `yaml:"error_rate"`
+	// calls that take longer are slow
+	SlowCallDuration time.Duration `yaml:"slow_call_duration"`
+	// rate of slow calls in the window that opens the breaker, between 0 and 1
+	SlowCallRate float64 `yaml:"slow_call_rate"`
+	// duration the breaker rejects calls before it allows trial calls
+	OpenDuration time.Duration `yaml:"open_duration"`
+	// number of successful trial calls that close the breaker
+	HalfOpenCalls int `yaml:"half_open_calls"`
+	// use the shortcode with the next priority when the breaker of a shortcode is open,
+	// requests fail fast if false
+	Failover bool `yaml:"failover"`
+}
+
+// TracingConfig configures the export of opentelemetry traces
+type TracingConfig struct {
+	// otlp http endpoint of the collector, e.g. http://localhost:4318. Traces are not
+	// exported if empty
+	Endpoint string `yaml:"endpoint"`
+	// ratio of new traces that are sampled, between 0 and 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// HealthConfig configures the readiness checks of the api
+type HealthConfig struct {
+	// duration after which a check of a component fails
+	Timeout time.Duration `yaml:"timeout"`
+	// fail readiness when a circuit breaker of partner api calls is open
+	CheckBreakers bool `yaml:"check_breakers"`
+}
+
+// JobsConfig configures the schedules of the background jobs run by the worker role
+type JobsConfig struct {
+	InboxCleanup     InboxCleanupConfig     `yaml:"inbox_cleanup"`
+	WebhookRepublish WebhookRepublishConfig `yaml:"webhook_republish"`
+	RateLimitCleanup RateLimitCleanupConfig `yaml:"rate_limit_cleanup"`
+}
+
+// InboxCleanupConfig configures the job that removes old events from the inbox of
+// processed events
+type InboxCleanupConfig struct {
+	// interval between runs of the job, the job does not run if 0
+	Interval time.Duration `yaml:"interval"`
+	// age after which processed events are removed, it should be longer than the
+	// brokers may redeliver an event
+	Retention time.Duration `yaml:"retention"`
+}
+
+// WebhookRepublishConfig configures the job that publishes the events of webhooks that
+// were saved but not published
+type WebhookRepublishConfig struct {
+	// interval between runs of the job, the job does not run if 0
+	Interval time.Duration `yaml:"interval"`
+	// age after which a webhook that was not published is published again, it should be
+	// longer than a webhook takes to be published
+	Delay time.Duration `yaml:"delay"`
+}
+
+// RateLimitCleanupConfig configures the job that removes the rate limit buckets of keys
+// that are no longer used
+type RateLimitCleanupConfig struct {
+	// interval between runs of the job, the job does not run if 0
+	Interval time.Duration `yaml:"interval"`
 }
 
-type DarajaConfig struct {
-	Endpoint string
+// PartnerConfig configures the api calls made to a partner
+type PartnerConfig struct {
+	// endpoints of the partner api by environment, sandbox or production. The public
+	// endpoint of the partner is used for an environment without one
+	Endpoints map[string]string `yaml:"endpoints"`
+	// max duration of each attempt of a partner api call, no timeout if 0
+	Timeout time.Duration `yaml:"timeout"`
 }
 
-type QuikkConfig struct {
-	Endpoint string
+// Endpoint returns the endpoint configured for the environment, empty if there is none
+func (partner PartnerConfig) Endpoint(environment string) string {
+	return partner.Endpoints[environment]
 }
 
 type Config struct {
-	ServiceName string
-	LogLevel    string
-	HTTPPort    string
-	Postgres    PostgresConfigs
-	Kafka       KafkaConfig
-	Daraja      DarajaConfig
-	Quikk       QuikkConfig
+	ServiceName string `yaml:"service_name"`
+	// roles served by the process, api, webhooks or worker
+	Roles    Roles      `yaml:"roles"`
+	LogLevel string     `yaml:"log_level"`
+	HTTP     HTTPConfig `yaml:"http"`
+	// max duration to drain in-flight requests and events on shutdown
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout"`
+	Postgres        PostgresConfigs `yaml:"postgres"`
+	// event broker used to publish and subscribe to events, kafka or nats
+	EventBroker string            `yaml:"event_broker"`
+	Kafka       KafkaConfig       `yaml:"kafka"`
+	Nats        NatsConfig        `yaml:"nats"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks"`
+	Credentials CredentialsConfig `yaml:"credentials"`
+	Auth        AuthConfig        `yaml:"auth"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limits"`
+	Breaker     BreakerConfig     `yaml:"breakers"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Health      HealthConfig      `yaml:"health"`
+	Jobs        JobsConfig        `yaml:"jobs"`
+	Daraja      PartnerConfig     `yaml:"daraja"`
+	Quikk       PartnerConfig     `yaml:"quikk"`
 }
@@ -0,0 +1,59 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+)
+
+func TestParseRoles(t *testing.T) {
+	testcases := []struct {
+		name     string
+		input    string
+		expected config.Roles
+		err      string
+	}{
+		{name: "test a single role", input: "webhooks", expected: config.Roles{config.RoleWebhooks}},
+		{name: "test many roles", input: "api,worker", expected: config.Roles{config.RoleAPI, config.RoleWorker}},
+		{name: "test that spaces are trimmed", input: " api , webhooks ", expected: config.Roles{config.RoleAPI, config.RoleWebhooks}},
+		{name: "test that duplicate roles are removed", input: "api,api,worker", expected: config.Roles{config.RoleAPI, config.RoleWorker}},
+		{name: "test an unsupported role", input: "api,admin", err: `unsupported role "admin"`},
+		{name: "test an empty role", input: "api,", err: `unsupported role ""`},
+		{name: "test no roles", input: "", err: `unsupported role ""`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			roles, err := config.ParseRoles(tc.input)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Nil(t, roles)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, roles)
+		})
+	}
+}
+
+func TestRoles_Has(t *testing.T) {
+	testcases := []struct {
+		name     string
+		roles    config.Roles
+		role     string
+		expected bool
+	}{
+		{name: "test a role in the set", roles: config.Roles{config.RoleAPI, config.RoleWorker}, role: config.RoleWorker, expected: true},
+		{name: "test a role not in the set", roles: config.Roles{config.RoleAPI, config.RoleWorker}, role: config.RoleWebhooks},
+		{name: "test an empty set", roles: nil, role: config.RoleAPI},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.roles.Has(tc.role))
+		})
+	}
+}
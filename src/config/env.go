@@ -1,44 +1,264 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"fmt"
+	"time"
 
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+// envConfig holds the settings set by env variables. Settings are nil if their variable
+// is not set, so that they do not override the defaults or the config file.
 type envConfig struct {
-	LogLevel string `envconfig:"log_level" default:"debug"`
-	HTTPPort string `envconfig:"http_port" default:"6000"`
+	ServiceName *string `envconfig:"service_name"`
+	// comma separated roles
+	Roles    *string `envconfig:"roles"`
+	LogLevel *string `envconfig:"log_level"`
+
+	HTTPPort              *string        `envconfig:"http_port"`
+	HTTPInternalPort      *string        `envconfig:"http_internal_port"`
+	HTTPTrustedProxies    *[]string      `envconfig:"http_trusted_proxies"`
+	HTTPReadHeaderTimeout *time.Duration `envconfig:"http_read_header_timeout"`
+	HTTPReadTimeout       *time.Duration `envconfig:"http_read_timeout"`
+	HTTPWriteTimeout      *time.Duration `envconfig:"http_write_timeout"`
+	HTTPIdleTimeout       *time.Duration `envconfig:"http_idle_timeout"`
+	ShutdownTimeout       *time.Duration `envconfig:"shutdown_timeout"`
+
+	PostgresUser            *string        `envconfig:"postgres_user"`
+	PostgresPassword        *string        `envconfig:"postgres_password"`
+	PostgresHost            *string        `envconfig:"postgres_host"`
+	PostgresPort            *string        `envconfig:"postgres_port"`
+	PostgresDBName          *string        `envconfig:"postgres_database"`
+	PostgresSchema          *string        `envconfig:"postgres_schema"`
+	PostgresMaxOpenConns    *int           `envconfig:"postgres_max_open_conns"`
+	PostgresMaxIdleConns    *int           `envconfig:"postgres_max_idle_conns"`
+	PostgresConnMaxLifetime *time.Duration `envconfig:"postgres_conn_max_lifetime"`
+	PostgresConnMaxIdleTime *time.Duration `envconfig:"postgres_conn_max_idle_time"`
+	PostgresCheckSchema     *bool          `envconfig:"postgres_check_schema"`
+
+	EventBroker *string `envconfig:"event_broker"`
+
+	KafkaBrokers                *string        `envconfig:"kafka_brokers"`
+	KafkaConsumerConcurrency    *int           `envconfig:"kafka_consumer_concurrency"`
+	KafkaConsumerMinBytes       *int           `envconfig:"kafka_consumer_min_bytes"`
+	KafkaConsumerMaxBytes       *int           `envconfig:"kafka_consumer_max_bytes"`
+	KafkaConsumerCommitInterval *time.Duration `envconfig:"kafka_consumer_commit_interval"`
+	KafkaConsumerMaxRetries     *int           `envconfig:"kafka_consumer_max_retries"`
+	KafkaConsumerRetryDelay     *time.Duration `envconfig:"kafka_consumer_retry_delay"`
+	KafkaProducerBatchSize      *int           `envconfig:"kafka_producer_batch_size"`
+	KafkaProducerBatchTimeout   *time.Duration `envconfig:"kafka_producer_batch_timeout"`
+	KafkaProducerRetries        *int           `envconfig:"kafka_producer_retries"`
+	KafkaProducerRetryDelay     *time.Duration `envconfig:"kafka_producer_retry_delay"`
+
+	NatsURL                 *string        `envconfig:"nats_url"`
+	NatsStream              *string        `envconfig:"nats_stream"`
+	NatsSubjects            *[]string      `envconfig:"nats_subjects"`
+	NatsMaxDeliver          *int           `envconfig:"nats_max_deliver"`
+	NatsAckWait             *time.Duration `envconfig:"nats_ack_wait"`
+	NatsConsumerConcurrency *int           `envconfig:"nats_consumer_concurrency"`
+	NatsConsumerRetryDelay  *time.Duration `envconfig:"nats_consumer_retry_delay"`
+	NatsProducerRetries     *int           `envconfig:"nats_producer_retries"`
+	NatsProducerRetryDelay  *time.Duration `envconfig:"nats_producer_retry_delay"`
+
+	WebhookDarajaAllowedIPs     *[]string      `envconfig:"webhook_daraja_allowed_ips"`
+	WebhookQuikkSignatureMaxAge *time.Duration `envconfig:"webhook_quikk_signature_max_age"`
 
-	PostgresUser     string `envconfig:"postgres_user" required:"true"`
-	PostgresPassword string `envconfig:"postgres_password" required:"true"`
-	PostgresHost     string `envconfig:"postgres_host" required:"true"`
-	PostgresPort     string `envconfig:"postgres_port" required:"true"`
-	PostgresDBName   string `envconfig:"postgres_database" default:"payments"`
-	PostgresSchema   string `envconfig:"postgres_schema" default:"public"`
+	CredentialsMasterKeys     *[]string `envconfig:"credentials_master_keys"`
+	CredentialsKeyFile        *string   `envconfig:"credentials_key_file"`
+	CredentialsPrimaryKeyID   *string   `envconfig:"credentials_primary_key_id"`
+	CredentialsAllowPlaintext *bool     `envconfig:"credentials_allow_plaintext"`
 
-	KafkaBrokers string `envconfig:"kafka_brokers" required:"true"`
+	APIAuthDisabled    *bool          `envconfig:"api_auth_disabled"`
+	APISignatureMaxAge *time.Duration `envconfig:"api_signature_max_age"`
 
-	DarajaEndpoint string `envconfig:"daraja_endpoint"` // not required
-	QuikkEndpoint  string `envconfig:"quikk_endpoint"`  // not required
+	// limits in the form <requests>/<period>, 0 disables the limit
+	RateLimitClient    *string `envconfig:"rate_limit_client"`
+	RateLimitMSISDN    *string `envconfig:"rate_limit_msisdn"`
+	RateLimitShortCode *string `envconfig:"rate_limit_shortcode"`
+
+	// breakers are disabled if the window is 0
+	BreakerWindow           *int           `envconfig:"breaker_window"`
+	BreakerMinCalls         *int           `envconfig:"breaker_min_calls"`
+	BreakerErrorRate        *float64       `envconfig:"breaker_error_rate"`
+	BreakerSlowCallDuration *time.Duration `envconfig:"breaker_slow_call_duration"`
+	BreakerSlowCallRate     *float64       `envconfig:"breaker_slow_call_rate"`
+	BreakerOpenDuration     *time.Duration `envconfig:"breaker_open_duration"`
+	BreakerHalfOpenCalls    *int           `envconfig:"breaker_half_open_calls"`
+	BreakerFailover         *bool          `envconfig:"breaker_failover"`
+
+	TracingEndpoint    *string  `envconfig:"tracing_endpoint"`
+	TracingSampleRatio *float64 `envconfig:"tracing_sample_ratio"`
+
+	HealthCheckTimeout  *time.Duration `envconfig:"health_check_timeout"`
+	HealthCheckBreakers *bool          `envconfig:"health_check_breakers"`
+
+	JobInboxCleanupInterval     *time.Duration `envconfig:"job_inbox_cleanup_interval"`
+	JobInboxCleanupRetention    *time.Duration `envconfig:"job_inbox_cleanup_retention"`
+	JobWebhookRepublishInterval *time.Duration `envconfig:"job_webhook_republish_interval"`
+	JobWebhookRepublishDelay    *time.Duration `envconfig:"job_webhook_republish_delay"`
+	JobRateLimitCleanupInterval *time.Duration `envconfig:"job_rate_limit_cleanup_interval"`
+
+	// sets the endpoint of both environments, e.g. to call a mock of the partner
+	DarajaEndpoint           *string        `envconfig:"daraja_endpoint"`
+	DarajaSandboxEndpoint    *string        `envconfig:"daraja_sandbox_endpoint"`
+	DarajaProductionEndpoint *string        `envconfig:"daraja_production_endpoint"`
+	DarajaTimeout            *time.Duration `envconfig:"daraja_timeout"`
+	QuikkEndpoint            *string        `envconfig:"quikk_endpoint"`
+	QuikkSandboxEndpoint     *string        `envconfig:"quikk_sandbox_endpoint"`
+	QuikkProductionEndpoint  *string        `envconfig:"quikk_production_endpoint"`
+	QuikkTimeout             *time.Duration `envconfig:"quikk_timeout"`
+}
+
+// set sets the value of a setting if its env variable is set
+func set[T any](setting *T, value *T) {
+	if value != nil {
+		*setting = *value
+	}
 }
 
-func FromEnv(cfg *Config) error {
+// fromEnv overrides the settings of cfg with the env variables that are set
+func fromEnv(cfg *Config) error {
 	var c envConfig
 	if err := envconfig.Process("", &c); err != nil {
 		return err
 	}
 
-	cfg.LogLevel = c.LogLevel
-	cfg.HTTPPort = c.HTTPPort
+	set(&cfg.ServiceName, c.ServiceName)
+	if c.Roles != nil {
+		roles, err := ParseRoles(*c.Roles)
+		if err != nil {
+			return fmt.Errorf("ROLES: %w", err)
+		}
+		cfg.Roles = roles
+	}
+	set(&cfg.LogLevel, c.LogLevel)
+
+	set(&cfg.HTTP.Port, c.HTTPPort)
+	set(&cfg.HTTP.InternalPort, c.HTTPInternalPort)
+	set(&cfg.HTTP.TrustedProxies, c.HTTPTrustedProxies)
+	set(&cfg.HTTP.ReadHeaderTimeout, c.HTTPReadHeaderTimeout)
+	set(&cfg.HTTP.ReadTimeout, c.HTTPReadTimeout)
+	set(&cfg.HTTP.WriteTimeout, c.HTTPWriteTimeout)
+	set(&cfg.HTTP.IdleTimeout, c.HTTPIdleTimeout)
+	set(&cfg.ShutdownTimeout, c.ShutdownTimeout)
+
+	set(&cfg.Postgres.User, c.PostgresUser)
+	set(&cfg.Postgres.Password, c.PostgresPassword)
+	set(&cfg.Postgres.Host, c.PostgresHost)
+	set(&cfg.Postgres.Port, c.PostgresPort)
+	set(&cfg.Postgres.DbName, c.PostgresDBName)
+	set(&cfg.Postgres.Schema, c.PostgresSchema)
+	set(&cfg.Postgres.MaxOpenConns, c.PostgresMaxOpenConns)
+	set(&cfg.Postgres.MaxIdleConns, c.PostgresMaxIdleConns)
+	set(&cfg.Postgres.ConnMaxLifetime, c.PostgresConnMaxLifetime)
+	set(&cfg.Postgres.ConnMaxIdleTime, c.PostgresConnMaxIdleTime)
+	set(&cfg.Postgres.CheckSchema, c.PostgresCheckSchema)
+
+	set(&cfg.EventBroker, c.EventBroker)
+
+	set(&cfg.Kafka.Host, c.KafkaBrokers)
+	set(&cfg.Kafka.Consumer.Concurrency, c.KafkaConsumerConcurrency)
+	set(&cfg.Kafka.Consumer.MinBytes, c.KafkaConsumerMinBytes)
+	set(&cfg.Kafka.Consumer.MaxBytes, c.KafkaConsumerMaxBytes)
+	set(&cfg.Kafka.Consumer.CommitInterval, c.KafkaConsumerCommitInterval)
+	set(&cfg.Kafka.Consumer.MaxRetries, c.KafkaConsumerMaxRetries)
+	set(&cfg.Kafka.Consumer.RetryDelay, c.KafkaConsumerRetryDelay)
+	set(&cfg.Kafka.Producer.BatchSize, c.KafkaProducerBatchSize)
+	set(&cfg.Kafka.Producer.BatchTimeout, c.KafkaProducerBatchTimeout)
+	set(&cfg.Kafka.Producer.Retries, c.KafkaProducerRetries)
+	set(&cfg.Kafka.Producer.RetryDelay, c.KafkaProducerRetryDelay)
+
+	set(&cfg.Nats.URL, c.NatsURL)
+	set(&cfg.Nats.Stream, c.NatsStream)
+	set(&cfg.Nats.Subjects, c.NatsSubjects)
+	set(&cfg.Nats.MaxDeliver, c.NatsMaxDeliver)
+	set(&cfg.Nats.AckWait, c.NatsAckWait)
+	set(&cfg.Nats.ConsumerConcurrency, c.NatsConsumerConcurrency)
+	set(&cfg.Nats.ConsumerRetryDelay, c.NatsConsumerRetryDelay)
+	set(&cfg.Nats.ProducerRetries, c.NatsProducerRetries)
+	set(&cfg.Nats.ProducerRetryDelay, c.NatsProducerRetryDelay)
+
+	set(&cfg.Webhooks.DarajaAllowedIPs, c.WebhookDarajaAllowedIPs)
+	set(&cfg.Webhooks.QuikkSignatureMaxAge, c.WebhookQuikkSignatureMaxAge)
+
+	set(&cfg.Credentials.MasterKeys, c.CredentialsMasterKeys)
+	set(&cfg.Credentials.KeyFile, c.CredentialsKeyFile)
+	set(&cfg.Credentials.PrimaryKeyID, c.CredentialsPrimaryKeyID)
+	set(&cfg.Credentials.AllowPlaintext, c.CredentialsAllowPlaintext)
 
-	cfg.Postgres.User = c.PostgresUser
-	cfg.Postgres.Password = c.PostgresPassword
-	cfg.Postgres.Host = c.PostgresHost
-	cfg.Postgres.Port = c.PostgresPort
-	cfg.Postgres.DbName = c.PostgresDBName
-	cfg.Postgres.Schema = c.PostgresSchema
+	set(&cfg.Auth.Disabled, c.APIAuthDisabled)
+	set(&cfg.Auth.MaxSignatureAge, c.APISignatureMaxAge)
 
-	cfg.Kafka.Host = c.KafkaBrokers
+	limits := map[string]struct {
+		value *string
+		limit *rate.Limit
+	}{
+		"RATE_LIMIT_CLIENT":    {c.RateLimitClient, &cfg.RateLimit.Client},
+		"RATE_LIMIT_MSISDN":    {c.RateLimitMSISDN, &cfg.RateLimit.MSISDN},
+		"RATE_LIMIT_SHORTCODE": {c.RateLimitShortCode, &cfg.RateLimit.ShortCode},
+	}
+	for key, v := range limits {
+		if v.value == nil {
+			continue
+		}
+		limit, err := rate.ParseLimit(*v.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*v.limit = limit
+	}
+
+	set(&cfg.Breaker.Window, c.BreakerWindow)
+	set(&cfg.Breaker.MinCalls, c.BreakerMinCalls)
+	set(&cfg.Breaker.ErrorRate, c.BreakerErrorRate)
+	set(&cfg.Breaker.SlowCallDuration, c.BreakerSlowCallDuration)
+	set(&cfg.Breaker.SlowCallRate, c.BreakerSlowCallRate)
+	set(&cfg.Breaker.OpenDuration, c.BreakerOpenDuration)
+	set(&cfg.Breaker.HalfOpenCalls, c.BreakerHalfOpenCalls)
+	set(&cfg.Breaker.Failover, c.BreakerFailover)
+
+	set(&cfg.Tracing.Endpoint, c.TracingEndpoint)
+	set(&cfg.Tracing.SampleRatio, c.TracingSampleRatio)
 
-	cfg.Daraja.Endpoint = c.DarajaEndpoint
-	cfg.Quikk.Endpoint = c.QuikkEndpoint
+	set(&cfg.Health.Timeout, c.HealthCheckTimeout)
+	set(&cfg.Health.CheckBreakers, c.HealthCheckBreakers)
+
+	set(&cfg.Jobs.InboxCleanup.Interval, c.JobInboxCleanupInterval)
+	set(&cfg.Jobs.InboxCleanup.Retention, c.JobInboxCleanupRetention)
+	set(&cfg.Jobs.WebhookRepublish.Interval, c.JobWebhookRepublishInterval)
+	set(&cfg.Jobs.WebhookRepublish.Delay, c.JobWebhookRepublishDelay)
+	set(&cfg.Jobs.RateLimitCleanup.Interval, c.JobRateLimitCleanupInterval)
+
+	partners := []struct {
+		partner                       *PartnerConfig
+		endpoint, sandbox, production *string
+		timeout                       *time.Duration
+	}{
+		{&cfg.Daraja, c.DarajaEndpoint, c.DarajaSandboxEndpoint, c.DarajaProductionEndpoint, c.DarajaTimeout},
+		{&cfg.Quikk, c.QuikkEndpoint, c.QuikkSandboxEndpoint, c.QuikkProductionEndpoint, c.QuikkTimeout},
+	}
+	for _, p := range partners {
+		endpoints := map[string]*string{
+			EnvironmentSandbox:    p.sandbox,
+			EnvironmentProduction: p.production,
+		}
+		for environment, endpoint := range endpoints {
+			// the endpoint of an environment is more specific than the endpoint of both
+			if endpoint == nil {
+				endpoint = p.endpoint
+			}
+			if endpoint == nil || *endpoint == "" {
+				continue
+			}
+			if p.partner.Endpoints == nil {
+				p.partner.Endpoints = make(map[string]string)
+			}
+			p.partner.Endpoints[environment] = *endpoint
+		}
+		set(&p.partner.Timeout, p.timeout)
+	}
 
 	return nil
 }
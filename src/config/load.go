@@ -0,0 +1,357 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+// redacted replaces secrets in a printed config
+const redacted = "[REDACTED]"
+
+// Default returns the config with the default value of each setting
+func Default() Config {
+	return Config{
+		ServiceName: "payments-api",
+		Roles:       Roles{RoleAPI, RoleWebhooks, RoleWorker},
+		LogLevel:    "debug",
+		HTTP: HTTPConfig{
+			Port:              "6000",
+			InternalPort:      "9090",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      90 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		},
+		ShutdownTimeout: 30 * time.Second,
+		Postgres: PostgresConfigs{
+			DbName:          "payments",
+			Schema:          "public",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			CheckSchema:     true,
+		},
+		EventBroker: BrokerKafka,
+		Kafka: KafkaConfig{
+			Consumer: KafkaConsumerConfig{
+				Concurrency:    4,
+				MinBytes:       10e3, // 10KB
+				MaxBytes:       10e6, // 10MB
+				CommitInterval: time.Second,
+				MaxRetries:     3,
+				RetryDelay:     500 * time.Millisecond,
+			},
+			Producer: KafkaProducerConfig{
+				BatchSize:    100,
+				BatchTimeout: 50 * time.Millisecond,
+				Retries:      10,
+				RetryDelay:   100 * time.Millisecond,
+			},
+		},
+		Nats: NatsConfig{
+			Stream:              "PAYMENTS",
+			Subjects:            []string{"payment.>", "webhook.>", "partner.>"},
+			MaxDeliver:          4,
+			AckWait:             30 * time.Second,
+			ConsumerConcurrency: 4,
+			ConsumerRetryDelay:  500 * time.Millisecond,
+			ProducerRetries:     10,
+			ProducerRetryDelay:  100 * time.Millisecond,
+		},
+		Webhooks: WebhooksConfig{QuikkSignatureMaxAge: 5 * time.Minute},
+		Auth:     AuthConfig{MaxSignatureAge: 5 * time.Minute},
+		RateLimit: RateLimitConfig{
+			Client:    rate.Limit{Rate: 100, Burst: 100},
+			MSISDN:    rate.Limit{Rate: 5.0 / 60, Burst: 5},
+			ShortCode: rate.Limit{Rate: 30, Burst: 30},
+		},
+		Breaker: BreakerConfig{
+			Window:           20,
+			MinCalls:         10,
+			ErrorRate:        0.5,
+			SlowCallDuration: 10 * time.Second,
+			SlowCallRate:     0.8,
+			OpenDuration:     30 * time.Second,
+			HalfOpenCalls:    3,
+		},
+		Tracing: TracingConfig{SampleRatio: 1},
+		Health:  HealthConfig{Timeout: 2 * time.Second},
+		Jobs: JobsConfig{
+			InboxCleanup:     InboxCleanupConfig{Interval: time.Hour, Retention: 7 * 24 * time.Hour},
+			WebhookRepublish: WebhookRepublishConfig{Interval: time.Minute, Delay: time.Minute},
+			RateLimitCleanup: RateLimitCleanupConfig{Interval: time.Hour},
+		},
+		Daraja: PartnerConfig{Timeout: 30 * time.Second},
+		Quikk:  PartnerConfig{Timeout: 30 * time.Second},
+	}
+}
+
+// Load loads the config from the defaults, the yaml file at path and the env variables,
+// in that order, each overriding the settings of the previous. The file is not read if
+// the path is empty. The loaded config is validated.
+func Load(path string, cfg *Config) error {
+	c := Default()
+
+	if path != "" {
+		if err := fromFile(path, &c); err != nil {
+			return err
+		}
+	}
+
+	if err := fromEnv(&c); err != nil {
+		return err
+	}
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	*cfg = c
+	return nil
+}
+
+// FromEnv loads the config from the defaults and the env variables
+func FromEnv(cfg *Config) error {
+	return Load("", cfg)
+}
+
+// fromFile reads the yaml file at path into cfg, settings that are not in the file
+// are left unchanged. Unknown settings are an error.
+func fromFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// an empty file has no settings
+	if err = decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Validate checks the settings of the config, all invalid settings are returned
+func (cfg Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if len(cfg.Roles) == 0 {
+		invalid("roles", "at least one role is required")
+	}
+	for _, role := range cfg.Roles {
+		if _, err := ParseRoles(role); err != nil {
+			invalid("roles", "%v", err)
+		}
+	}
+
+	required := map[string]string{
+		"postgres.user":      cfg.Postgres.User,
+		"postgres.password":  cfg.Postgres.Password,
+		"postgres.host":      cfg.Postgres.Host,
+		"postgres.port":      cfg.Postgres.Port,
+		"http.port":          cfg.HTTP.Port,
+		"http.internal_port": cfg.HTTP.InternalPort,
+	}
+	if cfg.HTTP.InternalPort != "" && cfg.HTTP.InternalPort == cfg.HTTP.Port {
+		invalid("http.internal_port", "port %s is used by http.port", cfg.HTTP.InternalPort)
+	}
+	if cfg.EventBroker != BrokerKafka && cfg.EventBroker != BrokerNats {
+		invalid("event_broker", "unsupported event broker %q", cfg.EventBroker)
+	}
+	for key, value := range required {
+		if strings.TrimSpace(value) == "" {
+			invalid(key, "required")
+		}
+	}
+
+	positive := map[string]time.Duration{
+		"shutdown_timeout":           cfg.ShutdownTimeout,
+		"health.timeout":             cfg.Health.Timeout,
+		"kafka.consumer.retry_delay": cfg.Kafka.Consumer.RetryDelay,
+		"kafka.producer.retry_delay": cfg.Kafka.Producer.RetryDelay,
+		"nats.consumer_retry_delay":  cfg.Nats.ConsumerRetryDelay,
+		"nats.producer_retry_delay":  cfg.Nats.ProducerRetryDelay,
+	}
+	notNegative := map[string]time.Duration{
+		"http.read_header_timeout":     cfg.HTTP.ReadHeaderTimeout,
+		"kafka.producer.batch_timeout": cfg.Kafka.Producer.BatchTimeout,
+		// offsets are committed synchronously if 0
+		"kafka.consumer.commit_interval":   cfg.Kafka.Consumer.CommitInterval,
+		"http.read_timeout":                cfg.HTTP.ReadTimeout,
+		"http.write_timeout":               cfg.HTTP.WriteTimeout,
+		"http.idle_timeout":                cfg.HTTP.IdleTimeout,
+		"postgres.conn_max_lifetime":       cfg.Postgres.ConnMaxLifetime,
+		"postgres.conn_max_idle_time":      cfg.Postgres.ConnMaxIdleTime,
+		"jobs.inbox_cleanup.interval":      cfg.Jobs.InboxCleanup.Interval,
+		"jobs.webhook_republish.interval":  cfg.Jobs.WebhookRepublish.Interval,
+		"jobs.rate_limit_cleanup.interval": cfg.Jobs.RateLimitCleanup.Interval,
+		"daraja.timeout":                   cfg.Daraja.Timeout,
+		"quikk.timeout":                    cfg.Quikk.Timeout,
+	}
+	for key, d := range positive {
+		if d <= 0 {
+			invalid(key, "duration %s is not positive", d)
+		}
+	}
+	for key, d := range notNegative {
+		if d < 0 {
+			invalid(key, "duration %s is negative", d)
+		}
+	}
+
+	counts := map[string]int{
+		"postgres.max_open_conns":    cfg.Postgres.MaxOpenConns,
+		"postgres.max_idle_conns":    cfg.Postgres.MaxIdleConns,
+		"kafka.consumer.min_bytes":   cfg.Kafka.Consumer.MinBytes,
+		"kafka.consumer.max_retries": cfg.Kafka.Consumer.MaxRetries,
+		"kafka.producer.retries":     cfg.Kafka.Producer.Retries,
+		"nats.producer_retries":      cfg.Nats.ProducerRetries,
+	}
+	for key, n := range counts {
+		if n < 0 {
+			invalid(key, "%d is negative", n)
+		}
+	}
+	atLeastOne := map[string]int{
+		"kafka.consumer.concurrency": cfg.Kafka.Consumer.Concurrency,
+		"kafka.consumer.max_bytes":   cfg.Kafka.Consumer.MaxBytes,
+		"kafka.producer.batch_size":  cfg.Kafka.Producer.BatchSize,
+		"nats.consumer_concurrency":  cfg.Nats.ConsumerConcurrency,
+	}
+	for key, n := range atLeastOne {
+		if n < 1 {
+			invalid(key, "%d is less than 1", n)
+		}
+	}
+	if cfg.Kafka.Consumer.MinBytes > cfg.Kafka.Consumer.MaxBytes {
+		invalid("kafka.consumer.min_bytes", "%d is more than max_bytes", cfg.Kafka.Consumer.MinBytes)
+	}
+	if cfg.Jobs.InboxCleanup.Interval > 0 && cfg.Jobs.InboxCleanup.Retention <= 0 {
+		invalid("jobs.inbox_cleanup.retention", "duration %s is not positive", cfg.Jobs.InboxCleanup.Retention)
+	}
+	if cfg.Jobs.WebhookRepublish.Interval > 0 && cfg.Jobs.WebhookRepublish.Delay <= 0 {
+		invalid("jobs.webhook_republish.delay", "duration %s is not positive", cfg.Jobs.WebhookRepublish.Delay)
+	}
+
+	rates := map[string]float64{
+		"breakers.error_rate":     cfg.Breaker.ErrorRate,
+		"breakers.slow_call_rate": cfg.Breaker.SlowCallRate,
+		"tracing.sample_ratio":    cfg.Tracing.SampleRatio,
+	}
+	for key, rate := range rates {
+		if rate < 0 || rate > 1 {
+			invalid(key, "%v is not between 0 and 1", rate)
+		}
+	}
+
+	for name, partner := range map[string]PartnerConfig{"daraja": cfg.Daraja, "quikk": cfg.Quikk} {
+		for environment, endpoint := range partner.Endpoints {
+			key := fmt.Sprintf("%s.endpoints.%s", name, environment)
+			if environment != EnvironmentSandbox && environment != EnvironmentProduction {
+				invalid(key, "unsupported environment %q", environment)
+				continue
+			}
+			if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				invalid(key, "invalid url %q", endpoint)
+			}
+		}
+	}
+
+	// report the errors in the same order every time
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// ValidateEventBroker checks that the address of the event broker is set, it is only
+// required by processes that publish or consume events
+func (cfg Config) ValidateEventBroker() error {
+	switch cfg.EventBroker {
+	case BrokerKafka:
+		if strings.TrimSpace(cfg.Kafka.Host) == "" {
+			return errors.New("kafka.brokers: required")
+		}
+	case BrokerNats:
+		if strings.TrimSpace(cfg.Nats.URL) == "" {
+			return errors.New("nats.url: required")
+		}
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the config with its secrets replaced, to be printed or logged
+func (cfg Config) Redacted() Config {
+	if cfg.Postgres.Password != "" {
+		cfg.Postgres.Password = redacted
+	}
+
+	// the ids of master keys are kept, they are not secret
+	keys := make([]string, 0, len(cfg.Credentials.MasterKeys))
+	for _, key := range cfg.Credentials.MasterKeys {
+		id, _, _ := strings.Cut(key, ":")
+		keys = append(keys, id+":"+redacted)
+	}
+	cfg.Credentials.MasterKeys = keys
+
+	// urls may carry credentials in their userinfo
+	cfg.Nats.URL = redactURLs(cfg.Nats.URL)
+	cfg.Tracing.Endpoint = redactURLs(cfg.Tracing.Endpoint)
+	cfg.Daraja.Endpoints = redactEndpoints(cfg.Daraja.Endpoints)
+	cfg.Quikk.Endpoints = redactEndpoints(cfg.Quikk.Endpoints)
+
+	return cfg
+}
+
+// redactURLs strips the userinfo of each url in a comma separated list. An address
+// that cannot be parsed, e.g. 127.0.0.1:4222, is replaced if it may contain userinfo
+func redactURLs(value string) string {
+	if value == "" {
+		return value
+	}
+
+	urls := strings.Split(value, ",")
+	for i, raw := range urls {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			if strings.Contains(raw, "@") {
+				urls[i] = redacted
+			}
+			continue
+		}
+		if u.User != nil {
+			u.User = nil
+			urls[i] = u.String()
+		}
+	}
+	return strings.Join(urls, ",")
+}
+
+// redactEndpoints returns a copy of partner endpoints without userinfo
+func redactEndpoints(endpoints map[string]string) map[string]string {
+	if endpoints == nil {
+		return nil
+	}
+
+	out := make(map[string]string, len(endpoints))
+	for environment, endpoint := range endpoints {
+		out[environment] = redactURLs(endpoint)
+	}
+	return out
+}
@@ -1,8 +1,13 @@
 package di
 
 import (
+	"github.com/SirWaithaka/payments-api/pkg/health"
 	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
 	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
 	"github.com/SirWaithaka/payments-api/src/events"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
@@ -13,29 +18,74 @@ import (
 type DI struct {
 	Cfg       *config.Config
 	Publisher events.Publisher
+	Inbox     events.Inbox
+	// token buckets of the rate limiter
+	Buckets ratelimit.Repository
+	// readiness checks of the dependencies of the api
+	Health *health.Checker
 
+	Auth      auth.Service
+	Merchant  merchants.Service
+	Limiter   ratelimit.Limiter
+	Breakers  circuit.Breakers
 	Mpesa     mpesa.Service
 	ShortCode mpesa.ShortCodeService
 	Webhook   webhooks.Service
 }
 
-func New(cfg config.Config, db *storage.Database, pub events.Publisher) *DI {
+func New(cfg config.Config, db *storage.Database, pub events.Publisher, cipher services.CredentialsCipher) *DI {
 	requestsRepository := postgres.NewRequestRepository(db.PG)
 	webhooksRepository := postgres.NewWebhookRepository(db.PG)
 	shortcodeRepository := postgres.NewShortCodeRepository(db.PG)
 	mpesaPaymentsRepository := postgres.NewMpesaPaymentsRepository(db.PG)
+	inboxRepository := postgres.NewInboxRepository(db.PG)
+	clientRepository := postgres.NewClientRepository(db.PG)
+	merchantRepository := postgres.NewMerchantRepository(db.PG)
 
-	apiProvider := services.NewProvider(cfg, requestsRepository, webhooksRepository)
+	breakers := circuit.NewRegistry(breakerSettings(cfg.Breaker), pub)
+	apiProvider := services.NewProvider(cfg, requestsRepository, webhooksRepository, shortcodeRepository, clientRepository, cipher, breakers)
 
-	shortcodeService := mpesa.NewServiceShortCode(shortcodeRepository)
-	mpesaService := mpesa.NewService(mpesaPaymentsRepository, shortcodeRepository, requestsRepository, apiProvider, pub)
+	authService := auth.NewService(clientRepository, cipher, cfg.Auth.MaxSignatureAge)
+	merchantService := merchants.NewService(merchantRepository)
+	bucketRepository := postgres.NewRateLimitRepository(db.PG)
+	limiter := ratelimit.NewLimiter(bucketRepository)
+	shortcodeService := mpesa.NewServiceShortCode(shortcodeRepository, cipher, apiProvider)
+	mpesaService := mpesa.NewService(mpesaPaymentsRepository, shortcodeRepository, requestsRepository, apiProvider, pub,
+		limiter, mpesa.RateLimits{MSISDN: cfg.RateLimit.MSISDN, ShortCode: cfg.RateLimit.ShortCode},
+		breakers, cfg.Breaker.Failover)
 	webhooksService := webhooks.NewService(webhooksRepository, mpesaService, pub)
 
+	checker := health.NewChecker(cfg.Health.Timeout)
+	checker.Register("database", db.Check)
+	if cfg.Health.CheckBreakers {
+		checker.Register("breakers", circuit.Check(breakers))
+	}
+
 	return &DI{
 		Cfg:       &cfg,
 		Publisher: pub,
+		Inbox:     inboxRepository,
+		Health:    checker,
+		Auth:      authService,
+		Merchant:  merchantService,
+		Limiter:   limiter,
+		Buckets:   bucketRepository,
+		Breakers:  breakers,
 		Mpesa:     mpesaService,
 		ShortCode: shortcodeService,
 		Webhook:   webhooksService,
 	}
 }
+
+// breakerSettings returns the settings of the circuit breakers in the config
+func breakerSettings(cfg config.BreakerConfig) circuit.Settings {
+	return circuit.Settings{
+		Window:           cfg.Window,
+		MinCalls:         cfg.MinCalls,
+		ErrorRate:        cfg.ErrorRate,
+		SlowCallDuration: cfg.SlowCallDuration,
+		SlowCallRate:     cfg.SlowCallRate,
+		OpenDuration:     cfg.OpenDuration,
+		HalfOpenCalls:    cfg.HalfOpenCalls,
+	}
+}
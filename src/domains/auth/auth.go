@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DefaultMaxSignatureAge is the max age of a request signature if none is configured
+const DefaultMaxSignatureAge = 5 * time.Minute
+
+var (
+	ErrUnauthorized = errors.New("invalid api credentials")
+	ErrForbidden    = errors.New("api client does not have the required scope")
+	// ErrReplayed is returned when a signed request is received more than once
+	ErrReplayed = fmt.Errorf("%w: request replayed", ErrUnauthorized)
+	// ErrSignatureExpired is returned when the timestamp of a signed request is too old or in the future
+	ErrSignatureExpired = fmt.Errorf("%w: signature expired", ErrUnauthorized)
+)
+
+// Scope is a permission granted to an api client
+type Scope string
+
+const (
+	ScopeCharge   Scope = "charge"
+	ScopePayout   Scope = "payout"
+	ScopeTransfer Scope = "transfer"
+	ScopeRead     Scope = "read"
+	// ScopeAdmin grants every scope
+	ScopeAdmin Scope = "admin"
+)
+
+var scopes = []Scope{ScopeCharge, ScopePayout, ScopeTransfer, ScopeRead, ScopeAdmin}
+
+func (scope Scope) Valid() bool {
+	return slices.Contains(scopes, scope)
+}
+
+// ToScopes converts values to scopes, unknown scopes return an error
+func ToScopes(values []string) ([]Scope, error) {
+	out := make([]Scope, 0, len(values))
+	for _, value := range values {
+		scope := Scope(value)
+		if !scope.Valid() {
+			return nil, fmt.Errorf("unknown scope %q", value)
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
+
+// Client is a system that calls the api
+type Client struct {
+	ClientID string
+	Name     string
+	// merchant the client acts for, platform clients are not bound to a merchant
+	MerchantID string
+	// public identifier of the api key
+	KeyID string
+	// sha256 hash of the secret, the secret is only known to the client
+	SecretHash string
+	// key signed requests are verified with, encrypted by the SigningKeyCipher
+	SigningKey string `log:"secret"`
+	// master key that wraps the data key, empty if the signing key is in plaintext
+	MasterKeyID string
+	// data key the signing key is encrypted with, wrapped with the master key
+	DataKey string
+	Scopes  []Scope
+	// disabled clients are not authenticated
+	Disabled  bool
+	CreatedAt time.Time
+}
+
+// Platform returns true if the client is not bound to a merchant
+func (client Client) Platform() bool {
+	return client.MerchantID == ""
+}
+
+// HasScope returns true if the client is granted the scope or is an admin
+func (client Client) HasScope(scope Scope) bool {
+	return slices.Contains(client.Scopes, scope) || slices.Contains(client.Scopes, ScopeAdmin)
+}
+
+// Credentials of a new api client. The secret is only returned when the client is created.
+type Credentials struct {
+	KeyID  string
+	Secret string
+}
+
+// APIKey returns the api key the client authenticates with
+func (credentials Credentials) APIKey() string {
+	return credentials.KeyID + "." + credentials.Secret
+}
+
+// SignedRequest holds the values of a request signed with signature.SignRequest
+type SignedRequest struct {
+	KeyID     string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	// path and query of the request
+	Path string
+	Body []byte
+}
+
+// OptionsFindClients defines options used to find api clients
+type OptionsFindClients struct {
+	ClientID *string
+	KeyID    *string
+}
+
+// SigningKeyCipher encrypts the signing keys of api clients before they are saved, so
+// that requests cannot be signed with the values in the database
+type SigningKeyCipher interface {
+	// EncryptSigningKey encrypts the signing key of a new client
+	EncryptSigningKey(client Client) (Client, error)
+	// DecryptSigningKey returns the signing key of the client in plaintext
+	DecryptSigningKey(client Client) (string, error)
+}
+
+type Repository interface {
+	Add(ctx context.Context, client Client) error
+	FindOne(ctx context.Context, opts OptionsFindClients) (Client, error)
+	FindMany(ctx context.Context) ([]Client, error)
+	// Disable disables the client, disabled clients are not authenticated
+	Disable(ctx context.Context, clientID string) error
+	// AddNonce records the nonce of a signed request until it expires. A duplicate error
+	// is returned if the nonce has been used by the key.
+	AddNonce(ctx context.Context, keyID, nonce string, expiresAt time.Time) error
+}
+
+type Service interface {
+	// Create creates an api client and returns its credentials
+	Create(ctx context.Context, name, merchantID string, scopes []Scope) (Client, Credentials, error)
+	List(ctx context.Context) ([]Client, error)
+	Disable(ctx context.Context, clientID string) error
+	// AuthenticateKey authenticates a request with the api key as a bearer token
+	AuthenticateKey(ctx context.Context, apiKey string) (Client, error)
+	// AuthenticateSignature authenticates a signed request
+	AuthenticateSignature(ctx context.Context, request SignedRequest) (Client, error)
+}
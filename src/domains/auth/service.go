@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/pkg/signature"
+)
+
+func NewService(repository Repository, cipher SigningKeyCipher, maxSignatureAge time.Duration) ClientService {
+	if maxSignatureAge <= 0 {
+		maxSignatureAge = DefaultMaxSignatureAge
+	}
+	return ClientService{repository: repository, cipher: cipher, maxSignatureAge: maxSignatureAge, now: time.Now}
+}
+
+type ClientService struct {
+	repository      Repository
+	cipher          SigningKeyCipher
+	maxSignatureAge time.Duration
+	now             func() time.Time
+}
+
+func (service ClientService) Create(ctx context.Context, name, merchantID string, scopes []Scope) (Client, Credentials, error) {
+	if name == "" {
+		return Client{}, Credentials{}, errors.New("api client name is required")
+	}
+	if len(scopes) == 0 {
+		return Client{}, Credentials{}, errors.New("api client requires at least one scope")
+	}
+
+	credentials := Credentials{KeyID: "pk_" + randomHex(12), Secret: randomSecret()}
+	client := Client{
+		Name:       name,
+		MerchantID: merchantID,
+		KeyID:      credentials.KeyID,
+		SecretHash: signature.HashSecret(credentials.Secret),
+		SigningKey: signature.SigningKey(credentials.Secret),
+		Scopes:     scopes,
+	}
+
+	// the signing key is encrypted, the hash of the secret cannot sign requests
+	client, err := service.cipher.EncryptSigningKey(client)
+	if err != nil {
+		return Client{}, Credentials{}, err
+	}
+
+	if err = service.repository.Add(ctx, client); err != nil {
+		return Client{}, Credentials{}, err
+	}
+
+	client, err = service.repository.FindOne(ctx, OptionsFindClients{KeyID: &credentials.KeyID})
+	if err != nil {
+		return Client{}, Credentials{}, err
+	}
+
+	return client, credentials, nil
+}
+
+func (service ClientService) List(ctx context.Context) ([]Client, error) {
+	return service.repository.FindMany(ctx)
+}
+
+func (service ClientService) Disable(ctx context.Context, clientID string) error {
+	return service.repository.Disable(ctx, clientID)
+}
+
+func (service ClientService) AuthenticateKey(ctx context.Context, apiKey string) (Client, error) {
+	keyID, secret, err := signature.ParseAPIKey(apiKey)
+	if err != nil {
+		return Client{}, ErrUnauthorized
+	}
+
+	client, err := service.client(ctx, keyID)
+	if err != nil {
+		return Client{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(signature.HashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, ErrUnauthorized
+	}
+
+	return client, nil
+}
+
+func (service ClientService) AuthenticateSignature(ctx context.Context, request SignedRequest) (Client, error) {
+	l := zerolog.Ctx(ctx)
+
+	if request.KeyID == "" || request.Nonce == "" || request.Signature == "" {
+		return Client{}, ErrUnauthorized
+	}
+
+	seconds, err := strconv.ParseInt(request.Timestamp, 10, 64)
+	if err != nil {
+		return Client{}, ErrUnauthorized
+	}
+	timestamp := time.Unix(seconds, 0)
+
+	// reject signatures outside the window nonces are kept for
+	now := service.now()
+	if timestamp.Before(now.Add(-service.maxSignatureAge)) || timestamp.After(now.Add(service.maxSignatureAge)) {
+		return Client{}, ErrSignatureExpired
+	}
+
+	client, err := service.client(ctx, request.KeyID)
+	if err != nil {
+		return Client{}, err
+	}
+
+	signingKey, err := service.cipher.DecryptSigningKey(client)
+	if err != nil {
+		return Client{}, err
+	}
+
+	if !signature.Verify(signingKey, request.Signature, request.Method, request.Path, request.Timestamp, request.Nonce, request.Body) {
+		return Client{}, ErrUnauthorized
+	}
+
+	// the nonce only needs to be kept until the signature expires
+	err = service.repository.AddNonce(ctx, request.KeyID, request.Nonce, timestamp.Add(service.maxSignatureAge))
+	if err != nil {
+		var dup pkgerrors.Duplicate
+		if errors.As(err, &dup) && dup.Duplicate() {
+			l.Warn().Str("keyId", request.KeyID).Msg("signed request replayed")
+			return Client{}, ErrReplayed
+		}
+		return Client{}, err
+	}
+
+	return client, nil
+}
+
+// client finds an enabled client by its key id
+func (service ClientService) client(ctx context.Context, keyID string) (Client, error) {
+	client, err := service.repository.FindOne(ctx, OptionsFindClients{KeyID: &keyID})
+	if err != nil {
+		var notFound pkgerrors.NotFounder
+		if errors.As(err, &notFound) && notFound.NotFound() {
+			return Client{}, ErrUnauthorized
+		}
+		return Client{}, err
+	}
+
+	if client.Disabled {
+		return Client{}, ErrUnauthorized
+	}
+
+	return client, nil
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func randomSecret() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
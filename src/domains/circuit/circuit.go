@@ -0,0 +1,132 @@
+package circuit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type State string
+
+const (
+	// StateClosed allows calls, the outcomes of calls are recorded
+	StateClosed State = "closed"
+	// StateOpen rejects calls until the open duration has passed
+	StateOpen State = "open"
+	// StateHalfOpen allows a few trial calls that close the breaker if they succeed
+	StateHalfOpen State = "half_open"
+)
+
+// Key returns the key of the breaker of the calls made to a partner with a shortcode
+func Key(partner, shortCodeID string) string {
+	return partner + ":" + shortCodeID
+}
+
+// OpenError is returned when a call is rejected because the breaker is open
+type OpenError struct {
+	Key string
+	// duration until the breaker allows trial calls
+	RetryAfter time.Duration
+}
+
+func (e OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open, retry after %ds", e.Key, e.RetryAfterSeconds())
+}
+
+// Temporary returns true, the call can be retried once the breaker is closed
+func (e OpenError) Temporary() bool {
+	return true
+}
+
+// RetryAfterSeconds returns the retry duration in whole seconds, rounded up, as used in the
+// Retry-After header
+func (e OpenError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Settings configures when breakers open and close
+type Settings struct {
+	// number of latest calls the error and slow call rates are computed from, breakers are
+	// disabled if 0
+	Window int
+	// minimum number of calls in the window before the breaker can open
+	MinCalls int
+	// rate of failed calls in the window that opens the breaker, between 0 and 1
+	ErrorRate float64
+	// calls that take longer are slow
+	SlowCallDuration time.Duration
+	// rate of slow calls in the window that opens the breaker, between 0 and 1
+	SlowCallRate float64
+	// duration the breaker rejects calls before it allows trial calls
+	OpenDuration time.Duration
+	// number of successful trial calls that close the breaker
+	HalfOpenCalls int
+}
+
+// Disabled returns true if breakers never open
+func (settings Settings) Disabled() bool {
+	return settings.Window <= 0
+}
+
+// Outcome is the outcome of a partner api call
+type Outcome struct {
+	// true if the partner timed out or returned an error, partner responses that reject
+	// the request are not failures
+	Failed  bool
+	Latency time.Duration
+}
+
+// Status is the state of a breaker
+type Status struct {
+	Key          string
+	State        State
+	Calls        int
+	ErrorRate    float64
+	SlowCallRate float64
+	// time the breaker was last opened, nil if it has not been opened
+	OpenedAt *time.Time
+	// duration until an open breaker allows trial calls
+	RetryAfter time.Duration
+}
+
+// Transition is a change of the state of a breaker
+type Transition struct {
+	Key          string
+	From         State
+	To           State
+	ErrorRate    float64
+	SlowCallRate float64
+	At           time.Time
+}
+
+type Breakers interface {
+	// Allow returns an OpenError if the breaker of the key rejects calls
+	Allow(ctx context.Context, key string) error
+	// Peek returns an OpenError if the breaker of the key would reject a call, unlike
+	// Allow it does not take one of the trial calls of a half open breaker
+	Peek(key string) error
+	// Record records the outcome of a call allowed by the breaker of the key
+	Record(ctx context.Context, key string, outcome Outcome)
+	// Status returns the state of all breakers ordered by key
+	Status() []Status
+}
+
+// Check returns a health check that fails while any breaker is open, with the keys of
+// the open breakers. Half open breakers do not fail the check.
+func Check(breakers Breakers) func(context.Context) error {
+	return func(context.Context) error {
+		var open []string
+		for _, status := range breakers.Status() {
+			if status.State == StateOpen {
+				open = append(open, status.Key)
+			}
+		}
+
+		if len(open) > 0 {
+			return fmt.Errorf("open breakers: %s", strings.Join(open, ", "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+package circuit
+
+import (
+	"time"
+
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+// NewRegistryWithClock exposes NewRegistry to tests with a clock
+func NewRegistryWithClock(settings Settings, publisher events.Publisher, now func() time.Time) *Registry {
+	registry := NewRegistry(settings, publisher)
+	registry.now = now
+	return registry
+}
+
+// WaitPublished waits until the queued transitions of the registry are published
+func WaitPublished(registry *Registry) {
+	registry.pending.Wait()
+}
@@ -0,0 +1,347 @@
+package circuit
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/pkg/events/payloads"
+	"github.com/SirWaithaka/payments-api/pkg/events/subjects"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+const (
+	// number of transitions waiting to be published, transitions are dropped when it is full
+	publishQueueSize = 256
+	// maximum duration of publishing a transition
+	publishTimeout = 10 * time.Second
+)
+
+// NewRegistry creates the breakers of an instance of the api. Transitions of breakers are
+// published as events if the publisher is not nil. Events are published in the background
+// on a best effort basis, so that the calls that changed the state are not delayed.
+func NewRegistry(settings Settings, publisher events.Publisher) *Registry {
+	// at least one call is needed to open or close a breaker
+	settings.MinCalls = max(1, settings.MinCalls)
+	settings.HalfOpenCalls = max(1, settings.HalfOpenCalls)
+
+	registry := &Registry{
+		settings:  settings,
+		publisher: publisher,
+		now:       time.Now,
+		breakers:  make(map[string]*breaker),
+	}
+	if publisher != nil {
+		registry.queue = make(chan queuedTransition, publishQueueSize)
+		go registry.publishQueued()
+	}
+
+	return registry
+}
+
+// Registry keeps a breaker for each key, breakers are created on first use
+type Registry struct {
+	settings  Settings
+	publisher events.Publisher
+	now       func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	// transitions waiting to be published, in the order they happened
+	queue   chan queuedTransition
+	pending sync.WaitGroup
+}
+
+// queuedTransition is a transition waiting to be published with the context of the call
+// that made it
+type queuedTransition struct {
+	ctx        context.Context
+	transition Transition
+}
+
+func (registry *Registry) Allow(ctx context.Context, key string) error {
+	if registry.settings.Disabled() {
+		return nil
+	}
+
+	registry.mu.Lock()
+	b := registry.breaker(key)
+	transition, err := b.allow(registry.settings, registry.now())
+	registry.mu.Unlock()
+
+	registry.publish(ctx, transition)
+	return err
+}
+
+func (registry *Registry) Peek(key string) error {
+	if registry.settings.Disabled() {
+		return nil
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	b, ok := registry.breakers[key]
+	if !ok {
+		return nil
+	}
+	return b.peek(registry.settings, registry.now())
+}
+
+func (registry *Registry) Record(ctx context.Context, key string, outcome Outcome) {
+	if registry.settings.Disabled() {
+		return
+	}
+
+	registry.mu.Lock()
+	b := registry.breaker(key)
+	transition := b.record(registry.settings, outcome, registry.now())
+	registry.mu.Unlock()
+
+	registry.publish(ctx, transition)
+}
+
+func (registry *Registry) Status() []Status {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	now := registry.now()
+	statuses := make([]Status, 0, len(registry.breakers))
+	for key, b := range registry.breakers {
+		statuses = append(statuses, b.status(key, registry.settings, now))
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return strings.Compare(a.Key, b.Key) })
+
+	return statuses
+}
+
+// breaker returns the breaker of the key, the registry should be locked
+func (registry *Registry) breaker(key string) *breaker {
+	b, ok := registry.breakers[key]
+	if !ok {
+		b = &breaker{key: key, state: StateClosed}
+		registry.breakers[key] = b
+	}
+	return b
+}
+
+// publish logs the transition and queues it to be published as an event
+func (registry *Registry) publish(ctx context.Context, transition *Transition) {
+	if transition == nil {
+		return
+	}
+
+	l := zerolog.Ctx(ctx)
+	l.Warn().
+		Str("key", transition.Key).
+		Str("from", string(transition.From)).
+		Str("to", string(transition.To)).
+		Float64("errorRate", transition.ErrorRate).
+		Float64("slowCallRate", transition.SlowCallRate).
+		Msg("circuit breaker state changed")
+
+	if registry.publisher == nil {
+		return
+	}
+
+	// the event is published after the call that made the transition returns
+	registry.pending.Add(1)
+	select {
+	case registry.queue <- queuedTransition{ctx: context.WithoutCancel(ctx), transition: *transition}:
+	default:
+		registry.pending.Done()
+		l.Error().Str("key", transition.Key).Msg("circuit breaker event dropped, too many events waiting to be published")
+	}
+}
+
+// publishQueued publishes the queued transitions one at a time, so that the events of a
+// breaker are published in order
+func (registry *Registry) publishQueued() {
+	for queued := range registry.queue {
+		registry.send(queued.ctx, queued.transition)
+		registry.pending.Done()
+	}
+}
+
+// send publishes the transition as an event, errors are logged
+func (registry *Registry) send(ctx context.Context, transition Transition) {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	l := zerolog.Ctx(ctx)
+	event := pkgevents.NewEvent(subjects.CircuitBreakerStateChanged, payloads.CircuitBreakerStateChanged{
+		Key:          transition.Key,
+		From:         string(transition.From),
+		To:           string(transition.To),
+		ErrorRate:    transition.ErrorRate,
+		SlowCallRate: transition.SlowCallRate,
+		ChangedAt:    transition.At,
+	})
+	// events of a breaker are kept in order
+	event.SetKey(transition.Key)
+	if err := registry.publisher.Publish(ctx, event); err != nil {
+		l.Error().Err(err).Msg("error publishing circuit breaker event")
+	}
+}
+
+// breaker keeps the outcomes of the latest calls in a ring
+type breaker struct {
+	key   string
+	state State
+
+	outcomes []Outcome
+	next     int
+
+	openedAt *time.Time
+	// time trial calls were allowed and number of trial calls allowed and succeeded
+	halfOpenedAt time.Time
+	trials       int
+	successes    int
+}
+
+func (b *breaker) allow(settings Settings, now time.Time) (*Transition, error) {
+	var transition *Transition
+
+	if b.state == StateOpen {
+		retryAfter := b.openedAt.Add(settings.OpenDuration).Sub(now)
+		if retryAfter > 0 {
+			return nil, OpenError{Key: b.key, RetryAfter: retryAfter}
+		}
+		transition = b.transition(StateHalfOpen, settings, now)
+	}
+
+	if b.state == StateHalfOpen {
+		// trial calls that were allowed but never recorded are given up after the open duration
+		if b.trials >= settings.HalfOpenCalls && now.Sub(b.halfOpenedAt) > settings.OpenDuration {
+			b.halfOpenedAt, b.trials, b.successes = now, 0, 0
+		}
+		if b.trials >= settings.HalfOpenCalls {
+			return transition, OpenError{Key: b.key, RetryAfter: settings.OpenDuration - now.Sub(b.halfOpenedAt)}
+		}
+		b.trials++
+	}
+
+	return transition, nil
+}
+
+// peek returns the error allow would return without changing the state of the breaker
+func (b *breaker) peek(settings Settings, now time.Time) error {
+	switch b.state {
+	case StateOpen:
+		if retryAfter := b.openedAt.Add(settings.OpenDuration).Sub(now); retryAfter > 0 {
+			return OpenError{Key: b.key, RetryAfter: retryAfter}
+		}
+	case StateHalfOpen:
+		elapsed := now.Sub(b.halfOpenedAt)
+		if b.trials >= settings.HalfOpenCalls && elapsed <= settings.OpenDuration {
+			return OpenError{Key: b.key, RetryAfter: settings.OpenDuration - elapsed}
+		}
+	}
+
+	return nil
+}
+
+func (b *breaker) record(settings Settings, outcome Outcome, now time.Time) *Transition {
+	switch b.state {
+	case StateHalfOpen:
+		if b.failed(settings, outcome) {
+			return b.transition(StateOpen, settings, now)
+		}
+		b.successes++
+		if b.successes >= settings.HalfOpenCalls {
+			return b.transition(StateClosed, settings, now)
+		}
+		return nil
+
+	case StateClosed:
+		if len(b.outcomes) < settings.Window {
+			b.outcomes = append(b.outcomes, outcome)
+		} else {
+			b.outcomes[b.next] = outcome
+		}
+		b.next = (b.next + 1) % settings.Window
+
+		if len(b.outcomes) < settings.MinCalls {
+			return nil
+		}
+		errorRate, slowCallRate := b.rates(settings)
+		if (settings.ErrorRate > 0 && errorRate >= settings.ErrorRate) ||
+			(settings.SlowCallRate > 0 && slowCallRate >= settings.SlowCallRate) {
+			return b.transition(StateOpen, settings, now)
+		}
+		return nil
+
+	default:
+		// outcomes of calls made before the breaker opened are ignored
+		return nil
+	}
+}
+
+// failed returns true if the call failed or was slow
+func (b *breaker) failed(settings Settings, outcome Outcome) bool {
+	return outcome.Failed || (settings.SlowCallDuration > 0 && outcome.Latency > settings.SlowCallDuration)
+}
+
+// rates returns the rates of failed and slow calls in the window
+func (b *breaker) rates(settings Settings) (float64, float64) {
+	if len(b.outcomes) == 0 {
+		return 0, 0
+	}
+
+	var failed, slow int
+	for _, outcome := range b.outcomes {
+		if outcome.Failed {
+			failed++
+		} else if settings.SlowCallDuration > 0 && outcome.Latency > settings.SlowCallDuration {
+			slow++
+		}
+	}
+
+	calls := float64(len(b.outcomes))
+	return float64(failed) / calls, float64(slow) / calls
+}
+
+// transition changes the state of the breaker, the window is cleared when it opens or closes
+func (b *breaker) transition(to State, settings Settings, now time.Time) *Transition {
+	errorRate, slowCallRate := b.rates(settings)
+	transition := &Transition{Key: b.key, From: b.state, To: to, ErrorRate: errorRate, SlowCallRate: slowCallRate, At: now}
+
+	b.state = to
+	switch to {
+	case StateOpen:
+		b.openedAt = &now
+		b.outcomes, b.next = nil, 0
+	case StateHalfOpen:
+		b.halfOpenedAt, b.trials, b.successes = now, 0, 0
+	case StateClosed:
+		b.outcomes, b.next = nil, 0
+	}
+
+	return transition
+}
+
+func (b *breaker) status(key string, settings Settings, now time.Time) Status {
+	errorRate, slowCallRate := b.rates(settings)
+	status := Status{
+		Key:          key,
+		State:        b.state,
+		Calls:        len(b.outcomes),
+		ErrorRate:    errorRate,
+		SlowCallRate: slowCallRate,
+	}
+	if b.openedAt != nil {
+		openedAt := *b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == StateOpen {
+		status.RetryAfter = max(0, b.openedAt.Add(settings.OpenDuration).Sub(now))
+	}
+
+	return status
+}
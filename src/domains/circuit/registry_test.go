@@ -0,0 +1,200 @@
+package circuit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/pkg/events/payloads"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
+)
+
+// MockPublisher keeps the published breaker transitions. If release is not nil, events are
+// published once it is closed.
+type MockPublisher struct {
+	transitions []string
+	release     chan struct{}
+}
+
+func (m *MockPublisher) Publish(ctx context.Context, event pkgevents.EventType) error {
+	if m.release != nil {
+		<-m.release
+	}
+	payload := event.Message().(payloads.CircuitBreakerStateChanged)
+	m.transitions = append(m.transitions, payload.From+">"+payload.To)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	settings := circuit.Settings{
+		Window:           4,
+		MinCalls:         4,
+		ErrorRate:        0.5,
+		SlowCallDuration: time.Second,
+		SlowCallRate:     0.75,
+		OpenDuration:     30 * time.Second,
+		HalfOpenCalls:    2,
+	}
+	key := circuit.Key("daraja", "1")
+
+	failed := circuit.Outcome{Failed: true, Latency: 100 * time.Millisecond}
+	succeeded := circuit.Outcome{Latency: 100 * time.Millisecond}
+	slow := circuit.Outcome{Latency: 2 * time.Second}
+
+	setup := func() (*circuit.Registry, *MockPublisher, *time.Time) {
+		now := time.Now()
+		publisher := &MockPublisher{}
+		registry := circuit.NewRegistryWithClock(settings, publisher, func() time.Time { return now })
+		return registry, publisher, &now
+	}
+
+	t.Run("test that the breaker opens at the error rate", func(t *testing.T) {
+		registry, publisher, _ := setup()
+
+		for _, outcome := range []circuit.Outcome{succeeded, failed, succeeded} {
+			assert.Nil(t, registry.Allow(t.Context(), key))
+			registry.Record(t.Context(), key, outcome)
+		}
+		// the breaker does not open before the minimum calls
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		registry.Record(t.Context(), key, failed)
+
+		err := registry.Allow(t.Context(), key)
+		var open circuit.OpenError
+		if assert.ErrorAs(t, err, &open) {
+			assert.Equal(t, 30*time.Second, open.RetryAfter)
+		}
+		circuit.WaitPublished(registry)
+		assert.Equal(t, []string{"closed>open"}, publisher.transitions)
+
+		// breakers of other keys are not affected
+		assert.Nil(t, registry.Allow(t.Context(), circuit.Key("daraja", "2")))
+	})
+
+	t.Run("test that the breaker opens at the slow call rate", func(t *testing.T) {
+		registry, _, _ := setup()
+
+		for _, outcome := range []circuit.Outcome{slow, slow, succeeded, slow} {
+			registry.Record(t.Context(), key, outcome)
+		}
+
+		assert.Error(t, registry.Allow(t.Context(), key))
+	})
+
+	t.Run("test that successful trial calls close the breaker", func(t *testing.T) {
+		registry, publisher, now := setup()
+
+		for range settings.MinCalls {
+			registry.Record(t.Context(), key, failed)
+		}
+		assert.Error(t, registry.Allow(t.Context(), key))
+
+		*now = now.Add(settings.OpenDuration)
+
+		// only the trial calls are allowed
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		assert.Error(t, registry.Allow(t.Context(), key))
+
+		registry.Record(t.Context(), key, succeeded)
+		registry.Record(t.Context(), key, succeeded)
+
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		circuit.WaitPublished(registry)
+		assert.Equal(t, []string{"closed>open", "open>half_open", "half_open>closed"}, publisher.transitions)
+	})
+
+	t.Run("test that peeking does not take a trial call", func(t *testing.T) {
+		registry, publisher, now := setup()
+
+		// breakers that were never used allow calls
+		assert.Nil(t, registry.Peek(key))
+
+		for range settings.MinCalls {
+			registry.Record(t.Context(), key, failed)
+		}
+		var open circuit.OpenError
+		if assert.ErrorAs(t, registry.Peek(key), &open) {
+			assert.Equal(t, settings.OpenDuration, open.RetryAfter)
+		}
+
+		*now = now.Add(settings.OpenDuration)
+		for range settings.HalfOpenCalls + 1 {
+			assert.Nil(t, registry.Peek(key))
+		}
+		// the breaker does not change state
+		circuit.WaitPublished(registry)
+		assert.Equal(t, []string{"closed>open"}, publisher.transitions)
+
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		assert.Error(t, registry.Peek(key))
+	})
+
+	t.Run("test that a failed trial call opens the breaker again", func(t *testing.T) {
+		registry, publisher, now := setup()
+
+		for range settings.MinCalls {
+			registry.Record(t.Context(), key, failed)
+		}
+		*now = now.Add(settings.OpenDuration)
+
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		registry.Record(t.Context(), key, failed)
+
+		assert.Error(t, registry.Allow(t.Context(), key))
+		circuit.WaitPublished(registry)
+		assert.Equal(t, []string{"closed>open", "open>half_open", "half_open>open"}, publisher.transitions)
+
+		status := registry.Status()
+		if assert.Len(t, status, 1) {
+			assert.Equal(t, circuit.StateOpen, status[0].State)
+			assert.Equal(t, settings.OpenDuration, status[0].RetryAfter)
+		}
+	})
+
+	t.Run("test that open breakers fail the check", func(t *testing.T) {
+		registry, _, now := setup()
+		check := circuit.Check(registry)
+
+		registry.Record(t.Context(), circuit.Key("daraja", "2"), succeeded)
+		assert.Nil(t, check(t.Context()))
+
+		for range settings.MinCalls {
+			registry.Record(t.Context(), key, failed)
+		}
+		assert.EqualError(t, check(t.Context()), "open breakers: "+key)
+
+		// half open breakers allow trial calls
+		*now = now.Add(settings.OpenDuration)
+		assert.Nil(t, registry.Allow(t.Context(), key))
+		assert.Nil(t, check(t.Context()))
+	})
+
+	t.Run("test that transitions are published without delaying the calls", func(t *testing.T) {
+		publisher := &MockPublisher{release: make(chan struct{})}
+		registry := circuit.NewRegistry(settings, publisher)
+
+		// the publisher blocks until it is released
+		for range settings.MinCalls {
+			registry.Record(t.Context(), key, failed)
+		}
+		assert.Error(t, registry.Allow(t.Context(), key))
+
+		close(publisher.release)
+		circuit.WaitPublished(registry)
+		assert.Equal(t, []string{"closed>open"}, publisher.transitions)
+	})
+
+	t.Run("test that disabled breakers never open", func(t *testing.T) {
+		registry := circuit.NewRegistry(circuit.Settings{}, nil)
+
+		for range 10 {
+			registry.Record(t.Context(), key, failed)
+		}
+		assert.Nil(t, registry.Allow(t.Context(), key))
+	})
+}
@@ -0,0 +1,113 @@
+package merchants
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	// ErrMerchantRequired is returned when a merchant is not given and the caller is not bound to one
+	ErrMerchantRequired = Error{message: "merchant is required"}
+	// ErrMerchantForbidden is returned when a caller bound to a merchant acts on another merchant
+	ErrMerchantForbidden = Error{message: "merchant does not match the api client merchant", forbidden: true}
+	// ErrInvalidReportWindow is returned when the start of a report is not before its end
+	ErrInvalidReportWindow = Error{message: "report start should be before its end"}
+)
+
+// Error is an error of a merchant request that the caller can correct
+type Error struct {
+	message   string
+	forbidden bool
+}
+
+func (e Error) Error() string {
+	return e.message
+}
+
+// Invalid returns true if the request is missing a merchant or has invalid values
+func (e Error) Invalid() bool {
+	return !e.forbidden
+}
+
+// Forbidden returns true if the caller is bound to another merchant
+func (e Error) Forbidden() bool {
+	return e.forbidden
+}
+
+// Merchant is a business (tenant) that owns shortcodes, payments and api clients
+type Merchant struct {
+	MerchantID string
+	Name       string
+	CreatedAt  time.Time
+}
+
+type merchantKey struct{}
+
+// WithMerchant returns a context bound to the merchant. Repositories only return and
+// change records of the merchant bound to the context.
+func WithMerchant(ctx context.Context, merchantID string) context.Context {
+	return context.WithValue(ctx, merchantKey{}, merchantID)
+}
+
+// FromContext returns the merchant the context is bound to. Contexts that are not bound
+// to a merchant, e.g. of platform api clients and background jobs, can access all merchants.
+func FromContext(ctx context.Context) (string, bool) {
+	merchantID, ok := ctx.Value(merchantKey{}).(string)
+	return merchantID, ok && merchantID != ""
+}
+
+// Resolve returns the merchant a request acts on. Callers bound to a merchant can only act
+// on their merchant, other callers have to give the merchant.
+func Resolve(ctx context.Context, merchantID string) (string, error) {
+	bound, ok := FromContext(ctx)
+	if !ok {
+		if merchantID == "" {
+			return "", ErrMerchantRequired
+		}
+		return merchantID, nil
+	}
+
+	if merchantID != "" && merchantID != bound {
+		return "", ErrMerchantForbidden
+	}
+	return bound, nil
+}
+
+// OptionsReport defines the merchant and time window of a payments report
+type OptionsReport struct {
+	MerchantID string
+	// payments created at or after From
+	From *time.Time
+	// payments created before To
+	To *time.Time
+}
+
+// ReportTotal is the number and total amount of payments of a type and status
+type ReportTotal struct {
+	Type   string
+	Status string
+	Count  int64
+	Amount string
+}
+
+type Report struct {
+	MerchantID string
+	From       *time.Time
+	To         *time.Time
+	Totals     []ReportTotal
+}
+
+type Repository interface {
+	Add(ctx context.Context, merchant Merchant) (Merchant, error)
+	FindOne(ctx context.Context, merchantID string) (Merchant, error)
+	FindMany(ctx context.Context) ([]Merchant, error)
+	// Report sums the payments of the merchant by type and status
+	Report(ctx context.Context, opts OptionsReport) ([]ReportTotal, error)
+}
+
+type Service interface {
+	Create(ctx context.Context, name string) (Merchant, error)
+	List(ctx context.Context) ([]Merchant, error)
+	Get(ctx context.Context, merchantID string) (Merchant, error)
+	Report(ctx context.Context, opts OptionsReport) (Report, error)
+}
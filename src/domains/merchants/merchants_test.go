@@ -0,0 +1,54 @@
+package merchants_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+)
+
+func TestResolve(t *testing.T) {
+	bound := merchants.WithMerchant(context.Background(), "merchant-a")
+
+	tcs := map[string]struct {
+		ctx        context.Context
+		merchantID string
+		expected   string
+		err        error
+	}{
+		"test that unbound callers act on the given merchant": {
+			ctx: context.Background(), merchantID: "merchant-b", expected: "merchant-b",
+		},
+		"test that unbound callers have to give a merchant": {
+			ctx: context.Background(), err: merchants.ErrMerchantRequired,
+		},
+		"test that bound callers act on their merchant": {
+			ctx: bound, expected: "merchant-a",
+		},
+		"test that bound callers can give their merchant": {
+			ctx: bound, merchantID: "merchant-a", expected: "merchant-a",
+		},
+		"test that bound callers cannot act on other merchants": {
+			ctx: bound, merchantID: "merchant-b", err: merchants.ErrMerchantForbidden,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			merchantID, err := merchants.Resolve(tc.ctx, tc.merchantID)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.expected, merchantID)
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	// callers without a merchant send invalid requests, callers bound to another merchant are forbidden
+	assert.True(t, merchants.ErrMerchantRequired.Invalid())
+	assert.False(t, merchants.ErrMerchantRequired.Forbidden())
+	assert.True(t, merchants.ErrInvalidReportWindow.Invalid())
+	assert.True(t, merchants.ErrMerchantForbidden.Forbidden())
+	assert.False(t, merchants.ErrMerchantForbidden.Invalid())
+}
@@ -0,0 +1,64 @@
+package merchants
+
+import (
+	"context"
+	"errors"
+)
+
+func NewService(repository Repository) MerchantService {
+	return MerchantService{repository: repository}
+}
+
+type MerchantService struct {
+	repository Repository
+}
+
+func (service MerchantService) Create(ctx context.Context, name string) (Merchant, error) {
+	if name == "" {
+		return Merchant{}, errors.New("merchant name is required")
+	}
+
+	return service.repository.Add(ctx, Merchant{Name: name})
+}
+
+// List returns all merchants, or only the merchant the context is bound to
+func (service MerchantService) List(ctx context.Context) ([]Merchant, error) {
+	if merchantID, ok := FromContext(ctx); ok {
+		merchant, err := service.repository.FindOne(ctx, merchantID)
+		if err != nil {
+			return nil, err
+		}
+		return []Merchant{merchant}, nil
+	}
+
+	return service.repository.FindMany(ctx)
+}
+
+func (service MerchantService) Get(ctx context.Context, merchantID string) (Merchant, error) {
+	merchantID, err := Resolve(ctx, merchantID)
+	if err != nil {
+		return Merchant{}, err
+	}
+
+	return service.repository.FindOne(ctx, merchantID)
+}
+
+// Report sums the payments of a merchant by type and status
+func (service MerchantService) Report(ctx context.Context, opts OptionsReport) (Report, error) {
+	merchantID, err := Resolve(ctx, opts.MerchantID)
+	if err != nil {
+		return Report{}, err
+	}
+	opts.MerchantID = merchantID
+
+	if opts.From != nil && opts.To != nil && !opts.From.Before(*opts.To) {
+		return Report{}, ErrInvalidReportWindow
+	}
+
+	totals, err := service.repository.Report(ctx, opts)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Report{MerchantID: merchantID, From: opts.From, To: opts.To, Totals: totals}, nil
+}
@@ -2,7 +2,11 @@ package mpesa
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
 
+	"github.com/SirWaithaka/payments-api/pkg/rate"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 )
 
@@ -61,6 +65,8 @@ func ToAccountType(s string) AccountType {
 type Payment struct {
 	// generate unique id for the payment request
 	PaymentID string
+	// merchant the payment is made for
+	MerchantID string
 	// should be one of charge, transfer or payout
 	Type PaymentType
 	// client generated id for the payment which can be used for reconciliation. Need not be unique
@@ -77,22 +83,31 @@ type Payment struct {
 	DestinationAccountNumber string
 	// for transfers, this is the account number of the beneficiary.
 	// Not required for other payment types
-	Beneficiary string
+	Beneficiary string `log:"phone"`
 	// payment description
 	Description string
 	// shortcode id
 	ShortCodeID string
 	// payment status
 	Status requests.Status
+	// time the payment was created
+	CreatedAt time.Time
+	// w3c traceparent of the request that created the payment, the spans of its
+	// webhooks are linked to it
+	TraceParent string
+	// id of the api request that created the payment, from its X-Request-ID header
+	RequestID string
 }
 
 type PaymentRequest struct {
+	// merchant the payment is made for, not required if the caller is bound to a merchant
+	MerchantID            string
 	IdempotencyID         string
 	ClientTransactionID   string
 	Amount                string
 	ExternalAccountType   AccountType
 	ExternalAccountNumber string
-	Beneficiary           string
+	Beneficiary           string `log:"phone"`
 	Description           string
 }
 
@@ -106,6 +121,7 @@ type ReversalRequest struct {
 
 type ShortCode struct {
 	ShortCodeID       string
+	MerchantID        string           // merchant that owns the shortcode
 	Environment       string           // enum of sandbox, production
 	ShortCode         string           // business pay bill or buy goods account
 	Priority          uint             // low value means higher priority, min=1
@@ -114,9 +130,38 @@ type ShortCode struct {
 	InitiatorName     string           // daraja api initiator name
 	InitiatorPassword string           // daraja api initiator password
 	Passphrase        string           // (optional) passphrase for c2b transfers
-	Key               string           // daraja app consumer key or quikk app key
+	Key               string           `log:"secret"` // daraja app consumer key or quikk app key
 	Secret            string           // daraja app consumer secret or quikk app secret
 	CallbackURL       string           // callback url for shortcode async responses
+	CallbackToken     string           // secret token added to callback urls, verified on webhooks
+	Disabled          bool             // disabled shortcodes are not used for new payments
+	// time the shortcode was first issued a callback token, the callback urls of payments
+	// made before it carry no token
+	CallbackTokenIssuedAt time.Time
+	// time the shortcode was deleted, zero if it is not deleted
+	DeletedAt time.Time
+	// credentials encryption, the initiator password, passphrase, key and secret are
+	// encrypted with the data key. Empty if the credentials are stored in plaintext.
+	KeyID   string // id of the master key the data key is encrypted with
+	DataKey string // encrypted data key
+	KeyHash string // hash of the key, used to find shortcodes by key
+}
+
+// HashKey returns the hash a shortcode is found by its key with
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ShortCodeCredentials are the partner credentials of a shortcode, used to rotate them
+type ShortCodeCredentials struct {
+	InitiatorName     string
+	InitiatorPassword string
+	Passphrase        string
+	Key               string `log:"secret"`
+	Secret            string
+	// generate a new callback token, webhooks for requests sent before are rejected
+	RotateCallbackToken bool
 }
 
 type OptionsFindPayment struct {
@@ -131,23 +176,65 @@ type OptionsUpdatePayment struct {
 	PaymentReference *string
 }
 
+// PaymentUpdate is the update a webhook applies to a payment
+type PaymentUpdate struct {
+	PaymentID string
+	OptionsUpdatePayment
+}
+
+// WebhookKeys identify a webhook and the payment request it responds to
+type WebhookKeys struct {
+	// id of the partner request the webhook responds to, all webhooks for the same
+	// payment request share the same correlation id
+	CorrelationID string
+	// partner specific key that identifies the webhook, duplicate webhooks sent by the
+	// partner share the same natural key
+	NaturalKey string
+}
+
 type OptionsFindShortCodes struct {
 	ShortCodeID *string
+	MerchantID  *string
 	Service     *requests.Partner
 	Type        *string
 	ShortCode   *string
+	// find a shortcode by its app key
+	Key *string `log:"secret"`
+	// find a shortcode by its callback token
+	CallbackToken *string
+	// find enabled or disabled shortcodes, both are returned if nil
+	Disabled *bool
+	// include deleted shortcodes, shortcodes that are not deleted are found first
+	WithDeleted bool
+}
+
+type OptionsUpdateShortCode struct {
+	Environment   *string
+	Priority      *uint
+	CallbackURL   *string
+	Disabled      *bool
+	CallbackToken *string
 }
 
 type Repository interface {
 	Add(context.Context, Payment) error
 	FindOne(ctx context.Context, opts OptionsFindPayment) (Payment, error)
 	Update(ctx context.Context, id string, opts OptionsUpdatePayment) error
+	// Transition updates the payment and returns the updated payment and the status it
+	// had before the update
+	Transition(ctx context.Context, id string, opts OptionsUpdatePayment) (Payment, requests.Status, error)
 }
 
 type ShortCodeRepository interface {
 	Add(ctx context.Context, shortcode ShortCode) error
 	FindOne(ctx context.Context, opts OptionsFindShortCodes) (ShortCode, error)
 	FindMany(ctx context.Context, opts OptionsFindShortCodes) ([]ShortCode, error)
+	Update(ctx context.Context, id string, opts OptionsUpdateShortCode) error
+	// UpdateCredentials saves the credentials of the shortcode, including their encryption
+	// key id and data key. Credentials of deleted shortcodes are updated too.
+	UpdateCredentials(ctx context.Context, shortcode ShortCode) error
+	// Delete soft deletes the shortcode, deleted shortcodes are not found
+	Delete(ctx context.Context, id string) error
 }
 
 type API interface {
@@ -157,9 +244,33 @@ type API interface {
 	Status(ctx context.Context, payment Payment) error
 }
 
+// CredentialsEncrypter encrypts shortcode credentials before they are saved. Credentials
+// are only decrypted by the Provider, when a partner client is built or a webhook
+// signature is verified.
+type CredentialsEncrypter interface {
+	// Encrypt encrypts the credentials of a new shortcode
+	Encrypt(shortcode ShortCode) (ShortCode, error)
+	// Replace encrypts new credentials of an existing shortcode. Empty credentials are not replaced.
+	Replace(shortcode ShortCode, credentials ShortCodeCredentials) (ShortCode, error)
+}
+
+// ClientEvicter removes the partner clients kept for a shortcode, so that the clients
+// and access tokens of a deleted, disabled or rotated shortcode are not reused
+type ClientEvicter interface {
+	Evict(shortcodeID string)
+}
+
+// RateLimits limits the payments of each customer phone number and the partner api calls
+// made with each shortcode
+type RateLimits struct {
+	MSISDN    rate.Limit
+	ShortCode rate.Limit
+}
+
 type Provider interface {
-	GetMpesaApi(ShortCode) API
+	GetMpesaApi(ShortCode) (API, error)
 	GetWebhookProcessor(requests.Partner) requests.WebhookProcessor
+	GetWebhookAuthenticator(requests.Partner) requests.WebhookAuthenticator
 }
 
 type Service interface {
@@ -167,9 +278,21 @@ type Service interface {
 	Payout(ctx context.Context, request PaymentRequest) (Payment, error)
 	Transfer(ctx context.Context, request PaymentRequest) (Payment, error)
 	Status(ctx context.Context, opts OptionsFindPayment) (Payment, error)
+	// Requests returns the partner requests made for a payment, oldest first
+	Requests(ctx context.Context, paymentID string) ([]requests.Request, error)
 	ProcessWebhook(ctx context.Context, result *requests.WebhookResult) error
+	PreviewWebhook(ctx context.Context, result *requests.WebhookResult) (PaymentUpdate, error)
+	WebhookKeys(ctx context.Context, result *requests.WebhookResult) (WebhookKeys, error)
+	AuthenticateWebhook(ctx context.Context, result *requests.WebhookResult) error
 }
 
 type ShortCodeService interface {
 	Add(ctx context.Context, shortcode ShortCode) error
+	List(ctx context.Context, opts OptionsFindShortCodes) ([]ShortCode, error)
+	Get(ctx context.Context, id string) (ShortCode, error)
+	Update(ctx context.Context, id string, opts OptionsUpdateShortCode) error
+	Enable(ctx context.Context, id string) error
+	Disable(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+	RotateCredentials(ctx context.Context, id string, credentials ShortCodeCredentials) error
 }
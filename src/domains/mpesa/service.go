@@ -1,17 +1,29 @@
 package mpesa
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
 	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
 	"github.com/SirWaithaka/payments-api/pkg/events/payloads"
 	"github.com/SirWaithaka/payments-api/pkg/events/subjects"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
 	"github.com/SirWaithaka/payments-api/pkg/types"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/events"
 )
@@ -20,7 +32,11 @@ func NewService(repository Repository,
 	shortCodeRepository ShortCodeRepository,
 	requestsRepository requests.Repository,
 	provider Provider,
-	publisher events.Publisher) MpesaService {
+	publisher events.Publisher,
+	limiter ratelimit.Limiter,
+	limits RateLimits,
+	breakers circuit.Breakers,
+	failover bool) MpesaService {
 
 	return MpesaService{
 		repository:          repository,
@@ -28,6 +44,10 @@ func NewService(repository Repository,
 		requestsRepository:  requestsRepository,
 		provider:            provider,
 		publisher:           publisher,
+		limiter:             limiter,
+		limits:              limits,
+		breakers:            breakers,
+		failover:            failover,
 	}
 }
 
@@ -37,13 +57,53 @@ type MpesaService struct {
 	requestsRepository  requests.Repository
 	provider            Provider
 	publisher           events.Publisher
+	// limits are not applied if the limiter is nil
+	limiter ratelimit.Limiter
+	limits  RateLimits
+	// breakers are not checked if nil, with failover the next shortcode by priority
+	// is used when the breaker of a shortcode is open
+	breakers circuit.Breakers
+	failover bool
 }
 
-func (service MpesaService) getShortCode(ctx context.Context, paymentType PaymentType) (ShortCode, error) {
-	// get shortcode details for this payment type
+// allow takes a token from each of the buckets, no token is taken if any bucket is empty
+func (service MpesaService) allow(ctx context.Context, buckets ...ratelimit.Bucket) error {
+	if service.limiter == nil {
+		return nil
+	}
+	return service.limiter.AllowAll(ctx, buckets...)
+}
+
+// shortCodeBucket is the bucket of the partner api calls made with the shortcode
+func (service MpesaService) shortCodeBucket(shortcode ShortCode) ratelimit.Bucket {
+	return ratelimit.Bucket{Key: ratelimit.ShortCodeKey(shortcode.ShortCodeID), Limit: service.limits.ShortCode}
+}
+
+// available returns an error if the breaker of the shortcode is open, it takes a trial
+// call of a half open breaker so it is checked after the rate limits
+func (service MpesaService) available(ctx context.Context, shortcode ShortCode) error {
+	if service.breakers == nil {
+		return nil
+	}
+	return service.breakers.Allow(ctx, circuit.Key(shortcode.Service.String(), shortcode.ShortCodeID))
+}
+
+// ready returns an error if the breaker of the shortcode would reject a call
+func (service MpesaService) ready(shortcode ShortCode) error {
+	if service.breakers == nil {
+		return nil
+	}
+	return service.breakers.Peek(circuit.Key(shortcode.Service.String(), shortcode.ShortCodeID))
+}
+
+func (service MpesaService) getShortCode(ctx context.Context, merchantID string, paymentType PaymentType) (ShortCode, error) {
+	// get shortcode details for this payment type, only shortcodes of the merchant are used
 	shortcodes, err := service.shortCodeRepository.FindMany(ctx, OptionsFindShortCodes{
 		//Service: types.Pointer(requests.PartnerDaraja),
-		Type: types.Pointer(paymentType.String()),
+		MerchantID: &merchantID,
+		Type:       types.Pointer(paymentType.String()),
+		// disabled shortcodes are not used for new payments
+		Disabled: types.Pointer(false),
 	})
 	if err != nil {
 		return ShortCode{}, err
@@ -54,27 +114,55 @@ func (service MpesaService) getShortCode(ctx context.Context, paymentType Paymen
 	}
 
 	// select a shortcode according to priority, low value is higher priority
-	shortcode := shortcodes[0]
-	for _, code := range shortcodes {
-		if code.Priority < shortcode.Priority {
-			shortcode = code
+	slices.SortStableFunc(shortcodes, func(a, b ShortCode) int { return cmp.Compare(a.Priority, b.Priority) })
+
+	// the breakers are only peeked at, the trial call of a half open breaker is taken once
+	// the payment passes the rate limits
+	for _, shortcode := range shortcodes {
+		err = service.ready(shortcode)
+		if err == nil {
+			return shortcode, nil
+		}
+		if !service.failover {
+			return ShortCode{}, err
 		}
+
+		l := zerolog.Ctx(ctx)
+		l.Warn().Err(err).Str("shortcodeId", shortcode.ShortCodeID).Msg("shortcode unavailable, failing over")
 	}
 
-	return shortcode, nil
+	// the breakers of all the shortcodes are open
+	return ShortCode{}, err
 }
 
 func (service MpesaService) Charge(ctx context.Context, req PaymentRequest) (Payment, error) {
+	merchantID, err := merchants.Resolve(ctx, req.MerchantID)
+	if err != nil {
+		return Payment{}, err
+	}
 
 	// get shortcode details for this payment type
-	shortcode, err := service.getShortCode(ctx, PaymentTypeCharge)
+	shortcode, err := service.getShortCode(ctx, merchantID, PaymentTypeCharge)
 	if err != nil {
 		return Payment{}, err
 	}
 
+	// limit the stk pushes sent to the customer and the partner api calls made with the
+	// shortcode, before the payment is saved
+	msisdn := ratelimit.Bucket{Key: ratelimit.MSISDNKey(req.ExternalAccountNumber), Limit: service.limits.MSISDN}
+	if err = service.allow(ctx, msisdn, service.shortCodeBucket(shortcode)); err != nil {
+		return Payment{}, err
+	}
+
+	// a half open breaker only lets payments that passed the rate limits through
+	if err = service.available(ctx, shortcode); err != nil {
+		return Payment{}, err
+	}
+
 	// create a new payment and save it
 	payment := Payment{
 		PaymentID:                ulid.Make().String(),
+		MerchantID:               merchantID,
 		Type:                     PaymentTypeCharge,
 		ClientTransactionID:      req.ClientTransactionID,
 		IdempotencyID:            req.IdempotencyID,
@@ -84,15 +172,21 @@ func (service MpesaService) Charge(ctx context.Context, req PaymentRequest) (Pay
 		Description:              req.Description,
 		ShortCodeID:              shortcode.ShortCodeID,
 		Status:                   requests.StatusReceived,
+		TraceParent:              tracing.TraceParent(ctx),
+		RequestID:                requestid.FromContext(ctx),
 	}
 
 	err = service.repository.Add(ctx, payment)
 	if err != nil {
 		return Payment{}, err
 	}
+	metrics.PaymentCreated(payment.Type.String())
 
 	// get client api for this payment request
-	api := service.provider.GetMpesaApi(shortcode)
+	api, err := service.provider.GetMpesaApi(shortcode)
+	if err != nil {
+		return Payment{}, err
+	}
 	if api == nil {
 		return Payment{}, errors.New("api not configured")
 	}
@@ -115,16 +209,33 @@ func (service MpesaService) Charge(ctx context.Context, req PaymentRequest) (Pay
 }
 
 func (service MpesaService) Payout(ctx context.Context, req PaymentRequest) (Payment, error) {
+	merchantID, err := merchants.Resolve(ctx, req.MerchantID)
+	if err != nil {
+		return Payment{}, err
+	}
 
 	// get shortcode details for this payment type
-	shortcode, err := service.getShortCode(ctx, PaymentTypePayout)
+	shortcode, err := service.getShortCode(ctx, merchantID, PaymentTypePayout)
 	if err != nil {
 		return Payment{}, err
 	}
 
+	// limit the payouts made to the customer and the partner api calls made with the
+	// shortcode, before the payment is saved
+	msisdn := ratelimit.Bucket{Key: ratelimit.MSISDNKey(req.ExternalAccountNumber), Limit: service.limits.MSISDN}
+	if err = service.allow(ctx, msisdn, service.shortCodeBucket(shortcode)); err != nil {
+		return Payment{}, err
+	}
+
+	// a half open breaker only lets payments that passed the rate limits through
+	if err = service.available(ctx, shortcode); err != nil {
+		return Payment{}, err
+	}
+
 	// create a new payment and save it
 	payment := Payment{
 		PaymentID:                ulid.Make().String(),
+		MerchantID:               merchantID,
 		Type:                     PaymentTypePayout,
 		ClientTransactionID:      req.ClientTransactionID,
 		IdempotencyID:            req.IdempotencyID,
@@ -134,6 +245,8 @@ func (service MpesaService) Payout(ctx context.Context, req PaymentRequest) (Pay
 		Description:              req.Description,
 		ShortCodeID:              shortcode.ShortCodeID,
 		Status:                   requests.StatusReceived,
+		TraceParent:              tracing.TraceParent(ctx),
+		RequestID:                requestid.FromContext(ctx),
 	}
 
 	// saving will fail if payment with the same idempotency id already exists
@@ -141,9 +254,13 @@ func (service MpesaService) Payout(ctx context.Context, req PaymentRequest) (Pay
 	if err != nil {
 		return Payment{}, err
 	}
+	metrics.PaymentCreated(payment.Type.String())
 
 	// get client api for this payment request
-	api := service.provider.GetMpesaApi(shortcode)
+	api, err := service.provider.GetMpesaApi(shortcode)
+	if err != nil {
+		return Payment{}, err
+	}
 	if api == nil {
 		return Payment{}, errors.New("api not configured")
 	}
@@ -166,16 +283,31 @@ func (service MpesaService) Payout(ctx context.Context, req PaymentRequest) (Pay
 }
 
 func (service MpesaService) Transfer(ctx context.Context, req PaymentRequest) (Payment, error) {
+	merchantID, err := merchants.Resolve(ctx, req.MerchantID)
+	if err != nil {
+		return Payment{}, err
+	}
 
 	// get shortcode details for this payment type
-	shortcode, err := service.getShortCode(ctx, PaymentTypeTransfer)
+	shortcode, err := service.getShortCode(ctx, merchantID, PaymentTypeTransfer)
 	if err != nil {
 		return Payment{}, err
 	}
 
+	// limit the partner api calls made with the shortcode, before the payment is saved
+	if err = service.allow(ctx, service.shortCodeBucket(shortcode)); err != nil {
+		return Payment{}, err
+	}
+
+	// a half open breaker only lets payments that passed the rate limits through
+	if err = service.available(ctx, shortcode); err != nil {
+		return Payment{}, err
+	}
+
 	// create a new payment and save it
 	payment := Payment{
 		PaymentID:                ulid.Make().String(),
+		MerchantID:               merchantID,
 		Type:                     PaymentTypeTransfer,
 		ClientTransactionID:      req.ClientTransactionID,
 		IdempotencyID:            req.IdempotencyID,
@@ -186,6 +318,8 @@ func (service MpesaService) Transfer(ctx context.Context, req PaymentRequest) (P
 		Description:              req.Description,
 		ShortCodeID:              shortcode.ShortCodeID,
 		Status:                   requests.StatusReceived,
+		TraceParent:              tracing.TraceParent(ctx),
+		RequestID:                requestid.FromContext(ctx),
 	}
 
 	// saving will fail if payment with the same idempotency id already exists
@@ -193,9 +327,13 @@ func (service MpesaService) Transfer(ctx context.Context, req PaymentRequest) (P
 	if err != nil {
 		return Payment{}, err
 	}
+	metrics.PaymentCreated(payment.Type.String())
 
 	// get client api for this payment request
-	api := service.provider.GetMpesaApi(shortcode)
+	api, err := service.provider.GetMpesaApi(shortcode)
+	if err != nil {
+		return Payment{}, err
+	}
 	if api == nil {
 		return Payment{}, errors.New("api not configured")
 	}
@@ -237,11 +375,23 @@ func (service MpesaService) Status(ctx context.Context, opts OptionsFindPayment)
 		return Payment{}, err
 	}
 
-	api := service.provider.GetMpesaApi(shortcode)
+	api, err := service.provider.GetMpesaApi(shortcode)
+	if err != nil {
+		return Payment{}, err
+	}
 	if api == nil {
 		return Payment{}, errors.New("api not configured")
 	}
 
+	if err = service.allow(ctx, service.shortCodeBucket(shortcode)); err != nil {
+		return Payment{}, err
+	}
+
+	// the status is not queried while the partner is failing
+	if err = service.available(ctx, shortcode); err != nil {
+		return Payment{}, err
+	}
+
 	// make http request to payment processor api
 	if err = api.Status(ctx, payment); err != nil {
 		return Payment{}, err
@@ -251,14 +401,89 @@ func (service MpesaService) Status(ctx context.Context, opts OptionsFindPayment)
 	return service.repository.FindOne(ctx, opts)
 }
 
-func (service MpesaService) ProcessWebhook(ctx context.Context, result *requests.WebhookResult) error {
+func (service MpesaService) Requests(ctx context.Context, paymentID string) ([]requests.Request, error) {
+	// find the payment first, requests are only returned for payments of the merchant
+	payment, err := service.repository.FindOne(ctx, OptionsFindPayment{PaymentID: &paymentID})
+	if err != nil {
+		return nil, err
+	}
+
+	return service.requestsRepository.FindMany(ctx, requests.OptionsFindRequest{PaymentID: &payment.PaymentID})
+}
+
+func (service MpesaService) ProcessWebhook(ctx context.Context, result *requests.WebhookResult) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "mpesa.ProcessWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	l := zerolog.Ctx(ctx)
+
+	update, err := service.PreviewWebhook(ctx, result)
+	if err != nil {
+		return err
+	}
+
+	// webhook does not update any payment
+	if update.PaymentID == "" {
+		return nil
+	}
+	span.SetAttributes(attribute.String("payments.payment_id", update.PaymentID))
+
+	// update payment record
+	payment, previous, err := service.repository.Transition(ctx, update.PaymentID, update.OptionsUpdatePayment)
+	if err != nil {
+		return err
+	}
+	service.observeWebhook(ctx, result, payment, previous)
+
+	// publish webhook event, the event is published for duplicate webhooks too so that a
+	// webhook that failed to publish is published when it is processed again
+	event := pkgevents.NewEvent(subjects.PaymentCompleted, payloads.PaymentStatusUpdated{
+		PaymentID: payment.PaymentID,
+	})
+	event.SetKey(payment.PaymentID)
+	// the event carries the id of the api request that created the payment, not the id
+	// of the webhook, so that the payment can be followed from request to event
+	if payment.RequestID != "" {
+		ctx = requestid.WithContext(ctx, payment.RequestID)
+	}
+	err = service.publisher.Publish(ctx, event)
+	if err != nil {
+		l.Error().Err(err).Msg("error publishing event")
+		return err
+	}
+	l.Debug().Msg("webhook event published")
+
+	return nil
+}
+
+// observeWebhook links the span of the webhook to the trace of the request that created the
+// payment. If the webhook moved the payment to a final status, it counts the payment and
+// records the delay of the webhook since the payment was created. Duplicate and replayed
+// webhooks of a completed payment are not counted.
+func (service MpesaService) observeWebhook(ctx context.Context, result *requests.WebhookResult, payment Payment, previous requests.Status) {
+	if link, ok := tracing.Link(payment.TraceParent); ok {
+		trace.SpanFromContext(ctx).AddLink(link)
+	}
+
+	if previous.Final() || !payment.Status.Final() {
+		return
+	}
+
+	metrics.ObserveWebhookDelay(result.Service.String(), payment.Type.String(), time.Since(payment.CreatedAt))
+	metrics.PaymentCompleted(payment.Type.String(), payment.Status.String())
+}
+
+// PreviewWebhook parses the webhook and returns the update it would apply to a payment
+// without applying it. The PaymentID of the update is empty if the webhook is not tied
+// to a payment.
+func (service MpesaService) PreviewWebhook(ctx context.Context, result *requests.WebhookResult) (PaymentUpdate, error) {
 	l := zerolog.Ctx(ctx)
 	l.Debug().Any(logger.LData, result).Msg("processing webhook")
 
 	// get the webhook processor for this service
 	processor := service.provider.GetWebhookProcessor(result.Service)
 	if processor == nil {
-		return errors.New("webhook processor not found")
+		return PaymentUpdate{}, errors.New("webhook processor not found")
 	}
 
 	// use client to get necessary data to update payment
@@ -267,7 +492,7 @@ func (service MpesaService) ProcessWebhook(ctx context.Context, result *requests
 	if err != nil {
 		// if error, do nothing and return
 		l.Warn().Err(err).Msg("error transforming webhook")
-		return err
+		return PaymentUpdate{}, err
 	}
 
 	// check if the webhook is tied to a request
@@ -276,7 +501,7 @@ func (service MpesaService) ProcessWebhook(ctx context.Context, result *requests
 	if in, ok = result.Data.(interface{ ExternalID() string }); !ok || in.ExternalID() == "" {
 		// TODO: do something else with webhook if its not registered
 		l.Warn().Msg("webhook not registered")
-		return nil
+		return PaymentUpdate{}, nil
 	}
 
 	// fetch request
@@ -285,31 +510,141 @@ func (service MpesaService) ProcessWebhook(ctx context.Context, result *requests
 	if err != nil {
 		// TODO: do something if error is not found
 		l.Error().Err(err).Msg("error fetching request")
-		return err
+		return PaymentUpdate{}, err
 	}
 
-	// check if the request has a payment record attached, then update the payment
+	// check if the request has a payment record attached
 	if req.PaymentID == "" {
 		l.Info().Msg("no payment details attached to request")
+		return PaymentUpdate{}, nil
+	}
+
+	return PaymentUpdate{PaymentID: req.PaymentID, OptionsUpdatePayment: *opts}, nil
+}
+
+// WebhookKeys parses the webhook and returns the keys that identify it. A webhook that was
+// already parsed, e.g. when it was authenticated, is not parsed again.
+func (service MpesaService) WebhookKeys(ctx context.Context, result *requests.WebhookResult) (WebhookKeys, error) {
+	if result.Data == nil {
+		// get the webhook processor for this service
+		processor := service.provider.GetWebhookProcessor(result.Service)
+		if processor == nil {
+			return WebhookKeys{}, errors.New("webhook processor not found")
+		}
+
+		// parse the webhook, the payment update options are not needed
+		if err := processor.Process(ctx, result, &OptionsUpdatePayment{}); err != nil {
+			return WebhookKeys{}, err
+		}
+	}
+
+	var keys WebhookKeys
+	if in, ok := result.Data.(interface{ ExternalID() string }); ok {
+		keys.CorrelationID = in.ExternalID()
+	}
+	if in, ok := result.Data.(interface{ NaturalKey() string }); ok {
+		keys.NaturalKey = in.NaturalKey()
+	}
+
+	return keys, nil
+}
+
+// AuthenticateWebhook verifies that the webhook was sent by the partner it claims to be from,
+// and that the payment it updates belongs to the merchant of the shortcode it was sent for.
+// Webhooks of a deleted shortcode are accepted for payments made before it was deleted.
+func (service MpesaService) AuthenticateWebhook(ctx context.Context, result *requests.WebhookResult) error {
+	authenticator := service.provider.GetWebhookAuthenticator(result.Service)
+	if authenticator == nil {
+		return requests.WebhookRejectedError{Reason: "unsupported partner"}
+	}
+
+	err := authenticator.Authenticate(ctx, result)
+	if errors.Is(err, requests.ErrMissingCallbackToken) {
+		return service.authenticateWithoutToken(ctx, result, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	deleted := !result.ShortCodeDeletedAt.IsZero()
+	payment, ok, err := service.webhookPayment(ctx, result)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if deleted {
+			return requests.WebhookRejectedError{Reason: "shortcode deleted"}
+		}
 		return nil
 	}
+	if payment.MerchantID != result.MerchantID {
+		return requests.WebhookRejectedError{Reason: "payment does not belong to the merchant of the shortcode"}
+	}
+	if deleted && !payment.CreatedAt.Before(result.ShortCodeDeletedAt) {
+		return requests.WebhookRejectedError{Reason: "shortcode deleted"}
+	}
 
-	// update payment record
-	err = service.repository.Update(ctx, req.PaymentID, *opts)
+	return nil
+}
+
+// authenticateWithoutToken accepts a webhook without a callback token if it updates a
+// payment made before its shortcode was issued a callback token, the callback urls of
+// the payment had no token
+func (service MpesaService) authenticateWithoutToken(ctx context.Context, result *requests.WebhookResult, cause error) error {
+	l := zerolog.Ctx(ctx)
+
+	payment, ok, err := service.webhookPayment(ctx, result)
 	if err != nil {
 		return err
 	}
+	if !ok {
+		return cause
+	}
 
-	// publish webhook event
-	event := pkgevents.NewEvent(subjects.PaymentCompleted, payloads.PaymentStatusUpdated{
-		PaymentID: req.PaymentID,
-	})
-	err = service.publisher.Publish(ctx, event)
+	shortcode, err := service.shortCodeRepository.FindOne(ctx, OptionsFindShortCodes{ShortCodeID: &payment.ShortCodeID, WithDeleted: true})
 	if err != nil {
-		l.Error().Err(err).Msg("error publishing event")
+		l.Error().Err(err).Msg("error fetching shortcode of payment")
 		return err
 	}
-	l.Debug().Msg("webhook event published")
+	if shortcode.CallbackTokenIssuedAt.IsZero() || !payment.CreatedAt.Before(shortcode.CallbackTokenIssuedAt) {
+		return cause
+	}
+
+	l.Info().Str("paymentId", payment.PaymentID).Msg("accepting webhook without callback token for payment made before the token")
+	result.MerchantID = payment.MerchantID
 
 	return nil
 }
+
+// webhookPayment returns the payment the webhook updates, false if it is not tied to a payment
+func (service MpesaService) webhookPayment(ctx context.Context, result *requests.WebhookResult) (Payment, bool, error) {
+	l := zerolog.Ctx(ctx)
+
+	// a webhook that cannot be parsed is not tied to a payment, it fails when processed
+	keys, err := service.WebhookKeys(ctx, result)
+	if err != nil || keys.CorrelationID == "" {
+		return Payment{}, false, nil
+	}
+	extID := keys.CorrelationID
+
+	req, err := service.requestsRepository.FindOne(ctx, requests.OptionsFindRequest{ExternalID: &extID})
+	var nf pkgerrors.NotFounder
+	if errors.As(err, &nf) && nf.NotFound() {
+		return Payment{}, false, nil
+	}
+	if err != nil {
+		l.Error().Err(err).Msg("error fetching request of webhook")
+		return Payment{}, false, err
+	}
+	if req.PaymentID == "" {
+		return Payment{}, false, nil
+	}
+
+	payment, err := service.repository.FindOne(ctx, OptionsFindPayment{PaymentID: &req.PaymentID})
+	if err != nil {
+		l.Error().Err(err).Msg("error fetching payment of webhook")
+		return Payment{}, false, err
+	}
+
+	return payment, true, nil
+}
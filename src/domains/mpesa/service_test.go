@@ -3,15 +3,25 @@ package mpesa_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gofrs/uuid/v5"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 	"github.com/SirWaithaka/payments-api/testdata"
@@ -30,13 +40,27 @@ func (f FakeWebhookBody) ExternalID() string {
 
 type MockPublisher struct {
 	calls uint
+	// request ids of the published events
+	requestIDs []string
 }
 
 func (m *MockPublisher) Publish(ctx context.Context, event events.EventType) error {
 	m.calls++
+	m.requestIDs = append(m.requestIDs, requestid.FromContext(ctx))
 	return nil
 }
 
+// MockLimiter rejects all requests
+type MockLimiter struct{}
+
+func (m MockLimiter) Allow(ctx context.Context, key string, limit rate.Limit) error {
+	return ratelimit.LimitedError{Key: key, RetryAfter: time.Second}
+}
+
+func (m MockLimiter) AllowAll(ctx context.Context, buckets ...ratelimit.Bucket) error {
+	return ratelimit.LimitedError{Key: buckets[0].Key, RetryAfter: time.Second}
+}
+
 type MockWebhookProcessor struct{}
 
 func (m MockWebhookProcessor) Process(ctx context.Context, result *requests.WebhookResult, out any) error {
@@ -63,16 +87,38 @@ func (m MockWebhookProcessor) Process(ctx context.Context, result *requests.Webh
 	return nil
 }
 
-type MockProvider struct{}
+// MockWebhookAuthenticator authenticates every webhook for the merchant, or returns err
+type MockWebhookAuthenticator struct {
+	merchantID string
+	deletedAt  time.Time
+	err        error
+}
 
-func (m MockProvider) GetMpesaApi(shortcode mpesa.ShortCode) mpesa.API {
+func (m MockWebhookAuthenticator) Authenticate(ctx context.Context, result *requests.WebhookResult) error {
+	if m.err != nil {
+		return m.err
+	}
+	result.MerchantID = m.merchantID
+	result.ShortCodeDeletedAt = m.deletedAt
 	return nil
 }
 
+type MockProvider struct {
+	authenticator requests.WebhookAuthenticator
+}
+
+func (m MockProvider) GetMpesaApi(shortcode mpesa.ShortCode) (mpesa.API, error) {
+	return nil, nil
+}
+
 func (m MockProvider) GetWebhookProcessor(service requests.Partner) requests.WebhookProcessor {
 	return &MockWebhookProcessor{}
 }
 
+func (m MockProvider) GetWebhookAuthenticator(service requests.Partner) requests.WebhookAuthenticator {
+	return m.authenticator
+}
+
 func TestWebhookService_Process(t *testing.T) {
 	defer testdata.ResetTables(inf)
 
@@ -86,6 +132,8 @@ func TestWebhookService_Process(t *testing.T) {
 		ClientTransactionID: ulid.Make().String(),
 		IdempotencyID:       ulid.Make().String(),
 		Status:              "received",
+		// id of the api request that created the payment
+		RequestID: requestid.New(),
 	}
 	err := paymentsRepo.Add(t.Context(), payment)
 	if err != nil {
@@ -106,7 +154,7 @@ func TestWebhookService_Process(t *testing.T) {
 	}
 
 	publisher := &MockPublisher{}
-	service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, publisher)
+	service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, publisher, nil, mpesa.RateLimits{}, nil, false)
 
 	// fake webhook result
 	body := `{"ResultCode": "%s","OriginationID": "%s","Amount": "100","ReceiptID": "%s"}`
@@ -114,7 +162,9 @@ func TestWebhookService_Process(t *testing.T) {
 	// use a fake payment reference, use request external id in the fake webhook result
 	paymentReference := ulid.Make().String()
 	fakeWebhook := requests.NewWebhookResult("test", "express", strings.NewReader(fmt.Sprintf(body, "0", request.ExternalID, paymentReference)))
-	err = service.ProcessWebhook(t.Context(), fakeWebhook)
+	// the webhook is received with its own request id
+	ctx := requestid.WithContext(t.Context(), requestid.New())
+	err = service.ProcessWebhook(ctx, fakeWebhook)
 	if err != nil {
 		t.Errorf("expected nil error, got %v", err)
 	}
@@ -130,4 +180,358 @@ func TestWebhookService_Process(t *testing.T) {
 	assert.Equal(t, requests.StatusSucceeded.String(), record.Status)
 	// check it call publisher
 	assert.Equal(t, uint(1), publisher.calls)
+	// the event carries the request id of the payment
+	assert.Equal(t, []string{payment.RequestID}, publisher.requestIDs)
+}
+
+// completedPayments returns the count of succeeded payments of the type in the metrics
+func completedPayments(paymentType mpesa.PaymentType) float64 {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	prefix := fmt.Sprintf(`payments_completed_total{status="succeeded",type="%s"} `, paymentType)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			count, _ := strconv.ParseFloat(value, 64)
+			return count
+		}
+	}
+	return 0
+}
+
+func TestMpesaService_ProcessWebhook_Duplicate(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	requestsRepo := postgres.NewRequestRepository(inf.Storage.PG)
+	paymentsRepo := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+	shortCodeRepo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	// save a payment and the request made for it
+	payment := mpesa.Payment{
+		PaymentID:           ulid.Make().String(),
+		Type:                mpesa.PaymentTypeTransfer,
+		ClientTransactionID: ulid.Make().String(),
+		IdempotencyID:       ulid.Make().String(),
+		Status:              requests.StatusSent,
+	}
+	if err := paymentsRepo.Add(t.Context(), payment); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	request := requests.Request{
+		RequestID:  ulid.Make().String(),
+		PaymentID:  payment.PaymentID,
+		ExternalID: ulid.Make().String(),
+		Partner:    "test",
+		Status:     requests.StatusSucceeded,
+	}
+	if err := requestsRepo.Add(t.Context(), request); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	publisher := &MockPublisher{}
+	service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, publisher, nil, mpesa.RateLimits{}, nil, false)
+
+	body := fmt.Sprintf(`{"ResultCode": "0","OriginationID": "%s","Amount": "100","ReceiptID": "%s"}`, request.ExternalID, ulid.Make().String())
+	before := completedPayments(mpesa.PaymentTypeTransfer)
+
+	// the webhook is delivered twice
+	for range 2 {
+		webhook := requests.NewWebhookResult("test", "express", strings.NewReader(body))
+		assert.Nil(t, service.ProcessWebhook(t.Context(), webhook))
+	}
+
+	// the payment is counted once, the event is published for both
+	assert.Equal(t, before+1, completedPayments(mpesa.PaymentTypeTransfer))
+	assert.Equal(t, uint(2), publisher.calls)
+}
+
+func TestMpesaService_PreviewWebhook(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	requestsRepo := postgres.NewRequestRepository(inf.Storage.PG)
+	paymentsRepo := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+	shortCodeRepo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	// save a payment
+	payment := mpesa.Payment{
+		PaymentID:           ulid.Make().String(),
+		ClientTransactionID: ulid.Make().String(),
+		IdempotencyID:       ulid.Make().String(),
+		Status:              "received",
+	}
+	err := paymentsRepo.Add(t.Context(), payment)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	// save a request record
+	request := requests.Request{
+		RequestID:  ulid.Make().String(),
+		PaymentID:  payment.PaymentID,
+		ExternalID: ulid.Make().String(),
+		Partner:    "test",
+		Status:     requests.StatusSucceeded,
+	}
+	err = requestsRepo.Add(t.Context(), request)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	publisher := &MockPublisher{}
+	service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, publisher, nil, mpesa.RateLimits{}, nil, false)
+
+	// fake webhook result
+	body := `{"ResultCode": "%s","OriginationID": "%s","Amount": "100","ReceiptID": "%s"}`
+
+	// use a fake payment reference, use request external id in the fake webhook result
+	paymentReference := ulid.Make().String()
+	fakeWebhook := requests.NewWebhookResult("test", "express", strings.NewReader(fmt.Sprintf(body, "0", request.ExternalID, paymentReference)))
+	update, err := service.PreviewWebhook(t.Context(), fakeWebhook)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	assert.Equal(t, payment.PaymentID, update.PaymentID)
+	assert.Equal(t, paymentReference, *update.PaymentReference)
+	assert.Equal(t, requests.StatusSucceeded, *update.Status)
+
+	// check that the payment is not updated
+	var record postgres.MpesaPaymentSchema
+	result := inf.Storage.PG.Where(postgres.MpesaPaymentSchema{PaymentID: payment.PaymentID}).First(&record)
+	if result.Error != nil {
+		t.Errorf("expected nil error, got %v", result.Error)
+	}
+
+	assert.Nil(t, record.PaymentReference)
+	assert.Equal(t, "received", record.Status)
+	assert.Equal(t, uint(0), publisher.calls)
+}
+
+func TestMpesaService_Charge_Breakers(t *testing.T) {
+	requestsRepo := postgres.NewRequestRepository(inf.Storage.PG)
+	paymentsRepo := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+	shortCodeRepo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	settings := circuit.Settings{Window: 1, MinCalls: 1, ErrorRate: 1, OpenDuration: time.Minute, HalfOpenCalls: 1}
+
+	merchantID := uuid.Must(uuid.NewV7()).String()
+	primary := mpesa.ShortCode{
+		ShortCodeID: ulid.Make().String(),
+		MerchantID:  merchantID,
+		ShortCode:   "000000",
+		Environment: "sandbox",
+		Priority:    1,
+		Service:     requests.PartnerDaraja,
+		Type:        mpesa.PaymentTypeCharge,
+		Key:         "fake_key",
+		Secret:      "fake_secret",
+	}
+	secondary := primary
+	secondary.ShortCodeID = ulid.Make().String()
+	secondary.ShortCode = "000001"
+	secondary.Priority = 2
+
+	setup := func(t *testing.T) *circuit.Registry {
+		for _, shortcode := range []mpesa.ShortCode{primary, secondary} {
+			if err := shortCodeRepo.Add(t.Context(), shortcode); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+		}
+
+		// open the breaker of the primary shortcode
+		breakers := circuit.NewRegistry(settings, nil)
+		breakers.Record(t.Context(), circuit.Key(primary.Service.String(), primary.ShortCodeID), circuit.Outcome{Failed: true})
+		return breakers
+	}
+
+	request := func() mpesa.PaymentRequest {
+		return mpesa.PaymentRequest{
+			MerchantID:            merchantID,
+			ClientTransactionID:   ulid.Make().String(),
+			IdempotencyID:         ulid.Make().String(),
+			Amount:                "10",
+			ExternalAccountNumber: "254700000000",
+		}
+	}
+
+	t.Run("test that payments fail fast while the breaker is open", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		breakers := setup(t)
+		service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, &MockPublisher{}, nil, mpesa.RateLimits{}, breakers, false)
+
+		_, err := service.Charge(t.Context(), request())
+		var open circuit.OpenError
+		assert.ErrorAs(t, err, &open)
+
+		// no payment is saved
+		var count int64
+		inf.Storage.PG.Model(&postgres.MpesaPaymentSchema{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("test that payments fail over to the next shortcode", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		breakers := setup(t)
+		service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, &MockPublisher{}, nil, mpesa.RateLimits{}, breakers, true)
+
+		// the mock provider has no api, the payment is saved before the api is called
+		req := request()
+		_, _ = service.Charge(t.Context(), req)
+
+		var record postgres.MpesaPaymentSchema
+		result := inf.Storage.PG.Where(postgres.MpesaPaymentSchema{IdempotencyID: req.IdempotencyID}).First(&record)
+		if result.Error != nil {
+			t.Errorf("expected nil error, got %v", result.Error)
+		}
+		assert.Equal(t, secondary.ShortCodeID, *record.ShortCodeID)
+	})
+
+	t.Run("test that rate limited payments do not take the trial call of a half open breaker", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		setup(t)
+		// the breaker of the primary shortcode is half open once the open duration passes
+		settings := settings
+		settings.OpenDuration = time.Millisecond
+		breakers := circuit.NewRegistry(settings, nil)
+		key := circuit.Key(primary.Service.String(), primary.ShortCodeID)
+		breakers.Record(t.Context(), key, circuit.Outcome{Failed: true})
+		time.Sleep(2 * time.Millisecond)
+
+		limits := mpesa.RateLimits{MSISDN: rate.Limit{Rate: 1, Burst: 1}, ShortCode: rate.Limit{Rate: 1, Burst: 1}}
+		service := mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, &MockProvider{}, &MockPublisher{}, MockLimiter{}, limits, breakers, false)
+
+		_, err := service.Charge(t.Context(), request())
+		var limited ratelimit.LimitedError
+		assert.ErrorAs(t, err, &limited)
+
+		// the trial call is still available
+		assert.Nil(t, breakers.Allow(t.Context(), key))
+	})
+}
+
+func TestMpesaService_AuthenticateWebhook(t *testing.T) {
+	requestsRepo := postgres.NewRequestRepository(inf.Storage.PG)
+	paymentsRepo := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+	shortCodeRepo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	merchantID := uuid.Must(uuid.NewV7()).String()
+	body := `{"ResultCode": "0","OriginationID": "%s","Amount": "100","ReceiptID": "%s"}`
+
+	// setup saves a shortcode issued a callback token at issuedAt, and a payment made with it.
+	// It returns a webhook for the payment.
+	setup := func(t *testing.T, issuedAt time.Time) *requests.WebhookResult {
+		shortcode := mpesa.ShortCode{
+			ShortCodeID:   ulid.Make().String(),
+			MerchantID:    merchantID,
+			ShortCode:     "000000",
+			Environment:   "sandbox",
+			Service:       requests.PartnerQuikk,
+			Type:          mpesa.PaymentTypeCharge,
+			Key:           "fake_key",
+			Secret:        "fake_secret",
+			CallbackToken: ulid.Make().String(),
+		}
+		if err := shortCodeRepo.Add(t.Context(), shortcode); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		result := inf.Storage.PG.Model(&postgres.ShortCodeSchema{}).
+			Where("id = ?", shortcode.ShortCodeID).
+			Update("callback_token_issued_at", issuedAt)
+		if result.Error != nil {
+			t.Fatalf("expected nil error, got %v", result.Error)
+		}
+
+		payment := mpesa.Payment{
+			PaymentID:           ulid.Make().String(),
+			MerchantID:          merchantID,
+			ShortCodeID:         shortcode.ShortCodeID,
+			ClientTransactionID: ulid.Make().String(),
+			IdempotencyID:       ulid.Make().String(),
+			Status:              "received",
+		}
+		if err := paymentsRepo.Add(t.Context(), payment); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		request := requests.Request{
+			RequestID:  ulid.Make().String(),
+			PaymentID:  payment.PaymentID,
+			ExternalID: ulid.Make().String(),
+			Partner:    "test",
+			Status:     requests.StatusSucceeded,
+		}
+		if err := requestsRepo.Add(t.Context(), request); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		return requests.NewWebhookResult(requests.PartnerQuikk.String(), "express", strings.NewReader(fmt.Sprintf(body, request.ExternalID, ulid.Make().String())))
+	}
+
+	newService := func(authenticator requests.WebhookAuthenticator) mpesa.MpesaService {
+		provider := &MockProvider{authenticator: authenticator}
+		return mpesa.NewService(paymentsRepo, shortCodeRepo, requestsRepo, provider, &MockPublisher{}, nil, mpesa.RateLimits{}, nil, false)
+	}
+
+	t.Run("test that a webhook for a payment of the merchant is accepted", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(-time.Hour))
+		service := newService(MockWebhookAuthenticator{merchantID: merchantID})
+
+		assert.Nil(t, service.AuthenticateWebhook(t.Context(), webhook))
+		assert.Equal(t, merchantID, webhook.MerchantID)
+	})
+
+	t.Run("test that a webhook for a payment of another merchant is rejected", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(-time.Hour))
+		service := newService(MockWebhookAuthenticator{merchantID: uuid.Must(uuid.NewV7()).String()})
+
+		err := service.AuthenticateWebhook(t.Context(), webhook)
+		var rejected requests.WebhookRejectedError
+		assert.ErrorAs(t, err, &rejected)
+	})
+
+	t.Run("test that a webhook of a deleted shortcode is accepted for a payment made before the delete", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(-time.Hour))
+		service := newService(MockWebhookAuthenticator{merchantID: merchantID, deletedAt: time.Now().Add(time.Minute)})
+
+		assert.Nil(t, service.AuthenticateWebhook(t.Context(), webhook))
+	})
+
+	t.Run("test that a webhook of a deleted shortcode is rejected for a payment made after the delete", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(-time.Hour))
+		service := newService(MockWebhookAuthenticator{merchantID: merchantID, deletedAt: time.Now().Add(-time.Minute)})
+
+		err := service.AuthenticateWebhook(t.Context(), webhook)
+		assert.Equal(t, requests.WebhookRejectedError{Reason: "shortcode deleted"}, err)
+	})
+
+	t.Run("test that a webhook without a token is accepted for a payment made before the token", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(time.Hour))
+		service := newService(MockWebhookAuthenticator{err: requests.ErrMissingCallbackToken})
+
+		assert.Nil(t, service.AuthenticateWebhook(t.Context(), webhook))
+		assert.Equal(t, merchantID, webhook.MerchantID)
+	})
+
+	t.Run("test that a webhook without a token is rejected for a payment made after the token", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		webhook := setup(t, time.Now().Add(-time.Hour))
+		service := newService(MockWebhookAuthenticator{err: requests.ErrMissingCallbackToken})
+
+		err := service.AuthenticateWebhook(t.Context(), webhook)
+		assert.ErrorIs(t, err, requests.ErrMissingCallbackToken)
+	})
 }
@@ -2,20 +2,33 @@ package mpesa
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 
+	"github.com/gofrs/uuid/v5"
+
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 )
 
-func NewServiceShortCode(repository ShortCodeRepository) ServiceShortCode {
-	return ServiceShortCode{repository: repository}
+func NewServiceShortCode(repository ShortCodeRepository, encrypter CredentialsEncrypter, clients ClientEvicter) ServiceShortCode {
+	return ServiceShortCode{repository: repository, encrypter: encrypter, clients: clients}
 }
 
 type ServiceShortCode struct {
 	repository ShortCodeRepository
+	encrypter  CredentialsEncrypter
+	clients    ClientEvicter
 }
 
 func (service ServiceShortCode) Add(ctx context.Context, shortcode ShortCode) error {
+	merchantID, err := merchants.Resolve(ctx, shortcode.MerchantID)
+	if err != nil {
+		return err
+	}
+	shortcode.MerchantID = merchantID
+
 	if !shortcode.Type.Valid() {
 		return errors.New("unknown type on shortcode")
 	}
@@ -34,5 +47,131 @@ func (service ServiceShortCode) Add(ctx context.Context, shortcode ShortCode) er
 		shortcode.Priority = 10
 	}
 
+	// generate the token partners present on callbacks
+	if shortcode.CallbackToken == "" {
+		shortcode.CallbackToken = NewCallbackToken()
+	}
+
+	// the credentials are bound to the id of the shortcode when they are encrypted
+	if shortcode.ShortCodeID == "" {
+		shortcode.ShortCodeID = uuid.Must(uuid.NewV7()).String()
+	}
+
+	// the key is encrypted, shortcodes are found by its hash
+	shortcode.KeyHash = HashKey(shortcode.Key)
+	shortcode, err = service.encrypter.Encrypt(shortcode)
+	if err != nil {
+		return err
+	}
+
 	return service.repository.Add(ctx, shortcode)
 }
+
+// NewCallbackToken generates a random, url safe token that is added to shortcode
+// callback urls. Webhooks are only accepted if they present a known token.
+func NewCallbackToken() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (service ServiceShortCode) List(ctx context.Context, opts OptionsFindShortCodes) ([]ShortCode, error) {
+	return service.repository.FindMany(ctx, opts)
+}
+
+func (service ServiceShortCode) Get(ctx context.Context, id string) (ShortCode, error) {
+	return service.repository.FindOne(ctx, OptionsFindShortCodes{ShortCodeID: &id})
+}
+
+// Update changes the priority, callback url or environment of a shortcode
+func (service ServiceShortCode) Update(ctx context.Context, id string, opts OptionsUpdateShortCode) error {
+	if opts.Priority != nil && *opts.Priority == 0 {
+		return errors.New("shortcode priority should be greater than 0")
+	}
+
+	if opts.Environment != nil && *opts.Environment != "sandbox" && *opts.Environment != "production" {
+		return errors.New("unknown environment on shortcode")
+	}
+
+	// credentials are changed with RotateCredentials
+	update := OptionsUpdateShortCode{
+		Environment: opts.Environment,
+		Priority:    opts.Priority,
+		CallbackURL: opts.CallbackURL,
+	}
+
+	return service.repository.Update(ctx, id, update)
+}
+
+func (service ServiceShortCode) Enable(ctx context.Context, id string) error {
+	disabled := false
+	return service.repository.Update(ctx, id, OptionsUpdateShortCode{Disabled: &disabled})
+}
+
+// Disable stops the shortcode from being used for new payments. Webhooks for
+// payments made with the shortcode are still accepted.
+func (service ServiceShortCode) Disable(ctx context.Context, id string) error {
+	disabled := true
+	if err := service.repository.Update(ctx, id, OptionsUpdateShortCode{Disabled: &disabled}); err != nil {
+		return err
+	}
+
+	service.evict(id)
+	return nil
+}
+
+func (service ServiceShortCode) Delete(ctx context.Context, id string) error {
+	if err := service.repository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	service.evict(id)
+	return nil
+}
+
+// evict removes the partner clients kept for the shortcode
+func (service ServiceShortCode) evict(id string) {
+	if service.clients != nil {
+		service.clients.Evict(id)
+	}
+}
+
+// RotateCredentials replaces the partner credentials of a shortcode. Only the
+// credentials that are not empty are replaced.
+func (service ServiceShortCode) RotateCredentials(ctx context.Context, id string, credentials ShortCodeCredentials) error {
+	replace := credentials
+	replace.RotateCallbackToken = false
+	if replace == (ShortCodeCredentials{}) && !credentials.RotateCallbackToken {
+		return errors.New("no credentials to rotate")
+	}
+
+	if replace != (ShortCodeCredentials{}) {
+		shortcode, err := service.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if credentials.Key != "" {
+			shortcode.KeyHash = HashKey(credentials.Key)
+		}
+		shortcode, err = service.encrypter.Replace(shortcode, replace)
+		if err != nil {
+			return err
+		}
+
+		if err = service.repository.UpdateCredentials(ctx, shortcode); err != nil {
+			return err
+		}
+		service.evict(id)
+	}
+
+	if credentials.RotateCallbackToken {
+		token := NewCallbackToken()
+		if err := service.repository.Update(ctx, id, OptionsUpdateShortCode{CallbackToken: &token}); err != nil {
+			return err
+		}
+		service.evict(id)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+func NewLimiter(repository Repository) BucketLimiter {
+	return BucketLimiter{repository: repository}
+}
+
+// BucketLimiter keeps the token buckets in the repository, so that limits are shared by
+// all instances of the api
+type BucketLimiter struct {
+	repository Repository
+}
+
+func (limiter BucketLimiter) Allow(ctx context.Context, key string, limit rate.Limit) error {
+	if limit.Disabled() {
+		return nil
+	}
+
+	l := zerolog.Ctx(ctx)
+
+	ok, retryAfter, err := limiter.repository.Take(ctx, key, limit)
+	if err != nil {
+		// requests are allowed if the buckets cannot be read, an unavailable limiter
+		// should not stop payments
+		l.Warn().Err(err).Str("key", redactKey(key)).Msg("rate limit not checked")
+		return nil
+	}
+	if !ok {
+		l.Warn().Str("key", redactKey(key)).Dur("retryAfter", retryAfter).Msg("rate limit exceeded")
+		return LimitedError{Key: key, RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+func (limiter BucketLimiter) AllowAll(ctx context.Context, buckets ...Bucket) error {
+	enabled := make([]Bucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if !bucket.Limit.Disabled() {
+			enabled = append(enabled, bucket)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+	if len(enabled) == 1 {
+		return limiter.Allow(ctx, enabled[0].Key, enabled[0].Limit)
+	}
+
+	l := zerolog.Ctx(ctx)
+
+	key, retryAfter, err := limiter.repository.TakeAll(ctx, enabled)
+	if err != nil {
+		// requests are allowed if the buckets cannot be read, an unavailable limiter
+		// should not stop payments
+		l.Warn().Err(err).Msg("rate limits not checked")
+		return nil
+	}
+	if key != "" {
+		l.Warn().Str("key", redactKey(key)).Dur("retryAfter", retryAfter).Msg("rate limit exceeded")
+		return LimitedError{Key: key, RetryAfter: retryAfter}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+)
+
+// LimitedError is returned when a request is rate limited
+type LimitedError struct {
+	Key string
+	// duration until the next request is allowed
+	RetryAfter time.Duration
+}
+
+func (e LimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s, retry after %ds", redactKey(e.Key), e.RetryAfterSeconds())
+}
+
+func (e LimitedError) RateLimited() bool {
+	return true
+}
+
+// RetryAfterSeconds returns the retry duration in whole seconds, rounded up, as used in the
+// Retry-After header
+func (e LimitedError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// ClientKey is the key of the bucket of an api client
+func ClientKey(clientID string) string {
+	return "client:" + clientID
+}
+
+// IPKey is the key of the bucket of a client ip, used when requests are not authenticated
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MSISDNKey is the key of the bucket of a customer phone number. The number is normalized,
+// so every format of a number shares a bucket.
+func MSISDNKey(msisdn string) string {
+	return msisdnPrefix + normalizeMSISDN(msisdn)
+}
+
+// countryCode is the country code of kenyan phone numbers
+const countryCode = "254"
+
+// normalizeMSISDN returns the phone number in E.164 format without the + prefix, the format
+// of phone numbers in daraja requests e.g. 0712345678, 712345678 and +254712345678 are all
+// 254712345678. Spaces and dashes are removed, numbers in other formats are returned as they are.
+func normalizeMSISDN(msisdn string) string {
+	msisdn = strings.NewReplacer(" ", "", "-", "").Replace(msisdn)
+	msisdn = strings.TrimPrefix(msisdn, "+")
+
+	switch {
+	case len(msisdn) == 14 && strings.HasPrefix(msisdn, "00"+countryCode):
+		return msisdn[2:]
+	case len(msisdn) == 10 && strings.HasPrefix(msisdn, "0"):
+		return countryCode + msisdn[1:]
+	case len(msisdn) == 9 && (msisdn[0] == '7' || msisdn[0] == '1'):
+		return countryCode + msisdn
+	default:
+		return msisdn
+	}
+}
+
+// ShortCodeKey is the key of the bucket of the partner calls made with a shortcode
+func ShortCodeKey(shortCodeID string) string {
+	return "shortcode:" + shortCodeID
+}
+
+const msisdnPrefix = "msisdn:"
+
+// redactKey masks the phone number of msisdn keys
+func redactKey(key string) string {
+	if msisdn, ok := strings.CutPrefix(key, msisdnPrefix); ok {
+		return msisdnPrefix + logger.MaskPhone(msisdn)
+	}
+	return key
+}
+
+// Bucket is the token bucket of a key and the limit it is refilled with
+type Bucket struct {
+	Key   string
+	Limit rate.Limit
+}
+
+type Repository interface {
+	// Take takes a token from the bucket of the key. It returns false and the duration until
+	// a token is available if the bucket is empty.
+	Take(ctx context.Context, key string, limit rate.Limit) (bool, time.Duration, error)
+	// TakeAll takes a token from each of the buckets, tokens are only taken if none of the
+	// buckets is empty. It returns the key of an empty bucket and the duration until it has
+	// a token, or an empty key if the tokens were taken.
+	TakeAll(ctx context.Context, buckets []Bucket) (string, time.Duration, error)
+	// RemoveBefore removes the buckets that were last taken from before the time
+	RemoveBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type Limiter interface {
+	// Allow takes a token from the bucket of the key, a LimitedError is returned if the
+	// bucket is empty
+	Allow(ctx context.Context, key string, limit rate.Limit) error
+	// AllowAll takes a token from each of the buckets. No token is taken if any bucket is
+	// empty, a LimitedError is returned for the empty bucket.
+	AllowAll(ctx context.Context, buckets ...Bucket) error
+}
@@ -0,0 +1,148 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+)
+
+// MockRepository takes tokens from in memory buckets that are never refilled
+type MockRepository struct {
+	taken map[string]int
+	err   error
+}
+
+func (m *MockRepository) Take(ctx context.Context, key string, limit rate.Limit) (bool, time.Duration, error) {
+	if m.err != nil {
+		return false, 0, m.err
+	}
+	if m.taken[key] >= limit.Burst {
+		return false, time.Second, nil
+	}
+	m.taken[key]++
+	return true, 0, nil
+}
+
+func (m *MockRepository) TakeAll(ctx context.Context, buckets []ratelimit.Bucket) (string, time.Duration, error) {
+	if m.err != nil {
+		return "", 0, m.err
+	}
+	for _, bucket := range buckets {
+		if m.taken[bucket.Key] >= bucket.Limit.Burst {
+			return bucket.Key, time.Second, nil
+		}
+	}
+	for _, bucket := range buckets {
+		m.taken[bucket.Key]++
+	}
+	return "", 0, nil
+}
+
+func (m *MockRepository) RemoveBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, m.err
+}
+
+func TestMSISDNKey(t *testing.T) {
+	testcases := []struct {
+		name   string
+		msisdn string
+	}{
+		{name: "test that international format is kept", msisdn: "254712345678"},
+		{name: "test that + prefix is removed", msisdn: "+254712345678"},
+		{name: "test that 00 prefix is removed", msisdn: "00254712345678"},
+		{name: "test that local format gets the country code", msisdn: "0712345678"},
+		{name: "test that format without prefix gets the country code", msisdn: "712345678"},
+		{name: "test that spaces are removed", msisdn: "+254 712 345 678"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, "msisdn:254712345678", ratelimit.MSISDNKey(tc.msisdn))
+		})
+	}
+
+	t.Run("test that numbers of the 01 range get the country code", func(t *testing.T) {
+		assert.Equal(t, "msisdn:254112345678", ratelimit.MSISDNKey("0112345678"))
+		assert.Equal(t, "msisdn:254112345678", ratelimit.MSISDNKey("112345678"))
+	})
+}
+
+func TestBucketLimiter_Allow(t *testing.T) {
+	limit := rate.Limit{Rate: 1, Burst: 2}
+
+	t.Run("test that requests are limited when the bucket is empty", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(&MockRepository{taken: map[string]int{}})
+
+		key := ratelimit.MSISDNKey("254700000000")
+		assert.Nil(t, limiter.Allow(t.Context(), key, limit))
+		assert.Nil(t, limiter.Allow(t.Context(), key, limit))
+
+		err := limiter.Allow(t.Context(), key, limit)
+		var limited ratelimit.LimitedError
+		if assert.ErrorAs(t, err, &limited) {
+			assert.Equal(t, time.Second, limited.RetryAfter)
+			// phone numbers are masked in the error
+			assert.NotContains(t, limited.Error(), "254700000000")
+		}
+	})
+
+	t.Run("test that disabled limits do not limit requests", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(&MockRepository{taken: map[string]int{}})
+
+		for i := 0; i < 5; i++ {
+			assert.Nil(t, limiter.Allow(t.Context(), ratelimit.ClientKey("1"), rate.Limit{}))
+		}
+	})
+
+	t.Run("test that requests are allowed if the buckets cannot be read", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(&MockRepository{err: errors.New("connection refused")})
+
+		assert.Nil(t, limiter.Allow(t.Context(), ratelimit.ClientKey("1"), limit))
+	})
+}
+
+func TestBucketLimiter_AllowAll(t *testing.T) {
+	limit := rate.Limit{Rate: 1, Burst: 2}
+
+	t.Run("test that no token is taken when a bucket is empty", func(t *testing.T) {
+		repository := &MockRepository{taken: map[string]int{}}
+		limiter := ratelimit.NewLimiter(repository)
+
+		msisdn := ratelimit.Bucket{Key: ratelimit.MSISDNKey("254700000000"), Limit: limit}
+		shortcode := ratelimit.Bucket{Key: ratelimit.ShortCodeKey("1"), Limit: rate.Limit{Rate: 1, Burst: 1}}
+		assert.Nil(t, limiter.AllowAll(t.Context(), msisdn, shortcode))
+
+		err := limiter.AllowAll(t.Context(), msisdn, shortcode)
+		var limited ratelimit.LimitedError
+		if assert.ErrorAs(t, err, &limited) {
+			assert.Equal(t, shortcode.Key, limited.Key)
+		}
+		// the token of the msisdn was not taken
+		assert.Equal(t, 1, repository.taken[msisdn.Key])
+	})
+
+	t.Run("test that disabled limits are not taken from", func(t *testing.T) {
+		repository := &MockRepository{taken: map[string]int{}}
+		limiter := ratelimit.NewLimiter(repository)
+
+		msisdn := ratelimit.Bucket{Key: ratelimit.MSISDNKey("254700000000"), Limit: limit}
+		shortcode := ratelimit.Bucket{Key: ratelimit.ShortCodeKey("1")}
+		assert.Nil(t, limiter.AllowAll(t.Context(), msisdn, shortcode))
+		assert.Nil(t, limiter.AllowAll(t.Context(), shortcode))
+
+		assert.Equal(t, map[string]int{msisdn.Key: 1}, repository.taken)
+	})
+
+	t.Run("test that requests are allowed if the buckets cannot be read", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(&MockRepository{err: errors.New("connection refused")})
+
+		buckets := []ratelimit.Bucket{{Key: ratelimit.ClientKey("1"), Limit: limit}, {Key: ratelimit.ShortCodeKey("1"), Limit: limit}}
+		assert.Nil(t, limiter.AllowAll(t.Context(), buckets...))
+	})
+}
@@ -79,15 +79,41 @@ func ToPartner(partner string) Partner {
 	}
 }
 
+// Operation is the partner api operation a request is made for
+type Operation string
+
+const (
+	OperationC2B      Operation = "c2b"
+	OperationB2C      Operation = "b2c"
+	OperationB2B      Operation = "b2b"
+	OperationReversal Operation = "reversal"
+	OperationStatus   Operation = "status"
+	OperationBalance  Operation = "balance"
+)
+
+func (operation Operation) String() string {
+	return string(operation)
+}
+
 type Request struct {
 	RequestID  string // unique request id
 	PaymentID  string // foreign id tied to the original payment request
+	MerchantID string // merchant of the shortcode the request was made with
 	ExternalID string // request id we get back from partner from response
 	Partner    string
+	Operation  Operation
 	Status     Status
 	Latency    time.Duration
 	Response   map[string]any
-	CreatedAt  time.Time
+	// id of the api request or event the partner request was made for
+	OriginRequestID string
+	// exchange with the partner, kept to prove what was sent and received
+	Attempt         int               // number of attempts made, retries included
+	RequestBody     []byte            // payload sent to the partner, secrets and phone numbers redacted
+	HTTPStatus      int               // status of the partner response, 0 if no response was received
+	ResponseHeaders map[string]string // headers of the partner response
+	ResponseBody    string            // raw body of the partner response
+	CreatedAt       time.Time
 }
 
 // OptionsFindRequest defines all options that can be used to find
@@ -99,17 +125,39 @@ type OptionsFindRequest struct {
 }
 
 type OptionsUpdateRequest struct {
-	ExternalID *string
-	Status     *Status
-	Latency    *time.Duration
-	Response   map[string]any
+	ExternalID      *string
+	Status          *Status
+	Latency         *time.Duration
+	Response        map[string]any
+	Attempt         *int
+	HTTPStatus      *int
+	ResponseHeaders map[string]string
+	ResponseBody    *string
+}
+
+// WebhookCredentials are values taken from a webhook http request, used
+// to verify that the webhook was sent by the partner
+type WebhookCredentials struct {
+	SourceIP string
+	// callback token from the callback url query
+	Token string `log:"secret"`
+	// value of the date header
+	Date string
+	// value of the authorization header
+	Authorization string
 }
 
 type WebhookResult struct {
-	Service Partner
-	Action  string
-	Body    io.Reader
-	Data    any
+	Service     Partner
+	Action      string
+	Body        io.Reader
+	Data        any
+	Credentials WebhookCredentials `json:"-"`
+	// merchant of the shortcode the webhook was authenticated with
+	MerchantID string `json:"-"`
+	// time the shortcode the webhook was authenticated with was deleted, zero if it is
+	// not deleted
+	ShortCodeDeletedAt time.Time `json:"-"`
 
 	body []byte
 }
@@ -139,9 +187,39 @@ func NewWebhookResult(partner string, action string, body io.Reader) *WebhookRes
 type Repository interface {
 	Add(ctx context.Context, req Request) error
 	FindOne(ctx context.Context, opts OptionsFindRequest) (Request, error)
+	// FindMany returns requests ordered by the time they were made
+	FindMany(ctx context.Context, opts OptionsFindRequest) ([]Request, error)
 	UpdateRequest(ctx context.Context, id string, opts OptionsUpdateRequest) error
 }
 
 type WebhookProcessor interface {
 	Process(ctx context.Context, in *WebhookResult, out any) error
 }
+
+// WebhookAuthenticator verifies that a webhook was sent by the partner.
+// A webhook that fails verification returns a WebhookRejectedError.
+type WebhookAuthenticator interface {
+	Authenticate(ctx context.Context, result *WebhookResult) error
+}
+
+// WebhookRejectedError is returned when a webhook fails authentication
+type WebhookRejectedError struct {
+	Reason string
+}
+
+func (e WebhookRejectedError) Error() string {
+	return "webhook rejected: " + e.Reason
+}
+
+// ErrMissingCallbackToken is returned by an authenticator when the callback url of the
+// webhook carries no callback token. Callback urls of payments made before the shortcode
+// was issued a token have none.
+var ErrMissingCallbackToken = WebhookRejectedError{Reason: "missing callback token"}
+
+// WebhookNonces records the signatures of webhooks, so that a signed webhook is only
+// accepted once
+type WebhookNonces interface {
+	// AddNonce records the nonce of the key until it expires. A duplicate error is
+	// returned if the nonce has been used by the key.
+	AddNonce(ctx context.Context, keyID, nonce string, expiresAt time.Time) error
+}
@@ -2,13 +2,17 @@ package webhooks
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/rs/zerolog"
 
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
 	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
 	"github.com/SirWaithaka/payments-api/pkg/events/payloads"
 	"github.com/SirWaithaka/payments-api/pkg/events/subjects"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/events"
@@ -28,18 +32,67 @@ type WebhookService struct {
 	publisher    events.Publisher
 }
 
+// Authenticate verifies the webhook was sent by the partner. Rejected webhooks are saved
+// together with the reason they were rejected, and a requests.WebhookRejectedError is returned.
+func (service WebhookService) Authenticate(ctx context.Context, result *requests.WebhookResult) error {
+	l := zerolog.Ctx(ctx)
+
+	var err error
+	if result.Service == requests.PartnerDaraja || result.Service == requests.PartnerQuikk {
+		err = service.mpesaService.AuthenticateWebhook(ctx, result)
+	} else {
+		err = requests.WebhookRejectedError{Reason: "unsupported partner"}
+	}
+
+	var rejected requests.WebhookRejectedError
+	if !errors.As(err, &rejected) {
+		return err
+	}
+	l.Warn().Str("reason", rejected.Reason).Msg("webhook rejected")
+
+	// save the rejected webhook for auditing
+	if e := service.repository.Reject(ctx, result.Service.String(), result.Action, result.Bytes(), rejected.Reason); e != nil {
+		l.Error().Err(e).Msg("error saving rejected webhook")
+	}
+
+	return err
+}
+
+// Confirm saves the webhook and publishes its event. The webhook is saved before its event
+// is published, a webhook whose event failed to publish is published again when the partner
+// resends it, or by Republish.
 func (service WebhookService) Confirm(ctx context.Context, result *requests.WebhookResult) error {
 	l := zerolog.Ctx(ctx)
 
-	// TODO: Maybe validate against double webhooks before saving and publishing
+	if result.MerchantID != "" {
+		ctx = merchants.WithMerchant(ctx, result.MerchantID)
+	}
+
+	// parse the webhook once for both keys
+	naturalKey, correlationID := service.keys(ctx, result)
 
-	// save the webhook result
-	err := service.repository.Add(ctx, result.Service.String(), result.Action, result.Bytes())
-	if err != nil {
+	// save the webhook result, partners send the same webhook more than once
+	// and duplicates are counted on the saved webhook instead
+	webhook, err := service.repository.Add(ctx, result.Service.String(), result.Action, result.Bytes(), naturalKey)
+	var dup pkgerrors.Duplicate
+	if errors.As(err, &dup) && dup.Duplicate() {
+		if !webhook.PublishedAt.IsZero() {
+			l.Info().Msg("duplicate webhook, skipping")
+			return nil
+		}
+		l.Info().Str("webhook_id", webhook.ID).Msg("duplicate of unpublished webhook, publishing")
+	} else if err != nil {
 		// I think we should fail if saving fails
 		return err
 	}
 
+	return service.publish(ctx, webhook.ID, result, correlationID)
+}
+
+// publish publishes the event of a saved webhook and marks it published
+func (service WebhookService) publish(ctx context.Context, id string, result *requests.WebhookResult, correlationID string) error {
+	l := zerolog.Ctx(ctx)
+
 	// publish webhook event
 	payload := payloads.WebhookReceived[[]byte]{
 		Action:  result.Action,
@@ -47,15 +100,70 @@ func (service WebhookService) Confirm(ctx context.Context, result *requests.Webh
 		Content: result.Bytes(),
 	}
 	event := pkgevents.NewEvent(subjects.WebhookReceived, payload)
-	err = service.publisher.Publish(ctx, event)
+	// key the event by correlation id, so that webhooks for the same payment are processed in order
+	event.SetKey(correlationID)
+	err := service.publisher.Publish(ctx, event)
 	if err != nil {
 		l.Error().Err(err).Msg("error publishing event")
 		return err
 	}
 	l.Debug().Msg("webhook event published")
 
+	// the event is published again if the webhook is not marked, webhooks
+	// are processed idempotently so the error is not returned
+	if err = service.repository.MarkPublished(ctx, id); err != nil {
+		l.Error().Err(err).Msg("error marking webhook published")
+	}
+
 	return nil
+}
+
+// Republish publishes the events of webhooks received before the given time that were saved
+// but not published, e.g. because the broker was unavailable
+func (service WebhookService) Republish(ctx context.Context, before time.Time) (int, error) {
+	l := zerolog.Ctx(ctx)
+
+	records, err := service.repository.FindUnpublished(ctx, before, DefaultReplayLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, record := range records {
+		result := requests.NewWebhookResult(record.Partner, record.Action, record.Payload)
+		_, correlationID := service.keys(ctx, result)
+
+		if err = service.publish(ctx, record.ID, result, correlationID); err != nil {
+			l.Warn().Err(err).Str("webhook_id", record.ID).Msg("error republishing webhook")
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+// keys returns the key that identifies duplicates of the webhook, made up of the action
+// and the partner specific key, and the id that links the webhook to a payment request.
+// The hash of the payload is used if the webhook has no partner specific key, and the
+// correlation id is empty if the webhook cannot be parsed.
+func (service WebhookService) keys(ctx context.Context, result *requests.WebhookResult) (string, string) {
+	l := zerolog.Ctx(ctx)
 
+	var keys mpesa.WebhookKeys
+	if result.Service == requests.PartnerDaraja || result.Service == requests.PartnerQuikk {
+		var err error
+		if keys, err = service.mpesaService.WebhookKeys(ctx, result); err != nil {
+			l.Warn().Err(err).Msg("could not get webhook keys")
+		}
+	}
+
+	naturalKey := keys.NaturalKey
+	if naturalKey == "" {
+		naturalKey = ContentHash(result.Bytes())
+	}
+
+	return result.Action + ":" + naturalKey, keys.CorrelationID
 }
 
 // Process checks if the webhook received relates to any recorded payment request, if yes,
@@ -71,3 +179,68 @@ func (service WebhookService) Process(ctx context.Context, result *requests.Webh
 
 	return nil
 }
+
+// Replay processes stored webhooks again, oldest first. Webhooks that were rejected are skipped.
+// A dry run returns the payment updates of the webhooks without applying them.
+func (service WebhookService) Replay(ctx context.Context, opts OptionsFindWebhooks, dryRun bool) ([]ReplayResult, error) {
+	l := zerolog.Ctx(ctx)
+
+	// avoid replaying every stored webhook by mistake
+	if opts.Empty() {
+		return nil, ErrReplayFilterRequired
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultReplayLimit
+	}
+
+	records, err := service.repository.FindMany(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	l.Info().Int("count", len(records)).Bool("dry_run", dryRun).Msg("replaying webhooks")
+
+	results := make([]ReplayResult, 0, len(records))
+	for _, record := range records {
+		results = append(results, service.replay(ctx, record, dryRun))
+	}
+
+	return results, nil
+}
+
+func (service WebhookService) replay(ctx context.Context, record WebhookRequest, dryRun bool) ReplayResult {
+	l := zerolog.Ctx(ctx).With().Str("webhook_id", record.ID).Logger()
+
+	res := ReplayResult{WebhookID: record.ID, Partner: record.Partner, Action: record.Action}
+	if record.RejectionReason != "" {
+		res.Skipped = "webhook was rejected: " + record.RejectionReason
+		return res
+	}
+
+	result := requests.NewWebhookResult(record.Partner, record.Action, record.Payload)
+	if result.Service != requests.PartnerDaraja && result.Service != requests.PartnerQuikk {
+		res.Skipped = "unsupported partner"
+		return res
+	}
+
+	update, err := service.mpesaService.PreviewWebhook(l.WithContext(ctx), result)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if update.PaymentID != "" {
+		res.Update = &update
+	}
+
+	if dryRun {
+		return res
+	}
+
+	if err = service.Process(l.WithContext(ctx), result); err != nil {
+		l.Warn().Err(err).Msg("error replaying webhook")
+		res.Err = err
+		return res
+	}
+	res.Replayed = true
+
+	return res
+}
@@ -2,12 +2,15 @@ package webhooks_test
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
@@ -16,13 +19,32 @@ import (
 
 type MockPublisher struct {
 	calls uint
+	err   error
 }
 
 func (m *MockPublisher) Publish(ctx context.Context, event events.EventType) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.calls++
 	return nil
 }
 
+type MockMpesaService struct {
+	mpesa.Service
+	processed uint
+}
+
+func (m *MockMpesaService) PreviewWebhook(ctx context.Context, result *requests.WebhookResult) (mpesa.PaymentUpdate, error) {
+	status := requests.StatusSucceeded
+	return mpesa.PaymentUpdate{PaymentID: "payment_id", OptionsUpdatePayment: mpesa.OptionsUpdatePayment{Status: &status}}, nil
+}
+
+func (m *MockMpesaService) ProcessWebhook(ctx context.Context, result *requests.WebhookResult) error {
+	m.processed++
+	return nil
+}
+
 func TestWebhookService_Confirm(t *testing.T) {
 	defer testdata.ResetTables(inf)
 
@@ -48,4 +70,172 @@ func TestWebhookService_Confirm(t *testing.T) {
 	assert.Equal(t, body, record.Payload.String())
 	assert.Equal(t, uint(1), publisher.calls)
 
+	// a duplicate webhook is accepted but not published
+	err = service.Confirm(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	result = inf.Storage.PG.First(&record)
+	if err = result.Error; err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	assert.Equal(t, 1, record.DuplicateCount)
+	assert.Equal(t, uint(1), publisher.calls)
+
+}
+
+func TestWebhookService_Confirm_PublishFailure(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	repository := postgres.NewWebhookRepository(inf.Storage.PG)
+	publisher := &MockPublisher{err: errors.New("broker unavailable")}
+
+	service := webhooks.NewService(repository, nil, publisher)
+
+	// the webhook is saved but not published, the partner retries it
+	body := `{"ResultCode": "0"}`
+	err := service.Confirm(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+	assert.EqualError(t, err, "broker unavailable")
+
+	var record postgres.WebhookRequestSchema
+	if result := inf.Storage.PG.First(&record); result.Error != nil {
+		t.Fatalf("expected nil error, got %v", result.Error)
+	}
+	assert.Nil(t, record.PublishedAt)
+
+	// the retry of an unpublished webhook is published
+	publisher.err = nil
+	err = service.Confirm(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, uint(1), publisher.calls)
+
+	if result := inf.Storage.PG.First(&record); result.Error != nil {
+		t.Fatalf("expected nil error, got %v", result.Error)
+	}
+	assert.NotNil(t, record.PublishedAt)
+
+	// further duplicates are not published
+	err = service.Confirm(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, uint(1), publisher.calls)
+}
+
+func TestWebhookService_Republish(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	repository := postgres.NewWebhookRepository(inf.Storage.PG)
+	publisher := &MockPublisher{err: errors.New("broker unavailable")}
+
+	service := webhooks.NewService(repository, nil, publisher)
+
+	body := `{"ResultCode": "0"}`
+	err := service.Confirm(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+	assert.EqualError(t, err, "broker unavailable")
+
+	// webhooks are not published while the broker is unavailable
+	published, err := service.Republish(t.Context(), time.Now().Add(time.Minute))
+	assert.EqualError(t, err, "broker unavailable")
+	assert.Equal(t, 0, published)
+
+	publisher.err = nil
+	published, err = service.Republish(t.Context(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, 1, published)
+	assert.Equal(t, uint(1), publisher.calls)
+
+	// published webhooks are not published again
+	published, err = service.Republish(t.Context(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, 0, published)
+}
+
+func TestWebhookService_Authenticate(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	repository := postgres.NewWebhookRepository(inf.Storage.PG)
+	publisher := &MockPublisher{}
+
+	service := webhooks.NewService(repository, nil, publisher)
+
+	// webhooks from unsupported partners are rejected
+	body := `{"ResultCode": "0"}`
+	err := service.Authenticate(t.Context(), requests.NewWebhookResult("test", "action", strings.NewReader(body)))
+
+	var rejected requests.WebhookRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected rejected error, got %v", err)
+	}
+
+	// check that the rejected webhook was saved with the reason
+	var record postgres.WebhookRequestSchema
+	result := inf.Storage.PG.First(&record)
+	if err = result.Error; err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	assert.Equal(t, body, record.Payload.String())
+	if assert.NotNil(t, record.RejectionReason) {
+		assert.Equal(t, "unsupported partner", *record.RejectionReason)
+	}
+	assert.Equal(t, uint(0), publisher.calls)
+}
+
+func TestWebhookService_Replay(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	repository := postgres.NewWebhookRepository(inf.Storage.PG)
+	mpesaService := &MockMpesaService{}
+
+	service := webhooks.NewService(repository, mpesaService, &MockPublisher{})
+
+	// replaying without a filter is not allowed
+	_, err := service.Replay(t.Context(), webhooks.OptionsFindWebhooks{}, false)
+	assert.ErrorIs(t, err, webhooks.ErrReplayFilterRequired)
+
+	body := []byte(`{"ResultCode": "0"}`)
+	if _, err = repository.Add(t.Context(), "daraja", "b2c", body, "b2c:1"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if err = repository.Reject(t.Context(), "daraja", "b2c", body, "invalid token"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	partner := "daraja"
+	opts := webhooks.OptionsFindWebhooks{Partner: &partner}
+
+	// dry run returns the payment updates without processing the webhooks
+	results, err := service.Replay(t.Context(), opts, true)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	assert.False(t, results[0].Replayed)
+	if assert.NotNil(t, results[0].Update) {
+		assert.Equal(t, "payment_id", results[0].Update.PaymentID)
+	}
+	// rejected webhooks are not replayed
+	assert.NotEmpty(t, results[1].Skipped)
+	assert.Equal(t, uint(0), mpesaService.processed)
+
+	results, err = service.Replay(t.Context(), opts, false)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	assert.True(t, results[0].Replayed)
+	assert.False(t, results[1].Replayed)
+	assert.Equal(t, uint(1), mpesaService.processed)
 }
@@ -2,26 +2,101 @@ package webhooks
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"time"
 
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 )
 
+// DefaultReplayLimit is the maximum number of webhooks replayed if no limit is given
+const DefaultReplayLimit = 100
+
+// ErrReplayFilterRequired is returned when webhooks are replayed without any filter
+var ErrReplayFilterRequired = errors.New("at least one of ids, partner, action or time window is required")
+
 type WebhookRequest struct {
-	ID        string
-	Action    string
+	ID      string
+	Action  string
+	Partner string
+	Payload io.Reader
+	// sha256 hash of the payload
+	ContentHash string
+	// partner specific key that identifies the webhook
+	NaturalKey string
+	// number of duplicates of this webhook received after it
+	DuplicateCount int
+	// reason the webhook was rejected, empty if it was accepted
+	RejectionReason string
+	// merchant of the shortcode the webhook was authenticated with
+	MerchantID string
+	// time the event of the webhook was published, zero until it is published
+	PublishedAt time.Time
+	CreatedAt   time.Time
+}
+
+// ContentHash returns the hex encoded sha256 hash of the payload
+func ContentHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// OptionsFindWebhooks defines options used to find stored webhooks
+type OptionsFindWebhooks struct {
+	IDs     []string
+	Partner *string
+	Action  *string
+	// webhooks received at or after From
+	From *time.Time
+	// webhooks received before To
+	To    *time.Time
+	Limit int
+}
+
+// Empty returns true if no filter is set
+func (opts OptionsFindWebhooks) Empty() bool {
+	return len(opts.IDs) == 0 && opts.Partner == nil && opts.Action == nil && opts.From == nil && opts.To == nil
+}
+
+// ReplayResult is the outcome of replaying a stored webhook
+type ReplayResult struct {
+	WebhookID string
 	Partner   string
-	Payload   io.Reader
-	CreatedAt time.Time
+	Action    string
+	// update the webhook applies to a payment, nil if it does not update a payment
+	Update *mpesa.PaymentUpdate
+	// true if the webhook was processed again, false for dry runs
+	Replayed bool
+	// reason the webhook was not replayed
+	Skipped string
+	Err     error
 }
 
 type Repository interface {
-	Add(ctx context.Context, partner, action string, payload []byte) error
+	// Add saves the webhook request and returns it. If a webhook with the same partner and
+	// natural key exists, its duplicate count is incremented and it is returned together
+	// with a duplicate error.
+	Add(ctx context.Context, partner, action string, payload []byte, naturalKey string) (WebhookRequest, error)
+	// MarkPublished records that the event of the webhook was published
+	MarkPublished(ctx context.Context, id string) error
+	// FindUnpublished returns accepted webhooks received before the given time whose event
+	// was not published, oldest first
+	FindUnpublished(ctx context.Context, before time.Time, limit int) ([]WebhookRequest, error)
+	Reject(ctx context.Context, partner, action string, payload []byte, reason string) error
 	Find(ctx context.Context, id string) (WebhookRequest, error)
+	// FindMany returns webhooks matching the options ordered by the time they were received
+	FindMany(ctx context.Context, opts OptionsFindWebhooks) ([]WebhookRequest, error)
 }
 
 type Service interface {
+	Authenticate(ctx context.Context, result *requests.WebhookResult) error
 	Confirm(ctx context.Context, result *requests.WebhookResult) error
 	Process(ctx context.Context, result *requests.WebhookResult) error
+	Replay(ctx context.Context, opts OptionsFindWebhooks, dryRun bool) ([]ReplayResult, error)
+	// Republish publishes the events of webhooks received before the given time that were
+	// saved but not published, and returns the number of webhooks published
+	Republish(ctx context.Context, before time.Time) (int, error)
 }
@@ -2,6 +2,7 @@ package events
 
 import (
 	"context"
+	"time"
 
 	"github.com/SirWaithaka/payments-api/pkg/events"
 )
@@ -11,12 +12,33 @@ type Publisher interface {
 	Publish(ctx context.Context, event events.EventType) error
 }
 
-// Subscriber defines the behavior for subscribing an event
+// Subscriber defines the behavior for subscribing to an event
 type Subscriber interface {
-	Subscribe(ctx context.Context, event events.EventType) error
+	// Subscribe passes events with the given name to the handler until ctx is cancelled.
+	// Subscribers sharing a group each receive a share of the events.
+	Subscribe(ctx context.Context, name, group string, handler Handler) error
 }
 
 // Handler is a decorator function that returns 2 values
 // 1. a variable that satisfies events.EventMessage interface
 // 2. a handler function that acts upon the passed event
 type Handler func() (events.EventMessage, func(context.Context) error)
+
+// Inbox records the events each consumer group has processed. A consumer claims an
+// event before handling it, so that concurrent deliveries of the event are handled once.
+type Inbox interface {
+	// Claim claims the event for the consumer group, it returns false if the event has been
+	// processed or is claimed by another consumer. A claim older than the timeout can be
+	// taken over, the consumer that made it is assumed to have stopped.
+	Claim(ctx context.Context, group, eventID string, timeout time.Duration) (bool, error)
+	// Processed returns true if the event has been processed by the consumer group
+	Processed(ctx context.Context, group, eventID string) (bool, error)
+	// Complete records the claimed event as processed
+	Complete(ctx context.Context, group, eventID string) error
+	// Release removes the claim of an event that was not processed, so that it can be
+	// claimed again
+	Release(ctx context.Context, group, eventID string) error
+	// RemoveBefore removes the events processed before the time, it returns the number of
+	// events removed
+	RemoveBefore(ctx context.Context, before time.Time) (int64, error)
+}
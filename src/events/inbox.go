@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/pkg/events"
+)
+
+// ClaimTimeout is the duration after which the claim of an event that was not processed
+// can be taken over, it should be longer than an event takes to handle
+const ClaimTimeout = 5 * time.Minute
+
+// ErrInProgress is returned for a delivery of an event claimed by another consumer that
+// has not processed it, the delivery is retried in case that consumer fails
+var ErrInProgress = errors.New("event is being handled by another consumer")
+
+// WithInbox wraps a Handler so that an event is handled at most once per consumer group.
+// The event is claimed in the inbox before it is handled, deliveries of an event that is
+// processed are skipped. A delivery of an event claimed by another consumer fails with
+// ErrInProgress, so that it is retried instead of acknowledged. The claim is released if
+// the handler fails so that the event is handled again when it is redelivered. Events
+// without an id are always handled.
+func WithInbox(inbox Inbox, group string, handler Handler) Handler {
+	return func() (events.EventMessage, func(context.Context) error) {
+		out, fn := handler()
+		if fn == nil {
+			return out, nil
+		}
+
+		return out, func(ctx context.Context) error {
+			evt, ok := out.(interface{ ID() string })
+			if !ok || evt.ID() == "" {
+				return fn(ctx)
+			}
+
+			l := zerolog.Ctx(ctx).With().Str("event_id", evt.ID()).Str("group", group).Logger()
+
+			claimed, err := inbox.Claim(ctx, group, evt.ID(), ClaimTimeout)
+			if err != nil {
+				l.Error().Err(err).Msg("error claiming event")
+				return err
+			}
+			if !claimed {
+				processed, err := inbox.Processed(ctx, group, evt.ID())
+				if err != nil {
+					l.Error().Err(err).Msg("error reading event from inbox")
+					return err
+				}
+				if processed {
+					l.Info().Msg("event already processed, skipping")
+					return nil
+				}
+
+				// the other consumer may fail and release the event, the delivery is
+				// only acknowledged once the event is processed
+				l.Info().Msg("event being handled by another consumer")
+				return ErrInProgress
+			}
+
+			if err = fn(ctx); err != nil {
+				// the claim expires if it cannot be released
+				if e := inbox.Release(ctx, group, evt.ID()); e != nil {
+					l.Warn().Err(e).Msg("error releasing event claim")
+				}
+				return err
+			}
+
+			// the claim keeps a redelivery of the event from being handled until it expires
+			if err = inbox.Complete(ctx, group, evt.ID()); err != nil {
+				l.Error().Err(err).Msg("error recording event in inbox")
+				return err
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+// fakeInbox keeps the claims of events in memory
+type fakeInbox struct {
+	mu        sync.Mutex
+	claimed   map[string]bool
+	processed map[string]bool
+
+	completeErr error
+}
+
+func newFakeInbox() *fakeInbox {
+	return &fakeInbox{claimed: make(map[string]bool), processed: make(map[string]bool)}
+}
+
+func (inbox *fakeInbox) Claim(_ context.Context, group, eventID string, _ time.Duration) (bool, error) {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+
+	key := group + "/" + eventID
+	if inbox.claimed[key] || inbox.processed[key] {
+		return false, nil
+	}
+	inbox.claimed[key] = true
+	return true, nil
+}
+
+func (inbox *fakeInbox) Processed(_ context.Context, group, eventID string) (bool, error) {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+
+	return inbox.processed[group+"/"+eventID], nil
+}
+
+func (inbox *fakeInbox) Complete(_ context.Context, group, eventID string) error {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+
+	if inbox.completeErr != nil {
+		return inbox.completeErr
+	}
+	inbox.processed[group+"/"+eventID] = true
+	return nil
+}
+
+func (inbox *fakeInbox) Release(_ context.Context, group, eventID string) error {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+
+	delete(inbox.claimed, group+"/"+eventID)
+	return nil
+}
+
+func (inbox *fakeInbox) RemoveBefore(context.Context, time.Time) (int64, error) { return 0, nil }
+
+type testEvent struct {
+	id string
+}
+
+func (event testEvent) ID() string   { return event.id }
+func (event testEvent) Message() any { return event }
+
+func newHandler(id string, fn func(context.Context) error) events.Handler {
+	return func() (pkgevents.EventMessage, func(context.Context) error) {
+		return testEvent{id: id}, fn
+	}
+}
+
+func TestWithInbox(t *testing.T) {
+	t.Run("test that concurrent deliveries of an event are handled once", func(t *testing.T) {
+		inbox := newFakeInbox()
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		handler := events.WithInbox(inbox, "fake-group", newHandler("event-1", func(context.Context) error {
+			calls.Add(1)
+			<-release
+			return nil
+		}))
+
+		var wg sync.WaitGroup
+		var inProgress atomic.Int32
+		for range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, fn := handler()
+				// deliveries of the event being handled are retried
+				if err := fn(t.Context()); err != nil {
+					assert.ErrorIs(t, err, events.ErrInProgress)
+					inProgress.Add(1)
+				}
+			}()
+		}
+		assert.Eventually(t, func() bool { return calls.Load() == 1 && inProgress.Load() == 4 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		// a later delivery of the processed event is skipped
+		_, fn := handler()
+		assert.Nil(t, fn(t.Context()))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("test that a failed event is handled again", func(t *testing.T) {
+		inbox := newFakeInbox()
+
+		var calls atomic.Int32
+		handler := events.WithInbox(inbox, "fake-group", newHandler("event-1", func(context.Context) error {
+			if calls.Add(1) == 1 {
+				return errors.New("handler error")
+			}
+			return nil
+		}))
+
+		_, fn := handler()
+		assert.EqualError(t, fn(t.Context()), "handler error")
+		_, fn = handler()
+		assert.Nil(t, fn(t.Context()))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("test that a failure to complete the event is returned and the event is not handled again", func(t *testing.T) {
+		inbox := newFakeInbox()
+		inbox.completeErr = errors.New("inbox error")
+
+		var calls atomic.Int32
+		handler := events.WithInbox(inbox, "fake-group", newHandler("event-1", func(context.Context) error {
+			calls.Add(1)
+			return nil
+		}))
+
+		_, fn := handler()
+		assert.EqualError(t, fn(t.Context()), "inbox error")
+
+		// the claim holds back the redelivery until it expires
+		_, fn = handler()
+		assert.ErrorIs(t, fn(t.Context()), events.ErrInProgress)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("test that a delivery retried after the other consumer fails handles the event", func(t *testing.T) {
+		inbox := newFakeInbox()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var calls atomic.Int32
+		handler := events.WithInbox(inbox, "fake-group", newHandler("event-1", func(context.Context) error {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-release
+				return errors.New("handler error")
+			}
+			return nil
+		}))
+
+		errs := make(chan error, 1)
+		go func() {
+			_, fn := handler()
+			errs <- fn(t.Context())
+		}()
+		<-started
+
+		// a redelivery while the event is being handled is not acknowledged
+		_, fn := handler()
+		assert.ErrorIs(t, fn(t.Context()), events.ErrInProgress)
+
+		close(release)
+		assert.EqualError(t, <-errs, "handler error")
+
+		// the retried delivery handles the released event
+		_, fn = handler()
+		assert.Nil(t, fn(t.Context()))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("test that events without an id are always handled", func(t *testing.T) {
+		inbox := newFakeInbox()
+
+		var calls atomic.Int32
+		handler := events.WithInbox(inbox, "fake-group", newHandler("", func(context.Context) error {
+			calls.Add(1)
+			return nil
+		}))
+
+		for range 2 {
+			_, fn := handler()
+			assert.Nil(t, fn(t.Context()))
+		}
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
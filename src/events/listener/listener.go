@@ -5,69 +5,51 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
-	"strings"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
-	"github.com/segmentio/kafka-go"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/SirWaithaka/payments-api/pkg/events/subjects"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
-	kafkaclient "github.com/SirWaithaka/payments-api/src/clients/kafka"
-	"github.com/SirWaithaka/payments-api/src/config"
 	dipkg "github.com/SirWaithaka/payments-api/src/di"
 	"github.com/SirWaithaka/payments-api/src/events"
 	"github.com/SirWaithaka/payments-api/src/events/handlers"
 )
 
-func New(c context.Context, cfg config.KafkaConfig, di *dipkg.DI) *Listener {
-	// create instance of consumers
-	consumers := make(map[string][]*kafkaclient.Consumer)
+func New(c context.Context, subscriber events.Subscriber, di *dipkg.DI) *Listener {
+	// create instance of handlers
+	handlers := make(map[string][]events.Handler)
 
-	return &Listener{ctx: c, kafkaCfg: cfg, di: di, consumers: consumers}
+	return &Listener{ctx: c, subscriber: subscriber, di: di, handlers: handlers}
 }
 
 type Listener struct {
-	di        *dipkg.DI
-	ctx       context.Context
-	kafkaCfg  config.KafkaConfig
-	consumers map[string][]*kafkaclient.Consumer
+	di         *dipkg.DI
+	ctx        context.Context
+	subscriber events.Subscriber
+	handlers   map[string][]events.Handler
 
-	// a wait group for running consumer goroutines
+	// a wait group for running subscription goroutines
 	waitGroup *errgroup.Group
+	// stops the subscriptions
+	cancel context.CancelFunc
+	// number of subscriptions started by Listen, and number still running
+	subscriptions atomic.Int32
+	running       atomic.Int32
 }
 
-func (listener *Listener) newConsumer(topic string) *kafkaclient.Consumer {
-	// kafka client config
-	brokers := strings.Split(listener.kafkaCfg.Host, ",")
-	// Define consumer-specific configuration
-	cCfg := kafkaclient.ConsumerConfig{
-		Topic:   topic,
-		Brokers: brokers,
-		// groupId in the format of <topicName-group>
-		GroupID:        fmt.Sprintf("%s-group", topic), //
-		Partition:      0,
-		MinBytes:       10e3, // 10KB
-		MaxBytes:       10e6, // 10MB
-		CommitInterval: 1000, // 1 second
-		StartOffset:    kafka.FirstOffset,
-	}
-
-	// Initialize the consumer
-	return kafkaclient.NewConsumer(cCfg)
+// groupID returns the consumer group id for a topic in the format of <topicName-group>
+func groupID(topic string) string {
+	return fmt.Sprintf("%s-group", topic)
 }
 
 // RegisterHandler adds a handler to a topic/event name
 func (listener *Listener) RegisterHandler(name string, handler events.Handler) {
-	// get all consumers for a particular event name/topic
-	consumers := listener.consumers[name]
-	// create new consumer with given handler
-	consumer := listener.newConsumer(name)
-	consumer.SetHandler(handler)
-	// add new consumer to the list of consumers
-	consumers = append(consumers, consumer)
-	// update registered consumers
-	listener.consumers[name] = consumers
+	// events already processed by the consumer group are skipped
+	handler = events.WithInbox(listener.di.Inbox, groupID(name), handler)
+	// add handler to the list of handlers for the event name/topic
+	listener.handlers[name] = append(listener.handlers[name], handler)
 }
 
 func (listener *Listener) Listen() error {
@@ -79,14 +61,20 @@ func (listener *Listener) Listen() error {
 	// register event handlers
 	listener.RegisterHandler(subjects.WebhookReceived, handler.WebhookReceived)
 
-	g, ctx := errgroup.WithContext(listener.ctx)
+	ctx, cancel := context.WithCancel(listener.ctx)
+	g, ctx := errgroup.WithContext(ctx)
 	listener.waitGroup = g
+	listener.cancel = cancel
+
+	// loop through handlers and subscribe each
+	for name, handlers := range listener.handlers {
+		for _, handler := range handlers {
+			listener.subscriptions.Add(1)
+			listener.running.Add(1)
 
-	// loop through consumers and start them
-	for _, consumers := range listener.consumers {
-		for _, consumer := range consumers {
-			// run each consumer in a goroutine
+			// run each subscription in a goroutine
 			g.Go(func() error {
+				defer listener.running.Add(-1)
 				// recover from any panics
 				defer func() {
 					if r := recover(); r != nil {
@@ -94,8 +82,8 @@ func (listener *Listener) Listen() error {
 					}
 				}()
 
-				// read messages from kafka
-				return consumer.ReadMessage(ctx)
+				// read events until the context is cancelled
+				return listener.subscriber.Subscribe(ctx, name, groupID(name), handler)
 			})
 		}
 	}
@@ -103,30 +91,49 @@ func (listener *Listener) Listen() error {
 	return nil
 }
 
-func (listener *Listener) Close() error {
-	l := zerolog.Ctx(listener.ctx)
-	defer l.Info().Msg("listener closed")
-
-	// wait for the done event from context
-	<-listener.ctx.Done()
-	l.Info().Msg("stopping listener")
-
-	var errs []error
+// Check reports whether all the subscriptions are running. The listener is not ready
+// before it has started, once any of its subscriptions has stopped, or while the
+// subscriber reports a subscription as stalled.
+func (listener *Listener) Check(ctx context.Context) error {
+	subscriptions := listener.subscriptions.Load()
+	if subscriptions == 0 {
+		return errors.New("listener not started")
+	}
 
-	// block and wait for all consumer goroutines to finish
-	err := listener.waitGroup.Wait()
-	if err != nil {
-		errs = append(errs, err)
+	if running := listener.running.Load(); running < subscriptions {
+		return fmt.Errorf("%d of %d subscriptions stopped", subscriptions-running, subscriptions)
 	}
 
-	// fetch all consumers and close each
-	for _, consumers := range listener.consumers {
-		for _, consumer := range consumers {
-			if err = consumer.Close(); err != nil {
-				errs = append(errs, err)
-			}
-		}
+	if checker, ok := listener.subscriber.(interface{ Check(context.Context) error }); ok {
+		return checker.Check(ctx)
 	}
 
-	return errors.Join(errs...)
+	return nil
+}
+
+// Shutdown stops the subscriptions and waits until they return, each subscription stops
+// after the events it is handling. Events still being handled when ctx is done are left
+// unacknowledged and are redelivered.
+func (listener *Listener) Shutdown(ctx context.Context) error {
+	l := zerolog.Ctx(listener.ctx)
+	l.Info().Msg("stopping listener")
+
+	// the listener was not started
+	if listener.waitGroup == nil {
+		return nil
+	}
+	listener.cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- listener.waitGroup.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		l.Info().Msg("listener closed")
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("subscriptions still running: %w", ctx.Err())
+	}
 }
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"context"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/rs/zerolog"
+
+	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	natsclient "github.com/SirWaithaka/payments-api/src/clients/nats"
+	"github.com/SirWaithaka/payments-api/src/config"
+)
+
+func NewJetStream(client *natsclient.Client, nCfg config.NatsConfig) JetStream {
+	producer := natsclient.NewProducer(client, natsclient.ProducerConfig{
+		PostRetries: nCfg.ProducerRetries,
+		RetryDelay:  nCfg.ProducerRetryDelay,
+	})
+
+	return JetStream{producer: producer}
+}
+
+// JetStream publishes events to a jetstream stream, the event name is used as the subject
+type JetStream struct {
+	producer *natsclient.Producer
+}
+
+func (publisher JetStream) Publish(ctx context.Context, event pkgevents.EventType) error {
+	// set the event id and publish time, and the id of the request the event is published for
+	pkgevents.Stamp(event)
+	pkgevents.SetRequestID(event, requestid.FromContext(ctx))
+
+	l := zerolog.Ctx(ctx)
+	l.Debug().Any(logger.LData, event).Msg("event to publish")
+
+	edata, err := jsoniter.Marshal(event)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to marshal event")
+		return err
+	}
+
+	// the event id lets the stream discard duplicate publishes of the same event
+	err = publisher.producer.SendMessage(ctx, event.Name(), event.ID(), event.Key(), edata)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to publish event")
+		metrics.EventPublishError(config.BrokerNats, event.Name())
+		return err
+	}
+	l.Info().Msg("message sent")
+
+	return nil
+}
+
+// Close is a no-op, the nats connection is owned and closed by the caller
+func (publisher JetStream) Close() error {
+	return nil
+}
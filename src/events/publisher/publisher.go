@@ -3,7 +3,6 @@ package publisher
 import (
 	"context"
 	"strings"
-	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/rs/zerolog"
@@ -11,6 +10,8 @@ import (
 
 	pkgevents "github.com/SirWaithaka/payments-api/pkg/events"
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
 	kafkaclient "github.com/SirWaithaka/payments-api/src/clients/kafka"
 	"github.com/SirWaithaka/payments-api/src/config"
 )
@@ -22,12 +23,12 @@ func New(kCfg config.KafkaConfig) Publisher {
 	cfg := kafkaclient.Config{Brokers: brokers}
 	// Define producer-specific configuration
 	pCfg := kafkaclient.ProducerConfig{
-		BatchSize:    100,
-		BatchTimeout: 50, // in milliseconds
+		BatchSize:    kCfg.Producer.BatchSize,
+		BatchTimeout: int(kCfg.Producer.BatchTimeout.Milliseconds()),
 		Async:        false,
 		RequiredAcks: kafka.RequireAll,
-		PostRetries:  10,
-		RetryDelay:   time.Millisecond * 100,
+		PostRetries:  kCfg.Producer.Retries,
+		RetryDelay:   kCfg.Producer.RetryDelay,
 	}
 
 	producer := kafkaclient.NewProducer(cfg, pCfg)
@@ -41,6 +42,10 @@ type Publisher struct {
 }
 
 func (publisher Publisher) Publish(ctx context.Context, event pkgevents.EventType) error {
+	// set the event id and publish time, and the id of the request the event is published for
+	pkgevents.Stamp(event)
+	pkgevents.SetRequestID(event, requestid.FromContext(ctx))
+
 	l := zerolog.Ctx(ctx)
 	l.Debug().Any(logger.LData, event).Msg("event to publish")
 
@@ -50,9 +55,17 @@ func (publisher Publisher) Publish(ctx context.Context, event pkgevents.EventTyp
 		return err
 	}
 
-	err = publisher.producer.SendMessage(ctx, event.Name(), []byte(event.Name()), edata)
+	// events with the same key are published to the same partition, keeping them
+	// in order. Events without a key are spread across partitions
+	var key []byte
+	if event.Key() != "" {
+		key = []byte(event.Key())
+	}
+
+	err = publisher.producer.SendMessage(ctx, event.Name(), key, edata)
 	if err != nil {
 		l.Error().Err(err).Msg("failed to publish event")
+		metrics.EventPublishError(config.BrokerKafka, event.Name())
 		return err
 	}
 	l.Info().Msg("message sent")
@@ -0,0 +1,37 @@
+package subscriber
+
+import (
+	"context"
+	"strings"
+
+	natsclient "github.com/SirWaithaka/payments-api/src/clients/nats"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+func NewJetStream(client *natsclient.Client, nCfg config.NatsConfig) JetStream {
+	return JetStream{client: client, cfg: nCfg}
+}
+
+// JetStream subscribes to events with a durable jetstream consumer per subscription
+type JetStream struct {
+	client *natsclient.Client
+	cfg    config.NatsConfig
+}
+
+// Subscribe reads messages from the subject until ctx is cancelled. The group is used
+// as the durable consumer name, so delivery resumes where the group left off.
+func (subscriber JetStream) Subscribe(ctx context.Context, name, group string, handler events.Handler) error {
+	consumer := natsclient.NewConsumer(subscriber.client, natsclient.ConsumerConfig{
+		Subject: name,
+		// durable names cannot contain dots
+		Durable:     strings.ReplaceAll(group, ".", "-"),
+		MaxDeliver:  subscriber.cfg.MaxDeliver,
+		AckWait:     subscriber.cfg.AckWait,
+		RetryDelay:  subscriber.cfg.ConsumerRetryDelay,
+		Concurrency: subscriber.cfg.ConsumerConcurrency,
+	})
+	consumer.SetHandler(handler)
+
+	return consumer.ReadMessage(ctx)
+}
@@ -0,0 +1,108 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+
+	kafkaclient "github.com/SirWaithaka/payments-api/src/clients/kafka"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+func NewKafka(kCfg config.KafkaConfig) Kafka {
+	// create a producer for messages that consumers fail to handle
+	brokers := strings.Split(kCfg.Host, ",")
+	dlq := kafkaclient.NewProducer(kafkaclient.Config{Brokers: brokers}, kafkaclient.ProducerConfig{
+		BatchSize:    1,
+		Async:        false,
+		RequiredAcks: kafka.RequireAll,
+		PostRetries:  kCfg.Producer.Retries,
+		RetryDelay:   kCfg.Producer.RetryDelay,
+	})
+
+	return Kafka{cfg: kCfg, dlq: dlq, consumers: &consumers{running: make(map[*kafkaclient.Consumer]struct{})}}
+}
+
+// Kafka subscribes to events with a kafka consumer per subscription
+type Kafka struct {
+	cfg config.KafkaConfig
+	// producer shared by consumers to publish to dead letter topics
+	dlq *kafkaclient.Producer
+	// consumers of the running subscriptions
+	consumers *consumers
+}
+
+type consumers struct {
+	mu      sync.Mutex
+	running map[*kafkaclient.Consumer]struct{}
+}
+
+func (subscriber Kafka) newConsumer(topic, group string) *kafkaclient.Consumer {
+	// kafka client config
+	brokers := strings.Split(subscriber.cfg.Host, ",")
+	// Define consumer-specific configuration
+	cCfg := kafkaclient.ConsumerConfig{
+		Topic:          topic,
+		Brokers:        brokers,
+		GroupID:        group,
+		Partition:      0,
+		MinBytes:       subscriber.cfg.Consumer.MinBytes,
+		MaxBytes:       subscriber.cfg.Consumer.MaxBytes,
+		CommitInterval: int(subscriber.cfg.Consumer.CommitInterval.Milliseconds()),
+		StartOffset:    kafka.FirstOffset,
+		// dead letter topic in the format of <topicName.dlq>
+		DeadLetterTopic: fmt.Sprintf("%s.dlq", topic),
+		MaxRetries:      subscriber.cfg.Consumer.MaxRetries,
+		RetryDelay:      subscriber.cfg.Consumer.RetryDelay,
+		Concurrency:     subscriber.cfg.Consumer.Concurrency,
+	}
+
+	// Initialize the consumer
+	consumer := kafkaclient.NewConsumer(cCfg)
+	consumer.SetDeadLetterProducer(subscriber.dlq)
+
+	return consumer
+}
+
+// Subscribe reads messages from the topic until ctx is cancelled. The consumer
+// completes and commits any in-flight message before it is closed.
+func (subscriber Kafka) Subscribe(ctx context.Context, name, group string, handler events.Handler) error {
+	consumer := subscriber.newConsumer(name, group)
+	consumer.SetHandler(handler)
+
+	subscriber.consumers.mu.Lock()
+	subscriber.consumers.running[consumer] = struct{}{}
+	subscriber.consumers.mu.Unlock()
+	defer func() {
+		subscriber.consumers.mu.Lock()
+		delete(subscriber.consumers.running, consumer)
+		subscriber.consumers.mu.Unlock()
+	}()
+
+	err := consumer.ReadMessage(ctx)
+
+	// closing the consumer flushes its pending commits
+	return errors.Join(err, consumer.Close())
+}
+
+// Check reports whether any consumer is stalled on a message it cannot commit
+func (subscriber Kafka) Check(ctx context.Context) error {
+	subscriber.consumers.mu.Lock()
+	defer subscriber.consumers.mu.Unlock()
+
+	var errs []error
+	for consumer := range subscriber.consumers.running {
+		errs = append(errs, consumer.Check(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the dead letter producer, it should be called once no consumer is running
+func (subscriber Kafka) Close() error {
+	return subscriber.dlq.Close()
+}
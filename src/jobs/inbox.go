@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/events"
+)
+
+// NewInboxCleanup creates the job that removes events older than the retention from
+// the inbox. The inbox only needs to keep events for as long as a broker may redeliver them.
+func NewInboxCleanup(inbox events.Inbox, cfg config.InboxCleanupConfig) Job {
+	return Job{
+		Name:     "inbox cleanup",
+		Interval: cfg.Interval,
+		Run: func(ctx context.Context) error {
+			removed, err := inbox.RemoveBefore(ctx, time.Now().Add(-cfg.Retention))
+			if err != nil {
+				return err
+			}
+
+			zerolog.Ctx(ctx).Info().Msgf("removed %d events older than %s from inbox", removed, cfg.Retention)
+			return nil
+		},
+	}
+}
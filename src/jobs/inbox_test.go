@@ -0,0 +1,53 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/jobs"
+)
+
+type fakeInbox struct {
+	before time.Time
+	err    error
+}
+
+func (inbox *fakeInbox) Claim(context.Context, string, string, time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (inbox *fakeInbox) Processed(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (inbox *fakeInbox) Complete(context.Context, string, string) error { return nil }
+
+func (inbox *fakeInbox) Release(context.Context, string, string) error { return nil }
+
+func (inbox *fakeInbox) RemoveBefore(_ context.Context, before time.Time) (int64, error) {
+	inbox.before = before
+	return 1, inbox.err
+}
+
+func TestNewInboxCleanup(t *testing.T) {
+	t.Run("test that events older than the retention are removed", func(t *testing.T) {
+		inbox := &fakeInbox{}
+		job := jobs.NewInboxCleanup(inbox, config.InboxCleanupConfig{Interval: time.Hour, Retention: 24 * time.Hour})
+
+		assert.Equal(t, time.Hour, job.Interval)
+		assert.Nil(t, job.Run(t.Context()))
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), inbox.before, time.Second)
+	})
+
+	t.Run("test that inbox errors are returned", func(t *testing.T) {
+		inbox := &fakeInbox{err: errors.New("fake error")}
+		job := jobs.NewInboxCleanup(inbox, config.InboxCleanupConfig{Interval: time.Hour, Retention: 24 * time.Hour})
+
+		assert.EqualError(t, job.Run(t.Context()), "fake error")
+	})
+}
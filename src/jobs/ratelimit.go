@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+)
+
+// NewRateLimitCleanup creates the job that removes the rate limit buckets of keys that
+// are no longer used. A bucket is only removed once it has been idle for longer than the
+// slowest of the limits takes to refill it, since a removed bucket is created full.
+func NewRateLimitCleanup(buckets ratelimit.Repository, cfg config.RateLimitCleanupConfig, limits config.RateLimitConfig) Job {
+	idle := max(limits.Client.Refill(), limits.MSISDN.Refill(), limits.ShortCode.Refill())
+
+	return Job{
+		Name:     "rate limit cleanup",
+		Interval: cfg.Interval,
+		Run: func(ctx context.Context) error {
+			removed, err := buckets.RemoveBefore(ctx, time.Now().Add(-idle))
+			if err != nil {
+				return err
+			}
+
+			zerolog.Ctx(ctx).Info().Msgf("removed %d rate limit buckets idle for %s", removed, idle)
+			return nil
+		},
+	}
+}
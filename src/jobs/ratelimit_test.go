@@ -0,0 +1,52 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+	"github.com/SirWaithaka/payments-api/src/jobs"
+)
+
+type fakeBuckets struct {
+	ratelimit.Repository
+
+	before time.Time
+	err    error
+}
+
+func (buckets *fakeBuckets) RemoveBefore(_ context.Context, before time.Time) (int64, error) {
+	buckets.before = before
+	return 1, buckets.err
+}
+
+func TestNewRateLimitCleanup(t *testing.T) {
+	limits := config.RateLimitConfig{
+		// refilled in 1m
+		Client: rate.Limit{Rate: 1, Burst: 60},
+		// refilled in 10m
+		MSISDN: rate.Limit{Rate: 1.0 / 60, Burst: 10},
+	}
+
+	t.Run("test that buckets idle for longer than the slowest refill are removed", func(t *testing.T) {
+		buckets := &fakeBuckets{}
+		job := jobs.NewRateLimitCleanup(buckets, config.RateLimitCleanupConfig{Interval: time.Hour}, limits)
+
+		assert.Equal(t, time.Hour, job.Interval)
+		assert.Nil(t, job.Run(t.Context()))
+		assert.WithinDuration(t, time.Now().Add(-10*time.Minute), buckets.before, time.Second)
+	})
+
+	t.Run("test that repository errors are returned", func(t *testing.T) {
+		buckets := &fakeBuckets{err: errors.New("fake error")}
+		job := jobs.NewRateLimitCleanup(buckets, config.RateLimitCleanupConfig{Interval: time.Hour}, limits)
+
+		assert.EqualError(t, job.Run(t.Context()), "fake error")
+	})
+}
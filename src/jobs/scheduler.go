@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Job is a background task run on an interval
+type Job struct {
+	Name string
+	// interval between runs, a job with no interval is not run
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs on their intervals until it is shut down. A job is first run an
+// interval after the scheduler starts, and runs of the same job do not overlap.
+type Scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   []Job
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(c context.Context) *Scheduler {
+	ctx, cancel := context.WithCancel(c)
+	return &Scheduler{ctx: ctx, cancel: cancel}
+}
+
+// Add adds a job to be run once the scheduler starts
+func (scheduler *Scheduler) Add(job Job) {
+	l := zerolog.Ctx(scheduler.ctx)
+	if job.Interval <= 0 {
+		l.Info().Msgf("job %s is disabled", job.Name)
+		return
+	}
+
+	scheduler.jobs = append(scheduler.jobs, job)
+}
+
+// Start runs each job in a goroutine
+func (scheduler *Scheduler) Start() {
+	for _, job := range scheduler.jobs {
+		scheduler.wg.Add(1)
+		go func() {
+			defer scheduler.wg.Done()
+			scheduler.schedule(job)
+		}()
+	}
+}
+
+func (scheduler *Scheduler) schedule(job Job) {
+	l := zerolog.Ctx(scheduler.ctx).With().Str("job", job.Name).Logger()
+	l.Info().Msgf("scheduled job to run every %s", job.Interval)
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-scheduler.ctx.Done():
+			return
+		case <-ticker.C:
+			scheduler.run(l.WithContext(scheduler.ctx), job)
+		}
+	}
+}
+
+// run runs the job once, errors and panics are logged and the job runs again on
+// the next interval
+func (scheduler *Scheduler) run(ctx context.Context, job Job) {
+	l := zerolog.Ctx(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			l.Error().Str("stack", string(debug.Stack())).Msgf("job panicked: %v", r)
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		l.Error().Err(err).Msg("job failed")
+		return
+	}
+	l.Info().Msgf("job completed in %s", time.Since(start))
+}
+
+// Shutdown stops scheduling jobs and waits for running jobs to complete, or for ctx
+// to be done
+func (scheduler *Scheduler) Shutdown(ctx context.Context) error {
+	scheduler.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		scheduler.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs still running: %w", ctx.Err())
+	}
+}
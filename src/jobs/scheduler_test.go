@@ -0,0 +1,97 @@
+package jobs_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/jobs"
+)
+
+func TestScheduler(t *testing.T) {
+	t.Run("test that a job is run on its interval", func(t *testing.T) {
+		var runs atomic.Int32
+
+		scheduler := jobs.NewScheduler(t.Context())
+		scheduler.Add(jobs.Job{Name: "fake-job", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}})
+		scheduler.Start()
+
+		assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, 5*time.Millisecond)
+		assert.Nil(t, scheduler.Shutdown(t.Context()))
+	})
+
+	t.Run("test that a job without an interval is not run", func(t *testing.T) {
+		var runs atomic.Int32
+
+		scheduler := jobs.NewScheduler(t.Context())
+		scheduler.Add(jobs.Job{Name: "fake-job", Run: func(context.Context) error {
+			runs.Add(1)
+			return nil
+		}})
+		scheduler.Start()
+
+		time.Sleep(20 * time.Millisecond)
+		assert.Nil(t, scheduler.Shutdown(t.Context()))
+		assert.Equal(t, int32(0), runs.Load())
+	})
+
+	t.Run("test that a job runs again after it panics", func(t *testing.T) {
+		var runs atomic.Int32
+
+		scheduler := jobs.NewScheduler(t.Context())
+		scheduler.Add(jobs.Job{Name: "fake-job", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			runs.Add(1)
+			panic("fake panic")
+		}})
+		scheduler.Start()
+
+		assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, 5*time.Millisecond)
+		assert.Nil(t, scheduler.Shutdown(t.Context()))
+	})
+
+	t.Run("test that shutdown waits for a running job", func(t *testing.T) {
+		started := make(chan struct{})
+		var completed atomic.Bool
+
+		scheduler := jobs.NewScheduler(t.Context())
+		scheduler.Add(jobs.Job{Name: "fake-job", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			if completed.Load() {
+				return nil
+			}
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			completed.Store(true)
+			return nil
+		}})
+		scheduler.Start()
+
+		<-started
+		assert.Nil(t, scheduler.Shutdown(t.Context()))
+		assert.True(t, completed.Load())
+	})
+
+	t.Run("test that shutdown returns once ctx is done", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+
+		scheduler := jobs.NewScheduler(t.Context())
+		scheduler.Add(jobs.Job{Name: "fake-job", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}})
+		scheduler.Start()
+
+		<-started
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, scheduler.Shutdown(ctx), context.DeadlineExceeded)
+	})
+}
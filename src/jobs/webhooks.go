@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
+)
+
+// NewWebhookRepublish creates the job that publishes the events of webhooks that were saved
+// but not published, e.g. because the broker was unavailable when they were received
+func NewWebhookRepublish(service webhooks.Service, cfg config.WebhookRepublishConfig) Job {
+	return Job{
+		Name:     "webhook republish",
+		Interval: cfg.Interval,
+		Run: func(ctx context.Context) error {
+			published, err := service.Republish(ctx, time.Now().Add(-cfg.Delay))
+			if published > 0 {
+				zerolog.Ctx(ctx).Info().Msgf("republished %d webhooks", published)
+			}
+			return err
+		},
+	}
+}
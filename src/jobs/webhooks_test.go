@@ -0,0 +1,44 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
+	"github.com/SirWaithaka/payments-api/src/jobs"
+)
+
+type fakeWebhookService struct {
+	webhooks.Service
+
+	before time.Time
+	err    error
+}
+
+func (service *fakeWebhookService) Republish(_ context.Context, before time.Time) (int, error) {
+	service.before = before
+	return 1, service.err
+}
+
+func TestNewWebhookRepublish(t *testing.T) {
+	t.Run("test that webhooks older than the delay are republished", func(t *testing.T) {
+		service := &fakeWebhookService{}
+		job := jobs.NewWebhookRepublish(service, config.WebhookRepublishConfig{Interval: time.Minute, Delay: 2 * time.Minute})
+
+		assert.Equal(t, time.Minute, job.Interval)
+		assert.Nil(t, job.Run(t.Context()))
+		assert.WithinDuration(t, time.Now().Add(-2*time.Minute), service.before, time.Second)
+	})
+
+	t.Run("test that republish errors are returned", func(t *testing.T) {
+		service := &fakeWebhookService{err: errors.New("fake error")}
+		job := jobs.NewWebhookRepublish(service, config.WebhookRepublishConfig{Interval: time.Minute, Delay: time.Minute})
+
+		assert.EqualError(t, job.Run(t.Context()), "fake error")
+	})
+}
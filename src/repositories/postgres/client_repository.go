@@ -0,0 +1,213 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+)
+
+type ClientSchema struct {
+	ClientID   string  `gorm:"column:id;primaryKey;type:uuid;"`
+	Name       string  `gorm:"column:name;check:name<>'';not null"`
+	MerchantID *string `gorm:"column:merchant_id;index"`
+	KeyID      string  `gorm:"column:key_id;check:key_id<>'';not null;uniqueIndex"`
+	SecretHash string  `gorm:"column:secret_hash;check:secret_hash<>'';not null"`
+	SigningKey string  `gorm:"column:signing_key;check:signing_key<>'';not null"`
+	// master key and wrapped data key the signing key is encrypted with
+	MasterKeyID *string `gorm:"column:master_key_id;"`
+	DataKey     *string `gorm:"column:data_key;"`
+	// comma separated scopes
+	Scopes   string `gorm:"column:scopes;check:scopes<>'';not null"`
+	Disabled bool   `gorm:"column:disabled;not null;default:false"`
+
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (ClientSchema) TableName() string {
+	return "api_clients"
+}
+
+func (schema *ClientSchema) BeforeCreate(tx *gorm.DB) (err error) {
+	// generate uuid v7 id for the primary key
+	schema.ClientID = uuid.Must(uuid.NewV7()).String()
+	return
+}
+
+func (schema ClientSchema) ToEntity() auth.Client {
+	var scopes []auth.Scope
+	for _, scope := range strings.Split(schema.Scopes, ",") {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+
+	client := auth.Client{
+		ClientID:   schema.ClientID,
+		Name:       schema.Name,
+		KeyID:      schema.KeyID,
+		SecretHash: schema.SecretHash,
+		SigningKey: schema.SigningKey,
+		Scopes:     scopes,
+		Disabled:   schema.Disabled,
+		CreatedAt:  schema.CreatedAt,
+	}
+
+	if schema.MerchantID != nil {
+		client.MerchantID = *schema.MerchantID
+	}
+	if schema.MasterKeyID != nil {
+		client.MasterKeyID = *schema.MasterKeyID
+	}
+	if schema.DataKey != nil {
+		client.DataKey = *schema.DataKey
+	}
+
+	return client
+}
+
+func (schema *ClientSchema) FindOptions(opts auth.OptionsFindClients) {
+	if opts.ClientID != nil {
+		schema.ClientID = *opts.ClientID
+	}
+	if opts.KeyID != nil {
+		schema.KeyID = *opts.KeyID
+	}
+}
+
+// NonceSchema records the nonces of signed requests until their signatures expire
+type NonceSchema struct {
+	KeyID     string    `gorm:"column:key_id;primaryKey"`
+	Nonce     string    `gorm:"column:nonce;primaryKey"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index"`
+}
+
+func (NonceSchema) TableName() string {
+	return "api_nonces"
+}
+
+func NewClientRepository(db *gorm.DB) ClientRepository {
+	return ClientRepository{db}
+}
+
+type ClientRepository struct {
+	db *gorm.DB
+}
+
+func (repository ClientRepository) Add(ctx context.Context, client auth.Client) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("keyId", client.KeyID).Msg("saving api client")
+
+	scopes := make([]string, 0, len(client.Scopes))
+	for _, scope := range client.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	record := ClientSchema{
+		Name:        client.Name,
+		MerchantID:  nullable(client.MerchantID),
+		KeyID:       client.KeyID,
+		SecretHash:  client.SecretHash,
+		SigningKey:  client.SigningKey,
+		MasterKeyID: nullable(client.MasterKeyID),
+		DataKey:     nullable(client.DataKey),
+		Scopes:      strings.Join(scopes, ","),
+		Disabled:    client.Disabled,
+	}
+
+	result := repository.db.WithContext(ctx).Create(&record)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error saving record")
+		return Error{Err: err}
+	}
+	l.Debug().Msg("saved record")
+
+	return nil
+}
+
+func (repository ClientRepository) FindOne(ctx context.Context, opts auth.OptionsFindClients) (auth.Client, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msg("find api client")
+
+	where := ClientSchema{}
+	where.FindOptions(opts)
+
+	var record ClientSchema
+	result := repository.db.WithContext(ctx).Where(where).First(&record)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding record")
+		return auth.Client{}, Error{Err: err}
+	}
+	l.Debug().Str("id", record.ClientID).Msg("record found")
+
+	return record.ToEntity(), nil
+}
+
+func (repository ClientRepository) FindMany(ctx context.Context) ([]auth.Client, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msg("find api clients")
+
+	var records []ClientSchema
+	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, ClientSchema{}.TableName())).
+		Order("created_at ASC").
+		Find(&records)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding records")
+		return []auth.Client{}, Error{Err: err}
+	}
+	l.Debug().Int("count", len(records)).Msg("records found")
+
+	clients := make([]auth.Client, 0, len(records))
+	for _, record := range records {
+		clients = append(clients, record.ToEntity())
+	}
+
+	return clients, nil
+}
+
+func (repository ClientRepository) Disable(ctx context.Context, clientID string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", clientID).Msg("disabling api client")
+
+	result := repository.db.WithContext(ctx).
+		Model(&ClientSchema{}).
+		Where("id = ?", clientID).
+		Update("disabled", true)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error updating record")
+		return Error{Err: err}
+	}
+	if result.RowsAffected == 0 {
+		return Error{Err: ErrNotFound}
+	}
+	l.Info().Msg("record updated")
+
+	return nil
+}
+
+func (repository ClientRepository) AddNonce(ctx context.Context, keyID, nonce string, expiresAt time.Time) error {
+	l := zerolog.Ctx(ctx)
+
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// remove expired nonces of the key, a nonce can be reused once it expires
+		result := tx.Where("key_id = ? AND expires_at < ?", keyID, time.Now()).Delete(&NonceSchema{})
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&NonceSchema{KeyID: keyID, Nonce: nonce, ExpiresAt: expiresAt}).Error
+	})
+	if err != nil {
+		if e := (Error{Err: err}); !e.Duplicate() {
+			l.Error().Err(err).Msg("error saving nonce")
+		}
+		return Error{Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+func TestClientRepository(t *testing.T) {
+	ctx := context.Background()
+
+	repo := postgres.NewClientRepository(inf.Storage.PG)
+
+	t.Run("test that a client is found by its key id", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		client := auth.Client{
+			Name:        "payouts",
+			KeyID:       "pk_1",
+			SecretHash:  "hash",
+			SigningKey:  "encrypted",
+			MasterKeyID: "k1",
+			DataKey:     "wrapped",
+			Scopes:      []auth.Scope{auth.ScopePayout, auth.ScopeRead},
+		}
+		if err := repo.Add(ctx, client); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		keyID := "pk_1"
+		found, err := repo.FindOne(ctx, auth.OptionsFindClients{KeyID: &keyID})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.NotEmpty(t, found.ClientID)
+		assert.Equal(t, client.Scopes, found.Scopes)
+		assert.Equal(t, []string{"encrypted", "k1", "wrapped"}, []string{found.SigningKey, found.MasterKeyID, found.DataKey})
+		assert.False(t, found.Disabled)
+
+		if err = repo.Disable(ctx, found.ClientID); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		clients, err := repo.FindMany(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, clients, 1)
+		assert.True(t, clients[0].Disabled)
+	})
+
+	t.Run("test that a nonce is only added once until it expires", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if err := repo.AddNonce(ctx, "pk_1", "nonce", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		err := repo.AddNonce(ctx, "pk_1", "nonce", time.Now().Add(time.Minute))
+		if e, ok := err.(postgres.Error); !ok || !e.Duplicate() {
+			t.Errorf("expected duplicate error, got %v", err)
+		}
+
+		// other keys can use the same nonce
+		assert.Nil(t, repo.AddNonce(ctx, "pk_2", "nonce", time.Now().Add(time.Minute)))
+
+		// expired nonces are removed
+		assert.Nil(t, repo.AddNonce(ctx, "pk_3", "nonce", time.Now().Add(-time.Minute)))
+		assert.Nil(t, repo.AddNonce(ctx, "pk_3", "nonce", time.Now().Add(time.Minute)))
+	})
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+type InboxSchema struct {
+	ID            string `gorm:"column:id;primaryKey;type:uuid;"`
+	ConsumerGroup string `gorm:"column:consumer_group;check:consumer_group<>'';not null;uniqueIndex:unique_consumer_group_event_id"`
+	EventID       string `gorm:"column:event_id;check:event_id<>'';not null;uniqueIndex:unique_consumer_group_event_id"`
+	// time the event was last claimed by a consumer of the group
+	ClaimedAt *time.Time `gorm:"column:claimed_at"`
+	// time the event was processed, nil while it is being handled
+	ProcessedAt *time.Time `gorm:"column:processed_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;index:idx_event_inbox_created_at"`
+}
+
+func (InboxSchema) TableName() string {
+	return "event_inbox"
+}
+
+func (schema *InboxSchema) BeforeCreate(tx *gorm.DB) (err error) {
+	// generate uuid v7 id for the primary key
+	schema.ID = uuid.Must(uuid.NewV7()).String()
+	return
+}
+
+// claimEvent inserts the claim of an event, or takes over a claim that has expired. The
+// unique constraint makes concurrent claims of an event wait for each other, no row is
+// returned if the event is processed or claimed by another consumer.
+const claimEvent = `
+INSERT INTO event_inbox AS inbox (id, consumer_group, event_id, claimed_at, created_at)
+VALUES (@id, @group, @event_id, now(), now())
+ON CONFLICT (consumer_group, event_id) DO UPDATE
+    SET claimed_at = now()
+    WHERE inbox.processed_at IS NULL
+      AND inbox.claimed_at < now() - make_interval(secs => @timeout)
+RETURNING id`
+
+func NewInboxRepository(db *gorm.DB) InboxRepository {
+	return InboxRepository{db}
+}
+
+type InboxRepository struct {
+	db *gorm.DB
+}
+
+func (repository InboxRepository) Claim(ctx context.Context, group, eventID string, timeout time.Duration) (bool, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("claiming event %s for group %s", eventID, group)
+
+	args := map[string]any{
+		"id":       uuid.Must(uuid.NewV7()).String(),
+		"group":    group,
+		"event_id": eventID,
+		"timeout":  timeout.Seconds(),
+	}
+
+	var ids []string
+	result := repository.db.WithContext(ctx).Raw(claimEvent, args).Scan(&ids)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error claiming event")
+		return false, Error{Err: err}
+	}
+
+	return len(ids) > 0, nil
+}
+
+func (repository InboxRepository) Processed(ctx context.Context, group, eventID string) (bool, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("checking event %s for group %s is processed", eventID, group)
+
+	var count int64
+	result := repository.db.WithContext(ctx).
+		Model(InboxSchema{}).
+		Where(InboxSchema{ConsumerGroup: group, EventID: eventID}).
+		Where("processed_at IS NOT NULL").
+		Count(&count)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error counting records")
+		return false, Error{Err: err}
+	}
+
+	return count > 0, nil
+}
+
+func (repository InboxRepository) Complete(ctx context.Context, group, eventID string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("completing event %s for group %s", eventID, group)
+
+	result := repository.db.WithContext(ctx).
+		Model(InboxSchema{}).
+		Where(InboxSchema{ConsumerGroup: group, EventID: eventID}).
+		Update("processed_at", time.Now())
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error updating record")
+		return Error{Err: err}
+	}
+	if result.RowsAffected == 0 {
+		return Error{Err: ErrNotFound}
+	}
+
+	return nil
+}
+
+func (repository InboxRepository) Release(ctx context.Context, group, eventID string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("releasing event %s for group %s", eventID, group)
+
+	// processed events are never released
+	result := repository.db.WithContext(ctx).
+		Where(InboxSchema{ConsumerGroup: group, EventID: eventID}).
+		Where("processed_at IS NULL").
+		Delete(&InboxSchema{})
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error deleting record")
+		return Error{Err: err}
+	}
+
+	return nil
+}
+
+// RemoveBefore removes the events of all consumer groups recorded before the time
+func (repository InboxRepository) RemoveBefore(ctx context.Context, before time.Time) (int64, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("removing events recorded before %s from inbox", before)
+
+	result := repository.db.WithContext(ctx).
+		Where("created_at < ?", before).
+		Delete(&InboxSchema{})
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error deleting records")
+		return 0, Error{Err: err}
+	}
+	l.Debug().Msgf("removed %d records", result.RowsAffected)
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,210 @@
+package postgres_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+func TestInboxRepository(t *testing.T) {
+	ctx := context.Background()
+
+	repo := postgres.NewInboxRepository(inf.Storage.PG)
+
+	t.Run("test that an event is claimed once", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		claimed, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if !claimed {
+			t.Errorf("expected event to be claimed")
+		}
+
+		claimed, err = repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if claimed {
+			t.Errorf("expected claimed event not to be claimed again")
+		}
+
+		// the same event in a different group is claimed separately
+		claimed, err = repo.Claim(ctx, "other-group", "fake-event-id", time.Minute)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if !claimed {
+			t.Errorf("expected event to be claimed in other group")
+		}
+	})
+
+	t.Run("test that concurrent claims of an event claim it once", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		count := 0
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute)
+				if err != nil {
+					t.Errorf("expected nil error, got %v", err)
+				}
+				if claimed {
+					mu.Lock()
+					count++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if count != 1 {
+			t.Errorf("expected 1 claim, got %d", count)
+		}
+	})
+
+	t.Run("test that an expired claim is taken over", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if _, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		// age the claim
+		result := inf.Storage.PG.Model(postgres.InboxSchema{}).
+			Where(postgres.InboxSchema{EventID: "fake-event-id"}).
+			Update("claimed_at", time.Now().Add(-2*time.Minute))
+		if result.Error != nil {
+			t.Errorf("expected nil error, got %v", result.Error)
+		}
+
+		claimed, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if !claimed {
+			t.Errorf("expected expired claim to be taken over")
+		}
+	})
+
+	t.Run("test that a completed event is not claimed again", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if _, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if err := repo.Complete(ctx, "fake-group", "fake-event-id"); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		// neither an expired lease nor a release makes a processed event claimable
+		if err := repo.Release(ctx, "fake-group", "fake-event-id"); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		claimed, err := repo.Claim(ctx, "fake-group", "fake-event-id", 0)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if claimed {
+			t.Errorf("expected completed event not to be claimed")
+		}
+	})
+
+	t.Run("test that only a completed event is processed", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if _, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		processed, err := repo.Processed(ctx, "fake-group", "fake-event-id")
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if processed {
+			t.Errorf("expected claimed event not to be processed")
+		}
+
+		if err = repo.Complete(ctx, "fake-group", "fake-event-id"); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		processed, err = repo.Processed(ctx, "fake-group", "fake-event-id")
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if !processed {
+			t.Errorf("expected completed event to be processed")
+		}
+	})
+
+	t.Run("test that a released event is claimed again", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if _, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if err := repo.Release(ctx, "fake-group", "fake-event-id"); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		claimed, err := repo.Claim(ctx, "fake-group", "fake-event-id", time.Minute)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if !claimed {
+			t.Errorf("expected released event to be claimed")
+		}
+	})
+
+	t.Run("test that completing an unclaimed event returns not found", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		err := repo.Complete(ctx, "fake-group", "fake-event-id")
+		if e, ok := err.(postgres.Error); !ok || !e.NotFound() {
+			t.Errorf("expected not found error, got %v", err)
+		}
+	})
+
+	t.Run("test that events recorded before the time are removed", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		for _, id := range []string{"old-event-id", "new-event-id"} {
+			if _, err := repo.Claim(ctx, "fake-group", id, time.Minute); err != nil {
+				t.Errorf("expected nil error, got %v", err)
+			}
+			if err := repo.Complete(ctx, "fake-group", id); err != nil {
+				t.Errorf("expected nil error, got %v", err)
+			}
+		}
+		// age the first event
+		result := inf.Storage.PG.Model(postgres.InboxSchema{}).
+			Where(postgres.InboxSchema{EventID: "old-event-id"}).
+			Update("created_at", time.Now().Add(-48*time.Hour))
+		if result.Error != nil {
+			t.Errorf("expected nil error, got %v", result.Error)
+		}
+
+		removed, err := repo.RemoveBefore(ctx, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		if removed != 1 {
+			t.Errorf("expected 1 removed record, got %d", removed)
+		}
+
+		var records []postgres.InboxSchema
+		if result = inf.Storage.PG.Find(&records); result.Error != nil {
+			t.Errorf("expected nil error, got %v", result.Error)
+		}
+		if len(records) != 1 || records[0].EventID != "new-event-id" {
+			t.Errorf("expected only the new event to remain, got %v", records)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+)
+
+// tenant limits a query to the records of the merchant bound to the context, queries
+// of contexts that are not bound to a merchant are not limited
+func tenant(ctx context.Context, table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		merchantID, ok := merchants.FromContext(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(table+".merchant_id = ?", merchantID)
+	}
+}
+
+type MerchantSchema struct {
+	MerchantID string `gorm:"column:id;primaryKey;type:uuid;"`
+	Name       string `gorm:"column:name;check:name<>'';not null"`
+
+	CreatedAt time.Time `gorm:"column:created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (MerchantSchema) TableName() string {
+	return "merchants"
+}
+
+func (schema *MerchantSchema) BeforeCreate(tx *gorm.DB) (err error) {
+	// generate uuid v7 id for the primary key
+	schema.MerchantID = uuid.Must(uuid.NewV7()).String()
+	return
+}
+
+func (schema MerchantSchema) ToEntity() merchants.Merchant {
+	return merchants.Merchant{
+		MerchantID: schema.MerchantID,
+		Name:       schema.Name,
+		CreatedAt:  schema.CreatedAt,
+	}
+}
+
+func NewMerchantRepository(db *gorm.DB) MerchantRepository {
+	return MerchantRepository{db}
+}
+
+type MerchantRepository struct {
+	db *gorm.DB
+}
+
+func (repository MerchantRepository) Add(ctx context.Context, merchant merchants.Merchant) (merchants.Merchant, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("name", merchant.Name).Msg("saving merchant")
+
+	record := MerchantSchema{Name: merchant.Name}
+
+	result := repository.db.WithContext(ctx).Create(&record)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error saving record")
+		return merchants.Merchant{}, Error{Err: err}
+	}
+	l.Debug().Str("id", record.MerchantID).Msg("saved record")
+
+	return record.ToEntity(), nil
+}
+
+func (repository MerchantRepository) FindOne(ctx context.Context, merchantID string) (merchants.Merchant, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", merchantID).Msg("find merchant")
+
+	var record MerchantSchema
+	result := repository.db.WithContext(ctx).Where("id = ?", merchantID).First(&record)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding record")
+		return merchants.Merchant{}, Error{Err: err}
+	}
+
+	return record.ToEntity(), nil
+}
+
+func (repository MerchantRepository) FindMany(ctx context.Context) ([]merchants.Merchant, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msg("find merchants")
+
+	var records []MerchantSchema
+	result := repository.db.WithContext(ctx).Order("created_at ASC").Find(&records)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding records")
+		return []merchants.Merchant{}, Error{Err: err}
+	}
+	l.Debug().Int("count", len(records)).Msg("records found")
+
+	out := make([]merchants.Merchant, 0, len(records))
+	for _, record := range records {
+		out = append(out, record.ToEntity())
+	}
+
+	return out, nil
+}
+
+func (repository MerchantRepository) Report(ctx context.Context, opts merchants.OptionsReport) ([]merchants.ReportTotal, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", opts.MerchantID).Msg("report merchant payments")
+
+	query := repository.db.WithContext(ctx).
+		Model(&MpesaPaymentSchema{}).
+		Select("type, status, COUNT(*) AS count, COALESCE(SUM(amount::numeric), 0)::text AS amount").
+		Where("merchant_id = ?", opts.MerchantID).
+		Group("type, status").
+		Order("type, status")
+	if opts.From != nil {
+		query = query.Where("created_at >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("created_at < ?", *opts.To)
+	}
+
+	var totals []merchants.ReportTotal
+	result := query.Scan(&totals)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error reporting payments")
+		return nil, Error{Err: err}
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,91 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+func TestMerchantRepository(t *testing.T) {
+	repo := postgres.NewMerchantRepository(inf.Storage.PG)
+	payments := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+
+	newPayment := func(merchantID string, paymentType mpesa.PaymentType, amount string) mpesa.Payment {
+		return mpesa.Payment{
+			PaymentID:           ulid.Make().String(),
+			MerchantID:          merchantID,
+			Type:                paymentType,
+			Status:              requests.StatusSucceeded,
+			ClientTransactionID: ulid.Make().String(),
+			IdempotencyID:       ulid.Make().String(),
+			Amount:              amount,
+			ShortCodeID:         ulid.Make().String(),
+		}
+	}
+
+	t.Run("test that a merchant is saved and found", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		merchant, err := repo.Add(t.Context(), merchants.Merchant{Name: "brand"})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.NotEmpty(t, merchant.MerchantID)
+
+		found, err := repo.FindOne(t.Context(), merchant.MerchantID)
+		assert.Nil(t, err)
+		assert.Equal(t, "brand", found.Name)
+
+		values, err := repo.FindMany(t.Context())
+		assert.Nil(t, err)
+		assert.Len(t, values, 1)
+	})
+
+	t.Run("test that payments of other merchants are not found", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		payment := newPayment("merchant-a", mpesa.PaymentTypeCharge, "10")
+		if err := payments.Add(t.Context(), payment); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		_, err := payments.FindOne(merchants.WithMerchant(t.Context(), "merchant-a"), mpesa.OptionsFindPayment{PaymentID: &payment.PaymentID})
+		assert.Nil(t, err)
+
+		_, err = payments.FindOne(merchants.WithMerchant(t.Context(), "merchant-b"), mpesa.OptionsFindPayment{PaymentID: &payment.PaymentID})
+		var nf pkgerrors.NotFounder
+		if !assert.ErrorAs(t, err, &nf) || !nf.NotFound() {
+			t.Errorf("expected not found error, got %v", err)
+		}
+	})
+
+	t.Run("test that the report sums the merchant payments by type and status", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		for _, payment := range []mpesa.Payment{
+			newPayment("merchant-a", mpesa.PaymentTypeCharge, "10"),
+			newPayment("merchant-a", mpesa.PaymentTypeCharge, "15.50"),
+			newPayment("merchant-a", mpesa.PaymentTypePayout, "100"),
+			newPayment("merchant-b", mpesa.PaymentTypeCharge, "1000"),
+		} {
+			if err := payments.Add(t.Context(), payment); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+		}
+
+		totals, err := repo.Report(t.Context(), merchants.OptionsReport{MerchantID: "merchant-a"})
+		assert.Nil(t, err)
+		assert.Equal(t, []merchants.ReportTotal{
+			{Type: "charge", Status: requests.StatusSucceeded.String(), Count: 2, Amount: "25.50"},
+			{Type: "payout", Status: requests.StatusSucceeded.String(), Count: 1, Amount: "100"},
+		}, totals)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gofrs/uuid/v5"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
@@ -16,10 +17,11 @@ import (
 type MpesaPaymentSchema struct {
 	ID                       string  `gorm:"column:id;primaryKey;type:uuid;"`
 	PaymentID                string  `gorm:"column:payment_id;not null"`
+	MerchantID               *string `gorm:"column:merchant_id;index;uniqueIndex:unique_mpesa_payments_merchant_idempotency_id"`
 	Type                     string  `gorm:"column:type;not null"`
 	Status                   string  `gorm:"column:status;not null"`
 	ClientTransactionID      string  `gorm:"column:client_transaction_id;not null"`
-	IdempotencyID            string  `gorm:"column:idempotency_id;not null"`
+	IdempotencyID            string  `gorm:"column:idempotency_id;not null;uniqueIndex:unique_mpesa_payments_merchant_idempotency_id"`
 	PaymentReference         *string `gorm:"column:payment_reference;"`
 	Amount                   string  `gorm:"column:amount;not null"`
 	SourceAccountNumber      string  `gorm:"column:source_account_number;not null"`
@@ -28,6 +30,10 @@ type MpesaPaymentSchema struct {
 	Description              *string `gorm:"column:description;check:description<>'';"`
 
 	ShortCodeID *string `gorm:"column:shortcode_id;"`
+	// traceparent of the request that created the payment
+	TraceParent *string `gorm:"column:trace_parent;"`
+	// id of the api request that created the payment
+	RequestID *string `gorm:"column:request_id;index"`
 
 	CreatedAt time.Time `gorm:"column:created_at;type:timestamp;"`
 	UpdatedAt time.Time `gorm:"column:updated_at;type:timestamp;"`
@@ -47,6 +53,7 @@ func (schema MpesaPaymentSchema) ToEntity() mpesa.Payment {
 		SourceAccountNumber:      schema.SourceAccountNumber,
 		DestinationAccountNumber: schema.DestinationAccountNumber,
 		Status:                   requests.ToStatus(schema.Status),
+		CreatedAt:                schema.CreatedAt,
 	}
 
 	// check if pointer values are nil
@@ -59,9 +66,18 @@ func (schema MpesaPaymentSchema) ToEntity() mpesa.Payment {
 	if schema.ShortCodeID != nil {
 		payment.ShortCodeID = *schema.ShortCodeID
 	}
+	if schema.MerchantID != nil {
+		payment.MerchantID = *schema.MerchantID
+	}
 	if schema.Description != nil {
 		payment.Description = *schema.Description
 	}
+	if schema.TraceParent != nil {
+		payment.TraceParent = *schema.TraceParent
+	}
+	if schema.RequestID != nil {
+		payment.RequestID = *schema.RequestID
+	}
 
 	return payment
 }
@@ -121,6 +137,7 @@ func (repository MpesaPaymentsRepository) Add(ctx context.Context, payment mpesa
 
 	record := MpesaPaymentSchema{
 		PaymentID:                payment.PaymentID,
+		MerchantID:               nullable(payment.MerchantID),
 		Type:                     string(payment.Type),
 		Status:                   string(payment.Status),
 		ClientTransactionID:      payment.ClientTransactionID,
@@ -132,6 +149,8 @@ func (repository MpesaPaymentsRepository) Add(ctx context.Context, payment mpesa
 		Beneficiary:              &payment.Beneficiary,
 		Description:              &payment.Description,
 		ShortCodeID:              &payment.ShortCodeID,
+		TraceParent:              nullable(payment.TraceParent),
+		RequestID:                nullable(payment.RequestID),
 	}
 
 	result := repository.db.WithContext(ctx).Create(&record)
@@ -155,7 +174,10 @@ func (repository MpesaPaymentsRepository) FindOne(ctx context.Context, opts mpes
 	l.Info().Any(logger.LData, where).Msg("query params")
 
 	var record MpesaPaymentSchema
-	result := repository.db.WithContext(ctx).Where(where).First(&record)
+	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, MpesaPaymentSchema{}.TableName())).
+		Where(where).
+		First(&record)
 	if err := result.Error; err != nil {
 		l.Error().Err(err).Msg("error fetching record")
 		return mpesa.Payment{}, Error{Err: err}
@@ -178,6 +200,7 @@ func (repository MpesaPaymentsRepository) Update(ctx context.Context, id string,
 	}
 
 	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, MpesaPaymentSchema{}.TableName())).
 		Where(MpesaPaymentSchema{PaymentID: id}).
 		Updates(values)
 
@@ -189,3 +212,43 @@ func (repository MpesaPaymentsRepository) Update(ctx context.Context, id string,
 
 	return nil
 }
+
+// Transition updates the payment and returns it with the status it had before the update.
+// The payment is locked until it is updated, so that only one of concurrent webhooks of a
+// payment sees it move to a final status.
+func (repository MpesaPaymentsRepository) Transition(ctx context.Context, id string, opts mpesa.OptionsUpdatePayment) (mpesa.Payment, requests.Status, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Any(logger.LData, opts).Msg("update options")
+
+	var record MpesaPaymentSchema
+	var previous requests.Status
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(tenant(ctx, MpesaPaymentSchema{}.TableName())).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(MpesaPaymentSchema{PaymentID: id}).
+			First(&record)
+		if err := result.Error; err != nil {
+			return err
+		}
+		previous = requests.ToStatus(record.Status)
+
+		values := MpesaPaymentSchema{}
+		if opts.Status != nil {
+			values.Status = string(*opts.Status)
+			record.Status = values.Status
+		}
+		if opts.PaymentReference != nil {
+			values.PaymentReference = opts.PaymentReference
+			record.PaymentReference = values.PaymentReference
+		}
+
+		return tx.Model(&MpesaPaymentSchema{}).Where("id = ?", record.ID).Updates(values).Error
+	})
+	if err != nil {
+		l.Error().Err(err).Msg("error updating record")
+		return mpesa.Payment{}, "", Error{Err: err}
+	}
+	l.Info().Msg("record updated")
+
+	return record.ToEntity(), previous, nil
+}
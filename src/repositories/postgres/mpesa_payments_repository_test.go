@@ -3,6 +3,7 @@ package postgres_test
 import (
 	"testing"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 
@@ -33,6 +34,8 @@ func TestMpesaPaymentRepository_Add(t *testing.T) {
 			Beneficiary:              "fake_beneficiary",
 			Description:              "fake_description",
 			ShortCodeID:              ulid.Make().String(),
+			TraceParent:              "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			RequestID:                ulid.Make().String(),
 		}
 
 		err := repo.Add(t.Context(), payment)
@@ -47,9 +50,42 @@ func TestMpesaPaymentRepository_Add(t *testing.T) {
 			t.Errorf("expected nil error, got %v", err)
 		}
 
+		// the creation time is set by the database
+		assert.False(t, record.CreatedAt.IsZero())
+		payment.CreatedAt = record.CreatedAt
 		assert.Equal(t, payment, record.ToEntity())
 	})
 
+	t.Run("test that a repeated idempotency id of a merchant is a duplicate", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		payment := mpesa.Payment{
+			PaymentID:           ulid.Make().String(),
+			MerchantID:          uuid.Must(uuid.NewV4()).String(),
+			Type:                mpesa.PaymentTypeCharge,
+			Status:              requests.StatusReceived,
+			ClientTransactionID: ulid.Make().String(),
+			IdempotencyID:       ulid.Make().String(),
+			Amount:              "10",
+			Description:         "fake_description",
+		}
+		assert.Nil(t, repo.Add(t.Context(), payment))
+
+		// the retried payment is rejected
+		retried := payment
+		retried.PaymentID = ulid.Make().String()
+		err := repo.Add(t.Context(), retried)
+		var e postgres.Error
+		if assert.ErrorAs(t, err, &e) {
+			assert.True(t, e.Duplicate())
+		}
+
+		// the idempotency ids of merchants are independent
+		other := retried
+		other.MerchantID = uuid.Must(uuid.NewV4()).String()
+		assert.Nil(t, repo.Add(t.Context(), other))
+	})
+
 }
 
 func TestMpesaPaymentsRepository_FindOne(t *testing.T) {
@@ -176,3 +212,40 @@ func TestMpesaPaymentsRepository_Update(t *testing.T) {
 		})
 	}
 }
+
+func TestMpesaPaymentsRepository_Transition(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	repo := postgres.NewMpesaPaymentsRepository(inf.Storage.PG)
+
+	payment := mpesa.Payment{
+		PaymentID:           ulid.Make().String(),
+		ClientTransactionID: ulid.Make().String(),
+		IdempotencyID:       ulid.Make().String(),
+		Status:              requests.StatusSent,
+		Description:         "fake_description",
+	}
+	if err := repo.Add(t.Context(), payment); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	opts := mpesa.OptionsUpdatePayment{
+		Status:           types.Pointer(requests.StatusSucceeded),
+		PaymentReference: types.Pointer(ulid.Make().String()),
+	}
+
+	updated, previous, err := repo.Transition(t.Context(), payment.PaymentID, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, requests.StatusSent, previous)
+	assert.Equal(t, payment.PaymentID, updated.PaymentID)
+	assert.Equal(t, requests.StatusSucceeded, updated.Status)
+	assert.Equal(t, *opts.PaymentReference, updated.PaymentReference)
+
+	// the status before a repeated update is the final status
+	_, previous, err = repo.Transition(t.Context(), payment.PaymentID, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, requests.StatusSucceeded, previous)
+
+	// unknown payments are not found
+	_, _, err = repo.Transition(t.Context(), ulid.Make().String(), opts)
+	assert.Error(t, err)
+}
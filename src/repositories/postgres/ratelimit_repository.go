@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+)
+
+// RateLimitBucketSchema is the token bucket of a rate limit key. Tokens are refilled when
+// the bucket is taken from, using the time elapsed since it was last updated.
+type RateLimitBucketSchema struct {
+	Key       string    `gorm:"column:key;primaryKey"`
+	Tokens    float64   `gorm:"column:tokens;not null"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null;index"`
+}
+
+func (RateLimitBucketSchema) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// takeToken refills the bucket and takes a token in one statement, the row is locked by
+// the upsert so that concurrent requests of all instances take tokens in turn. The time of
+// the database is used so that instances with different clocks refill buckets equally.
+// No row is returned if the bucket has no token.
+const takeToken = `
+INSERT INTO rate_limit_buckets AS bucket (key, tokens, updated_at)
+VALUES (@key, @burst - 1, now())
+ON CONFLICT (key) DO UPDATE
+    SET tokens     = LEAST(@burst, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at) * @rate) - 1,
+        updated_at = now()
+    WHERE LEAST(@burst, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at) * @rate) >= 1
+RETURNING tokens`
+
+// availableTokens returns the tokens of a bucket refilled up to now
+const availableTokens = `
+SELECT LEAST(@burst, tokens + EXTRACT(EPOCH FROM now() - updated_at) * @rate)
+FROM rate_limit_buckets
+WHERE key = @key`
+
+// lockBucket creates the bucket of the key if it does not exist and locks it until the
+// transaction ends. It returns the tokens of the bucket refilled up to now.
+const lockBucket = `
+INSERT INTO rate_limit_buckets AS bucket (key, tokens, updated_at)
+VALUES (@key, @burst, now())
+ON CONFLICT (key) DO UPDATE
+    SET key = bucket.key
+RETURNING LEAST(@burst, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at) * @rate)`
+
+// takeLockedToken takes a token from a bucket locked by lockBucket
+const takeLockedToken = `
+UPDATE rate_limit_buckets
+SET tokens     = @tokens - 1,
+    updated_at = now()
+WHERE key = @key`
+
+func NewRateLimitRepository(db *gorm.DB) RateLimitRepository {
+	return RateLimitRepository{db}
+}
+
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+func (repository RateLimitRepository) Take(ctx context.Context, key string, limit rate.Limit) (bool, time.Duration, error) {
+	l := zerolog.Ctx(ctx)
+
+	args := map[string]any{"key": key, "burst": float64(limit.Burst), "rate": limit.Rate}
+
+	var tokens []float64
+	result := repository.db.WithContext(ctx).Raw(takeToken, args).Scan(&tokens)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error taking rate limit token")
+		return false, 0, Error{Err: err}
+	}
+	if len(tokens) > 0 {
+		return true, 0, nil
+	}
+
+	// the bucket is empty, find when the next token is available
+	var available float64
+	result = repository.db.WithContext(ctx).Raw(availableTokens, args).Scan(&available)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error reading rate limit bucket")
+		return false, 0, Error{Err: err}
+	}
+
+	wait := math.Max(0, 1-available) / limit.Rate
+	return false, time.Duration(wait * float64(time.Second)), nil
+}
+
+func (repository RateLimitRepository) TakeAll(ctx context.Context, buckets []ratelimit.Bucket) (string, time.Duration, error) {
+	l := zerolog.Ctx(ctx)
+
+	// buckets are locked in the order of their keys, so that concurrent requests
+	// for the same buckets do not deadlock
+	buckets = slices.Clone(buckets)
+	slices.SortFunc(buckets, func(a, b ratelimit.Bucket) int { return strings.Compare(a.Key, b.Key) })
+
+	var limited string
+	var retryAfter time.Duration
+	err := repository.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tokens := make([]float64, len(buckets))
+		for i, bucket := range buckets {
+			args := map[string]any{"key": bucket.Key, "burst": float64(bucket.Limit.Burst), "rate": bucket.Limit.Rate}
+			if err := tx.Raw(lockBucket, args).Scan(&tokens[i]).Error; err != nil {
+				return err
+			}
+
+			// the bucket with the longest wait is reported
+			if tokens[i] < 1 {
+				wait := time.Duration((1 - tokens[i]) / bucket.Limit.Rate * float64(time.Second))
+				if wait > retryAfter || limited == "" {
+					limited, retryAfter = bucket.Key, wait
+				}
+			}
+		}
+
+		// no token is taken if any bucket is empty
+		if limited != "" {
+			return nil
+		}
+
+		for i, bucket := range buckets {
+			args := map[string]any{"key": bucket.Key, "tokens": tokens[i]}
+			if err := tx.Exec(takeLockedToken, args).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		l.Error().Err(err).Msg("error taking rate limit tokens")
+		return "", 0, Error{Err: err}
+	}
+
+	return limited, retryAfter, nil
+}
+
+// RemoveBefore removes the buckets that were last taken from before the time. A removed
+// bucket is created full when it is next taken from.
+func (repository RateLimitRepository) RemoveBefore(ctx context.Context, before time.Time) (int64, error) {
+	l := zerolog.Ctx(ctx)
+
+	result := repository.db.WithContext(ctx).Where("updated_at < ?", before).Delete(&RateLimitBucketSchema{})
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error removing rate limit buckets")
+		return 0, Error{Err: err}
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,113 @@
+package postgres_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/rate"
+	"github.com/SirWaithaka/payments-api/src/domains/ratelimit"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+func TestRateLimitRepository_Take(t *testing.T) {
+	repo := postgres.NewRateLimitRepository(inf.Storage.PG)
+
+	t.Run("test that tokens are taken until the bucket is empty", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		// 2 requests a minute
+		limit := rate.Limit{Rate: 2.0 / 60, Burst: 2}
+
+		for i := 0; i < limit.Burst; i++ {
+			ok, _, err := repo.Take(t.Context(), "client:1", limit)
+			assert.Nil(t, err)
+			assert.True(t, ok)
+		}
+
+		ok, retryAfter, err := repo.Take(t.Context(), "client:1", limit)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, 30*time.Second)
+
+		// buckets of other keys are not affected
+		ok, _, err = repo.Take(t.Context(), "client:2", limit)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("test that buckets are refilled over time", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		// 10 requests a second
+		limit := rate.Limit{Rate: 10, Burst: 1}
+
+		ok, _, err := repo.Take(t.Context(), "client:1", limit)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, _, _ = repo.Take(t.Context(), "client:1", limit)
+		assert.False(t, ok)
+
+		time.Sleep(150 * time.Millisecond)
+		ok, _, err = repo.Take(t.Context(), "client:1", limit)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestRateLimitRepository_TakeAll(t *testing.T) {
+	repo := postgres.NewRateLimitRepository(inf.Storage.PG)
+
+	t.Run("test that no token is taken when a bucket is empty", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		// 2 requests a minute
+		msisdn := ratelimit.Bucket{Key: "msisdn:254700000000", Limit: rate.Limit{Rate: 2.0 / 60, Burst: 2}}
+		// 1 request a minute
+		shortcode := ratelimit.Bucket{Key: "shortcode:1", Limit: rate.Limit{Rate: 1.0 / 60, Burst: 1}}
+
+		key, _, err := repo.TakeAll(t.Context(), []ratelimit.Bucket{msisdn, shortcode})
+		assert.Nil(t, err)
+		assert.Empty(t, key)
+
+		key, retryAfter, err := repo.TakeAll(t.Context(), []ratelimit.Bucket{msisdn, shortcode})
+		assert.Nil(t, err)
+		assert.Equal(t, shortcode.Key, key)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, time.Minute)
+
+		// the token of the msisdn was not taken by the limited request
+		ok, _, err := repo.Take(t.Context(), msisdn.Key, msisdn.Limit)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestRateLimitRepository_RemoveBefore(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	repo := postgres.NewRateLimitRepository(inf.Storage.PG)
+
+	limit := rate.Limit{Rate: 1, Burst: 1}
+	buckets := []postgres.RateLimitBucketSchema{
+		{Key: "client:1", Tokens: 0, UpdatedAt: time.Now().Add(-2 * time.Hour)},
+		{Key: "client:2", Tokens: 0, UpdatedAt: time.Now()},
+	}
+	assert.Nil(t, inf.Storage.PG.Create(&buckets).Error)
+
+	removed, err := repo.RemoveBefore(t.Context(), time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	// a removed bucket is created full
+	ok, _, err := repo.Take(t.Context(), "client:1", limit)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, _, err = repo.Take(t.Context(), "client:2", limit)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
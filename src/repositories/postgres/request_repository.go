@@ -19,15 +19,25 @@ type RequestSchema struct {
 	RequestID  string    `gorm:"column:request_id;unique;check:request_id<>'';"` // business id
 	ExternalID *string   `gorm:"column:external_id;check:external_id<>'';"`
 	Partner    string    `gorm:"column:partner;check:partner<>'';"`
+	Operation  *string   `gorm:"column:operation;check:operation<>'';"`
 	Status     *string   `gorm:"column:status;check:status<>'';"`
 	Latency    int64     `gorm:"column:latency_ms"` // duration in milliseconds
+	Attempt    int       `gorm:"column:attempt"`
+	HTTPStatus *int      `gorm:"column:http_status"`
 	CreatedAt  time.Time `gorm:"column:created_at"`
 	UpdatedAt  time.Time `gorm:"column:updated_at"`
 
-	Response datatypes.JSONMap `gorm:"column:response;type:json"`
+	Response        datatypes.JSONMap `gorm:"column:response;type:json"`
+	RequestBody     datatypes.JSON    `gorm:"column:request_body;type:json"`
+	ResponseHeaders datatypes.JSONMap `gorm:"column:response_headers;type:json"`
+	ResponseBody    *string           `gorm:"column:response_body"`
 
 	// define a belongsTo relationship
 	PaymentID *string `gorm:"column:payment_id"`
+	// merchant of the shortcode the request was made with
+	MerchantID *string `gorm:"column:merchant_id;index"`
+	// id of the api request the partner request was made for
+	OriginRequestID *string `gorm:"column:origin_request_id;index"`
 }
 
 func (RequestSchema) TableName() string {
@@ -50,6 +60,12 @@ func (schema *RequestSchema) BeforeCreate(tx *gorm.DB) (err error) {
 	if sch.PaymentID != nil && *sch.PaymentID == "" {
 		schema.PaymentID = nil
 	}
+	if sch.Operation != nil && *sch.Operation == "" {
+		schema.Operation = nil
+	}
+	if sch.OriginRequestID != nil && *sch.OriginRequestID == "" {
+		schema.OriginRequestID = nil
+	}
 
 	return
 }
@@ -59,6 +75,7 @@ func (schema RequestSchema) ToEntity() requests.Request {
 		RequestID: schema.RequestID,
 		Partner:   schema.Partner,
 		Latency:   time.Duration(schema.Latency) * time.Millisecond,
+		Attempt:   schema.Attempt,
 		CreatedAt: schema.CreatedAt,
 	}
 
@@ -75,13 +92,59 @@ func (schema RequestSchema) ToEntity() requests.Request {
 		request.PaymentID = (*schema.PaymentID)
 	}
 
+	if schema.MerchantID != nil {
+		request.MerchantID = *schema.MerchantID
+	}
+
+	if schema.OriginRequestID != nil {
+		request.OriginRequestID = *schema.OriginRequestID
+	}
+
 	if schema.Response != nil {
 		request.Response = schema.Response
 	}
 
+	if schema.Operation != nil {
+		request.Operation = requests.Operation(*schema.Operation)
+	}
+
+	if schema.HTTPStatus != nil {
+		request.HTTPStatus = *schema.HTTPStatus
+	}
+
+	if len(schema.RequestBody) > 0 {
+		request.RequestBody = schema.RequestBody
+	}
+
+	if schema.ResponseHeaders != nil {
+		request.ResponseHeaders = make(map[string]string, len(schema.ResponseHeaders))
+		for key, value := range schema.ResponseHeaders {
+			if v, ok := value.(string); ok {
+				request.ResponseHeaders[key] = v
+			}
+		}
+	}
+
+	if schema.ResponseBody != nil {
+		request.ResponseBody = *schema.ResponseBody
+	}
+
 	return request
 }
 
+// headers converts response headers to a json map, nil if there are no headers
+func headers(values map[string]string) datatypes.JSONMap {
+	if values == nil {
+		return nil
+	}
+
+	m := make(datatypes.JSONMap, len(values))
+	for key, value := range values {
+		m[key] = value
+	}
+	return m
+}
+
 func NewRequestRepository(db *gorm.DB) RequestRepository {
 	return RequestRepository{db}
 }
@@ -98,10 +161,18 @@ func (repository RequestRepository) Add(ctx context.Context, req requests.Reques
 		RequestID:  req.RequestID,
 		ExternalID: &req.ExternalID,
 		Partner:    req.Partner,
+		Operation:  types.Pointer(req.Operation.String()),
 		Status:     types.Pointer(req.Status.String()),
 		Latency:    req.Latency.Milliseconds(),
+		Attempt:    req.Attempt,
 		Response:   req.Response,
 		PaymentID:  &req.PaymentID,
+		MerchantID: nullable(req.MerchantID),
+
+		OriginRequestID: &req.OriginRequestID,
+	}
+	if len(req.RequestBody) > 0 {
+		record.RequestBody = req.RequestBody
 	}
 
 	result := repository.db.WithContext(ctx).Model(RequestSchema{}).Create(&record)
@@ -133,6 +204,7 @@ func (repository RequestRepository) FindOne(ctx context.Context, opts requests.O
 
 	var record RequestSchema
 	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, RequestSchema{}.TableName())).
 		Where(where).
 		Take(&record).
 		Order("created_at desc")
@@ -146,6 +218,40 @@ func (repository RequestRepository) FindOne(ctx context.Context, opts requests.O
 
 }
 
+// FindMany returns the requests of a payment ordered by "created_at" ascending
+func (repository RequestRepository) FindMany(ctx context.Context, opts requests.OptionsFindRequest) ([]requests.Request, error) {
+	l := zerolog.Ctx(ctx)
+	l.Info().Any(logger.LData, opts).Msg("find api requests")
+
+	query := repository.db.WithContext(ctx).
+		Model(RequestSchema{}).
+		Scopes(tenant(ctx, RequestSchema{}.TableName()))
+	if opts.RequestID != nil {
+		query = query.Where("request_id = ?", *opts.RequestID)
+	}
+	if opts.ExternalID != nil {
+		query = query.Where("external_id = ?", *opts.ExternalID)
+	}
+	if opts.PaymentID != nil {
+		query = query.Where("payment_id = ?", *opts.PaymentID)
+	}
+
+	var records []RequestSchema
+	result := query.Order("created_at ASC").Find(&records)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding records")
+		return []requests.Request{}, Error{Err: err}
+	}
+	l.Info().Int("count", len(records)).Msg("records found")
+
+	values := make([]requests.Request, 0, len(records))
+	for _, record := range records {
+		values = append(values, record.ToEntity())
+	}
+
+	return values, nil
+}
+
 func (repository RequestRepository) UpdateRequest(ctx context.Context, id string, opts requests.OptionsUpdateRequest) error {
 	l := zerolog.Ctx(ctx)
 	l.Info().Msg("updating api request")
@@ -163,9 +269,22 @@ func (repository RequestRepository) UpdateRequest(ctx context.Context, id string
 	if opts.Latency != nil {
 		values.Latency = opts.Latency.Milliseconds()
 	}
+	if opts.Attempt != nil {
+		values.Attempt = *opts.Attempt
+	}
+	if opts.HTTPStatus != nil {
+		values.HTTPStatus = opts.HTTPStatus
+	}
+	if opts.ResponseHeaders != nil {
+		values.ResponseHeaders = headers(opts.ResponseHeaders)
+	}
+	if opts.ResponseBody != nil {
+		values.ResponseBody = opts.ResponseBody
+	}
 
 	// when using a struct to update, gorm will ignore zero values
 	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, RequestSchema{}.TableName())).
 		Where(RequestSchema{RequestID: id}).
 		Updates(values)
 
@@ -12,6 +12,7 @@ import (
 
 	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
 	"github.com/SirWaithaka/payments-api/pkg/types"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 	"github.com/SirWaithaka/payments-api/testdata"
@@ -114,12 +115,13 @@ func TestRequestRepository_FindOne(t *testing.T) {
 		defer testdata.ResetTables(inf)
 
 		apiRequest := requests.Request{
-			RequestID:  ulid.Make().String(),
-			ExternalID: ulid.Make().String(),
-			Partner:    "fake_partner",
-			Status:     "received",
-			Latency:    1000,
-			Response:   nil,
+			RequestID:       ulid.Make().String(),
+			ExternalID:      ulid.Make().String(),
+			OriginRequestID: ulid.Make().String(),
+			Partner:         "fake_partner",
+			Status:          "received",
+			Latency:         1000,
+			Response:        nil,
 		}
 		err := repo.Add(ctx, apiRequest)
 		if err != nil {
@@ -133,6 +135,7 @@ func TestRequestRepository_FindOne(t *testing.T) {
 
 		assert.Equal(t, apiRequest.RequestID, req.RequestID)
 		assert.Equal(t, apiRequest.ExternalID, req.ExternalID)
+		assert.Equal(t, apiRequest.OriginRequestID, req.OriginRequestID)
 
 	})
 
@@ -230,6 +233,16 @@ func TestRequestRepository_UpdateRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "test exchange provided",
+			input: requests.OptionsUpdateRequest{
+				Status:          types.Pointer(requests.StatusFailed),
+				Attempt:         types.Pointer(2),
+				HTTPStatus:      types.Pointer(400),
+				ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+				ResponseBody:    types.Pointer(`{"errorCode":"400.002.02"}`),
+			},
+		},
 	}
 
 	for _, tc := range testcases {
@@ -266,9 +279,91 @@ func TestRequestRepository_UpdateRequest(t *testing.T) {
 			}
 			assert.Equal(t, tc.input.ExternalID, record.ExternalID)
 			assert.Equal(t, tc.input.Response, record.ToEntity().Response)
+			assert.Equal(t, tc.input.HTTPStatus, record.HTTPStatus)
+			assert.Equal(t, tc.input.ResponseBody, record.ResponseBody)
+			assert.Equal(t, tc.input.ResponseHeaders, record.ToEntity().ResponseHeaders)
+			if tc.input.Attempt != nil {
+				assert.Equal(t, *tc.input.Attempt, record.Attempt)
+			}
+
+		})
+
+	}
+
+}
+
+func TestRequestRepository_FindMany(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	ctx := context.Background()
+
+	repo := postgres.NewRequestRepository(inf.Storage.PG)
 
+	// save requests of 2 payments
+	paymentID := ulid.Make().String()
+	operations := []requests.Operation{requests.OperationC2B, requests.OperationStatus}
+	for _, operation := range operations {
+		err := repo.Add(ctx, requests.Request{
+			RequestID:   ulid.Make().String(),
+			PaymentID:   paymentID,
+			Partner:     "daraja",
+			Operation:   operation,
+			Status:      requests.StatusReceived,
+			Attempt:     1,
+			RequestBody: []byte(`{"Password":"[REDACTED]"}`),
 		})
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+	}
+	err := repo.Add(ctx, requests.Request{RequestID: ulid.Make().String(), PaymentID: ulid.Make().String(), Partner: "daraja"})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
 
+	values, err := repo.FindMany(ctx, requests.OptionsFindRequest{PaymentID: &paymentID})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
 	}
 
+	// requests are ordered by the time they were made
+	if assert.Len(t, values, 2) {
+		for i, value := range values {
+			assert.Equal(t, operations[i], value.Operation)
+			assert.Equal(t, paymentID, value.PaymentID)
+			assert.Equal(t, 1, value.Attempt)
+			assert.JSONEq(t, `{"Password":"[REDACTED]"}`, string(value.RequestBody))
+		}
+	}
+}
+
+func TestRequestRepository_Tenant(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	ctx := context.Background()
+
+	repo := postgres.NewRequestRepository(inf.Storage.PG)
+
+	paymentID := ulid.Make().String()
+	request := requests.Request{RequestID: ulid.Make().String(), PaymentID: paymentID, MerchantID: "merchant-a", Partner: "daraja"}
+	if err := repo.Add(ctx, request); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	found, err := repo.FindOne(merchants.WithMerchant(ctx, "merchant-a"), requests.OptionsFindRequest{RequestID: &request.RequestID})
+	assert.Nil(t, err)
+	assert.Equal(t, "merchant-a", found.MerchantID)
+
+	// requests of other merchants are not found
+	_, err = repo.FindOne(merchants.WithMerchant(ctx, "merchant-b"), requests.OptionsFindRequest{RequestID: &request.RequestID})
+	var nf pkgerrors.NotFounder
+	if !assert.ErrorAs(t, err, &nf) || !nf.NotFound() {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	values, err := repo.FindMany(merchants.WithMerchant(ctx, "merchant-b"), requests.OptionsFindRequest{PaymentID: &paymentID})
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+
+	values, err = repo.FindMany(ctx, requests.OptionsFindRequest{PaymentID: &paymentID})
+	assert.Nil(t, err)
+	assert.Len(t, values, 1)
 }
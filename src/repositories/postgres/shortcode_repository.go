@@ -9,26 +9,37 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/types"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 )
 
 type ShortCodeSchema struct {
 	ShortCodeID       string  `gorm:"column:id;primaryKey;"`
+	MerchantID        *string `gorm:"column:merchant_id;index;uniqueIndex:unique_merchant_priority_type,where:deleted_at IS NULL"`
 	Environment       string  `gorm:"column:environment;check:environment<>'';not null"`
-	Priority          uint    `gorm:"column:priority;check:priority>0;default:1;uniqueIndex:unique_priority_type"`
-	Service           string  `gorm:"column:service;check:service<>'';not null;uniqueIndex:unique_service_shortcode_type"`
-	Type              string  `gorm:"column:type;check:type<>'';not null;uniqueIndex:unique_priority_type;uniqueIndex:unique_service_shortcode_type"`
-	ShortCode         string  `gorm:"column:shortcode;check:shortcode<>'';not null;uniqueIndex:unique_service_shortcode_type"`
+	Priority          uint    `gorm:"column:priority;check:priority>0;default:1;uniqueIndex:unique_merchant_priority_type,where:deleted_at IS NULL"`
+	Service           string  `gorm:"column:service;check:service<>'';not null;uniqueIndex:unique_service_shortcode_type,where:deleted_at IS NULL"`
+	Type              string  `gorm:"column:type;check:type<>'';not null;uniqueIndex:unique_merchant_priority_type,where:deleted_at IS NULL;uniqueIndex:unique_service_shortcode_type,where:deleted_at IS NULL"`
+	ShortCode         string  `gorm:"column:shortcode;check:shortcode<>'';not null;uniqueIndex:unique_service_shortcode_type,where:deleted_at IS NULL"`
 	InitiatorName     *string `gorm:"column:initiator_name;"`
 	InitiatorPassword *string `gorm:"column:initiator_password;"`
 	Passphrase        *string `gorm:"column:passphrase;"`
-	Key               string  `gorm:"column:key;check:key<>'';not null"`
+	Key               string  `gorm:"column:key;check:key<>'';not null" log:"secret"`
 	Secret            string  `gorm:"column:secret;check:secret<>'';not null"`
-	CallbackURL       *string `gorm:"column:callback_url;"`
-
-	CreatedAt time.Time `gorm:"column:created_at;type:timestamp;"`
-	UpdatedAt time.Time `gorm:"column:updated_at;type:timestamp;"`
+	// credentials encryption, nil if the credentials are stored in plaintext
+	KeyID         *string `gorm:"column:key_id;"`
+	DataKey       *string `gorm:"column:data_key;"`
+	KeyHash       *string `gorm:"column:key_hash;index"`
+	CallbackURL   *string `gorm:"column:callback_url;"`
+	CallbackToken *string `gorm:"column:callback_token;uniqueIndex"`
+	// time the shortcode was first issued a callback token
+	CallbackTokenIssuedAt *time.Time `gorm:"column:callback_token_issued_at;type:timestamp;"`
+	Disabled              bool       `gorm:"column:disabled;not null;default:false"`
+
+	CreatedAt time.Time      `gorm:"column:created_at;type:timestamp;"`
+	UpdatedAt time.Time      `gorm:"column:updated_at;type:timestamp;"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;type:timestamp;index"`
 }
 
 func (ShortCodeSchema) TableName() string {
@@ -45,6 +56,7 @@ func (schema ShortCodeSchema) ToEntity() mpesa.ShortCode {
 		Type:        mpesa.ToPaymentType(schema.Type),
 		Key:         schema.Key,
 		Secret:      schema.Secret,
+		Disabled:    schema.Disabled,
 	}
 
 	// check if pointer values are nil
@@ -60,6 +72,27 @@ func (schema ShortCodeSchema) ToEntity() mpesa.ShortCode {
 	if schema.CallbackURL != nil {
 		shortcode.CallbackURL = *schema.CallbackURL
 	}
+	if schema.CallbackToken != nil {
+		shortcode.CallbackToken = *schema.CallbackToken
+	}
+	if schema.CallbackTokenIssuedAt != nil {
+		shortcode.CallbackTokenIssuedAt = *schema.CallbackTokenIssuedAt
+	}
+	if schema.MerchantID != nil {
+		shortcode.MerchantID = *schema.MerchantID
+	}
+	if schema.KeyID != nil {
+		shortcode.KeyID = *schema.KeyID
+	}
+	if schema.DataKey != nil {
+		shortcode.DataKey = *schema.DataKey
+	}
+	if schema.KeyHash != nil {
+		shortcode.KeyHash = *schema.KeyHash
+	}
+	if schema.DeletedAt.Valid {
+		shortcode.DeletedAt = schema.DeletedAt.Time
+	}
 
 	return shortcode
 }
@@ -84,6 +117,19 @@ func (schema *ShortCodeSchema) BeforeCreate(tx *gorm.DB) (err error) {
 	if sch.CallbackURL != nil && *sch.CallbackURL == "" {
 		schema.CallbackURL = nil
 	}
+	if sch.CallbackToken != nil && *sch.CallbackToken == "" {
+		schema.CallbackToken = nil
+	}
+	// the token is issued when the shortcode is created with one
+	if schema.CallbackToken != nil && schema.CallbackTokenIssuedAt == nil {
+		schema.CallbackTokenIssuedAt = types.Pointer(time.Now())
+	}
+	if sch.KeyID != nil && *sch.KeyID == "" {
+		schema.KeyID = nil
+	}
+	if sch.DataKey != nil && *sch.DataKey == "" {
+		schema.DataKey = nil
+	}
 
 	return
 }
@@ -95,6 +141,9 @@ func (schema *ShortCodeSchema) FindOptions(opts mpesa.OptionsFindShortCodes) {
 	if opts.ShortCodeID != nil {
 		schema.ShortCodeID = *opts.ShortCodeID
 	}
+	if opts.MerchantID != nil {
+		schema.MerchantID = opts.MerchantID
+	}
 	if opts.Service != nil {
 		schema.Service = opts.Service.String()
 	}
@@ -104,6 +153,14 @@ func (schema *ShortCodeSchema) FindOptions(opts mpesa.OptionsFindShortCodes) {
 	if opts.ShortCode != nil {
 		schema.ShortCode = *opts.ShortCode
 	}
+	if opts.Key != nil {
+		// keys are encrypted, find by the hash of the key
+		hash := mpesa.HashKey(*opts.Key)
+		schema.KeyHash = &hash
+	}
+	if opts.CallbackToken != nil {
+		schema.CallbackToken = opts.CallbackToken
+	}
 }
 
 func NewShortCodeRepository(db *gorm.DB) ShortCodeRepository {
@@ -116,10 +173,12 @@ type ShortCodeRepository struct {
 
 func (repository ShortCodeRepository) Add(ctx context.Context, shortcode mpesa.ShortCode) error {
 	l := zerolog.Ctx(ctx)
-	l.Debug().Any(logger.LData, shortcode).Msg("saving shortcode")
+	// the shortcode is not logged, it has the partner credentials
+	l.Debug().Str("shortcode", shortcode.ShortCode).Msg("saving shortcode")
 
 	record := ShortCodeSchema{
 		ShortCodeID:       shortcode.ShortCodeID,
+		MerchantID:        nullable(shortcode.MerchantID),
 		Environment:       shortcode.Environment,
 		Priority:          shortcode.Priority,
 		Service:           shortcode.Service.String(),
@@ -131,6 +190,17 @@ func (repository ShortCodeRepository) Add(ctx context.Context, shortcode mpesa.S
 		Key:               shortcode.Key,
 		Secret:            shortcode.Secret,
 		CallbackURL:       &shortcode.CallbackURL,
+		CallbackToken:     &shortcode.CallbackToken,
+		Disabled:          shortcode.Disabled,
+		KeyID:             &shortcode.KeyID,
+		DataKey:           &shortcode.DataKey,
+		KeyHash:           &shortcode.KeyHash,
+	}
+
+	// plaintext keys are found by their hash
+	if shortcode.KeyHash == "" && shortcode.KeyID == "" {
+		hash := mpesa.HashKey(shortcode.Key)
+		record.KeyHash = &hash
 	}
 
 	// if priority is not set, set it to 1
@@ -157,18 +227,13 @@ func (repository ShortCodeRepository) FindOne(ctx context.Context, opts mpesa.Op
 	l := zerolog.Ctx(ctx)
 	l.Info().Any(logger.LData, opts).Msg("find shortcode by id")
 
-	// build find options
-	where := ShortCodeSchema{}
-	where.FindOptions(opts)
-	l.Info().Any(logger.LData, where).Msg("query params")
-
 	var record ShortCodeSchema
-	result := repository.db.WithContext(ctx).Where(where).First(&record)
+	result := repository.find(ctx, opts).First(&record)
 	if err := result.Error; err != nil {
 		l.Error().Err(err).Msg("error finding record")
 		return mpesa.ShortCode{}, Error{Err: err}
 	}
-	l.Info().Any(logger.LData, record).Msg("record found")
+	l.Info().Str("id", record.ShortCodeID).Msg("record found")
 
 	return record.ToEntity(), nil
 }
@@ -177,18 +242,13 @@ func (repository ShortCodeRepository) FindMany(ctx context.Context, opts mpesa.O
 	l := zerolog.Ctx(ctx)
 	l.Info().Msg("find shortcodes")
 
-	// build find options
-	where := ShortCodeSchema{}
-	where.FindOptions(opts)
-	l.Info().Any(logger.LData, where).Msg("query params")
-
 	var records []ShortCodeSchema
-	result := repository.db.WithContext(ctx).Where(where).Find(&records)
+	result := repository.find(ctx, opts).Find(&records)
 	if err := result.Error; err != nil {
 		l.Error().Err(err).Msg("error finding records")
 		return []mpesa.ShortCode{}, Error{Err: err}
 	}
-	l.Info().Any(logger.LData, records).Msg("records found")
+	l.Info().Int("count", len(records)).Msg("records found")
 
 	var shortcodes []mpesa.ShortCode
 	for _, record := range records {
@@ -197,3 +257,132 @@ func (repository ShortCodeRepository) FindMany(ctx context.Context, opts mpesa.O
 
 	return shortcodes, nil
 }
+
+// find builds the query for the find options
+func (repository ShortCodeRepository) find(ctx context.Context, opts mpesa.OptionsFindShortCodes) *gorm.DB {
+	l := zerolog.Ctx(ctx)
+
+	// build find options
+	where := ShortCodeSchema{}
+	where.FindOptions(opts)
+	l.Info().Any(logger.LData, where).Msg("query params")
+
+	query := repository.db.WithContext(ctx).Scopes(tenant(ctx, ShortCodeSchema{}.TableName())).Where(where)
+	if opts.WithDeleted {
+		// a shortcode added again after it was deleted has the same key
+		query = query.Unscoped().Order("deleted_at DESC NULLS FIRST")
+	}
+	// false is a zero value and is ignored in the where struct
+	if opts.Disabled != nil {
+		query = query.Where("disabled = ?", *opts.Disabled)
+	}
+
+	return query
+}
+
+func (repository ShortCodeRepository) Update(ctx context.Context, id string, opts mpesa.OptionsUpdateShortCode) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", id).Msg("updating shortcode")
+
+	// use a map, the disabled column can be updated to false
+	values := make(map[string]any)
+	if opts.Environment != nil {
+		values["environment"] = *opts.Environment
+	}
+	if opts.Priority != nil {
+		values["priority"] = *opts.Priority
+	}
+	if opts.CallbackURL != nil {
+		values["callback_url"] = nullable(*opts.CallbackURL)
+	}
+	if opts.Disabled != nil {
+		values["disabled"] = *opts.Disabled
+	}
+	if opts.CallbackToken != nil {
+		values["callback_token"] = nullable(*opts.CallbackToken)
+		// rotating the token keeps the time the first token was issued
+		values["callback_token_issued_at"] = gorm.Expr("COALESCE(callback_token_issued_at, ?)", time.Now())
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	result := repository.db.WithContext(ctx).
+		Model(&ShortCodeSchema{}).
+		Scopes(tenant(ctx, ShortCodeSchema{}.TableName())).
+		Where("id = ?", id).
+		Updates(values)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error updating record")
+		return Error{Err: err}
+	}
+	if result.RowsAffected == 0 {
+		return Error{Err: ErrNotFound}
+	}
+	l.Info().Msg("record updated")
+
+	return nil
+}
+
+func (repository ShortCodeRepository) UpdateCredentials(ctx context.Context, shortcode mpesa.ShortCode) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", shortcode.ShortCodeID).Msg("updating shortcode credentials")
+
+	values := map[string]any{
+		"initiator_name":     nullable(shortcode.InitiatorName),
+		"initiator_password": nullable(shortcode.InitiatorPassword),
+		"passphrase":         nullable(shortcode.Passphrase),
+		"key":                shortcode.Key,
+		"secret":             shortcode.Secret,
+		"key_id":             nullable(shortcode.KeyID),
+		"data_key":           nullable(shortcode.DataKey),
+		"key_hash":           nullable(shortcode.KeyHash),
+	}
+
+	// credentials of deleted shortcodes are re-encrypted too
+	result := repository.db.WithContext(ctx).
+		Unscoped().
+		Model(&ShortCodeSchema{}).
+		Scopes(tenant(ctx, ShortCodeSchema{}.TableName())).
+		Where("id = ?", shortcode.ShortCodeID).
+		Updates(values)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error updating record")
+		return Error{Err: err}
+	}
+	if result.RowsAffected == 0 {
+		return Error{Err: ErrNotFound}
+	}
+	l.Info().Msg("record updated")
+
+	return nil
+}
+
+func (repository ShortCodeRepository) Delete(ctx context.Context, id string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str("id", id).Msg("deleting shortcode")
+
+	result := repository.db.WithContext(ctx).
+		Scopes(tenant(ctx, ShortCodeSchema{}.TableName())).
+		Where("id = ?", id).
+		Delete(&ShortCodeSchema{})
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error deleting record")
+		return Error{Err: err}
+	}
+	if result.RowsAffected == 0 {
+		return Error{Err: ErrNotFound}
+	}
+	l.Info().Msg("record deleted")
+
+	return nil
+}
+
+// nullable returns nil for empty strings, nullable columns should be nil instead of zero values
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
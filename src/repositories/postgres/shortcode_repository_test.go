@@ -4,11 +4,13 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 
 	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/pkg/types"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
@@ -47,6 +49,8 @@ func TestShortCodeRepository_Add(t *testing.T) {
 			t.Errorf("expected nil error, got %v", err)
 		}
 
+		// the hash of plaintext keys is saved
+		shortcode.KeyHash = mpesa.HashKey(shortcode.Key)
 		assert.Equal(t, shortcode, record.ToEntity())
 	})
 
@@ -189,8 +193,10 @@ func TestShortCodeRepository_Add(t *testing.T) {
 	t.Run("test that 2 records with the same priority and type wont be saved", func(t *testing.T) {
 		defer testdata.ResetTables(inf)
 
+		merchantID := uuid.Must(uuid.NewV7()).String()
 		shortcode1 := mpesa.ShortCode{
 			ShortCodeID: ulid.Make().String(),
+			MerchantID:  merchantID,
 			ShortCode:   "000000",
 			Environment: "sandbox",
 			Priority:    1,
@@ -201,6 +207,7 @@ func TestShortCodeRepository_Add(t *testing.T) {
 		}
 		shortcode2 := mpesa.ShortCode{
 			ShortCodeID: ulid.Make().String(),
+			MerchantID:  merchantID,
 			ShortCode:   "000001",
 			Environment: "sandbox",
 			Priority:    1,
@@ -225,6 +232,11 @@ func TestShortCodeRepository_Add(t *testing.T) {
 			t.Errorf("expected duplicate error, got %T %v", err, err)
 		}
 
+		// priorities are unique per merchant
+		shortcode2.MerchantID = uuid.Must(uuid.NewV7()).String()
+		if err = repo.Add(t.Context(), shortcode2); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
 	})
 }
 
@@ -259,7 +271,215 @@ func TestShortCodeRepository_FindOne(t *testing.T) {
 			t.Errorf("expected nil error, got %v", err)
 		}
 
+		shortcode.KeyHash = mpesa.HashKey(shortcode.Key)
 		assert.Equal(t, shortcode, result)
 	})
 
 }
+
+func TestShortCodeRepository_FindMany(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	repo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	enabled := mpesa.ShortCode{
+		ShortCodeID: ulid.Make().String(),
+		ShortCode:   "000000",
+		Environment: "sandbox",
+		Priority:    1,
+		Service:     requests.PartnerDaraja,
+		Type:        mpesa.PaymentTypePayout,
+		Key:         "fake_key",
+		Secret:      "fake_secret",
+	}
+	disabled := enabled
+	disabled.ShortCodeID = ulid.Make().String()
+	disabled.ShortCode = "000001"
+	disabled.Priority = 2
+	disabled.Disabled = true
+
+	for _, shortcode := range []mpesa.ShortCode{enabled, disabled} {
+		if err := repo.Add(t.Context(), shortcode); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+
+	shortcodes, err := repo.FindMany(t.Context(), mpesa.OptionsFindShortCodes{})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Len(t, shortcodes, 2)
+
+	shortcodes, err = repo.FindMany(t.Context(), mpesa.OptionsFindShortCodes{Disabled: types.Pointer(false)})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if assert.Len(t, shortcodes, 1) {
+		assert.Equal(t, enabled.ShortCodeID, shortcodes[0].ShortCodeID)
+	}
+
+	shortcodes, err = repo.FindMany(t.Context(), mpesa.OptionsFindShortCodes{Disabled: types.Pointer(true)})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if assert.Len(t, shortcodes, 1) {
+		assert.Equal(t, disabled.ShortCodeID, shortcodes[0].ShortCodeID)
+	}
+}
+
+func TestShortCodeRepository_Update(t *testing.T) {
+	repo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	t.Run("test that it updates record", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		shortcode := mpesa.ShortCode{
+			ShortCodeID:   ulid.Make().String(),
+			ShortCode:     "000000",
+			Environment:   "sandbox",
+			Priority:      1,
+			Service:       requests.PartnerDaraja,
+			Type:          mpesa.PaymentTypePayout,
+			Key:           "fake_key",
+			Secret:        "fake_secret",
+			CallbackURL:   "fake_url",
+			CallbackToken: "fake_token",
+			Disabled:      true,
+		}
+		if err := repo.Add(t.Context(), shortcode); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		err := repo.Update(t.Context(), shortcode.ShortCodeID, mpesa.OptionsUpdateShortCode{
+			Environment: types.Pointer("production"),
+			Priority:    types.Pointer(uint(2)),
+			CallbackURL: types.Pointer(""),
+			Disabled:    types.Pointer(false),
+		})
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		record := postgres.ShortCodeSchema{}
+		result := inf.Storage.PG.First(&record)
+		if err = result.Error; err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		assert.Equal(t, "production", record.Environment)
+		assert.Equal(t, uint(2), record.Priority)
+		assert.Nil(t, record.CallbackURL)
+		assert.False(t, record.Disabled)
+		// values not in the options are not updated
+		assert.Equal(t, "fake_key", record.Key)
+		assert.Equal(t, "fake_token", *record.CallbackToken)
+	})
+
+	t.Run("test that it returns not found error", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		err := repo.Update(t.Context(), ulid.Make().String(), mpesa.OptionsUpdateShortCode{Disabled: types.Pointer(true)})
+		if e, ok := err.(pkgerrors.NotFounder); !ok || !e.NotFound() {
+			t.Errorf("expected not found error, got %T %v", err, err)
+		}
+	})
+}
+
+func TestShortCodeRepository_UpdateCredentials(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	repo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	shortcode := mpesa.ShortCode{
+		ShortCodeID: ulid.Make().String(),
+		ShortCode:   "000000",
+		Environment: "sandbox",
+		Priority:    1,
+		Service:     requests.PartnerQuikk,
+		Type:        mpesa.PaymentTypePayout,
+		Key:         "fake_key",
+		Secret:      "fake_secret",
+	}
+	if err := repo.Add(t.Context(), shortcode); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	// plaintext shortcodes are found by key
+	found, err := repo.FindOne(t.Context(), mpesa.OptionsFindShortCodes{Key: &shortcode.Key})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, mpesa.HashKey("fake_key"), found.KeyHash)
+
+	// credentials of deleted shortcodes are updated too
+	if err = repo.Delete(t.Context(), shortcode.ShortCodeID); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	shortcode.Key = "encrypted_key"
+	shortcode.Secret = "encrypted_secret"
+	shortcode.KeyID = "k1"
+	shortcode.DataKey = "data_key"
+	shortcode.KeyHash = mpesa.HashKey("fake_key")
+	if err = repo.UpdateCredentials(t.Context(), shortcode); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	found, err = repo.FindOne(t.Context(), mpesa.OptionsFindShortCodes{Key: types.Pointer("fake_key"), WithDeleted: true})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, "encrypted_key", found.Key)
+	assert.Equal(t, "encrypted_secret", found.Secret)
+	assert.Equal(t, "k1", found.KeyID)
+	assert.Equal(t, "data_key", found.DataKey)
+}
+
+func TestShortCodeRepository_Delete(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	repo := postgres.NewShortCodeRepository(inf.Storage.PG)
+
+	shortcode := mpesa.ShortCode{
+		ShortCodeID: ulid.Make().String(),
+		ShortCode:   "000000",
+		Environment: "sandbox",
+		Priority:    1,
+		Service:     requests.PartnerDaraja,
+		Type:        mpesa.PaymentTypePayout,
+		Key:         "fake_key",
+		Secret:      "fake_secret",
+	}
+	if err := repo.Add(t.Context(), shortcode); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	err := repo.Delete(t.Context(), shortcode.ShortCodeID)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	// deleted shortcodes are not found
+	_, err = repo.FindOne(t.Context(), mpesa.OptionsFindShortCodes{ShortCodeID: &shortcode.ShortCodeID})
+	if e, ok := err.(pkgerrors.NotFounder); !ok || !e.NotFound() {
+		t.Errorf("expected not found error, got %T %v", err, err)
+	}
+
+	// deleted shortcodes are found with the time they were deleted
+	found, err := repo.FindOne(t.Context(), mpesa.OptionsFindShortCodes{ShortCodeID: &shortcode.ShortCodeID, WithDeleted: true})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.False(t, found.DeletedAt.IsZero())
+
+	// the same shortcode can be added again
+	shortcode.ShortCodeID = ulid.Make().String()
+	if err = repo.Add(t.Context(), shortcode); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	// the shortcode that is not deleted is found first
+	found, err = repo.FindOne(t.Context(), mpesa.OptionsFindShortCodes{Key: types.Pointer("fake_key"), WithDeleted: true})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	assert.Equal(t, shortcode.ShortCodeID, found.ShortCodeID)
+	assert.True(t, found.DeletedAt.IsZero())
+}
@@ -11,14 +11,26 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/src/domains/merchants"
 	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
 )
 
 type WebhookRequestSchema struct {
-	ID      string         `gorm:"column:id; primaryKey; type:UUID;"`
-	Action  string         `gorm:"column:action"`
-	Partner string         `gorm:"column:partner"`
-	Payload datatypes.JSON `gorm:"column:payload; type:JSONB"`
+	ID          string         `gorm:"column:id; primaryKey; type:UUID;"`
+	Action      string         `gorm:"column:action"`
+	Partner     string         `gorm:"column:partner;uniqueIndex:unique_webhook_partner_natural_key,where:rejection_reason IS NULL"`
+	Payload     datatypes.JSON `gorm:"column:payload; type:JSONB"`
+	ContentHash *string        `gorm:"column:content_hash"`
+	NaturalKey  *string        `gorm:"column:natural_key;uniqueIndex:unique_webhook_partner_natural_key,where:rejection_reason IS NULL"`
+	// number of duplicates received after the webhook was saved
+	DuplicateCount  int        `gorm:"column:duplicate_count;not null;default:0"`
+	LastDuplicateAt *time.Time `gorm:"column:last_duplicate_at"`
+	// reason the webhook failed authentication, nil for accepted webhooks
+	RejectionReason *string `gorm:"column:rejection_reason"`
+	// merchant of the shortcode the webhook was authenticated with
+	MerchantID *string `gorm:"column:merchant_id;index"`
+	// time the event of the webhook was published, nil until it is published
+	PublishedAt *time.Time `gorm:"column:published_at"`
 
 	CreatedAt time.Time `gorm:"column:created_at"`
 }
@@ -28,15 +40,44 @@ func (WebhookRequestSchema) TableName() string {
 }
 
 func (schema WebhookRequestSchema) ToEntity() webhooks.WebhookRequest {
-	return webhooks.WebhookRequest{
-		ID:        schema.ID,
-		Action:    schema.Action,
-		Partner:   schema.Partner,
-		Payload:   bytes.NewReader(schema.Payload),
-		CreatedAt: schema.CreatedAt,
+	webhook := webhooks.WebhookRequest{
+		ID:             schema.ID,
+		Action:         schema.Action,
+		Partner:        schema.Partner,
+		Payload:        bytes.NewReader(schema.Payload),
+		DuplicateCount: schema.DuplicateCount,
+		CreatedAt:      schema.CreatedAt,
 	}
+
+	if schema.ContentHash != nil {
+		webhook.ContentHash = *schema.ContentHash
+	}
+	if schema.NaturalKey != nil {
+		webhook.NaturalKey = *schema.NaturalKey
+	}
+	if schema.RejectionReason != nil {
+		webhook.RejectionReason = *schema.RejectionReason
+	}
+	if schema.MerchantID != nil {
+		webhook.MerchantID = *schema.MerchantID
+	}
+	if schema.PublishedAt != nil {
+		webhook.PublishedAt = *schema.PublishedAt
+	}
+
+	return webhook
 }
 
+// countDuplicateWebhook counts a duplicate on the webhook that was saved first and returns it
+const countDuplicateWebhook = `
+UPDATE webhook_requests
+SET duplicate_count   = duplicate_count + 1,
+    last_duplicate_at = now()
+WHERE partner = @partner
+  AND natural_key = @natural_key
+  AND rejection_reason IS NULL
+RETURNING *`
+
 func NewWebhookRepository(db *gorm.DB) WebhookRepository {
 	return WebhookRepository{db}
 }
@@ -45,20 +86,111 @@ type WebhookRepository struct {
 	db *gorm.DB
 }
 
-func (repo WebhookRepository) Add(ctx context.Context, partner, action string, payload []byte) error {
+func (repo WebhookRepository) Add(ctx context.Context, partner, action string, payload []byte, naturalKey string) (webhooks.WebhookRequest, error) {
 	l := zerolog.Ctx(ctx)
 	l.Debug().Msg("saving webhook request ...")
 
+	record := newWebhookRequestSchema(partner, action, payload)
+	if naturalKey != "" {
+		record.NaturalKey = &naturalKey
+	}
+	if merchantID, ok := merchants.FromContext(ctx); ok {
+		record.MerchantID = &merchantID
+	}
+
+	err := repo.create(ctx, record)
+	if e, ok := err.(Error); !ok || !e.Duplicate() {
+		return record.ToEntity(), err
+	}
+
+	// count the duplicate on the webhook that was saved first
+	var records []WebhookRequestSchema
+	result := repo.db.WithContext(ctx).
+		Raw(countDuplicateWebhook, map[string]any{"partner": partner, "natural_key": naturalKey}).
+		Scan(&records)
+	if result.Error != nil {
+		l.Error().Err(result.Error).Msg("error updating duplicate count")
+		return webhooks.WebhookRequest{}, Error{Err: result.Error}
+	}
+	if len(records) == 0 {
+		return webhooks.WebhookRequest{}, Error{Err: gorm.ErrRecordNotFound}
+	}
+	l.Debug().Msg("duplicate webhook counted")
+
+	return records[0].ToEntity(), err
+}
+
+// MarkPublished records that the event of the webhook was published
+func (repo WebhookRepository) MarkPublished(ctx context.Context, id string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Str(logger.LData, id).Msg("marking webhook request published")
+
+	result := repo.db.WithContext(ctx).
+		Model(WebhookRequestSchema{}).
+		Where("id = ? AND published_at IS NULL", id).
+		Update("published_at", time.Now())
+	if result.Error != nil {
+		l.Error().Err(result.Error).Msg("error updating record")
+		return Error{Err: result.Error}
+	}
+
+	return nil
+}
+
+// FindUnpublished returns accepted webhooks received before the given time whose event was
+// not published, oldest first
+func (repo WebhookRepository) FindUnpublished(ctx context.Context, before time.Time, limit int) ([]webhooks.WebhookRequest, error) {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msgf("find webhook requests not published before %s", before)
+
+	var records []WebhookRequestSchema
+	result := repo.db.WithContext(ctx).
+		Where("published_at IS NULL AND rejection_reason IS NULL AND created_at < ?", before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&records)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding records")
+		return []webhooks.WebhookRequest{}, Error{Err: err}
+	}
+
+	webhookRequests := make([]webhooks.WebhookRequest, 0, len(records))
+	for _, record := range records {
+		webhookRequests = append(webhookRequests, record.ToEntity())
+	}
+
+	return webhookRequests, nil
+}
+
+// Reject saves a webhook request that failed authentication together with the reason
+func (repo WebhookRepository) Reject(ctx context.Context, partner, action string, payload []byte, reason string) error {
+	l := zerolog.Ctx(ctx)
+	l.Debug().Msg("saving rejected webhook request ...")
+
+	record := newWebhookRequestSchema(partner, action, payload)
+	record.RejectionReason = &reason
+
+	return repo.create(ctx, record)
+}
+
+func newWebhookRequestSchema(partner, action string, payload []byte) WebhookRequestSchema {
 	// copy payload
 	buf := make([]byte, len(payload))
 	copy(buf, payload)
 
-	record := WebhookRequestSchema{
-		ID:      uuid.Must(uuid.NewV7()).String(),
-		Action:  action,
-		Partner: partner,
-		Payload: buf,
+	hash := webhooks.ContentHash(buf)
+
+	return WebhookRequestSchema{
+		ID:          uuid.Must(uuid.NewV7()).String(),
+		Action:      action,
+		Partner:     partner,
+		Payload:     buf,
+		ContentHash: &hash,
 	}
+}
+
+func (repo WebhookRepository) create(ctx context.Context, record WebhookRequestSchema) error {
+	l := zerolog.Ctx(ctx)
 
 	result := repo.db.WithContext(ctx).Model(WebhookRequestSchema{}).Create(&record)
 	if result.Error != nil {
@@ -76,6 +208,7 @@ func (repo WebhookRepository) Find(ctx context.Context, id string) (webhooks.Web
 
 	var record WebhookRequestSchema
 	result := repo.db.WithContext(ctx).
+		Scopes(tenant(ctx, WebhookRequestSchema{}.TableName())).
 		Where(WebhookRequestSchema{ID: id}).
 		First(&record)
 
@@ -88,3 +221,45 @@ func (repo WebhookRepository) Find(ctx context.Context, id string) (webhooks.Web
 	return record.ToEntity(), nil
 
 }
+
+func (repo WebhookRepository) FindMany(ctx context.Context, opts webhooks.OptionsFindWebhooks) ([]webhooks.WebhookRequest, error) {
+	l := zerolog.Ctx(ctx)
+	l.Info().Any(logger.LData, opts).Msg("find webhook requests")
+
+	query := repo.db.WithContext(ctx).
+		Model(WebhookRequestSchema{}).
+		Scopes(tenant(ctx, WebhookRequestSchema{}.TableName()))
+	if len(opts.IDs) > 0 {
+		query = query.Where("id IN ?", opts.IDs)
+	}
+	if opts.Partner != nil {
+		query = query.Where("partner = ?", *opts.Partner)
+	}
+	if opts.Action != nil {
+		query = query.Where("action = ?", *opts.Action)
+	}
+	if opts.From != nil {
+		query = query.Where("created_at >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("created_at < ?", *opts.To)
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	var records []WebhookRequestSchema
+	result := query.Order("created_at ASC").Find(&records)
+	if err := result.Error; err != nil {
+		l.Error().Err(err).Msg("error finding records")
+		return []webhooks.WebhookRequest{}, Error{Err: err}
+	}
+	l.Info().Int("count", len(records)).Msg("records found")
+
+	webhookRequests := make([]webhooks.WebhookRequest, 0, len(records))
+	for _, record := range records {
+		webhookRequests = append(webhookRequests, record.ToEntity())
+	}
+
+	return webhookRequests, nil
+}
@@ -3,7 +3,9 @@ package postgres_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 	"github.com/SirWaithaka/payments-api/testdata"
 )
@@ -17,7 +19,7 @@ func TestWebhookRepository_Add(t *testing.T) {
 		defer testdata.ResetTables(inf)
 
 		payload := []byte(`{"name":"john doe","amount":10}`)
-		err := repo.Add(ctx, "fake_partner", "fake_action", payload)
+		_, err := repo.Add(ctx, "fake_partner", "fake_action", payload, "")
 		if err != nil {
 			t.Errorf("expected nil error, got %v", err)
 		}
@@ -33,7 +35,7 @@ func TestWebhookRepository_Add(t *testing.T) {
 	t.Run("test that nil payload saves as nil", func(t *testing.T) {
 		defer testdata.ResetTables(inf)
 
-		err := repo.Add(ctx, "fake_partner", "fake_action", nil)
+		_, err := repo.Add(ctx, "fake_partner", "fake_action", nil, "")
 		if err != nil {
 			t.Errorf("expected nil error, got %v", err)
 		}
@@ -49,4 +51,154 @@ func TestWebhookRepository_Add(t *testing.T) {
 		}
 
 	})
+
+	t.Run("test that duplicate natural key is counted on the first record", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		payload := []byte(`{"name":"john doe","amount":10}`)
+		first, err := repo.Add(ctx, "fake_partner", "fake_action", payload, "fake_key")
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		for range 2 {
+			var webhook webhooks.WebhookRequest
+			webhook, err = repo.Add(ctx, "fake_partner", "fake_action", payload, "fake_key")
+			if e, ok := err.(postgres.Error); !ok || !e.Duplicate() {
+				t.Errorf("expected duplicate error, got %v", err)
+			}
+			// the webhook saved first is returned
+			if webhook.ID != first.ID {
+				t.Errorf("expected webhook %s, got %s", first.ID, webhook.ID)
+			}
+		}
+
+		var records []postgres.WebhookRequestSchema
+		result := inf.Storage.PG.Find(&records)
+		if result.Error != nil {
+			t.Errorf("expected nil error, got %v", result.Error)
+		}
+
+		if len(records) != 1 {
+			t.Fatalf("expected 1 record, got %d", len(records))
+		}
+		if records[0].DuplicateCount != 2 {
+			t.Errorf("expected duplicate count 2, got %d", records[0].DuplicateCount)
+		}
+		if records[0].ContentHash == nil || *records[0].ContentHash == "" {
+			t.Errorf("expected content hash to be set")
+		}
+	})
+
+	t.Run("test that rejected webhooks do not count as duplicates", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		payload := []byte(`{"name":"john doe","amount":10}`)
+		err := repo.Reject(ctx, "fake_partner", "fake_action", payload, "invalid token")
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		_, err = repo.Add(ctx, "fake_partner", "fake_action", payload, "fake_key")
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+	})
+}
+
+func TestWebhookRepository_FindUnpublished(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	ctx := context.Background()
+
+	repo := postgres.NewWebhookRepository(inf.Storage.PG)
+
+	var ids []string
+	for _, key := range []string{"b2c:1", "b2c:2", "b2c:3"} {
+		webhook, err := repo.Add(ctx, "daraja", "b2c", []byte(`{}`), key)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		ids = append(ids, webhook.ID)
+	}
+	if err := repo.Reject(ctx, "daraja", "b2c", []byte(`{}`), "invalid token"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	if err := repo.MarkPublished(ctx, ids[1]); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+
+	// published and rejected webhooks are not returned
+	records, err := repo.FindUnpublished(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0].ID != ids[0] || records[1].ID != ids[2] {
+		t.Errorf("expected unpublished records oldest first, got %s and %s", records[0].ID, records[1].ID)
+	}
+
+	// webhooks received after the given time are not returned
+	records, err = repo.FindUnpublished(ctx, time.Now().Add(-time.Minute), 10)
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records, got %d", len(records))
+	}
+}
+
+func TestWebhookRepository_FindMany(t *testing.T) {
+	defer testdata.ResetTables(inf)
+	ctx := context.Background()
+
+	repo := postgres.NewWebhookRepository(inf.Storage.PG)
+
+	// save webhooks for different partners and actions
+	fixtures := []struct{ partner, action, key string }{
+		{"daraja", "b2c", "b2c:1"},
+		{"daraja", "c2b", "c2b:1"},
+		{"quikk", "payout", "payout:1"},
+		{"daraja", "b2c", "b2c:2"},
+	}
+	for _, webhook := range fixtures {
+		_, err := repo.Add(ctx, webhook.partner, webhook.action, []byte(`{}`), webhook.key)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+
+	partner, action := "daraja", "b2c"
+	records, err := repo.FindMany(ctx, webhooks.OptionsFindWebhooks{Partner: &partner, Action: &action})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	// oldest webhook is returned first
+	if records[0].NaturalKey != "b2c:1" || records[1].NaturalKey != "b2c:2" {
+		t.Errorf("expected records ordered by time received, got %s and %s", records[0].NaturalKey, records[1].NaturalKey)
+	}
+
+	// find by ids
+	records, err = repo.FindMany(ctx, webhooks.OptionsFindWebhooks{IDs: []string{records[0].ID}})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("expected 1 record, got %d", len(records))
+	}
+
+	// find by time window
+	from := time.Now().Add(-time.Minute)
+	records, err = repo.FindMany(ctx, webhooks.OptionsFindWebhooks{From: &from, Limit: 3})
+	if err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("expected 3 records, got %d", len(records))
+	}
 }
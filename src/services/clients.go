@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	daraja2 "github.com/SirWaithaka/payments/daraja"
+	quikk2 "github.com/SirWaithaka/payments/quikk"
+)
+
+// tokenExpiryMargin is how long before they expire access tokens are refreshed
+const tokenExpiryMargin = time.Minute
+
+func newTokenCache(fetch func() (daraja2.ResponseAuthorization, error)) *tokenCache {
+	return &tokenCache{fetch: fetch, now: time.Now}
+}
+
+// tokenCache caches an access token until just before it expires
+type tokenCache struct {
+	fetch func() (daraja2.ResponseAuthorization, error)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     daraja2.ResponseAuthorization
+	expiresAt time.Time
+}
+
+// Token returns the cached access token or fetches a new one if it has expired.
+// Concurrent callers wait for a single fetch.
+func (cache *tokenCache) Token() (daraja2.ResponseAuthorization, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.token.AccessToken != "" && cache.now().Before(cache.expiresAt) {
+		return cache.token, nil
+	}
+
+	token, err := cache.fetch()
+	if err != nil {
+		return token, err
+	}
+
+	// tokens without a valid expiry are not cached, each call fetches a new token
+	seconds, err := strconv.Atoi(token.ExpiresIn)
+	expiresIn := time.Duration(seconds) * time.Second
+	if err != nil || expiresIn <= tokenExpiryMargin {
+		cache.token = daraja2.ResponseAuthorization{}
+		cache.expiresAt = time.Time{}
+		return token, nil
+	}
+
+	cache.token = token
+	cache.expiresAt = cache.now().Add(expiresIn - tokenExpiryMargin)
+
+	return token, nil
+}
+
+// Invalidate clears the cached token, the next call to Token fetches a new token
+func (cache *tokenCache) Invalidate() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.token = daraja2.ResponseAuthorization{}
+	cache.expiresAt = time.Time{}
+}
+
+// InvalidateOnUnauthorized invalidates the cached token when a request is rejected with 401
+func (cache *tokenCache) InvalidateOnUnauthorized() gorequest.Hook {
+	return gorequest.Hook{Name: "TokenCache.InvalidateOnUnauthorized", Fn: func(r *gorequest.Request) {
+		if r.Response != nil && r.Response.StatusCode == http.StatusUnauthorized {
+			cache.Invalidate()
+		}
+	}}
+}
+
+// clientIdleTimeout is how long a pooled client is kept without being used. It also
+// removes the clients of shortcodes that were deleted or disabled on another instance.
+const clientIdleTimeout = time.Hour
+
+func newClientPool() *clientPool {
+	return &clientPool{clients: make(map[string]pooledClient), now: time.Now}
+}
+
+// clientPool keeps a partner client per shortcode. Clients are replaced when the
+// shortcode credentials change, which also clears the cached access token, and are
+// removed when the shortcode is deleted, disabled or rotated, or has not been used
+// for clientIdleTimeout.
+type clientPool struct {
+	mu      sync.Mutex
+	clients map[string]pooledClient // by shortcode id
+	now     func() time.Time
+}
+
+type pooledClient struct {
+	fingerprint string
+	lastUsed    time.Time
+	daraja      *daraja2.Client
+	quikk       *quikk2.Client
+	tokens      *tokenCache
+}
+
+// get returns the pooled client of the shortcode, the client is built if the pool does
+// not have one for the shortcode credentials
+func (pool *clientPool) get(shortcode mpesa.ShortCode, build func() pooledClient) pooledClient {
+	fingerprint := credentialsFingerprint(shortcode)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	now := pool.now()
+	pool.evictIdle(now)
+
+	client, ok := pool.clients[shortcode.ShortCodeID]
+	if !ok || client.fingerprint != fingerprint {
+		client = build()
+		client.fingerprint = fingerprint
+	}
+	client.lastUsed = now
+	pool.clients[shortcode.ShortCodeID] = client
+
+	return client
+}
+
+// remove removes the pooled client of the shortcode, the next get builds a new client
+func (pool *clientPool) remove(shortcodeID string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	delete(pool.clients, shortcodeID)
+}
+
+// evictIdle removes the clients that have not been used for clientIdleTimeout
+func (pool *clientPool) evictIdle(now time.Time) {
+	for id, client := range pool.clients {
+		if now.Sub(client.lastUsed) > clientIdleTimeout {
+			delete(pool.clients, id)
+		}
+	}
+}
+
+// credentialsFingerprint returns a hash of the shortcode values the partner clients are built with
+func credentialsFingerprint(shortcode mpesa.ShortCode) string {
+	h := sha256.New()
+	for _, value := range []string{shortcode.Service.String(), shortcode.Environment, shortcode.Key, shortcode.Secret} {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
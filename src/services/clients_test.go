@@ -0,0 +1,171 @@
+package services_test
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+	"github.com/SirWaithaka/payments-api/src/services"
+	daraja2 "github.com/SirWaithaka/payments/daraja"
+)
+
+func TestTokenCache(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	var fetches atomic.Int32
+	fetch := func() (daraja2.ResponseAuthorization, error) {
+		n := fetches.Add(1)
+		return daraja2.ResponseAuthorization{AccessToken: "token" + strconv.Itoa(int(n)), ExpiresIn: "3599"}, nil
+	}
+
+	t.Run("test that the token is fetched once under concurrency", func(t *testing.T) {
+		fetches.Store(0)
+		cache := services.NewTokenCache(fetch, clock)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := cache.Token()
+				assert.Nil(t, err)
+				assert.Equal(t, "token1", token.AccessToken)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), fetches.Load())
+	})
+
+	t.Run("test that the token is refreshed before it expires", func(t *testing.T) {
+		fetches.Store(0)
+		cache := services.NewTokenCache(fetch, clock)
+
+		_, _ = cache.Token()
+		now = now.Add(58 * time.Minute)
+		token, _ := cache.Token()
+		assert.Equal(t, "token1", token.AccessToken)
+
+		// within a minute of expiry
+		now = now.Add(time.Minute)
+		token, _ = cache.Token()
+		assert.Equal(t, "token2", token.AccessToken)
+	})
+
+	t.Run("test that the token is invalidated on unauthorized responses", func(t *testing.T) {
+		fetches.Store(0)
+		cache := services.NewTokenCache(fetch, clock)
+		_, _ = cache.Token()
+
+		hook := cache.InvalidateOnUnauthorized()
+		hook.Fn(&gorequest.Request{Response: &http.Response{StatusCode: http.StatusOK}})
+		token, _ := cache.Token()
+		assert.Equal(t, "token1", token.AccessToken)
+
+		hook.Fn(&gorequest.Request{Response: &http.Response{StatusCode: http.StatusUnauthorized}})
+		token, _ = cache.Token()
+		assert.Equal(t, "token2", token.AccessToken)
+	})
+
+	t.Run("test that errors are not cached", func(t *testing.T) {
+		calls := 0
+		cache := services.NewTokenCache(func() (daraja2.ResponseAuthorization, error) {
+			calls++
+			if calls == 1 {
+				return daraja2.ResponseAuthorization{}, errors.New("unavailable")
+			}
+			return daraja2.ResponseAuthorization{AccessToken: "token", ExpiresIn: "3599"}, nil
+		}, clock)
+
+		_, err := cache.Token()
+		assert.NotNil(t, err)
+		token, err := cache.Token()
+		assert.Nil(t, err)
+		assert.Equal(t, "token", token.AccessToken)
+	})
+
+	t.Run("test that tokens without a valid expiry are not cached", func(t *testing.T) {
+		for _, expiresIn := range []string{"", "never", "30"} {
+			calls := 0
+			cache := services.NewTokenCache(func() (daraja2.ResponseAuthorization, error) {
+				calls++
+				return daraja2.ResponseAuthorization{AccessToken: "token" + strconv.Itoa(calls), ExpiresIn: expiresIn}, nil
+			}, clock)
+
+			token, _ := cache.Token()
+			assert.Equal(t, "token1", token.AccessToken, expiresIn)
+			token, _ = cache.Token()
+			assert.Equal(t, "token2", token.AccessToken, expiresIn)
+		}
+	})
+}
+
+func TestProvider_GetDarajaClient(t *testing.T) {
+	cipher, _ := services.NewCredentialsCipher(config.CredentialsConfig{})
+	provider := services.NewProvider(config.Config{}, nil, nil, nil, nil, cipher, nil)
+
+	shortcode := mpesa.ShortCode{ShortCodeID: "1", Service: requests.PartnerDaraja, Key: "key", Secret: "secret"}
+	client := provider.GetDarajaClient(shortcode)
+
+	// same credentials return the pooled client
+	assert.Same(t, client, provider.GetDarajaClient(shortcode))
+
+	// changed credentials replace the client
+	shortcode.Secret = "rotated"
+	rotated := provider.GetDarajaClient(shortcode)
+	assert.NotSame(t, client, rotated)
+	assert.Same(t, rotated, provider.GetDarajaClient(shortcode))
+
+	// clients are pooled per shortcode
+	other := shortcode
+	other.ShortCodeID = "2"
+	assert.NotSame(t, rotated, provider.GetDarajaClient(other))
+
+	// evicted clients are built again
+	provider.Evict(shortcode.ShortCodeID)
+	assert.NotSame(t, rotated, provider.GetDarajaClient(shortcode))
+}
+
+func TestProvider_GetDarajaClient_Idle(t *testing.T) {
+	cipher, _ := services.NewCredentialsCipher(config.CredentialsConfig{})
+	provider := services.NewProvider(config.Config{}, nil, nil, nil, nil, cipher, nil)
+
+	now := time.Now()
+	services.SetClientClock(provider, func() time.Time { return now })
+
+	shortcode := mpesa.ShortCode{ShortCodeID: "1", Service: requests.PartnerDaraja, Key: "key", Secret: "secret"}
+	client := provider.GetDarajaClient(shortcode)
+
+	// used clients are kept
+	now = now.Add(59 * time.Minute)
+	assert.Same(t, client, provider.GetDarajaClient(shortcode))
+
+	// clients that have not been used for an hour are removed
+	now = now.Add(61 * time.Minute)
+	assert.NotSame(t, client, provider.GetDarajaClient(shortcode))
+}
+
+func TestWithTimeout(t *testing.T) {
+	req := gorequest.New(gorequest.Config{}, gorequest.Operation{}, gorequest.Hooks{}, nil, nil, nil)
+	services.WithTimeout(5 * time.Second)(req)
+	if assert.NotNil(t, req.Config.HTTPClient) {
+		assert.Equal(t, 5*time.Second, req.Config.HTTPClient.Timeout)
+	}
+
+	// the client of the request is left unchanged without a timeout
+	req = gorequest.New(gorequest.Config{HTTPClient: http.DefaultClient}, gorequest.Operation{}, gorequest.Hooks{}, nil, nil, nil)
+	services.WithTimeout(0)(req)
+	assert.Same(t, http.DefaultClient, req.Config.HTTPClient)
+}
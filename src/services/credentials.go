@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/SirWaithaka/payments-api/pkg/envelope"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+)
+
+var (
+	ErrNoMasterKey   = errors.New("shortcode credentials are encrypted but no master key is configured")
+	ErrNoShortCodeID = errors.New("shortcode id is required to encrypt credentials")
+)
+
+// NewCredentialsCipher creates the cipher of shortcode credentials with the master keys in the
+// config and the key file. Credentials are saved in plaintext if no master key is configured.
+func NewCredentialsCipher(cfg config.CredentialsConfig) (CredentialsCipher, error) {
+	entries := slices.Clone(cfg.MasterKeys)
+	if cfg.KeyFile != "" {
+		fileEntries, err := envelope.ReadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return CredentialsCipher{}, fmt.Errorf("read master key file: %w", err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	if len(entries) == 0 {
+		return CredentialsCipher{}, nil
+	}
+
+	keys, err := envelope.ParseKeys(entries)
+	if err != nil {
+		return CredentialsCipher{}, err
+	}
+
+	keyring, err := envelope.NewKeyring(cfg.PrimaryKeyID, keys)
+	if err != nil {
+		return CredentialsCipher{}, err
+	}
+
+	return CredentialsCipher{keyring: keyring}, nil
+}
+
+// CredentialsCipher encrypts the initiator password, passphrase, key and secret of a
+// shortcode with a data key, which is saved encrypted with a master key. Each value is
+// bound to the id of its shortcode and its field, so encrypted values cannot be moved
+// between shortcodes or fields.
+type CredentialsCipher struct {
+	keyring *envelope.Keyring
+}
+
+// Enabled returns true if a master key is configured
+func (cipher CredentialsCipher) Enabled() bool {
+	return cipher.keyring != nil
+}
+
+// Encrypt encrypts the credentials with a new data key
+func (cipher CredentialsCipher) Encrypt(shortcode mpesa.ShortCode) (mpesa.ShortCode, error) {
+	if cipher.keyring == nil {
+		return shortcode, nil
+	}
+
+	dataKey, err := cipher.keyring.NewDataKey()
+	if err != nil {
+		return shortcode, err
+	}
+
+	return encryptCredentials(shortcode, dataKey)
+}
+
+// Replace encrypts the new credentials with the data key of the shortcode
+func (cipher CredentialsCipher) Replace(shortcode mpesa.ShortCode, credentials mpesa.ShortCodeCredentials) (mpesa.ShortCode, error) {
+	replacement := mpesa.ShortCode{
+		ShortCodeID:       shortcode.ShortCodeID,
+		InitiatorName:     credentials.InitiatorName,
+		InitiatorPassword: credentials.InitiatorPassword,
+		Passphrase:        credentials.Passphrase,
+		Key:               credentials.Key,
+		Secret:            credentials.Secret,
+	}
+
+	// credentials in plaintext are encrypted together with the new credentials
+	if shortcode.KeyID == "" {
+		return cipher.Encrypt(replaceCredentials(shortcode, replacement))
+	}
+
+	dataKey, err := cipher.dataKey(shortcode)
+	if err != nil {
+		return shortcode, err
+	}
+
+	// wrap the data key with the primary master key, the key id of the shortcode
+	// is updated with the new credentials
+	if dataKey.KeyID != cipher.keyring.PrimaryKeyID() {
+		if dataKey, err = cipher.keyring.Rewrap(dataKey); err != nil {
+			return shortcode, err
+		}
+	}
+
+	replacement, err = encryptCredentials(replacement, dataKey)
+	if err != nil {
+		return shortcode, err
+	}
+
+	return replaceCredentials(shortcode, replacement), nil
+}
+
+// Reencrypt encrypts credentials in plaintext and wraps data keys with the primary master key.
+// Returns true if the shortcode credentials changed and should be saved.
+func (cipher CredentialsCipher) Reencrypt(shortcode mpesa.ShortCode) (mpesa.ShortCode, bool, error) {
+	if cipher.keyring == nil {
+		return shortcode, false, ErrNoMasterKey
+	}
+
+	if shortcode.KeyID == "" {
+		if shortcode.KeyHash == "" {
+			shortcode.KeyHash = mpesa.HashKey(shortcode.Key)
+		}
+		shortcode, err := cipher.Encrypt(shortcode)
+		return shortcode, err == nil, err
+	}
+
+	if shortcode.KeyID == cipher.keyring.PrimaryKeyID() {
+		return shortcode, false, nil
+	}
+
+	dataKey, err := cipher.dataKey(shortcode)
+	if err != nil {
+		return shortcode, false, err
+	}
+
+	if dataKey, err = cipher.keyring.Rewrap(dataKey); err != nil {
+		return shortcode, false, err
+	}
+	shortcode.KeyID, shortcode.DataKey = dataKey.KeyID, dataKey.Wrapped
+
+	return shortcode, true, nil
+}
+
+// decrypt returns the shortcode with its credentials in plaintext. Only the Provider
+// decrypts credentials, when partner clients are built and webhooks are verified.
+func (cipher CredentialsCipher) decrypt(shortcode mpesa.ShortCode) (mpesa.ShortCode, error) {
+	if shortcode.KeyID == "" {
+		return shortcode, nil
+	}
+
+	dataKey, err := cipher.dataKey(shortcode)
+	if err != nil {
+		return shortcode, err
+	}
+
+	return decryptCredentials(shortcode, dataKey)
+}
+
+func (cipher CredentialsCipher) dataKey(shortcode mpesa.ShortCode) (envelope.DataKey, error) {
+	if cipher.keyring == nil {
+		return envelope.DataKey{}, ErrNoMasterKey
+	}
+
+	return cipher.keyring.Unwrap(shortcode.KeyID, shortcode.DataKey)
+}
+
+// credential is a shortcode credential that is encrypted
+type credential struct {
+	field string
+	value *string
+}
+
+// credentials returns pointers to the shortcode credentials that are encrypted
+func credentials(shortcode *mpesa.ShortCode) []credential {
+	return []credential{
+		{field: "initiator_password", value: &shortcode.InitiatorPassword},
+		{field: "passphrase", value: &shortcode.Passphrase},
+		{field: "key", value: &shortcode.Key},
+		{field: "secret", value: &shortcode.Secret},
+	}
+}
+
+// associatedData binds an encrypted value to the shortcode and the field it is saved in
+func associatedData(shortcodeID, field string) []byte {
+	return []byte(shortcodeID + "/" + field)
+}
+
+func encryptCredentials(shortcode mpesa.ShortCode, dataKey envelope.DataKey) (mpesa.ShortCode, error) {
+	if shortcode.ShortCodeID == "" {
+		return mpesa.ShortCode{}, ErrNoShortCodeID
+	}
+
+	var err error
+	for _, c := range credentials(&shortcode) {
+		if *c.value == "" {
+			continue
+		}
+		if *c.value, err = dataKey.Encrypt(*c.value, associatedData(shortcode.ShortCodeID, c.field)); err != nil {
+			return mpesa.ShortCode{}, err
+		}
+	}
+	shortcode.KeyID, shortcode.DataKey = dataKey.KeyID, dataKey.Wrapped
+
+	return shortcode, nil
+}
+
+func decryptCredentials(shortcode mpesa.ShortCode, dataKey envelope.DataKey) (mpesa.ShortCode, error) {
+	for _, c := range credentials(&shortcode) {
+		if *c.value == "" {
+			continue
+		}
+
+		value, err := dataKey.Decrypt(*c.value, associatedData(shortcode.ShortCodeID, c.field))
+		if err != nil {
+			return mpesa.ShortCode{}, fmt.Errorf("decrypt shortcode credentials: %w", err)
+		}
+		*c.value = value
+	}
+	shortcode.KeyID, shortcode.DataKey = "", ""
+
+	return shortcode, nil
+}
+
+// replaceCredentials replaces the shortcode credentials with the replacement credentials that are not empty
+func replaceCredentials(shortcode, replacement mpesa.ShortCode) mpesa.ShortCode {
+	if replacement.InitiatorName != "" {
+		shortcode.InitiatorName = replacement.InitiatorName
+	}
+	if replacement.InitiatorPassword != "" {
+		shortcode.InitiatorPassword = replacement.InitiatorPassword
+	}
+	if replacement.Passphrase != "" {
+		shortcode.Passphrase = replacement.Passphrase
+	}
+	if replacement.Key != "" {
+		shortcode.Key = replacement.Key
+	}
+	if replacement.Secret != "" {
+		shortcode.Secret = replacement.Secret
+	}
+	if replacement.KeyID != "" {
+		shortcode.KeyID, shortcode.DataKey = replacement.KeyID, replacement.DataKey
+	}
+
+	return shortcode
+}
@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/services"
+)
+
+func masterKey(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newCipher(t *testing.T, primary string, keys ...string) services.CredentialsCipher {
+	cipher, err := services.NewCredentialsCipher(config.CredentialsConfig{MasterKeys: keys, PrimaryKeyID: primary})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return cipher
+}
+
+func TestCredentialsCipher(t *testing.T) {
+	shortcode := mpesa.ShortCode{
+		ShortCodeID:       "018f7e2a-1b3c-7d4e-9f8a-2c5d6e7f8a9b",
+		ShortCode:         "000000",
+		InitiatorName:     "initiator",
+		InitiatorPassword: "password",
+		Key:               "key",
+		Secret:            "secret",
+	}
+
+	t.Run("test that credentials are decrypted", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+		assert.True(t, cipher.Enabled())
+
+		encrypted, err := cipher.Encrypt(shortcode)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		assert.Equal(t, "k1", encrypted.KeyID)
+		assert.NotEmpty(t, encrypted.DataKey)
+		assert.Equal(t, "initiator", encrypted.InitiatorName)
+		assert.Empty(t, encrypted.Passphrase)
+		for _, value := range []string{encrypted.InitiatorPassword, encrypted.Key, encrypted.Secret} {
+			assert.NotContains(t, []string{"password", "key", "secret"}, value)
+		}
+
+		decrypted, err := services.Decrypt(cipher, encrypted)
+		assert.Nil(t, err)
+		assert.Equal(t, shortcode, decrypted)
+	})
+
+	t.Run("test that credentials cannot be moved to another shortcode or field", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+		encrypted, _ := cipher.Encrypt(shortcode)
+
+		moved := encrypted
+		moved.ShortCodeID = "018f7e2a-2c4d-7e5f-a1b2-3d6e9f1a2b3c"
+		_, err := services.Decrypt(cipher, moved)
+		assert.NotNil(t, err)
+
+		swapped := encrypted
+		swapped.Key, swapped.Secret = encrypted.Secret, encrypted.Key
+		_, err = services.Decrypt(cipher, swapped)
+		assert.NotNil(t, err)
+
+		// the id is required to bind the credentials
+		_, err = cipher.Encrypt(mpesa.ShortCode{Key: "key", Secret: "secret"})
+		assert.True(t, errors.Is(err, services.ErrNoShortCodeID))
+	})
+
+	t.Run("test that credentials without associated data are not decrypted", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+		encrypted, _ := cipher.Encrypt(shortcode)
+
+		unbound, err := services.EncryptUnbound(cipher, encrypted)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		_, err = services.Decrypt(cipher, unbound)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("test that credentials are saved in plaintext without master keys", func(t *testing.T) {
+		cipher := newCipher(t, "")
+		assert.False(t, cipher.Enabled())
+
+		encrypted, err := cipher.Encrypt(shortcode)
+		assert.Nil(t, err)
+		assert.Equal(t, shortcode, encrypted)
+
+		// encrypted credentials cannot be decrypted without the master key
+		encrypted, _ = newCipher(t, "", masterKey("k1", 1)).Encrypt(shortcode)
+		_, err = services.Decrypt(cipher, encrypted)
+		assert.True(t, errors.Is(err, services.ErrNoMasterKey))
+	})
+
+	t.Run("test that replaced credentials are encrypted with the same data key", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+		encrypted, _ := cipher.Encrypt(shortcode)
+
+		replaced, err := cipher.Replace(encrypted, mpesa.ShortCodeCredentials{Secret: "new_secret"})
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.Equal(t, encrypted.Key, replaced.Key)
+		assert.Equal(t, encrypted.DataKey, replaced.DataKey)
+
+		decrypted, err := services.Decrypt(cipher, replaced)
+		assert.Nil(t, err)
+		assert.Equal(t, "new_secret", decrypted.Secret)
+		assert.Equal(t, "key", decrypted.Key)
+	})
+
+	t.Run("test that data keys are wrapped with the primary master key", func(t *testing.T) {
+		encrypted, _ := newCipher(t, "", masterKey("k1", 1)).Encrypt(shortcode)
+
+		cipher := newCipher(t, "k2", masterKey("k1", 1), masterKey("k2", 2))
+		reencrypted, changed, err := cipher.Reencrypt(encrypted)
+		assert.Nil(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "k2", reencrypted.KeyID)
+		// values are not encrypted again
+		assert.Equal(t, encrypted.Secret, reencrypted.Secret)
+
+		// the old master key is no longer needed
+		decrypted, err := services.Decrypt(newCipher(t, "", masterKey("k2", 2)), reencrypted)
+		assert.Nil(t, err)
+		assert.Equal(t, shortcode, decrypted)
+
+		_, changed, err = cipher.Reencrypt(reencrypted)
+		assert.Nil(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("test that plaintext credentials are encrypted", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+
+		reencrypted, changed, err := cipher.Reencrypt(shortcode)
+		assert.Nil(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "k1", reencrypted.KeyID)
+		assert.Equal(t, mpesa.HashKey("key"), reencrypted.KeyHash)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/services/hooks"
@@ -54,9 +55,9 @@ func (response ResponseC2BExpress) ExternalID() string {
 	return response.MerchantRequestID
 }
 
-// adds action to the path of base url
-// https://<baseurl>/:action
-func webhook(baseUrl string, action string) string {
+// adds action to the path of base url and the callback token to the query
+// https://<baseurl>/:action?token=<token>
+func webhook(baseUrl string, action string, token string) string {
 	if baseUrl == "" {
 		return ""
 	}
@@ -66,6 +67,12 @@ func webhook(baseUrl string, action string) string {
 		return ""
 	}
 
+	if token != "" {
+		query := u.Query()
+		query.Set(QueryCallbackToken, token)
+		u.RawQuery = query.Encode()
+	}
+
 	u.Path, err = url.JoinPath(u.Path, action)
 	if err != nil {
 		return u.String()
@@ -74,8 +81,14 @@ func webhook(baseUrl string, action string) string {
 	return u.String()
 }
 
-func NewDarajaApi(client *daraja.Client, certificate string, shortcode mpesa.ShortCode, repo requests.Repository) DarajaApi {
-	return DarajaApi{client: client, certificate: certificate, shortcode: shortcode, requestRepo: repo}
+func NewDarajaApi(client *daraja.Client, certificate string, shortcode mpesa.ShortCode, repo requests.Repository, breakers circuit.Breakers) DarajaApi {
+	return DarajaApi{
+		client:      client,
+		certificate: certificate,
+		shortcode:   shortcode,
+		requestRepo: repo,
+		recorder:    hooks.NewRequestRecorder(repo, breakers, shortcode),
+	}
 }
 
 // DarajaApi provides an interface to the mpesa wallet
@@ -85,6 +98,8 @@ type DarajaApi struct {
 	client      *daraja.Client
 	shortcode   mpesa.ShortCode
 	requestRepo requests.Repository
+	// records the requests made with the shortcode
+	recorder hooks.RequestRecorder
 }
 
 func (api DarajaApi) C2B(ctx context.Context, paymentID string, payment mpesa.PaymentRequest) error {
@@ -104,24 +119,20 @@ func (api DarajaApi) C2B(ctx context.Context, paymentID string, payment mpesa.Pa
 		PartyA:            payment.ExternalAccountNumber,
 		PartyB:            api.shortcode.ShortCode,
 		PhoneNumber:       payment.ExternalAccountNumber,
-		CallBackURL:       webhook(api.shortcode.CallbackURL, daraja.OperationC2BExpress),
+		CallBackURL:       webhook(api.shortcode.CallbackURL, daraja.OperationC2BExpress, api.shortcode.CallbackToken),
 		AccountReference:  payment.ClientTransactionID,
 		TransactionDesc:   payment.Description,
 		//TransactionDesc:   fmt.Sprintf("C2B REF %s ID %s", payment.TransactionID, payment.PaymentID),
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// initialize request recorder
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
-
 	// create an instance of request and add the request recorder hook
 	requestID := xid.New().String()
 	out := &ResponseC2BExpress{}
 	req, _ := api.client.C2BExpressRequest(payload, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationC2B)
 
 	if err := req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -151,8 +162,8 @@ func (api DarajaApi) B2C(ctx context.Context, paymentID string, payment mpesa.Pa
 		Amount:                   payment.Amount,
 		PartyA:                   api.shortcode.ShortCode,
 		PartyB:                   payment.ExternalAccountNumber,
-		QueueTimeOutURL:          webhook(api.shortcode.CallbackURL, daraja.OperationB2C),
-		ResultURL:                webhook(api.shortcode.CallbackURL, daraja.OperationB2C),
+		QueueTimeOutURL:          webhook(api.shortcode.CallbackURL, daraja.OperationB2C, api.shortcode.CallbackToken),
+		ResultURL:                webhook(api.shortcode.CallbackURL, daraja.OperationB2C, api.shortcode.CallbackToken),
 		Remarks:                  payment.Description,
 		Occasion:                 "OK",
 		//Remarks:                  fmt.Sprintf("B2C REF %s ID %s", payment.TransactionID, payment.PaymentID),
@@ -160,16 +171,13 @@ func (api DarajaApi) B2C(ctx context.Context, paymentID string, payment mpesa.Pa
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// configure and add a hook to record this request attempt
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
 	// create an instance of request and add the request recorder
 	requestID := xid.New().String()
 	out := &ResponseDefault{}
 	req, _ := api.client.B2CRequest(payload, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationB2C)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -200,8 +208,8 @@ func (api DarajaApi) B2B(ctx context.Context, paymentID string, payment mpesa.Pa
 		PartyA:                 api.shortcode.ShortCode,
 		PartyB:                 payment.ExternalAccountNumber,
 		AccountReference:       payment.Beneficiary,
-		QueueTimeOutURL:        webhook(api.shortcode.CallbackURL, daraja.OperationB2B),
-		ResultURL:              webhook(api.shortcode.CallbackURL, daraja.OperationB2B),
+		QueueTimeOutURL:        webhook(api.shortcode.CallbackURL, daraja.OperationB2B, api.shortcode.CallbackToken),
+		ResultURL:              webhook(api.shortcode.CallbackURL, daraja.OperationB2B, api.shortcode.CallbackToken),
 		Remarks:                payment.Description,
 	}
 	if payment.ExternalAccountType == mpesa.AccountTypeTill {
@@ -210,16 +218,13 @@ func (api DarajaApi) B2B(ctx context.Context, paymentID string, payment mpesa.Pa
 
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// configure and add a hook to record this request attempt
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
 	// create an instance of request and add the request recorder
 	requestID := xid.New().String()
 	out := &ResponseDefault{}
 	req, _ := api.client.B2BRequest(payload, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationB2B)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -248,8 +253,8 @@ func (api DarajaApi) Reversal(ctx context.Context, payment mpesa.ReversalRequest
 		ReceiverParty:          api.shortcode.ShortCode,
 		ReceiverIdentifierType: daraja.IdentifierOrgOperatorUsername,
 		Amount:                 payment.Amount,
-		ResultURL:              webhook(api.shortcode.CallbackURL, daraja.OperationReversal),
-		QueueTimeOutURL:        webhook(api.shortcode.CallbackURL, daraja.OperationReversal),
+		ResultURL:              webhook(api.shortcode.CallbackURL, daraja.OperationReversal, api.shortcode.CallbackToken),
+		QueueTimeOutURL:        webhook(api.shortcode.CallbackURL, daraja.OperationReversal, api.shortcode.CallbackToken),
 		Remarks:                fmt.Sprintf("REVERSAL REF %s ID %s", payment.ClientTransactionID, payment.PaymentID),
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
@@ -262,9 +267,7 @@ func (api DarajaApi) Reversal(ctx context.Context, payment mpesa.ReversalRequest
 	// generate a unique request id
 	requestID := xid.New().String()
 	// create new instance of request record and add as hook
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(payment.PaymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, payment.PaymentID, requestID, requests.OperationReversal)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -293,8 +296,8 @@ func (api DarajaApi) Status(ctx context.Context, payment mpesa.Payment) error {
 		CommandID:          daraja.CommandTransactionStatus,
 		PartyA:             api.shortcode.ShortCode,
 		IdentifierType:     daraja.IdentifierOrgShortCode,
-		ResultURL:          webhook(api.shortcode.CallbackURL, daraja.OperationTransactionStatus),
-		QueueTimeOutURL:    webhook(api.shortcode.CallbackURL, daraja.OperationTransactionStatus),
+		ResultURL:          webhook(api.shortcode.CallbackURL, daraja.OperationTransactionStatus, api.shortcode.CallbackToken),
+		QueueTimeOutURL:    webhook(api.shortcode.CallbackURL, daraja.OperationTransactionStatus, api.shortcode.CallbackToken),
 		Remarks:            "OK",
 		Occasion:           "OK",
 	}
@@ -306,12 +309,19 @@ func (api DarajaApi) Status(ctx context.Context, payment mpesa.Payment) error {
 		payload.OriginatorConversationID = &payment.ClientTransactionID
 	}
 
-	res, err := api.client.TransactionStatus(ctx, payload)
-	if err != nil {
+	// create an instance of request and add the request recorder
+	requestID := xid.New().String()
+	out := &ResponseDefault{}
+	req, _ := api.client.TransactionStatusRequest(payload, gorequest.WithServiceName(serviceName.String()))
+	req.WithContext(ctx)
+	req.Data = out
+	api.recorder.Attach(req, payment.PaymentID, requestID, requests.OperationStatus)
+
+	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
 		return err
 	}
-	l.Debug().Any(logger.LData, res).Msg("transaction status")
+	l.Debug().Any(logger.LData, out).Msg("transaction status")
 
 	return nil
 
@@ -334,16 +344,24 @@ func (api DarajaApi) Balance(ctx context.Context) error {
 		PartyA:             api.shortcode.ShortCode,
 		IdentifierType:     daraja.IdentifierOrgShortCode,
 		Remarks:            "Wallet Balance",
-		QueueTimeOutURL:    webhook(api.shortcode.CallbackURL, daraja.OperationBalance),
-		ResultURL:          webhook(api.shortcode.CallbackURL, daraja.OperationBalance),
+		QueueTimeOutURL:    webhook(api.shortcode.CallbackURL, daraja.OperationBalance, api.shortcode.CallbackToken),
+		ResultURL:          webhook(api.shortcode.CallbackURL, daraja.OperationBalance, api.shortcode.CallbackToken),
 	}
 
-	res, err := api.client.Balance(ctx, payload)
-	if err != nil {
+	// create an instance of request and add the request recorder, balance requests
+	// are not made for a payment
+	requestID := xid.New().String()
+	out := &ResponseDefault{}
+	req, _ := api.client.BalanceRequest(payload, gorequest.WithServiceName(serviceName.String()))
+	req.WithContext(ctx)
+	req.Data = out
+	api.recorder.Attach(req, "", requestID, requests.OperationBalance)
+
+	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
 		return err
 	}
-	l.Debug().Any(logger.LData, res).Msg("balance response")
+	l.Debug().Any(logger.LData, out).Msg("balance response")
 
 	return nil
 
@@ -10,6 +10,7 @@ import (
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/SirWaithaka/payments-api/pkg/logger"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
@@ -74,7 +75,7 @@ func TestDarajaApi_C2B(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 
 		// make request
 		paymentID := ulid.Make().String()
@@ -97,6 +98,46 @@ func TestDarajaApi_C2B(t *testing.T) {
 		assert.Equal(t, requests.StatusSucceeded, request.Status)
 	})
 
+	t.Run("test that the callback token is not saved with the request", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		merchantReqID := ulid.Make().String()
+		token := mpesa.NewCallbackToken()
+		mux := http.NewServeMux()
+		mux.HandleFunc(daraja_sdk.EndpointC2bExpress, func(w http.ResponseWriter, r *http.Request) {
+			var req daraja_sdk.RequestC2BExpress
+			if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("expected nil error, got %v", err)
+			}
+			// the partner still receives the token
+			assert.Contains(t, req.CallBackURL, "token="+token)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"ResponseMessage":"Success","ResponseCode":"0","MerchantRequestID":"%s","CheckoutRequestID":"%s"}`, merchantReqID, ulid.Make().String())))
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		withToken := shortcode
+		withToken.CallbackURL = "https://example.com/webhooks/daraja"
+		withToken.CallbackToken = token
+		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, withToken, repository, nil)
+
+		err := service.C2B(t.Context(), ulid.Make().String(), testPayment)
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		request, err := repository.FindOne(t.Context(), requests.OptionsFindRequest{ExternalID: &merchantReqID})
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+		assert.NotContains(t, string(request.RequestBody), token)
+		assert.Contains(t, string(request.RequestBody), "token="+logger.Redacted)
+	})
+
 	t.Run("test request fail", func(t *testing.T) {
 		defer testdata.ResetTables(inf)
 
@@ -115,7 +156,7 @@ func TestDarajaApi_C2B(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.C2B(t.Context(), paymentID, testPayment)
@@ -192,7 +233,7 @@ func TestDarajaApi_B2C(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.B2C(t.Context(), paymentID, testPayment)
@@ -233,7 +274,7 @@ func TestDarajaApi_B2C(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.B2C(t.Context(), paymentID, testPayment)
@@ -309,7 +350,7 @@ func TestDarajaApi_B2B(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.B2B(t.Context(), paymentID, testPayment)
@@ -363,7 +404,7 @@ func TestDarajaApi_B2B(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		testPayment.ExternalAccountType = mpesa.AccountTypeTill
 		paymentID := ulid.Make().String()
@@ -404,7 +445,7 @@ func TestDarajaApi_B2B(t *testing.T) {
 		// build daraja client
 		client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 		// create instance of daraja service
-		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+		service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.B2B(t.Context(), paymentID, testPayment)
@@ -458,7 +499,7 @@ func TestDarajaApi_Status(t *testing.T) {
 	// build daraja client
 	client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
 	// create instance of daraja service
-	service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository)
+	service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
 
 	t.Run("test transaction status parameters", func(t *testing.T) {
 		testcases := []struct {
@@ -481,4 +522,82 @@ func TestDarajaApi_Status(t *testing.T) {
 
 	})
 
+	t.Run("test that request is saved", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		paymentID := ulid.Make().String()
+		err := service.Status(t.Context(), mpesa.Payment{PaymentID: paymentID, PaymentReference: ulid.Make().String()})
+		if err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		// check request is saved
+		var record postgres.RequestSchema
+		result := inf.Storage.PG.First(&record)
+		if err = result.Error; err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		assert.Equal(t, paymentID, *record.PaymentID)
+		assert.Equal(t, requests.OperationStatus.String(), *record.Operation)
+		assert.Equal(t, requests.StatusSucceeded, requests.ToStatus(*record.Status))
+		assert.Equal(t, originatorConversationID, *record.ExternalID)
+		// the security credential is not saved
+		assert.NotContains(t, string(record.RequestBody), "test_password")
+	})
+
+}
+
+func TestDarajaApi_Balance(t *testing.T) {
+	shortcode := mpesa.ShortCode{
+		ShortCode:         "900999",
+		InitiatorName:     "test_name",
+		InitiatorPassword: "test_password",
+		Passphrase:        "test_passphrase",
+		Key:               key,
+		Secret:            secret,
+	}
+
+	repository := postgres.NewRequestRepository(inf.Storage.PG)
+
+	originatorConversationID := ulid.Make().String()
+	// create a mock test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=fake_session")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"ResponseDescription":"Success","ResponseCode":"0","ConversationID":"%s","OriginatorConversationID":"%s"}`, ulid.Make().String(), originatorConversationID)))
+	}))
+	defer server.Close()
+
+	// build daraja client
+	client := daraja_sdk.New(daraja_sdk.Config{Endpoint: server.URL})
+	// create instance of daraja service
+	service := daraja.NewDarajaApi(&client, daraja_sdk.SandboxCertificate, shortcode, repository, nil)
+
+	t.Run("test that request is saved", func(t *testing.T) {
+		defer testdata.ResetTables(inf)
+
+		if err := service.Balance(t.Context()); err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		// check request is saved
+		var record postgres.RequestSchema
+		result := inf.Storage.PG.First(&record)
+		if err := result.Error; err != nil {
+			t.Errorf("expected nil error, got %v", err)
+		}
+
+		// balance requests are not made for a payment
+		assert.Nil(t, record.PaymentID)
+		assert.Equal(t, requests.OperationBalance.String(), *record.Operation)
+		assert.Equal(t, requests.StatusSucceeded, requests.ToStatus(*record.Status))
+		assert.Equal(t, originatorConversationID, *record.ExternalID)
+
+		// response headers are saved redacted
+		headers := record.ToEntity().ResponseHeaders
+		assert.Equal(t, "application/json", headers["Content-Type"])
+		assert.Equal(t, logger.Redacted, headers["Set-Cookie"])
+	})
 }
@@ -0,0 +1,96 @@
+package daraja
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+)
+
+// QueryCallbackToken is the callback url query parameter that carries the shortcode callback token
+const QueryCallbackToken = "token"
+
+// NewWebhookAuthenticator creates a daraja webhook authenticator. allowedIPs is a list
+// of ip addresses or cidr ranges that webhooks can be received from, if empty webhooks
+// are rejected from every ip address.
+func NewWebhookAuthenticator(repository mpesa.ShortCodeRepository, allowedIPs []string) WebhookAuthenticator {
+	var prefixes []netip.Prefix
+	for _, value := range allowedIPs {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		// a single ip address is treated as a range of one
+		if !strings.Contains(value, "/") {
+			if addr, err := netip.ParseAddr(value); err == nil {
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			}
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return WebhookAuthenticator{repository: repository, allowed: prefixes}
+}
+
+// WebhookAuthenticator verifies daraja webhooks come from an allowed ip address
+// and carry the callback token of a daraja shortcode
+type WebhookAuthenticator struct {
+	repository mpesa.ShortCodeRepository
+	allowed    []netip.Prefix
+}
+
+func (authenticator WebhookAuthenticator) Authenticate(ctx context.Context, result *requests.WebhookResult) error {
+	l := zerolog.Ctx(ctx)
+
+	if !authenticator.allowedIP(result.Credentials.SourceIP) {
+		return requests.WebhookRejectedError{Reason: "source ip " + result.Credentials.SourceIP + " not allowed"}
+	}
+
+	token := result.Credentials.Token
+	if token == "" {
+		return requests.ErrMissingCallbackToken
+	}
+
+	service := requests.PartnerDaraja
+	shortcode, err := authenticator.repository.FindOne(ctx, mpesa.OptionsFindShortCodes{Service: &service, CallbackToken: &token, WithDeleted: true})
+	if err != nil {
+		var nf pkgerrors.NotFounder
+		if errors.As(err, &nf) && nf.NotFound() {
+			return requests.WebhookRejectedError{Reason: "invalid callback token"}
+		}
+		l.Error().Err(err).Msg("error finding shortcode by callback token")
+		return err
+	}
+	result.MerchantID = shortcode.MerchantID
+	result.ShortCodeDeletedAt = shortcode.DeletedAt
+
+	return nil
+}
+
+// allowedIP checks the ip against the allowlist, no ip is allowed if the allowlist is empty
+func (authenticator WebhookAuthenticator) allowedIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range authenticator.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package daraja_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/src/services/daraja"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+func TestWebhookAuthenticator_Authenticate(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	token := mpesa.NewCallbackToken()
+	repository := postgres.NewShortCodeRepository(inf.Storage.PG)
+	err := repository.Add(t.Context(), mpesa.ShortCode{
+		Environment:   "sandbox",
+		Service:       requests.PartnerDaraja,
+		Type:          mpesa.PaymentTypePayout,
+		ShortCode:     "900999",
+		Key:           key,
+		Secret:        secret,
+		CallbackToken: token,
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	authenticator := daraja.NewWebhookAuthenticator(repository, []string{"196.201.214.200", "196.201.212.0/24"})
+
+	result := func(ip, token string) *requests.WebhookResult {
+		result := requests.NewWebhookResult("daraja", "b2c", strings.NewReader(`{}`))
+		result.Credentials = requests.WebhookCredentials{SourceIP: ip, Token: token}
+		return result
+	}
+
+	t.Run("test that webhook with valid token from allowed ip is accepted", func(t *testing.T) {
+		assert.Nil(t, authenticator.Authenticate(t.Context(), result("196.201.214.200", token)))
+		assert.Nil(t, authenticator.Authenticate(t.Context(), result("196.201.212.74", token)))
+	})
+
+	t.Run("test that every ip is rejected if allowlist is empty", func(t *testing.T) {
+		authenticator := daraja.NewWebhookAuthenticator(repository, nil)
+		err := authenticator.Authenticate(t.Context(), result("10.0.0.1", token))
+		assert.Equal(t, requests.WebhookRejectedError{Reason: "source ip 10.0.0.1 not allowed"}, err)
+	})
+
+	t.Run("test that any ip is allowed by an allowlist of every range", func(t *testing.T) {
+		authenticator := daraja.NewWebhookAuthenticator(repository, []string{"0.0.0.0/0", "::/0"})
+		assert.Nil(t, authenticator.Authenticate(t.Context(), result("10.0.0.1", token)))
+	})
+
+	t.Run("test that a missing token is reported for the legacy check", func(t *testing.T) {
+		err := authenticator.Authenticate(t.Context(), result("196.201.214.200", ""))
+		assert.ErrorIs(t, err, requests.ErrMissingCallbackToken)
+	})
+
+	testcases := []struct {
+		name   string
+		result *requests.WebhookResult
+		reason string
+	}{
+		{name: "test that ip not in allowlist is rejected", result: result("10.0.0.1", token), reason: "source ip 10.0.0.1 not allowed"},
+		{name: "test that missing token is rejected", result: result("196.201.214.200", ""), reason: "missing callback token"},
+		{name: "test that unknown token is rejected", result: result("196.201.214.200", "unknown"), reason: "invalid callback token"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := authenticator.Authenticate(t.Context(), tc.result)
+
+			var rejected requests.WebhookRejectedError
+			if !errors.As(err, &rejected) {
+				t.Fatalf("expected rejected error, got %v", err)
+			}
+			assert.Equal(t, tc.reason, rejected.Reason)
+		})
+	}
+
+	t.Run("test that the token of a deleted shortcode is accepted", func(t *testing.T) {
+		deleted := mpesa.ShortCode{
+			ShortCodeID:   ulid.Make().String(),
+			Environment:   "sandbox",
+			Service:       requests.PartnerDaraja,
+			Type:          mpesa.PaymentTypeCharge,
+			ShortCode:     "900998",
+			Key:           key,
+			Secret:        secret,
+			CallbackToken: mpesa.NewCallbackToken(),
+		}
+		if err := repository.Add(t.Context(), deleted); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if err := repository.Delete(t.Context(), deleted.ShortCodeID); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		// the payments of the shortcode are checked against the time it was deleted
+		webhook := result("196.201.214.200", deleted.CallbackToken)
+		assert.Nil(t, authenticator.Authenticate(t.Context(), webhook))
+		assert.False(t, webhook.ShortCodeDeletedAt.IsZero())
+	})
+}
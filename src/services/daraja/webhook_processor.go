@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strconv"
 
@@ -45,6 +46,16 @@ func (result WebhookResult) ExternalID() string {
 	return result.OriginationID
 }
 
+// NaturalKey identifies the webhook among all daraja webhooks. Daraja sends the same
+// result more than once, the duplicates share the conversation id and result code.
+// For c2b webhooks the conversation id is the CheckoutRequestID.
+func (result WebhookResult) NaturalKey() string {
+	if result.ConversationID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%v", result.ConversationID, result.ResultCode)
+}
+
 // TRANSFORMER FUNCTIONS
 
 func c2bWebHookResult(body io.Reader) (WebhookResult, error) {
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"time"
+
+	daraja2 "github.com/SirWaithaka/payments/daraja"
+
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+)
+
+// Decrypt exposes decrypt to tests
+var Decrypt = CredentialsCipher.decrypt
+
+// EncryptUnbound encrypts the secret of the shortcode without associated data
+func EncryptUnbound(cipher CredentialsCipher, shortcode mpesa.ShortCode) (mpesa.ShortCode, error) {
+	dataKey, err := cipher.dataKey(shortcode)
+	if err != nil {
+		return shortcode, err
+	}
+	decrypted, err := cipher.decrypt(shortcode)
+	if err != nil {
+		return shortcode, err
+	}
+
+	shortcode.Secret, err = dataKey.Encrypt(decrypted.Secret, nil)
+	return shortcode, err
+}
+
+type TokenCache = tokenCache
+
+// NewTokenCache exposes newTokenCache to tests with a clock
+func NewTokenCache(fetch func() (daraja2.ResponseAuthorization, error), now func() time.Time) *TokenCache {
+	cache := newTokenCache(fetch)
+	cache.now = now
+	return cache
+}
+
+// SetClientClock sets the clock of the client pool of the provider
+func SetClientClock(provider *Provider, now func() time.Time) {
+	provider.clients.now = now
+}
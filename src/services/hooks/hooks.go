@@ -1,33 +1,77 @@
 package hooks
 
 import (
+	"bytes"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/SirWaithaka/gorequest"
 
 	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
 	"github.com/SirWaithaka/payments-api/pkg/types"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 )
 
-func NewRequestRecorder(repository requests.Repository) RequestRecorder {
-	return RequestRecorder{repository: repository}
+// NewRequestRecorder creates a RequestRecorder for requests made with the shortcode, the
+// outcomes of requests are recorded on the breaker of the shortcode if breakers is not nil.
+// Requests are saved for the merchant of the shortcode.
+func NewRequestRecorder(repository requests.Repository, breakers circuit.Breakers, shortcode mpesa.ShortCode) RequestRecorder {
+	return RequestRecorder{
+		repository:  repository,
+		breakers:    breakers,
+		shortcodeID: shortcode.ShortCodeID,
+		merchantID:  shortcode.MerchantID,
+	}
 }
 
 type RequestRecorder struct {
-	repository requests.Repository
+	repository  requests.Repository
+	breakers    circuit.Breakers
+	shortcodeID string
+	merchantID  string
+}
+
+// Attach adds the hooks that record the request, its response and the exchange with the
+// partner to the request
+func (recorder RequestRecorder) Attach(req *gorequest.Request, paymentID, requestID string, operation requests.Operation) {
+	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID, operation))
+	req.Hooks.Send.PushBackHook(recorder.CaptureResponse())
+	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID, operation))
 }
 
 // RecordRequest hooks saves all outgoing requests before the http request is sent to the
-// external api.
-func (recorder RequestRecorder) RecordRequest(paymentID, requestID string) gorequest.Hook {
+// external api. The payload is saved with secrets, phone numbers and the callback tokens in
+// callback urls redacted.
+func (recorder RequestRecorder) RecordRequest(paymentID, requestID string, operation requests.Operation) gorequest.Hook {
 	return gorequest.Hook{Name: "RequestRecorder.RecordRequest", Fn: func(r *gorequest.Request) {
+		// the send hooks run on every attempt, the request is saved on the first
+		if r.RetryCount > 0 {
+			return
+		}
 
 		req := requests.Request{
-			RequestID: requestID,
-			PaymentID: paymentID,
-			Partner:   r.Config.ServiceName,
-			Status:    requests.StatusReceived,
+			RequestID:  requestID,
+			PaymentID:  paymentID,
+			MerchantID: recorder.merchantID,
+			Partner:    r.Config.ServiceName,
+			Operation:  operation,
+			Status:     requests.StatusReceived,
+			Attempt:    1,
+			// the request context carries the id of the api request or event
+			OriginRequestID: requestid.FromContext(r.Context()),
+		}
+
+		if r.Params != nil {
+			body, err := logger.MarshalRedacted(r.Params)
+			if err == nil {
+				req.RequestBody = body
+			}
 		}
 
 		// save request
@@ -40,13 +84,46 @@ func (recorder RequestRecorder) RecordRequest(paymentID, requestID string) goreq
 	}}
 }
 
+// capturedBody replaces the body of a partner response after it is read, so that the
+// response can still be unmarshalled
+type capturedBody struct {
+	*bytes.Reader
+	raw []byte
+}
+
+func (body capturedBody) Close() error { return nil }
+
+// CaptureResponse hook reads the raw body of the partner response after the http request
+// is sent, the body is recorded by UpdateRequestResponse.
+func (recorder RequestRecorder) CaptureResponse() gorequest.Hook {
+	return gorequest.Hook{Name: "RequestRecorder.CaptureResponse", Fn: func(r *gorequest.Request) {
+		if r.Response == nil || r.Response.Body == nil {
+			return
+		}
+		if _, ok := r.Response.Body.(capturedBody); ok {
+			return
+		}
+
+		// on a read error the body read so far is kept
+		raw, _ := io.ReadAll(r.Response.Body)
+		_ = r.Response.Body.Close()
+		r.Response.Body = capturedBody{Reader: bytes.NewReader(raw), raw: raw}
+	}}
+}
+
 // UpdateRequestResponse updates a request record after the http request is made and a response
 // is/is not received.
-func (recorder RequestRecorder) UpdateRequestResponse(requestID string) gorequest.Hook {
+func (recorder RequestRecorder) UpdateRequestResponse(requestID string, operation requests.Operation) gorequest.Hook {
 	return gorequest.Hook{Name: "RequestRecorder.UpdateRequestResponse", Fn: func(r *gorequest.Request) {
-		opts := requests.OptionsUpdateRequest{}
+		opts := requests.OptionsUpdateRequest{
+			Latency: types.Pointer(time.Since(r.AttemptTime)),
+			Attempt: types.Pointer(r.RetryCount + 1),
+		}
+		exchange(r, &opts)
 
 		defer func() {
+			recorder.recordOutcome(r, operation, opts.Status)
+
 			err := recorder.repository.UpdateRequest(r.Context(), requestID, opts)
 			if err != nil {
 				r.Error = err
@@ -61,7 +138,7 @@ func (recorder RequestRecorder) UpdateRequestResponse(requestID string) goreques
 			resMap["error"] = r.Error.Error()
 
 			// check if it's a 4xx status code
-			if r.Response.StatusCode >= 400 && r.Response.StatusCode < 500 {
+			if r.Response != nil && r.Response.StatusCode >= 400 && r.Response.StatusCode < 500 {
 				s := requests.StatusFailed
 				opts.Status = &s
 			} else // check if it is a timeout error
@@ -91,7 +168,45 @@ func (recorder RequestRecorder) UpdateRequestResponse(requestID string) goreques
 
 		s := requests.StatusSucceeded
 		opts.Status = &s
-		opts.Latency = types.Pointer(time.Since(r.AttemptTime))
 		opts.Response = resMap
 	}}
 }
+
+// exchange sets the http status, headers and raw body of the partner response. Headers
+// and the body are saved with secrets and phone numbers redacted.
+func exchange(r *gorequest.Request, opts *requests.OptionsUpdateRequest) {
+	if r.Response == nil {
+		return
+	}
+
+	opts.HTTPStatus = types.Pointer(r.Response.StatusCode)
+
+	headers := make(map[string]string, len(r.Response.Header))
+	for key, values := range r.Response.Header {
+		headers[key] = strings.Join(values, ", ")
+	}
+	opts.ResponseHeaders = logger.Redact(headers).(map[string]string)
+
+	if body, ok := r.Response.Body.(capturedBody); ok {
+		opts.ResponseBody = types.Pointer(string(logger.RedactJSON(body.raw)))
+	}
+}
+
+// recordOutcome records the outcome of the request in the metrics and on the breaker. Requests
+// rejected by the partner with a 4xx status are not failures of the partner.
+func (recorder RequestRecorder) recordOutcome(r *gorequest.Request, operation requests.Operation, status *requests.Status) {
+	if status == nil {
+		return
+	}
+
+	latency := time.Since(r.AttemptTime)
+	metrics.ObservePartnerRequest(r.Config.ServiceName, recorder.shortcodeID, operation.String(), status.String(), latency)
+
+	if recorder.breakers == nil {
+		return
+	}
+
+	failed := *status == requests.StatusTimeout || *status == requests.StatusError
+	key := circuit.Key(r.Config.ServiceName, recorder.shortcodeID)
+	recorder.breakers.Record(r.Context(), key, circuit.Outcome{Failed: failed, Latency: latency})
+}
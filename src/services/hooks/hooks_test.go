@@ -14,6 +14,8 @@ import (
 	"github.com/SirWaithaka/gorequest"
 	"github.com/SirWaithaka/gorequest/corehooks"
 
+	"github.com/SirWaithaka/payments-api/pkg/requestid"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
 	"github.com/SirWaithaka/payments-api/src/services/hooks"
@@ -24,18 +26,26 @@ func TestRequestRecorder_RecordRequest(t *testing.T) {
 	defer testdata.ResetTables(inf)
 
 	repository := postgres.NewRequestRepository(inf.Storage.PG)
-	recorder := hooks.NewRequestRecorder(repository)
+	recorder := hooks.NewRequestRecorder(repository, nil, mpesa.ShortCode{})
 
 	// fake payment
 	paymentID := ulid.Make().String()
 
 	requestID := xid.New().String()
 	reqHooks := gorequest.Hooks{}
-	reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-
-	// make request
+	reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID, requests.OperationC2B))
+
+	// make request, secrets and callback tokens in the payload are redacted
+	params := struct {
+		ShortCode string `json:"ShortCode"`
+		Password  string `json:"Password"`
+		ResultURL string `json:"ResultURL"`
+	}{ShortCode: "000000", Password: "fake_password", ResultURL: "https://example.com/webhooks/daraja/b2c?token=fake_token"}
 	cfg := gorequest.Config{ServiceName: "test"}
-	req := gorequest.New(cfg, gorequest.Operation{}, reqHooks, nil, nil, nil)
+	req := gorequest.New(cfg, gorequest.Operation{}, reqHooks, nil, params, nil)
+	// the id of the api request the partner request is made for
+	originRequestID := requestid.New()
+	req.WithContext(requestid.WithContext(t.Context(), originRequestID))
 	if err := req.Send(); err != nil {
 		t.Errorf("expected nil error, got %v", err)
 	}
@@ -49,6 +59,10 @@ func TestRequestRecorder_RecordRequest(t *testing.T) {
 
 	// assert values
 	assert.Equal(t, requestID, rq.RequestID)
+	assert.Equal(t, requests.OperationC2B.String(), *rq.Operation)
+	assert.Equal(t, 1, rq.Attempt)
+	assert.Equal(t, originRequestID, *rq.OriginRequestID)
+	assert.JSONEq(t, `{"ShortCode":"000000","Password":"[REDACTED]","ResultURL":"https://example.com/webhooks/daraja/b2c?token=[REDACTED]"}`, string(rq.RequestBody))
 
 }
 
@@ -76,7 +90,7 @@ func TestRequestRecorder_UpdateRequestResponse(t *testing.T) {
 
 	// create an instance of recorder
 	repository := postgres.NewRequestRepository(inf.Storage.PG)
-	recorder := hooks.NewRequestRecorder(repository)
+	recorder := hooks.NewRequestRecorder(repository, nil, mpesa.ShortCode{})
 
 	t.Run("test on a success response", func(t *testing.T) {
 		defer testdata.ResetTables(inf)
@@ -87,8 +101,8 @@ func TestRequestRecorder_UpdateRequestResponse(t *testing.T) {
 		requestID := xid.New().String()
 		// create request hooks for
 		reqHooks := gorequest.Hooks{}
-		reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-		reqHooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+		reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID, requests.OperationC2B))
+		reqHooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID, requests.OperationC2B))
 
 		// configure the request
 		cfg := gorequest.Config{Endpoint: server.URL, DisableSSL: true, HTTPClient: http.DefaultClient, ServiceName: "test"}
@@ -127,13 +141,15 @@ func TestRequestRecorder_UpdateRequestResponse(t *testing.T) {
 		requestID := xid.New().String()
 		// create request hooks for
 		reqHooks := gorequest.Hooks{}
-		reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-		reqHooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+		reqHooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID, requests.OperationC2B))
+		reqHooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID, requests.OperationC2B))
 
 		// configure the request
 		cfg := gorequest.Config{Endpoint: server.URL, DisableSSL: true, HTTPClient: http.DefaultClient, ServiceName: "test", RequestID: xid.New().String()}
 		op := gorequest.Operation{Name: "FooBar", Path: "/error"}
 		reqHooks.Send.PushBackHook(corehooks.SendHook)
+		// the response body is captured and can still be read by the unmarshal hooks
+		reqHooks.Send.PushBackHook(recorder.CaptureResponse())
 		reqHooks.Unmarshal.PushFront(func(r *gorequest.Request) {
 			// the mock server returns non 200 status code and "error" in response body
 			if r.Response.StatusCode != http.StatusOK {
@@ -170,5 +186,14 @@ func TestRequestRecorder_UpdateRequestResponse(t *testing.T) {
 			t.Errorf("expected non-nil result, got nil")
 		}
 
+		// assert the exchange is recorded
+		if assert.NotNil(t, rq.HTTPStatus) {
+			assert.Equal(t, http.StatusInternalServerError, *rq.HTTPStatus)
+		}
+		if assert.NotNil(t, rq.ResponseBody) {
+			assert.Equal(t, "error", *rq.ResponseBody)
+		}
+		assert.Equal(t, 1, rq.Attempt)
+
 	})
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/pkg/logger"
 )
 
 func NewLogger(logger *zerolog.Logger, lvl gorequest.LogLevel) Logger {
@@ -19,7 +21,8 @@ type Logger struct {
 }
 
 func (l Logger) Log(v ...any) {
-	msg := strings.Replace(fmt.Sprint(v...), "\n", " ", -1)
+	// http request and response dumps include credentials and phone numbers
+	msg := logger.RedactString(strings.Replace(fmt.Sprint(v...), "\n", " ", -1))
 	switch {
 	case l.level == gorequest.LogSilent:
 		return
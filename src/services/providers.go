@@ -1,11 +1,15 @@
 package services
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/rs/zerolog"
 
 	"github.com/SirWaithaka/gorequest/corehooks"
 
 	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/domains/webhooks"
@@ -27,6 +31,19 @@ func WithLogger() gorequest.Option {
 	}
 }
 
+// WithTimeout sends the request with an http client that cuts off each attempt after the
+// timeout, requests are not cut off if the timeout is 0
+func WithTimeout(timeout time.Duration) gorequest.Option {
+	// the client is shared by the requests of a partner client, reusing its connections
+	client := &http.Client{Timeout: timeout}
+
+	return func(r *gorequest.Request) {
+		if timeout > 0 {
+			r.Config.HTTPClient = client
+		}
+	}
+}
+
 type ShortCodeConfig struct {
 	ShortCode         string // business pay bill or buy goods account
 	InitiatorName     string // daraja api initiator name
@@ -37,17 +54,42 @@ type ShortCodeConfig struct {
 	CallbackURL       string // callback url for shortcode async responses
 }
 
-func NewProvider(cfg config.Config, requestsRepo requests.Repository, webhooksRepo webhooks.Repository) *Provider {
-	return &Provider{config: cfg, requestsRepo: requestsRepo, webhooksRepo: webhooksRepo}
+func NewProvider(cfg config.Config, requestsRepo requests.Repository, webhooksRepo webhooks.Repository, shortcodesRepo mpesa.ShortCodeRepository, nonces requests.WebhookNonces, cipher CredentialsCipher, breakers circuit.Breakers) *Provider {
+	return &Provider{
+		config:         cfg,
+		requestsRepo:   requestsRepo,
+		webhooksRepo:   webhooksRepo,
+		shortcodesRepo: shortcodesRepo,
+		nonces:         nonces,
+		cipher:         cipher,
+		breakers:       breakers,
+		clients:        newClientPool(),
+	}
 }
 
 type Provider struct {
-	config       config.Config
-	requestsRepo requests.Repository
-	webhooksRepo webhooks.Repository
+	config         config.Config
+	requestsRepo   requests.Repository
+	webhooksRepo   webhooks.Repository
+	shortcodesRepo mpesa.ShortCodeRepository
+	nonces         requests.WebhookNonces
+	cipher         CredentialsCipher
+	breakers       circuit.Breakers
+	clients        *clientPool
 }
 
-func (provider Provider) GetMpesaApi(shortcode mpesa.ShortCode) mpesa.API {
+// Evict removes the pooled partner clients and cached access token of a shortcode
+func (provider Provider) Evict(shortcodeID string) {
+	provider.clients.remove(shortcodeID)
+}
+
+func (provider Provider) GetMpesaApi(shortcode mpesa.ShortCode) (mpesa.API, error) {
+	// credentials are only decrypted to build the partner clients
+	shortcode, err := provider.cipher.decrypt(shortcode)
+	if err != nil {
+		return nil, err
+	}
+
 	// build client depending on service
 	if shortcode.Service == requests.PartnerDaraja {
 		certificate := daraja2.SandboxCertificate
@@ -57,15 +99,15 @@ func (provider Provider) GetMpesaApi(shortcode mpesa.ShortCode) mpesa.API {
 
 		// build the daraja client
 		client := provider.GetDarajaClient(shortcode)
-		return daraja.NewDarajaApi(client, certificate, shortcode, provider.requestsRepo)
+		return daraja.NewDarajaApi(client, certificate, shortcode, provider.requestsRepo, provider.breakers), nil
 	}
 	if shortcode.Service == requests.PartnerQuikk {
 		// build the quikk client
 		client := provider.GetQuikkClient(shortcode)
-		return quikk.NewQuikkApi(client, shortcode, provider.requestsRepo)
+		return quikk.NewQuikkApi(client, shortcode, provider.requestsRepo, provider.breakers), nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (provider Provider) GetWebhookProcessor(service requests.Partner) requests.WebhookProcessor {
@@ -79,43 +121,89 @@ func (provider Provider) GetWebhookProcessor(service requests.Partner) requests.
 	}
 }
 
+func (provider Provider) GetWebhookAuthenticator(service requests.Partner) requests.WebhookAuthenticator {
+	switch service {
+	case requests.PartnerDaraja:
+		return daraja.NewWebhookAuthenticator(provider.shortcodesRepo, provider.config.Webhooks.DarajaAllowedIPs)
+	case requests.PartnerQuikk:
+		return quikk.NewWebhookAuthenticator(provider.shortcodesRepo, provider.nonces, provider.config.Webhooks.QuikkSignatureMaxAge, provider)
+	default:
+		return nil
+	}
+}
+
+// VerifyQuikkSignature verifies a quikk webhook signature with the secret of the shortcode,
+// the secret is decrypted to verify the signature
+func (provider Provider) VerifyQuikkSignature(shortcode mpesa.ShortCode, signature quikk.Signature, date string) (bool, error) {
+	shortcode, err := provider.cipher.decrypt(shortcode)
+	if err != nil {
+		return false, err
+	}
+
+	return signature.Verify(shortcode.Secret, date), nil
+}
+
+// GetDarajaClient returns the daraja client of the shortcode with its decrypted credentials.
+// Clients are pooled per shortcode, and access tokens are cached until just before they expire.
 func (provider Provider) GetDarajaClient(shortcode mpesa.ShortCode) *daraja2.Client {
+	return provider.clients.get(shortcode, func() pooledClient {
+		return provider.newDarajaClient(shortcode)
+	}).daraja
+}
+
+func (provider Provider) newDarajaClient(shortcode mpesa.ShortCode) pooledClient {
 	endpoint := daraja2.SandboxUrl
 	// check the environment the shortcode is configured for
 	if shortcode.Environment == "production" {
 		endpoint = daraja2.ProductionUrl
 	}
 
-	// use environment endpoint if set
-	if provider.config.Daraja.Endpoint != "" {
-		endpoint = provider.config.Daraja.Endpoint
+	// use the endpoint configured for the environment if set
+	if e := provider.config.Daraja.Endpoint(shortcode.Environment); e != "" {
+		endpoint = e
 	}
 
 	client := daraja2.New(daraja2.Config{Endpoint: endpoint, LogLevel: gorequest.LogError})
+	tokens := newTokenCache(client.AuthenticationRequest(shortcode.Key, shortcode.Secret))
+
 	client.Hooks.Build.PushFront(WithLogger())
-	client.Hooks.Build.PushBackHook(daraja2.Authenticate(client.AuthenticationRequest(shortcode.Key, shortcode.Secret)))
+	client.Hooks.Build.PushFront(WithTimeout(provider.config.Daraja.Timeout))
+	client.Hooks.Build.PushFrontHook(StartSpan(shortcode.ShortCodeID))
+	client.Hooks.Build.PushBackHook(daraja2.Authenticate(tokens.Token))
 	client.Hooks.Send.PushFrontHook(corehooks.LogHTTPRequest)
+	client.Hooks.Complete.PushBackHook(tokens.InvalidateOnUnauthorized())
+	client.Hooks.Complete.PushBackHook(EndSpan())
 
-	return &client
-
+	return pooledClient{daraja: &client, tokens: tokens}
 }
 
+// GetQuikkClient returns the quikk client of the shortcode with its decrypted credentials.
+// Clients are pooled per shortcode.
 func (provider Provider) GetQuikkClient(shortcode mpesa.ShortCode) *quikk2.Client {
+	return provider.clients.get(shortcode, func() pooledClient {
+		return provider.newQuikkClient(shortcode)
+	}).quikk
+}
+
+func (provider Provider) newQuikkClient(shortcode mpesa.ShortCode) pooledClient {
 	endpoint := quikk2.SandboxUrl
 	// check the environment the shortcode is configured for
 	if shortcode.Environment == "production" {
 		endpoint = quikk2.ProductionUrl
 	}
 
-	// use environment endpoint if set
-	if provider.config.Quikk.Endpoint != "" {
-		endpoint = provider.config.Quikk.Endpoint
+	// use the endpoint configured for the environment if set
+	if e := provider.config.Quikk.Endpoint(shortcode.Environment); e != "" {
+		endpoint = e
 	}
 
 	client := quikk2.New(quikk2.Config{Endpoint: endpoint, LogLevel: gorequest.LogError})
 	client.Hooks.Build.PushFront(WithLogger())
+	client.Hooks.Build.PushFront(WithTimeout(provider.config.Quikk.Timeout))
+	client.Hooks.Build.PushFrontHook(StartSpan(shortcode.ShortCodeID))
 	client.Hooks.Build.PushBackHook(quikk2.Sign(shortcode.Key, shortcode.Secret))
 	client.Hooks.Send.PushFrontHook(corehooks.LogHTTPRequest)
+	client.Hooks.Complete.PushBackHook(EndSpan())
 
-	return &client
+	return pooledClient{quikk: &client}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/src/domains/circuit"
 	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
 	"github.com/SirWaithaka/payments-api/src/domains/requests"
 	"github.com/SirWaithaka/payments-api/src/services/hooks"
@@ -28,14 +29,21 @@ func (response ResponseDefault) ExternalID() string { return response.Data.ID }
 // QUIKK MPESA API SERVICE
 
 // NewQuikkApi creates a new instance of QuikkApi
-func NewQuikkApi(client *quikk.Client, shortcode mpesa.ShortCode, repo requests.Repository) QuikkApi {
-	return QuikkApi{client: client, shortcode: shortcode, requestRepo: repo}
+func NewQuikkApi(client *quikk.Client, shortcode mpesa.ShortCode, repo requests.Repository, breakers circuit.Breakers) QuikkApi {
+	return QuikkApi{
+		client:      client,
+		shortcode:   shortcode,
+		requestRepo: repo,
+		recorder:    hooks.NewRequestRecorder(repo, breakers, shortcode),
+	}
 }
 
 type QuikkApi struct {
 	client      *quikk.Client
 	shortcode   mpesa.ShortCode
 	requestRepo requests.Repository
+	// records the requests made with the shortcode
+	recorder hooks.RequestRecorder
 }
 
 func (api QuikkApi) C2B(ctx context.Context, paymentID string, payment mpesa.PaymentRequest) error {
@@ -59,17 +67,13 @@ func (api QuikkApi) C2B(ctx context.Context, paymentID string, payment mpesa.Pay
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// initialize request recorder
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
-
 	// create an instance of request and add the request recorder hook
 	requestID := xid.New().String()
 	out := &ResponseDefault{}
 	req, _ := api.client.ChargeRequest(payload, requestID, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationC2B)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -100,17 +104,13 @@ func (api QuikkApi) B2C(ctx context.Context, paymentID string, payment mpesa.Pay
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// initialize request recorder
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
-
 	// create an instance of request and add the request recorder hook
 	requestID := xid.New().String()
 	out := &ResponseDefault{}
 	req, _ := api.client.PayoutRequest(payload, requestID, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationB2C)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -144,17 +144,13 @@ func (api QuikkApi) B2B(ctx context.Context, paymentID string, payment mpesa.Pay
 	}
 	l.Debug().Any(logger.LData, payload).Msg("request payload")
 
-	// initialize request recorder
-	recorder := hooks.NewRequestRecorder(api.requestRepo)
-
 	// create an instance of request and add the request recorder hook
 	requestID := xid.New().String()
 	out := &ResponseDefault{}
 	req, _ := api.client.TransferRequest(payload, requestID, gorequest.WithServiceName(serviceName.String()))
 	req.WithContext(ctx)
 	req.Data = out
-	req.Hooks.Send.PushFrontHook(recorder.RecordRequest(paymentID, requestID))
-	req.Hooks.Complete.PushFrontHook(recorder.UpdateRequestResponse(requestID))
+	api.recorder.Attach(req, paymentID, requestID, requests.OperationB2B)
 
 	if err = req.Send(); err != nil {
 		l.Error().Err(err).Msg("client error")
@@ -73,7 +73,7 @@ func TestQuikkApi_C2B(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		// make request
 		paymentID := ulid.Make().String()
 		err := service.C2B(t.Context(), paymentID, testPayment)
@@ -136,7 +136,7 @@ func TestQuikkApi_B2C(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		paymentID := ulid.Make().String()
 		err := service.B2C(t.Context(), paymentID, testPayment)
 		if err != nil {
@@ -201,7 +201,7 @@ func TestQuikkApi_B2B(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		paymentID := ulid.Make().String()
 		err := service.B2B(t.Context(), paymentID, testPayment)
 		if err != nil {
@@ -256,7 +256,7 @@ func TestQuikkApi_B2B(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		paymentID := ulid.Make().String()
 		err := service.B2B(t.Context(), paymentID, testPayment)
 		if err != nil {
@@ -325,7 +325,7 @@ func TestQuikkApi_Status(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		err = service.Status(t.Context(), payment)
 		if err != nil {
 			t.Errorf("expected nil error, got %v", err)
@@ -360,7 +360,7 @@ func TestQuikkApi_Status(t *testing.T) {
 
 		client := quikk_sdk.New(quikk_sdk.Config{Endpoint: server.URL})
 		// create instance of quikk service
-		service := quikk.NewQuikkApi(&client, shortcode, repository)
+		service := quikk.NewQuikkApi(&client, shortcode, repository, nil)
 		err = service.Status(t.Context(), payment)
 		if err != nil {
 			t.Errorf("expected nil error, got %v", err)
@@ -0,0 +1,190 @@
+package quikk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	pkgerrors "github.com/SirWaithaka/payments-api/pkg/errors"
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+)
+
+// nonceTTL is how long signatures are kept when their age is not checked
+const nonceTTL = 24 * time.Hour
+
+// SignatureVerifier verifies a signature with the secret of the shortcode that signed it.
+// Secrets may be encrypted, they are decrypted by the verifier and not returned.
+type SignatureVerifier interface {
+	VerifyQuikkSignature(shortcode mpesa.ShortCode, signature Signature, date string) (bool, error)
+}
+
+// NewWebhookAuthenticator creates a quikk webhook authenticator. Webhooks signed
+// more than maxAge ago are rejected, a zero maxAge disables the check.
+func NewWebhookAuthenticator(repository mpesa.ShortCodeRepository, nonces requests.WebhookNonces, maxAge time.Duration, verifier SignatureVerifier) WebhookAuthenticator {
+	return WebhookAuthenticator{repository: repository, nonces: nonces, maxAge: maxAge, verifier: verifier}
+}
+
+// WebhookAuthenticator verifies quikk webhook signatures. Quikk signs webhooks the same way
+// requests to its api are signed, with an hmac-sha256 of the date header keyed by the app
+// secret. The app key in the authorization header identifies the shortcode that signed it.
+//
+// The signature does not cover the body and only has a resolution of a second, so a replay
+// is detected by the signature together with a hash of the body, and the callback url must
+// carry the callback token of the shortcode.
+type WebhookAuthenticator struct {
+	repository mpesa.ShortCodeRepository
+	nonces     requests.WebhookNonces
+	maxAge     time.Duration
+	verifier   SignatureVerifier
+}
+
+func (authenticator WebhookAuthenticator) Authenticate(ctx context.Context, result *requests.WebhookResult) error {
+	l := zerolog.Ctx(ctx)
+
+	signature, err := ParseAuthorization(result.Credentials.Authorization)
+	if err != nil {
+		return requests.WebhookRejectedError{Reason: err.Error()}
+	}
+
+	if result.Credentials.Date == "" {
+		return requests.WebhookRejectedError{Reason: "missing date header"}
+	}
+
+	date, err := http.ParseTime(result.Credentials.Date)
+	if err != nil {
+		return requests.WebhookRejectedError{Reason: "invalid date header"}
+	}
+
+	// reject old signatures so a captured webhook cannot be replayed
+	if authenticator.maxAge > 0 {
+		if age := time.Since(date); age > authenticator.maxAge || age < -authenticator.maxAge {
+			return requests.WebhookRejectedError{Reason: "signature expired"}
+		}
+	}
+
+	service := requests.PartnerQuikk
+	shortcode, err := authenticator.repository.FindOne(ctx, mpesa.OptionsFindShortCodes{Service: &service, Key: &signature.KeyID, WithDeleted: true})
+	if err != nil {
+		var nf pkgerrors.NotFounder
+		if errors.As(err, &nf) && nf.NotFound() {
+			return requests.WebhookRejectedError{Reason: "unknown key id"}
+		}
+		l.Error().Err(err).Msg("error finding shortcode by key")
+		return err
+	}
+
+	ok, err := authenticator.verifier.VerifyQuikkSignature(shortcode, signature, result.Credentials.Date)
+	if err != nil {
+		l.Error().Err(err).Msg("error verifying signature")
+		return err
+	}
+	if !ok {
+		return requests.WebhookRejectedError{Reason: "invalid signature"}
+	}
+
+	// webhooks signed in the same second share a signature, the body tells the deliveries
+	// apart. the nonce only needs to be kept until the signature expires
+	sum := sha256.Sum256(result.Bytes())
+	nonce := result.Credentials.Date + " " + signature.Signature + " " + hex.EncodeToString(sum[:])
+	expiresAt := date.Add(nonceTTL)
+	if authenticator.maxAge > 0 {
+		expiresAt = date.Add(authenticator.maxAge)
+	}
+	err = authenticator.nonces.AddNonce(ctx, "quikk:"+signature.KeyID, nonce, expiresAt)
+	var dup pkgerrors.Duplicate
+	if errors.As(err, &dup) && dup.Duplicate() {
+		return requests.WebhookRejectedError{Reason: "signature already used"}
+	}
+	if err != nil {
+		l.Error().Err(err).Msg("error saving webhook signature")
+		return err
+	}
+	result.MerchantID = shortcode.MerchantID
+	result.ShortCodeDeletedAt = shortcode.DeletedAt
+
+	// the webhook is bound to the shortcode by its callback token
+	if shortcode.CallbackToken == "" {
+		return nil
+	}
+	if result.Credentials.Token == "" {
+		return requests.ErrMissingCallbackToken
+	}
+	if !hmac.Equal([]byte(result.Credentials.Token), []byte(shortcode.CallbackToken)) {
+		return requests.WebhookRejectedError{Reason: "invalid callback token"}
+	}
+
+	return nil
+}
+
+// Signature is a parsed quikk authorization header
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   string
+	Signature string
+}
+
+// ParseAuthorization parses an authorization header in the format
+// keyId="<key>",algorithm="hmac-sha256",headers="date",signature="<signature>"
+func ParseAuthorization(header string) (Signature, error) {
+	if header == "" {
+		return Signature{}, errors.New("missing authorization header")
+	}
+
+	var signature Signature
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+
+		switch key {
+		case "keyId":
+			signature.KeyID = value
+		case "algorithm":
+			signature.Algorithm = value
+		case "headers":
+			signature.Headers = value
+		case "signature":
+			signature.Signature = value
+		}
+	}
+
+	if signature.KeyID == "" || signature.Signature == "" {
+		return Signature{}, errors.New("malformed authorization header")
+	}
+	if signature.Algorithm != "hmac-sha256" || signature.Headers != "date" {
+		return Signature{}, errors.New("unsupported signature algorithm")
+	}
+
+	return signature, nil
+}
+
+// Verify checks the signature against one computed from the secret and date
+func (signature Signature) Verify(secret, date string) bool {
+	// the signature is url encoded
+	value, err := url.QueryUnescape(signature.Signature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(value), []byte(Sign(secret, date)))
+}
+
+// Sign computes the base64 encoded hmac-sha256 signature of the date header
+func Sign(secret, date string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("date: " + date))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,155 @@
+package quikk_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/src/domains/mpesa"
+	"github.com/SirWaithaka/payments-api/src/domains/requests"
+	"github.com/SirWaithaka/payments-api/src/repositories/postgres"
+	"github.com/SirWaithaka/payments-api/src/services/quikk"
+	"github.com/SirWaithaka/payments-api/testdata"
+)
+
+// plaintextVerifier verifies signatures with secrets stored in plaintext
+type plaintextVerifier struct{}
+
+func (plaintextVerifier) VerifyQuikkSignature(shortcode mpesa.ShortCode, signature quikk.Signature, date string) (bool, error) {
+	return signature.Verify(shortcode.Secret, date), nil
+}
+
+func authorization(keyID, signature string) string {
+	return fmt.Sprintf(`keyId="%s",algorithm="hmac-sha256",headers="date",signature="%s"`, keyID, url.QueryEscape(signature))
+}
+
+func TestParseAuthorization(t *testing.T) {
+	t.Run("test that a valid header is parsed", func(t *testing.T) {
+		signature, err := quikk.ParseAuthorization(authorization(key, "abc+/="))
+		assert.Nil(t, err)
+		assert.Equal(t, key, signature.KeyID)
+		assert.Equal(t, "hmac-sha256", signature.Algorithm)
+		assert.Equal(t, "date", signature.Headers)
+	})
+
+	t.Run("test that malformed headers are rejected", func(t *testing.T) {
+		headers := []string{
+			"",
+			`keyId="key"`,
+			`keyId="key",algorithm="hmac-sha1",headers="date",signature="abc"`,
+		}
+		for _, header := range headers {
+			_, err := quikk.ParseAuthorization(header)
+			assert.NotNil(t, err, header)
+		}
+	})
+
+	t.Run("test that signature is verified with the secret", func(t *testing.T) {
+		date := time.Now().UTC().Format(http.TimeFormat)
+
+		signature, err := quikk.ParseAuthorization(authorization(key, quikk.Sign(secret, date)))
+		assert.Nil(t, err)
+		assert.True(t, signature.Verify(secret, date))
+		assert.False(t, signature.Verify("other_secret", date))
+		assert.False(t, signature.Verify(secret, time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+	})
+}
+
+func TestWebhookAuthenticator_Authenticate(t *testing.T) {
+	defer testdata.ResetTables(inf)
+
+	token := mpesa.NewCallbackToken()
+	repository := postgres.NewShortCodeRepository(inf.Storage.PG)
+	err := repository.Add(t.Context(), mpesa.ShortCode{
+		Environment:   "sandbox",
+		Service:       requests.PartnerQuikk,
+		Type:          mpesa.PaymentTypeCharge,
+		ShortCode:     "800888",
+		Key:           key,
+		Secret:        secret,
+		CallbackToken: token,
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+
+	nonces := postgres.NewClientRepository(inf.Storage.PG)
+	authenticator := quikk.NewWebhookAuthenticator(repository, nonces, time.Minute*5, plaintextVerifier{})
+
+	// each webhook is signed a second apart, signatures are only accepted once
+	signedAt := time.Now().Add(-time.Minute)
+	result := func(keyID, secret string, date time.Time) *requests.WebhookResult {
+		if date.IsZero() {
+			signedAt = signedAt.Add(time.Second)
+			date = signedAt
+		}
+		result := requests.NewWebhookResult("quikk", "charge", strings.NewReader(`{}`))
+		result.Credentials.Date = date.UTC().Format(http.TimeFormat)
+		result.Credentials.Authorization = authorization(keyID, quikk.Sign(secret, result.Credentials.Date))
+		result.Credentials.Token = token
+		return result
+	}
+
+	t.Run("test that a correctly signed webhook is accepted", func(t *testing.T) {
+		err := authenticator.Authenticate(t.Context(), result(key, secret, time.Time{}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("test that a webhook is only accepted once", func(t *testing.T) {
+		webhook := result(key, secret, time.Time{})
+		assert.Nil(t, authenticator.Authenticate(t.Context(), webhook))
+
+		replay := requests.NewWebhookResult("quikk", "charge", strings.NewReader(`{}`))
+		replay.Credentials = webhook.Credentials
+		err := authenticator.Authenticate(t.Context(), replay)
+		assert.Equal(t, requests.WebhookRejectedError{Reason: "signature already used"}, err)
+	})
+
+	t.Run("test that webhooks signed in the same second are accepted", func(t *testing.T) {
+		webhook := result(key, secret, time.Time{})
+		assert.Nil(t, authenticator.Authenticate(t.Context(), webhook))
+
+		// another webhook has the same date, so the same signature
+		other := requests.NewWebhookResult("quikk", "charge", strings.NewReader(`{"id":"other"}`))
+		other.Credentials = webhook.Credentials
+		assert.Nil(t, authenticator.Authenticate(t.Context(), other))
+	})
+
+	t.Run("test that a missing callback token is reported for the legacy check", func(t *testing.T) {
+		webhook := result(key, secret, time.Time{})
+		webhook.Credentials.Token = ""
+		assert.ErrorIs(t, authenticator.Authenticate(t.Context(), webhook), requests.ErrMissingCallbackToken)
+	})
+
+	wrongToken := result(key, secret, time.Time{})
+	wrongToken.Credentials.Token = mpesa.NewCallbackToken()
+
+	testcases := []struct {
+		name   string
+		result *requests.WebhookResult
+		reason string
+	}{
+		{name: "test that wrong secret is rejected", result: result(key, "wrong_secret", time.Time{}), reason: "invalid signature"},
+		{name: "test that unknown key is rejected", result: result("unknown_key", secret, time.Time{}), reason: "unknown key id"},
+		{name: "test that old signature is rejected", result: result(key, secret, time.Now().Add(-time.Hour)), reason: "signature expired"},
+		{name: "test that wrong callback token is rejected", result: wrongToken, reason: "invalid callback token"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := authenticator.Authenticate(t.Context(), tc.result)
+
+			var rejected requests.WebhookRejectedError
+			if !errors.As(err, &rejected) {
+				t.Fatalf("expected rejected error, got %v", err)
+			}
+			assert.Equal(t, tc.reason, rejected.Reason)
+		})
+	}
+}
@@ -23,6 +23,14 @@ func (webhook ChargeWebhook) ExternalID() string {
 	return webhook.Data.Attributes.TxnChargeID
 }
 
+// NaturalKey identifies the webhook by the request it responds to and its result code
+func (webhook ChargeWebhook) NaturalKey() string {
+	if webhook.Meta != nil {
+		return naturalKey(webhook.ExternalID(), webhook.Meta.Code)
+	}
+	return naturalKey(webhook.ExternalID(), quikk.ResultCodeSuccess)
+}
+
 type PayoutWebhook quikk.WebhookResult[quikk.WebhookAttributesPayout]
 
 // ExternalID should match the id returned by the quikk api during the
@@ -31,6 +39,14 @@ func (webhook PayoutWebhook) ExternalID() string {
 	return webhook.Data.Attributes.ResponseID
 }
 
+// NaturalKey identifies the webhook by the request it responds to and its result code
+func (webhook PayoutWebhook) NaturalKey() string {
+	if webhook.Meta != nil {
+		return naturalKey(webhook.ExternalID(), webhook.Meta.Code)
+	}
+	return naturalKey(webhook.ExternalID(), quikk.ResultCodeSuccess)
+}
+
 type TransferWebhook quikk.WebhookResult[quikk.WebhookAttributesTransfer]
 
 // ExternalID should match the id returned by the quikk api during the
@@ -39,6 +55,14 @@ func (webhook TransferWebhook) ExternalID() string {
 	return webhook.Data.Attributes.ResponseID
 }
 
+// NaturalKey identifies the webhook by the request it responds to and its result code
+func (webhook TransferWebhook) NaturalKey() string {
+	if webhook.Meta != nil {
+		return naturalKey(webhook.ExternalID(), webhook.Meta.Code)
+	}
+	return naturalKey(webhook.ExternalID(), quikk.ResultCodeSuccess)
+}
+
 type TransactionSearchWebhook quikk.WebhookResult[quikk.WebhookAttributesTransactionSearch]
 
 // ExternalID should match the id returned during the initial payment request.
@@ -52,6 +76,23 @@ func (webhook TransactionSearchWebhook) ExternalID() string {
 	return webhook.Data.Attributes.ResponseID
 }
 
+// NaturalKey identifies the webhook by the request it responds to and its result code
+func (webhook TransactionSearchWebhook) NaturalKey() string {
+	if webhook.Meta != nil {
+		return naturalKey(webhook.ExternalID(), webhook.Meta.Code)
+	}
+	return naturalKey(webhook.ExternalID(), quikk.ResultCodeSuccess)
+}
+
+// naturalKey joins the external id and result code, webhooks
+// without a meta field are successful
+func naturalKey(externalID string, code string) string {
+	if externalID == "" {
+		return ""
+	}
+	return externalID + ":" + code
+}
+
 func NewWebhookProcessor() WebhookProcessor {
 	return WebhookProcessor{}
 }
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+)
+
+// EncryptSigningKey encrypts the signing key of an api client with a new data key. The
+// key is bound to the key id of the client. Signing keys are saved in plaintext if no
+// master key is configured.
+func (cipher CredentialsCipher) EncryptSigningKey(client auth.Client) (auth.Client, error) {
+	if cipher.keyring == nil {
+		return client, nil
+	}
+
+	dataKey, err := cipher.keyring.NewDataKey()
+	if err != nil {
+		return client, err
+	}
+
+	signingKey, err := dataKey.Encrypt(client.SigningKey, signingKeyData(client.KeyID))
+	if err != nil {
+		return client, err
+	}
+
+	client.SigningKey = signingKey
+	client.MasterKeyID, client.DataKey = dataKey.KeyID, dataKey.Wrapped
+	return client, nil
+}
+
+// DecryptSigningKey returns the signing key of an api client in plaintext
+func (cipher CredentialsCipher) DecryptSigningKey(client auth.Client) (string, error) {
+	if client.MasterKeyID == "" {
+		return client.SigningKey, nil
+	}
+	if cipher.keyring == nil {
+		return "", ErrNoMasterKey
+	}
+
+	dataKey, err := cipher.keyring.Unwrap(client.MasterKeyID, client.DataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return dataKey.Decrypt(client.SigningKey, signingKeyData(client.KeyID))
+}
+
+// signingKeyData binds an encrypted signing key to the key id of its api client
+func signingKeyData(keyID string) []byte {
+	return []byte("api_clients/" + keyID + "/signing_key")
+}
@@ -0,0 +1,53 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SirWaithaka/payments-api/pkg/signature"
+	"github.com/SirWaithaka/payments-api/src/config"
+	"github.com/SirWaithaka/payments-api/src/domains/auth"
+	"github.com/SirWaithaka/payments-api/src/services"
+)
+
+func TestCredentialsCipher_SigningKey(t *testing.T) {
+	client := auth.Client{KeyID: "pk_1", SecretHash: signature.HashSecret("secret"), SigningKey: signature.SigningKey("secret")}
+
+	t.Run("test that signing keys are decrypted", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+
+		encrypted, err := cipher.EncryptSigningKey(client)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		assert.Equal(t, "k1", encrypted.MasterKeyID)
+		assert.NotEmpty(t, encrypted.DataKey)
+		assert.NotEqual(t, client.SigningKey, encrypted.SigningKey)
+
+		signingKey, err := cipher.DecryptSigningKey(encrypted)
+		assert.Nil(t, err)
+		assert.Equal(t, client.SigningKey, signingKey)
+	})
+
+	t.Run("test that signing keys cannot be moved to another client", func(t *testing.T) {
+		cipher := newCipher(t, "", masterKey("k1", 1))
+
+		encrypted, _ := cipher.EncryptSigningKey(client)
+		encrypted.KeyID = "pk_2"
+		_, err := cipher.DecryptSigningKey(encrypted)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("test that signing keys are in plaintext without a master key", func(t *testing.T) {
+		cipher, _ := services.NewCredentialsCipher(config.CredentialsConfig{})
+
+		saved, err := cipher.EncryptSigningKey(client)
+		assert.Nil(t, err)
+		assert.Equal(t, client, saved)
+
+		signingKey, err := cipher.DecryptSigningKey(saved)
+		assert.Nil(t, err)
+		assert.Equal(t, client.SigningKey, signingKey)
+	})
+}
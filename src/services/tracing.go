@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
+)
+
+// shortcodeKey is the attribute of the shortcode a partner request is made with
+const shortcodeKey = attribute.Key("payments.shortcode_id")
+
+// spanKey is the context key of the span of a partner request
+type spanKey struct{}
+
+// StartSpan starts a client span for a partner request before it is built. The span covers
+// all the attempts of the request, and the hooks that run within the request context, e.g.
+// saving the request, are children of the span.
+func StartSpan(shortcodeID string) gorequest.Hook {
+	return gorequest.Hook{Name: "Tracing.StartSpan", Fn: func(r *gorequest.Request) {
+		// the span is started once per request
+		if _, ok := r.Context().Value(spanKey{}).(trace.Span); ok {
+			return
+		}
+
+		ctx, span := tracing.Tracer().Start(r.Context(), fmt.Sprintf("%s %s", r.Config.ServiceName, r.Operation.Name),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.PeerService(r.Config.ServiceName),
+				semconv.HTTPRequestMethodKey.String(r.Operation.Method),
+				shortcodeKey.String(shortcodeID),
+			),
+		)
+		r.WithContext(context.WithValue(ctx, spanKey{}, span))
+	}}
+}
+
+// EndSpan ends the span of a partner request once it completes, with the status of the last
+// attempt and the error of the request
+func EndSpan() gorequest.Hook {
+	return gorequest.Hook{Name: "Tracing.EndSpan", Fn: func(r *gorequest.Request) {
+		span, ok := r.Context().Value(spanKey{}).(trace.Span)
+		if !ok {
+			return
+		}
+
+		span.SetAttributes(semconv.HTTPRequestResendCount(r.RetryCount))
+		if r.Response != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(r.Response.StatusCode))
+		}
+		tracing.End(span, r.Error)
+	}}
+}
@@ -0,0 +1,53 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/SirWaithaka/gorequest"
+
+	"github.com/SirWaithaka/payments-api/src/services"
+)
+
+func TestTracingHooks(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	cfg := gorequest.Config{ServiceName: "daraja"}
+	op := gorequest.Operation{Name: "C2B", Method: http.MethodPost}
+	req := gorequest.New(cfg, op, gorequest.Hooks{}, nil, nil, nil)
+	req.WithContext(context.Background())
+
+	start := services.StartSpan("shortcode-1")
+	start.Fn(req)
+	// the span is started once if the build hooks run again
+	start.Fn(req)
+
+	req.RetryCount = 2
+	req.Response = &http.Response{StatusCode: http.StatusServiceUnavailable}
+	req.Error = errors.New("service unavailable")
+	services.EndSpan().Fn(req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "daraja C2B", span.Name())
+		assert.Equal(t, codes.Error, span.Status().Code)
+
+		attributes := make(map[string]any)
+		for _, attr := range span.Attributes() {
+			attributes[string(attr.Key)] = attr.Value.AsInterface()
+		}
+		assert.Equal(t, "shortcode-1", attributes["payments.shortcode_id"])
+		assert.Equal(t, int64(2), attributes["http.request.resend_count"])
+		assert.Equal(t, int64(http.StatusServiceUnavailable), attributes["http.response.status_code"])
+	}
+}
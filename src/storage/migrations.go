@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/SirWaithaka/payments-api/migrations"
+	"github.com/SirWaithaka/payments-api/pkg/migrate"
+	"github.com/SirWaithaka/payments-api/seeds"
+)
+
+// Migrator returns a migrator of the database schema with the embedded migrations
+func (db *Database) Migrator() (*migrate.Migrator, error) {
+	sqlDB, err := db.PG.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(sqlDB, ms), nil
+}
+
+// CheckSchema returns an error if the database schema is behind the embedded migrations
+func (db *Database) CheckSchema(ctx context.Context) error {
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	return migrator.Check(ctx)
+}
+
+// Seed runs the embedded seeds of test data, or reverts them if down is true
+func (db *Database) Seed(ctx context.Context, down bool) error {
+	sqlDB, err := db.PG.DB()
+	if err != nil {
+		return err
+	}
+
+	return migrate.Seed(ctx, sqlDB, seeds.FS, down)
+}
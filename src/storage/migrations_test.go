@@ -0,0 +1,211 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/SirWaithaka/payments-api/pkg/migrate"
+)
+
+// testMigrations create tables used only by these tests, the embedded migrations
+// conflict with the tables created by the test infrastructure
+func testMigrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 1, Name: "create_migrate_a_table", Up: "CREATE TABLE migrate_a (id int)", Down: "DROP TABLE migrate_a"},
+		{Version: 2, Name: "create_migrate_b_table", Up: "CREATE TABLE migrate_b (id int)", Down: "DROP TABLE migrate_b"},
+		{Version: 3, Name: "create_migrate_c_table", Up: "CREATE TABLE migrate_c (id int)", Down: "DROP TABLE migrate_c"},
+	}
+}
+
+func sqlDB(t *testing.T) *sql.DB {
+	db, err := inf.Storage.PG.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// resetMigrations drops the version table and the tables of the test migrations
+func resetMigrations(t *testing.T) {
+	for _, table := range []string{"schema_migrations", "migrate_a", "migrate_b", "migrate_c"} {
+		_, err := sqlDB(t).Exec("DROP TABLE IF EXISTS " + table)
+		assert.Nil(t, err)
+	}
+}
+
+func tableExists(t *testing.T, table string) bool {
+	var exists bool
+	err := sqlDB(t).QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists)
+	assert.Nil(t, err)
+	return exists
+}
+
+func TestMigrator_Up(t *testing.T) {
+	t.Run("test that all migrations are applied and the version is recorded", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrator := migrate.New(sqlDB(t), testMigrations())
+
+		assert.Nil(t, migrator.Up(t.Context()))
+
+		version, dirty, err := migrator.Version(t.Context())
+		assert.Nil(t, err)
+		assert.False(t, dirty)
+		assert.Equal(t, uint64(3), version)
+		assert.True(t, tableExists(t, "migrate_a"))
+		assert.True(t, tableExists(t, "migrate_c"))
+
+		// the version table has a single row
+		var rows int
+		assert.Nil(t, sqlDB(t).QueryRow("SELECT count(*) FROM schema_migrations").Scan(&rows))
+		assert.Equal(t, 1, rows)
+
+		// applied migrations are not applied again
+		assert.Nil(t, migrator.Up(t.Context()))
+	})
+
+	t.Run("test that a failed migration leaves the schema and the version unchanged", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrations := testMigrations()
+		migrations[1].Up = "CREATE TABLE migrate_b (id int); SELECT 1/0"
+		migrator := migrate.New(sqlDB(t), migrations)
+
+		assert.NotNil(t, migrator.Up(t.Context()))
+
+		version, dirty, err := migrator.Version(t.Context())
+		assert.Nil(t, err)
+		assert.False(t, dirty)
+		assert.Equal(t, uint64(1), version)
+		assert.True(t, tableExists(t, "migrate_a"))
+		assert.False(t, tableExists(t, "migrate_b"))
+		assert.False(t, tableExists(t, "migrate_c"))
+	})
+
+	t.Run("test that concurrent migrators apply each migration once", func(t *testing.T) {
+		defer resetMigrations(t)
+		// the migration is slow, so that the migrators overlap without the lock
+		migrations := testMigrations()
+		migrations[0].Up = "SELECT pg_sleep(0.2); CREATE TABLE migrate_a (id int)"
+
+		g, gCtx := errgroup.WithContext(t.Context())
+		for range 3 {
+			g.Go(func() error { return migrate.New(sqlDB(t), migrations).Up(gCtx) })
+		}
+		assert.Nil(t, g.Wait())
+
+		version, _, err := migrate.New(sqlDB(t), migrations).Version(t.Context())
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), version)
+	})
+
+	t.Run("test that a migrator waits for the lock until ctx is done", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrations := testMigrations()
+		migrations[0].Up = "SELECT pg_sleep(1); CREATE TABLE migrate_a (id int)"
+
+		started := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			close(started)
+			errs <- migrate.New(sqlDB(t), migrations).Up(t.Context())
+		}()
+		<-started
+		// let the first migrator take the lock
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+		defer cancel()
+		err := migrate.New(sqlDB(t), migrations).Up(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the first migrator is not affected
+		assert.Nil(t, <-errs)
+		assert.True(t, tableExists(t, "migrate_a"))
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	defer resetMigrations(t)
+	migrator := migrate.New(sqlDB(t), testMigrations())
+	assert.Nil(t, migrator.Up(t.Context()))
+
+	assert.Nil(t, migrator.Down(t.Context(), 2))
+	version, _, err := migrator.Version(t.Context())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), version)
+	assert.True(t, tableExists(t, "migrate_a"))
+	assert.False(t, tableExists(t, "migrate_b"))
+
+	// reverting all migrations leaves the version table empty
+	assert.Nil(t, migrator.To(t.Context(), 0))
+	var rows int
+	assert.Nil(t, sqlDB(t).QueryRow("SELECT count(*) FROM schema_migrations").Scan(&rows))
+	assert.Equal(t, 0, rows)
+	assert.False(t, tableExists(t, "migrate_a"))
+
+	statuses, current, err := migrator.Status(t.Context())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), current)
+	for _, status := range statuses {
+		assert.False(t, status.Applied)
+	}
+}
+
+func TestMigrator_Check(t *testing.T) {
+	t.Run("test that a database with pending migrations is behind", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrator := migrate.New(sqlDB(t), testMigrations())
+		assert.ErrorIs(t, migrator.Check(t.Context()), migrate.ErrBehind)
+
+		assert.Nil(t, migrator.To(t.Context(), 2))
+		assert.EqualError(t, migrator.Check(t.Context()), "database schema is behind: version 2, latest 3, 1 migrations pending")
+
+		assert.Nil(t, migrator.Up(t.Context()))
+		assert.Nil(t, migrator.Check(t.Context()))
+	})
+
+	t.Run("test that a database ahead of the migrations is not behind", func(t *testing.T) {
+		defer resetMigrations(t)
+		assert.Nil(t, migrate.New(sqlDB(t), testMigrations()).Up(t.Context()))
+
+		migrator := migrate.New(sqlDB(t), testMigrations()[:2])
+		assert.Nil(t, migrator.Check(t.Context()))
+	})
+
+	t.Run("test that a dirty database is an error", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrator := migrate.New(sqlDB(t), testMigrations())
+		assert.Nil(t, migrator.To(t.Context(), 1))
+		_, err := sqlDB(t).Exec("UPDATE schema_migrations SET dirty = true")
+		assert.Nil(t, err)
+
+		assert.ErrorIs(t, migrator.Check(t.Context()), migrate.ErrDirty)
+		assert.ErrorIs(t, migrator.Up(t.Context()), migrate.ErrDirty)
+	})
+}
+
+func TestDatabase_CheckSchema(t *testing.T) {
+	t.Run("test that serving is refused before the embedded migrations are applied", func(t *testing.T) {
+		defer resetMigrations(t)
+
+		assert.ErrorIs(t, inf.Storage.CheckSchema(t.Context()), migrate.ErrBehind)
+	})
+
+	t.Run("test that serving is allowed once the latest migration is recorded", func(t *testing.T) {
+		defer resetMigrations(t)
+		migrator, err := inf.Storage.Migrator()
+		assert.Nil(t, err)
+
+		// the tables of the test infrastructure already exist, record the version only
+		_, err = sqlDB(t).Exec(`CREATE TABLE schema_migrations ("version" bigint NOT NULL PRIMARY KEY, "dirty" boolean NOT NULL)`)
+		assert.Nil(t, err)
+		_, err = sqlDB(t).Exec(`INSERT INTO schema_migrations ("version", "dirty") VALUES ($1, false)`, int64(migrator.Latest()))
+		assert.Nil(t, err)
+
+		assert.Nil(t, inf.Storage.CheckSchema(t.Context()))
+	})
+}
@@ -7,10 +7,15 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 
+	"github.com/SirWaithaka/payments-api/pkg/logger"
+	"github.com/SirWaithaka/payments-api/pkg/metrics"
+	"github.com/SirWaithaka/payments-api/pkg/tracing"
 	"github.com/SirWaithaka/payments-api/src/config"
 )
 
@@ -50,6 +55,10 @@ func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql stri
 
 	elapsed := time.Since(begin)
 	sql, rows := fc()
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	metrics.ObserveQuery(sql, failed, elapsed)
+	span(ctx, sql, begin, elapsed, failed, err)
+
 	lg := logger.With().Str("sql_duration", elapsed.String()).Logger()
 	var lo *zerolog.Event
 	switch {
@@ -68,6 +77,20 @@ func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql stri
 	lo.Int64("rows", rows).Msg(sql)
 }
 
+// span records a span for the query after it has run, the query is recorded with phone
+// numbers redacted
+func span(ctx context.Context, sql string, begin time.Time, elapsed time.Duration, failed bool, err error) {
+	_, sp := tracing.Tracer().Start(ctx, "postgresql",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(begin),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBQueryText(logger.RedactString(sql))),
+	)
+	if failed {
+		tracing.RecordError(sp, err)
+	}
+	sp.End(trace.WithTimestamp(begin.Add(elapsed)))
+}
+
 // NewPostgresClient creates a new connection to postgres
 func NewPostgresClient(cfg config.PostgresConfigs) (*gorm.DB, error) {
 	var err error
@@ -85,6 +108,11 @@ func NewPostgresClient(cfg config.PostgresConfigs) (*gorm.DB, error) {
 		return nil, fmt.Errorf("native sql fetch error: %v", err)
 	}
 
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
 	// test connection to db
 	if err = sqlDB.Ping(); err != nil {
 		return nil, fmt.Errorf("ping error: %v", err)
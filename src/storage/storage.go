@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+
 	"gorm.io/gorm"
 
 	"github.com/SirWaithaka/payments-api/src/config"
@@ -23,6 +26,27 @@ func (db *Database) Close() {
 	//db.Cache.Client().Close()
 }
 
+// Check pings the database and checks that the connection pool is not saturated. The
+// pool is saturated when all of its connections are in use and queries wait for one.
+func (db *Database) Check(ctx context.Context) error {
+	sqlDB, err := db.PG.DB()
+	if err != nil {
+		return err
+	}
+
+	if err = sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping error: %w", err)
+	}
+
+	// the pool cannot be saturated without a limit of open connections
+	stats := sqlDB.Stats()
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		return fmt.Errorf("connection pool saturated, %d of %d connections in use", stats.InUse, stats.MaxOpenConnections)
+	}
+
+	return nil
+}
+
 // NewDatabase return a Database instance
 func NewDatabase(config config.Config) (*Database, error) {
 	// connect and return postgres client
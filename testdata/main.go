@@ -121,6 +121,11 @@ func Setup(cfg *config.Config) (*Infrastructure, error) {
 		&postgres.WebhookRequestSchema{},
 		&postgres.ShortCodeSchema{},
 		&postgres.MpesaPaymentSchema{},
+		&postgres.InboxSchema{},
+		&postgres.ClientSchema{},
+		&postgres.NonceSchema{},
+		&postgres.MerchantSchema{},
+		&postgres.RateLimitBucketSchema{},
 	); err != nil {
 		return nil, err
 	}
@@ -142,8 +147,14 @@ func ResetTables(inf *Infrastructure) {
 	// clear tables of any data
 	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.RequestSchema{})
 	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.WebhookRequestSchema{})
-	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.ShortCodeSchema{})
+	// shortcodes are soft deleted, delete the records permanently
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(&postgres.ShortCodeSchema{})
 	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.MpesaPaymentSchema{})
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.InboxSchema{})
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.ClientSchema{})
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.NonceSchema{})
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.MerchantSchema{})
+	inf.Storage.PG.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&postgres.RateLimitBucketSchema{})
 
 }
 